@@ -9,8 +9,8 @@ if [ -z "${DATABASE_URL:-}" ]; then
     exit 1
 fi
 
-echo "[run.sh] Running DB migrations..."
-goose -dir ./migrations postgres "${DATABASE_URL}" up
+# Миграции применяет сам сервис при запуске, под advisory lock
+export MIGRATE_ON_START="${MIGRATE_ON_START:-true}"
 
 echo "[run.sh] Starting Caddy"
 caddy run --config /etc/caddy/Caddyfile &
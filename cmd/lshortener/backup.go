@@ -0,0 +1,104 @@
+package main
+
+import (
+	"code/internal/backup"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// runBackup: lshortener backup [-o FILE]. "-" пишет архив в stdout.
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("o", fmt.Sprintf("lshortener-backup-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z")),
+		`archive path, "-" for stdout`)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	_, pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	if *out == "-" {
+		if _, err := backup.Backup(ctx, pool, os.Stdout); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		return nil
+	}
+	// O_EXCL: не затираем существующий архив
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	m, err := backup.Backup(ctx, pool, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(*out)
+		return fmt.Errorf("backup: %w", err)
+	}
+	for _, file := range m.Files {
+		slog.Info("table backed up", "table", file.Table, "rows", file.Rows)
+	}
+	slog.Info("backup written", "file", *out)
+	return nil
+}
+
+// runRestore: lshortener restore [-on-conflict skip|overwrite|rename] FILE. "-" читает stdin.
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	onConflict := fs.String("on-conflict", string(backup.OnConflictSkip), "what to do with existing rows: skip, overwrite, rename")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: lshortener restore [-on-conflict skip|overwrite|rename] FILE")
+	}
+	policy, err := backup.ParseConflictPolicy(*onConflict)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	_, pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	result, err := backup.Restore(ctx, pool, r, policy)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	for _, t := range result.Tables {
+		slog.Info("table restored", "table", t.Table, "inserted", t.Inserted,
+			"updated", t.Updated, "renamed", t.Renamed, "skipped", t.Skipped)
+	}
+	slog.Info("backup restored", "created_at", result.Manifest.CreatedAt.Format(time.RFC3339))
+	return nil
+}
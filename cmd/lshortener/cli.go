@@ -0,0 +1,93 @@
+package main
+
+import (
+	"code/internal/config"
+	"code/internal/logging"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// command - подкоманда lshortener. Все команды читают тот же config.Load, что и сервер.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	// commands заполняется в init: runHelp сам обращается к commands
+	commands = []command{
+		{"serve", "serve", runServe},
+		{"migrate", "migrate up|down|status", runMigrate},
+		{"links", "links create|list|delete ...", runLinks},
+		{"keys", "keys create|list|revoke ...", runKeys},
+		{"stats", "stats", runStats},
+		{"backup", "backup [-o FILE]", runBackup},
+		{"restore", "restore [-on-conflict skip|overwrite|rename] FILE", runRestore},
+		{"help", "help", runHelp},
+	}
+}
+
+func runCommand(name string, args []string) error {
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args)
+		}
+	}
+	if name == "-h" || name == "--help" {
+		return runHelp(nil)
+	}
+	_ = runHelp(nil)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+func runHelp([]string) error {
+	fmt.Fprintln(os.Stderr, "Usage: lshortener <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %s\n", c.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nWithout a command the server is started.")
+	return nil
+}
+
+// subcommand выбирает вложенную команду (migrate up, links list) по первому аргументу.
+func subcommand(group string, args []string, subs map[string]func(args []string) error) error {
+	names := slices.Sorted(maps.Keys(subs))
+	if len(args) == 0 {
+		return fmt.Errorf("usage: lshortener %s %s", group, strings.Join(names, "|"))
+	}
+	run, ok := subs[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, available: %s", group+" "+args[0], strings.Join(names, ", "))
+	}
+	return run(args[1:])
+}
+
+// connect загружает конфигурацию и открывает пул соединений.
+func connect(ctx context.Context) (*config.AppConfig, *pgxpool.Pool, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.SetDefault(logging.New(os.Stderr, cfg.LogConfig))
+	pool, err := NewPgxPool(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, pool, nil
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
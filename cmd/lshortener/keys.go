@@ -0,0 +1,114 @@
+package main
+
+import (
+	"code/internal/db/postgres_db"
+	"code/internal/service"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+func runKeys(args []string) error {
+	return subcommand("keys", args, map[string]func(args []string) error{
+		"create": keysCreate,
+		"list":   keysList,
+		"revoke": keysRevoke,
+	})
+}
+
+// withAPIKeyService открывает соединение и APIKeyService для команды keys.
+func withAPIKeyService(fn func(ctx context.Context, keys *service.APIKeyService) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	_, pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	return fn(ctx, service.NewAPIKeyService(postgres_db.New(pool)))
+}
+
+// keysCreate: keys create -name NAME. Ключ печатается один раз, в базе остаётся только его хеш.
+func keysCreate(args []string) error {
+	fs := flag.NewFlagSet("keys create", flag.ContinueOnError)
+	name := fs.String("name", "", "who or what the key is issued to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || fs.NArg() != 0 {
+		return errors.New("usage: lshortener keys create -name NAME")
+	}
+	return withAPIKeyService(func(ctx context.Context, keys *service.APIKeyService) error {
+		key, secret, err := keys.Create(ctx, *name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d\t%s\n", key.ID, secret)
+		fmt.Fprintln(os.Stderr, "Store the key now, it cannot be shown again.")
+		return nil
+	})
+}
+
+// keysList: keys list. Показывает начало ключа, по которому его можно узнать.
+func keysList(args []string) error {
+	fs := flag.NewFlagSet("keys list", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return withAPIKeyService(func(ctx context.Context, keys *service.APIKeyService) error {
+		list, err := keys.List(ctx)
+		if err != nil {
+			return err
+		}
+		tw := newTable()
+		fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tCREATED AT\tREVOKED AT")
+		for _, key := range list {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Prefix, formatTime(key.CreatedAt), formatTime(key.RevokedAt))
+		}
+		return tw.Flush()
+	})
+}
+
+// keysRevoke: keys revoke ID...
+func keysRevoke(args []string) error {
+	fs := flag.NewFlagSet("keys revoke", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: lshortener keys revoke ID...")
+	}
+	ids := make([]int64, 0, fs.NArg())
+	for _, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			return fmt.Errorf("invalid key id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return withAPIKeyService(func(ctx context.Context, keys *service.APIKeyService) error {
+		var errs []error
+		for _, id := range ids {
+			if err := keys.Revoke(ctx, id); err != nil {
+				if errors.Is(err, service.ErrNotFound) {
+					err = errors.New("not found or already revoked")
+				}
+				errs = append(errs, fmt.Errorf("key %d: %w", id, err))
+				continue
+			}
+			fmt.Printf("%d\trevoked\n", id)
+		}
+		return errors.Join(errs...)
+	})
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"code/internal/db/postgres_db"
+	"code/internal/handlers"
+	"code/internal/service"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// cliActor - автор изменений из CLI в истории ссылок
+const cliActor = "cli"
+
+func runLinks(args []string) error {
+	return subcommand("links", args, map[string]func(args []string) error{
+		"create": linksCreate,
+		"list":   linksList,
+		"delete": linksDelete,
+	})
+}
+
+// withLinkService открывает соединение и LinkService для команды links.
+func withLinkService(fn func(ctx context.Context, links *service.LinkService) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	cfg, pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	links := service.NewLinkService(postgres_db.New(pool), cfg)
+	links.SetTxRunner(postgres_db.NewTxRunner(pool))
+	return fn(service.WithActor(ctx, cliActor), links)
+}
+
+// linksCreate: links create [-name SHORT_NAME] URL. Без -name имя генерируется, как в API.
+func linksCreate(args []string) error {
+	fs := flag.NewFlagSet("links create", flag.ContinueOnError)
+	name := fs.String("name", "", "short name, generated when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: lshortener links create [-name SHORT_NAME] URL")
+	}
+	in := service.CreateLinkInput{OriginalUrl: fs.Arg(0), ShortName: *name}
+	if err := service.ValidateLinkInput(in); err != nil {
+		return err
+	}
+	if in.ShortName == "" {
+		var err error
+		if in.ShortName, err = service.GenerateShortName(handlers.Short_name_length); err != nil {
+			return err
+		}
+	}
+	return withLinkService(func(ctx context.Context, links *service.LinkService) error {
+		link, err := links.CreateShortLink(ctx, in.ShortName, in.OriginalUrl)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d\t%s\n", link.ID, link.ShortUrl)
+		return nil
+	})
+}
+
+// linksList: links list [-q TEXT] [-health STATUS] [-deleted] [-limit N] [-offset N]
+func linksList(args []string) error {
+	fs := flag.NewFlagSet("links list", flag.ContinueOnError)
+	query := fs.String("q", "", "search in url, short name and title")
+	health := fs.String("health", "", "unknown, healthy or broken")
+	deleted := fs.Bool("deleted", false, "list links in the trash")
+	limit := fs.Int("limit", 50, "max links to show")
+	offset := fs.Int("offset", 0, "links to skip")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	limit32, err := handlers.SaveConvertToInt32(*limit)
+	if err != nil {
+		return fmt.Errorf("limit: %w", err)
+	}
+	offset32, err := handlers.SaveConvertToInt32(*offset)
+	if err != nil {
+		return fmt.Errorf("offset: %w", err)
+	}
+	filter := service.LinkFilter{Query: *query, Health: *health, Deleted: *deleted}
+	return withLinkService(func(ctx context.Context, links *service.LinkService) error {
+		list, total, err := links.GetLinks(ctx, filter, service.DefaultLinkSort, limit32, offset32)
+		if err != nil {
+			return err
+		}
+		tw := newTable()
+		fmt.Fprintln(tw, "ID\tSHORT NAME\tORIGINAL URL\tHEALTH\tCREATED AT")
+		for _, link := range list {
+			created := ""
+			if link.CreatedAt != nil {
+				created = link.CreatedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", link.ID, link.ShortName, link.OriginalUrl, link.HealthStatus, created)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("%d of %d\n", len(list), total)
+		return nil
+	})
+}
+
+// linksDelete: links delete [-permanent] ID... Все id удаляются в одной транзакции.
+func linksDelete(args []string) error {
+	fs := flag.NewFlagSet("links delete", flag.ContinueOnError)
+	permanent := fs.Bool("permanent", false, "delete instead of moving to the trash")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: lshortener links delete [-permanent] ID...")
+	}
+	ids := make([]int64, 0, fs.NArg())
+	for _, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			return fmt.Errorf("invalid link id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return withLinkService(func(ctx context.Context, links *service.LinkService) error {
+		result, err := links.DeleteLinksBatch(ctx, ids, *permanent, service.BatchBestEffort)
+		if err != nil {
+			return err
+		}
+		for _, item := range result.Items {
+			if item.Status == service.BatchFailed {
+				fmt.Printf("%d\t%s\t%s\n", item.ID, item.Status, item.Error)
+				continue
+			}
+			fmt.Printf("%d\t%s\n", item.ID, item.Status)
+		}
+		if result.Failed > 0 {
+			return fmt.Errorf("%d of %d links not deleted", result.Failed, len(ids))
+		}
+		return nil
+	})
+}
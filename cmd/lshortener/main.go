@@ -2,18 +2,15 @@ package main
 
 import (
 	"code/internal/config"
-	"code/internal/db/postgres_db"
-	"code/internal/db/visits"
-	"code/internal/handlers"
-	"code/internal/service"
+	"code/internal/tracing"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"strconv"
+	"log/slog"
+	"os"
 	"time"
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib" // blank identifier означает, что пакет импортирован без прямого использования в коде
 )
@@ -21,54 +18,15 @@ import (
 const DefaultTimeout = 30 * time.Minute
 
 func main() {
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Создаём контекст с таймаутом. Если база "зависла", приложение не будет ждать бесконечно.
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
-	defer cancel()
-
-	pool, err := NewPgxPool(ctx, cfg)
-	if err != nil {
-		log.Fatal(err)
+	// Без аргументов запускается сервер, как и раньше: на это рассчитывает bin/run.sh
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"serve"}
 	}
-	defer pool.Close()
-
-	log.Println("✅ Database connected")
-
-	linkRepo := postgres_db.New(pool)
-	visitRepo := visits.New(pool)
-
-	linkService := service.NewLinkService(linkRepo, cfg)
-	visitService := service.NewVisitService(visitRepo)
-
-	router := handlers.SetupRouter()
-
-	router.Use(gin.Recovery())
-
-	// Cross-Origin Resource Sharing - это с каких сайтов разрешено делать запросы к моему API
-	router.Use(cors.New(config.SetCORSConfig(cfg.APPEnv)))
-
-	// Cloudflare для определения реального IP-адреса клиента
-	router.TrustedPlatform = gin.PlatformCloudflare
-
-	handlers := handlers.NewHandler(linkService, &visitService)
-
-	router.GET("/", handlers.HomePage)
-	router.POST("/api/links", handlers.CreateLink)
-	router.GET("/api/links", handlers.GetLinks)
-	router.GET("/api/links/:id", handlers.GetLinkByID)
-	router.PUT("/api/links/:id", handlers.UpdateLinkByID)
-	router.DELETE("/api/links/:id", handlers.DeleteLinkByID)
-	router.GET("/r/:code", handlers.RedirectByShortName)
-	router.GET("/api/link_visits", handlers.GetVisits)
-
-	port := cfg.ServerPort
-
-	if err := router.Run(fmt.Sprintf("0.0.0.0:%v", port)); err != nil {
-		log.Fatalf("не удалось запустить сервер на порту %v: %v", port, err)
+	// -h у команды печатает справку флагов, это не ошибка
+	if err := runCommand(args[0], args[1:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
 }
 
@@ -78,18 +36,14 @@ func NewPgxPool(ctx context.Context, cfg *config.AppConfig) (*pgxpool.Pool, erro
 	if err != nil {
 		return nil, fmt.Errorf("parse conf: %w", err)
 	}
-	maxConns, err := strconv.ParseInt(cfg.PoolConfig.DBMaxConns, 10, 32)
-	if err != nil {
-		return nil, fmt.Errorf("parseInt: %w", err)
+	conf.MaxConns = cfg.PoolConfig.DBMaxConns
+	conf.MinConns = cfg.PoolConfig.DBMaxIdleConns
+	if cfg.PoolConfig.DBConnMaxLifetime > 0 {
+		conf.MaxConnLifetime = cfg.PoolConfig.DBConnMaxLifetime
 	}
-	minConns, err := strconv.ParseInt(cfg.PoolConfig.DBMaxIdleConns, 10, 32)
-	if err != nil {
-		return nil, fmt.Errorf("parseInt: %w", err)
+	if cfg.TracingConfig.Enabled {
+		conf.ConnConfig.Tracer = tracing.QueryTracer{}
 	}
-	maxLifetime, _ := time.ParseDuration(cfg.PoolConfig.DBConnMaxLifetime)
-	conf.MaxConns = int32(maxConns)
-	conf.MinConns = int32(minConns)
-	conf.MaxConnIdleTime = maxLifetime
 
 	pool, err := pgxpool.NewWithConfig(ctx, conf)
 	if err != nil {
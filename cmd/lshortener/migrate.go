@@ -0,0 +1,170 @@
+package main
+
+import (
+	"code/internal/config"
+	"code/migrations"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// runMigrate применяет миграции, встроенные в бинарник: отдельный goose не нужен.
+func runMigrate(args []string) error {
+	return subcommand("migrate", args, map[string]func(args []string) error{
+		"up":     migrateUp,
+		"down":   migrateDown,
+		"status": migrateStatus,
+	})
+}
+
+// migrationLockPeriod - как часто повторяется попытка взять advisory lock миграций
+const migrationLockPeriod = 5 * time.Second
+
+// errSchemaNewer - БД уже мигрирована более новой версией сервиса, эта версия её не понимает.
+var errSchemaNewer = errors.New("database schema is newer than this binary")
+
+// newMigrationProvider создаёт Provider, который применяет миграции под advisory lock:
+// экземпляры, запущенные одновременно, выполняют их по очереди, а не наперегонки.
+func newMigrationProvider(pool *pgxpool.Pool, cfg config.GooseConfig) (*goose.Provider, error) {
+	attempts := max(uint64(cfg.LockTimeout/migrationLockPeriod), 1)
+	locker, err := lock.NewPostgresSessionLocker(lock.WithLockTimeout(uint64(migrationLockPeriod/time.Second), attempts))
+	if err != nil {
+		return nil, fmt.Errorf("migration lock: %w", err)
+	}
+	provider, err := goose.NewProvider(goose.DialectPostgres, stdlib.OpenDBFromPool(pool), migrations.MigrationsFS,
+		goose.WithSessionLocker(locker))
+	if err != nil {
+		return nil, fmt.Errorf("goose provider: %w", err)
+	}
+	return provider, nil
+}
+
+// prepareSchema вызывается при запуске сервера. Схема новее бинарника - отказ запускаться,
+// иначе при autoMigrate применяются недостающие миграции, без него о них только предупреждается.
+func prepareSchema(ctx context.Context, provider *goose.Provider, autoMigrate bool) error {
+	// В пустой БД ещё нет таблицы версий: при autoMigrate её создаст Up
+	current, target, err := provider.GetVersions(ctx)
+	if err != nil && !autoMigrate {
+		return fmt.Errorf("schema version: %w (run lshortener migrate up or set MIGRATE_ON_START=true)", err)
+	}
+	if err == nil && current > target {
+		return fmt.Errorf("%w: database is at version %d, binary knows up to %d", errSchemaNewer, current, target)
+	}
+	if !autoMigrate {
+		if current < target {
+			slog.Warn("database schema is behind, run lshortener migrate up", "version", current, "expected", target)
+		}
+		return nil
+	}
+
+	results, err := provider.Up(ctx)
+	for _, r := range results {
+		logMigration(r)
+	}
+	if err != nil {
+		return fmt.Errorf("migrate up: %w", err)
+	}
+	version, err := provider.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("schema is up to date", "version", version)
+	return nil
+}
+
+// checkSchemaVersion - проверка готовности: схема БД ровно той версии, которую знает бинарник.
+func checkSchemaVersion(ctx context.Context, provider *goose.Provider) error {
+	current, target, err := provider.GetVersions(ctx)
+	if err != nil {
+		return err
+	}
+	if current != target {
+		return fmt.Errorf("schema version %d, expected %d", current, target)
+	}
+	return nil
+}
+
+// withMigrations открывает соединение и Provider для команды migrate.
+func withMigrations(name string, args []string, fn func(ctx context.Context, p *goose.Provider) error) error {
+	fs := flag.NewFlagSet("migrate "+name, flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	cfg, pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	provider, err := newMigrationProvider(pool, cfg.GooseConfig)
+	if err != nil {
+		return err
+	}
+	defer provider.Close()
+	return fn(ctx, provider)
+}
+
+func logMigration(r *goose.MigrationResult) {
+	slog.Info("migration applied", "version", r.Source.Version, "source", r.Source.Path, "direction", r.Direction,
+		"duration", r.Duration.String(), "empty", r.Empty)
+}
+
+func migrateUp(args []string) error {
+	return withMigrations("up", args, func(ctx context.Context, p *goose.Provider) error {
+		results, err := p.Up(ctx)
+		for _, r := range results {
+			logMigration(r)
+		}
+		if err != nil {
+			return fmt.Errorf("migrate up: %w", err)
+		}
+		version, err := p.GetDBVersion(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("schema is up to date", "version", version)
+		return nil
+	})
+}
+
+// migrateDown откатывает одну последнюю миграцию, как goose down.
+func migrateDown(args []string) error {
+	return withMigrations("down", args, func(ctx context.Context, p *goose.Provider) error {
+		r, err := p.Down(ctx)
+		if r != nil {
+			logMigration(r)
+		}
+		if err != nil {
+			return fmt.Errorf("migrate down: %w", err)
+		}
+		return nil
+	})
+}
+
+func migrateStatus(args []string) error {
+	return withMigrations("status", args, func(ctx context.Context, p *goose.Provider) error {
+		statuses, err := p.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("migrate status: %w", err)
+		}
+		tw := newTable()
+		fmt.Fprintln(tw, "VERSION\tMIGRATION\tSTATE\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := ""
+			if !s.AppliedAt.IsZero() {
+				applied = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Source.Version, s.Source.Path, s.State, applied)
+		}
+		return tw.Flush()
+	})
+}
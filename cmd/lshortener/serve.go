@@ -0,0 +1,266 @@
+package main
+
+import (
+	"code/internal/config"
+	"code/internal/db/postgres_db"
+	"code/internal/db/visits"
+	"code/internal/handlers"
+	"code/internal/healthcheck"
+	"code/internal/logging"
+	"code/internal/metrics"
+	"code/internal/preview"
+	"code/internal/service"
+	"code/internal/tracing"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// runServe запускает HTTP-сервер и фоновые задачи.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logging.New(os.Stderr, cfg.LogConfig))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingConfig)
+	if err != nil {
+		return err
+	}
+	// Спаны дописываются после остановки сервера, чтобы не потерять последние запросы
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ServerConfig.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("flush traces", "err", err)
+		}
+	}()
+
+	// Создаём контекст с таймаутом. Если база "зависла", приложение не будет ждать бесконечно.
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	pool, err := NewPgxPool(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	slog.Info("database connected")
+
+	migrator, err := newMigrationProvider(pool, cfg.GooseConfig)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+	if err := prepareSchema(ctx, migrator, cfg.GooseConfig.AutoMigrate); err != nil {
+		return err
+	}
+
+	linkRepo := postgres_db.New(pool)
+	visitRepo := visits.New(pool)
+
+	linkService := service.NewLinkService(linkRepo, cfg)
+	linkService.SetTxRunner(postgres_db.NewTxRunner(pool))
+	visitService := service.NewVisitService(visitRepo)
+
+	// Фоновые задачи живут до остановки сервера, workers ждёт их завершения
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers workerGroup
+
+	if cfg.PreviewConfig.Enabled {
+		fetcher := preview.NewFetcher(preview.Options{
+			Timeout:      cfg.PreviewConfig.Timeout,
+			MaxBodyBytes: cfg.PreviewConfig.MaxBodyBytes,
+		})
+		metadataWorker := service.NewMetadataWorker(linkRepo, fetcher,
+			service.DefaultMetadataQueueSize, cfg.PreviewConfig.Timeout)
+		workers.Go("metadata", func() { metadataWorker.Run(workersCtx, cfg.PreviewConfig.Workers) })
+		linkService.SetMetadataQueue(metadataWorker)
+	}
+
+	workers.GoOnce(func() {
+		if _, err := service.NewOrphanCleaner(visitRepo, cfg.VisitsConfig).Run(workersCtx); err != nil {
+			slog.Error("orphan visits cleanup", "err", err)
+		}
+	})
+
+	if cfg.TrashConfig.Retention > 0 {
+		purger := service.NewTrashPurger(linkRepo, cfg.TrashConfig.Retention, cfg.TrashConfig.PurgeInterval)
+		workers.Go("trash purger", func() { purger.Run(workersCtx) })
+	}
+
+	idempotency := service.NewIdempotencyService(linkRepo, cfg.IdempotencyConfig.TTL)
+	workers.Go("idempotency cleanup", func() { idempotency.Run(workersCtx, min(cfg.IdempotencyConfig.TTL, time.Hour)) })
+
+	imports := service.NewImportService(linkRepo, linkService, cfg.ImportConfig.PollInterval)
+	workers.Go("imports", func() { imports.Run(workersCtx) })
+
+	if cfg.HealthConfig.Enabled {
+		prober := healthcheck.NewProber(healthcheck.Options{Timeout: cfg.HealthConfig.Timeout})
+		checker := service.NewHealthChecker(linkRepo, prober, service.HealthCheckOptions{
+			Interval:         cfg.HealthConfig.Interval,
+			Concurrency:      cfg.HealthConfig.Concurrency,
+			HostDelay:        cfg.HealthConfig.HostDelay,
+			FailureThreshold: cfg.HealthConfig.FailureThreshold,
+		})
+		workers.Go("health checker", func() { checker.Run(workersCtx) })
+	}
+
+	router := handlers.SetupRouter(cfg.SentryConfig.SentryDSN)
+	var linkServer service.LinkServer = linkService
+	var visitServer service.VisitServer = &visitService
+	var redirects gin.IRoutes = router
+
+	if cfg.TracingConfig.Enabled {
+		router.Use(
+			tracing.Middleware(cfg.TracingConfig.ServiceName, "/healthz", "/readyz", cfg.MetricsConfig.Path),
+			tracing.SentryTraceID(),
+		)
+		linkServer = tracing.LinkServer(linkServer)
+		visitServer = tracing.VisitServer(visitServer)
+	}
+	// Access-лог после трассировки, чтобы в логгер запроса попал trace_id
+	router.Use(logging.Middleware(slog.Default()))
+
+	// Cross-Origin Resource Sharing - это с каких сайтов разрешено делать запросы к моему API
+	router.Use(cors.New(config.SetCORSConfig(cfg.APPEnv, cfg.CORSConfig.AllowOrigins)))
+
+	// Cloudflare для определения реального IP-адреса клиента
+	router.TrustedPlatform = gin.PlatformCloudflare
+
+	// Метрики подключаются до маршрутов: middleware gin действует только на маршруты, объявленные после него
+	if cfg.MetricsConfig.Enabled {
+		m := metrics.New()
+		if err := errors.Join(
+			m.Register(metrics.NewPoolCollector(pool)),
+			m.Register(metrics.NewCacheCollector("qr", linkService.QRCacheStats)),
+		); err != nil {
+			return fmt.Errorf("register metrics: %w", err)
+		}
+		router.Use(m.Middleware())
+		router.GET(cfg.MetricsConfig.Path, gin.WrapH(m.Handler()))
+		redirects = router.Group("", m.Redirects())
+		visitServer = m.InstrumentVisits(visitServer)
+	}
+
+	// Группа создаётся после всех router.Use: gin копирует в неё middleware, подключённые к этому моменту
+	var api gin.IRoutes = router
+	if cfg.APIKeysConfig.Required {
+		api = router.Group("", handlers.RequireAPIKey(service.NewAPIKeyService(linkRepo)))
+	}
+
+	handler := handlers.NewHandler(linkServer, visitServer)
+	importHandler := handlers.NewImportHandler(imports, cfg.ImportConfig.MaxSize)
+
+	probes := handlers.NewProbes()
+	probes.AddCheck("database", func(ctx context.Context) error { return pool.Ping(ctx) })
+	probes.AddCheck("migrations", func(ctx context.Context) error { return checkSchemaVersion(ctx, migrator) })
+	probes.AddCheck("workers", workers.Check)
+
+	router.GET("/", handler.HomePage)
+	router.GET("/healthz", probes.Healthz)
+	router.GET("/readyz", probes.Readyz)
+	api.POST("/api/links", handlers.Idempotent(idempotency), handler.CreateLink)
+	api.GET("/api/links", handler.GetLinks)
+	api.POST("/api/links/batch", handlers.Idempotent(idempotency), handler.CreateLinksBatch)
+	api.DELETE("/api/links/batch", handler.DeleteLinksBatch)
+	api.GET("/api/links/:id", handler.GetLinkByID)
+	api.GET("/api/links/:id/qr", handler.GetLinkQR)
+	api.GET("/api/links/:id/health", handler.GetLinkHealth)
+	api.GET("/api/links/:id/visits", handler.GetLinkVisits)
+	api.PUT("/api/links/:id", handler.UpdateLinkByID)
+	api.PATCH("/api/links/:id", handler.PatchLink)
+	api.PUT("/api/links/:id/social", handler.UpdateLinkSocial)
+	api.DELETE("/api/links/:id", handler.DeleteLinkByID)
+	api.POST("/api/links/:id/restore", handler.RestoreLinkByID)
+	api.GET("/api/links/:id/history", handler.GetLinkHistory)
+	api.POST("/api/links/:id/revert", handler.RevertLink)
+	handlers.RegisterRedirectRoutes(redirects, handler, cfg.RedirectPrefix)
+	api.GET("/api/link_visits", handler.GetVisits)
+	api.GET("/api/export/links", handler.ExportLinks)
+	api.GET("/api/export/visits", handler.ExportVisits)
+	api.POST("/api/imports", importHandler.CreateImport)
+	api.GET("/api/imports/:id", importHandler.GetImport)
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf("0.0.0.0:%v", cfg.ServerPort),
+		Handler:           router,
+		ReadTimeout:       cfg.ServerConfig.ReadTimeout,
+		ReadHeaderTimeout: cfg.ServerConfig.ReadHeaderTimeout,
+		WriteTimeout:      cfg.ServerConfig.WriteTimeout,
+		IdleTimeout:       cfg.ServerConfig.IdleTimeout,
+	}
+	// Пул закрывается отложенным pool.Close уже после остановки сервера и фоновых задач
+	return runHTTPServer(srv, cfg.ServerConfig, probes, stopWorkers, &workers)
+}
+
+// runHTTPServer обслуживает запросы до SIGINT/SIGTERM и останавливается по порядку:
+// /readyz начинает отвечать 503 и DrainDelay ждёт, пока балансировщик это заметит,
+// затем сервер перестаёт принимать соединения и дожидается начатых запросов (вместе с записью посещений),
+// после чего останавливаются фоновые задачи. На остановку отводится ShutdownTimeout.
+func runHTTPServer(srv *http.Server, cfg config.ServerConfig, probes *handlers.Probes, stopWorkers context.CancelFunc, workers *workerGroup) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		stopWorkers()
+		workers.Wait()
+		return fmt.Errorf("listen on %s: %w", srv.Addr, err)
+	case <-ctx.Done():
+	}
+	// Повторный сигнал завершает процесс сразу, не дожидаясь остановки
+	stop()
+	probes.SetShuttingDown()
+	if cfg.DrainDelay > 0 {
+		slog.Info("shutting down, draining", "delay", cfg.DrainDelay.String())
+		time.Sleep(cfg.DrainDelay)
+	}
+	slog.Info("shutting down, waiting for in-flight requests", "timeout", cfg.ShutdownTimeout.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("http shutdown: %w", err))
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		errs = append(errs, errors.New("background workers did not stop in time"))
+	}
+	if len(errs) == 0 {
+		slog.Info("server stopped")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"code/internal/db/postgres_db"
+	"code/internal/db/visits"
+	"code/internal/service"
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// runStats печатает сводку: ссылки по состоянию и посещения за всё время и последние сутки.
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	cfg, pool, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	links := service.NewLinkService(postgres_db.New(pool), cfg)
+	visitService := service.NewVisitService(visits.New(pool))
+
+	dayAgo := time.Now().Add(-24 * time.Hour)
+	linkStats := []struct {
+		name   string
+		filter service.LinkFilter
+	}{
+		{"links", service.LinkFilter{}},
+		{"links healthy", service.LinkFilter{Health: service.HealthHealthy}},
+		{"links broken", service.LinkFilter{Health: service.HealthBroken}},
+		{"links in trash", service.LinkFilter{Deleted: true}},
+	}
+	visitStats := []struct {
+		name   string
+		filter service.VisitFilter
+	}{
+		{"visits", service.VisitFilter{}},
+		{"visits last 24h", service.VisitFilter{CreatedFrom: &dayAgo}},
+	}
+
+	tw := newTable()
+	for _, s := range linkStats {
+		_, total, err := links.GetLinks(ctx, s.filter, service.DefaultLinkSort, 0, 0)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%d\n", s.name, total)
+	}
+	for _, s := range visitStats {
+		_, total, err := visitService.GetVisits(ctx, s.filter, service.DefaultVisitSort, service.CountExact, 0, 0)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%d\n", s.name, total)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// workerGroup запускает фоновые задачи и помнит, какие из них уже завершились.
+// Постоянная задача, вышедшая до остановки сервера, делает /readyz неготовым.
+type workerGroup struct {
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	stopped []string
+}
+
+// Go запускает задачу, которая должна работать до остановки сервера.
+func (g *workerGroup) Go(name string, fn func()) {
+	g.wg.Go(func() {
+		defer func() {
+			g.mu.Lock()
+			g.stopped = append(g.stopped, name)
+			g.mu.Unlock()
+		}()
+		fn()
+	})
+}
+
+// GoOnce запускает разовую задачу, её завершение - норма.
+func (g *workerGroup) GoOnce(fn func()) {
+	g.wg.Go(fn)
+}
+
+func (g *workerGroup) Wait() {
+	g.wg.Wait()
+}
+
+// Check - проверка готовности: все постоянные задачи работают.
+func (g *workerGroup) Check(context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.stopped) > 0 {
+		return fmt.Errorf("stopped: %s", strings.Join(g.stopped, ", "))
+	}
+	return nil
+}
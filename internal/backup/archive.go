@@ -0,0 +1,190 @@
+// Package backup снимает и восстанавливает полную копию данных сервиса.
+//
+// Архив - tar.gz: первым идёт manifest.json, за ним по файлу NDJSON на таблицу
+// в порядке из манифеста. Строка файла - to_jsonb строки таблицы, так что архив
+// не зависит от порядка колонок и переживает добавление новых.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// FormatVersion - версия формата архива. Архивы новее этой версии не читаются.
+const FormatVersion = 1
+
+const manifestName = "manifest.json"
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported backup format version")
+	ErrInvalidArchive     = errors.New("invalid backup archive")
+	// ErrChecksum - содержимое файла не совпало с манифестом: архив повреждён
+	ErrChecksum = errors.New("backup checksum mismatch")
+)
+
+// Manifest описывает архив. SchemaVersion - версия миграций БД, с которой снята копия.
+type Manifest struct {
+	Version       int       `json:"version"`
+	CreatedAt     time.Time `json:"created_at"`
+	SchemaVersion int64     `json:"schema_version"`
+	Files         []File    `json:"files"`
+}
+
+// File - выгрузка одной таблицы.
+type File struct {
+	Name    string   `json:"name"`
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Rows    int64    `json:"rows"`
+	SHA256  string   `json:"sha256"`
+}
+
+// ArchiveWriter пишет архив. Размер каждого файла нужен tar заранее,
+// поэтому файлы сначала собираются на диске.
+type ArchiveWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func NewArchiveWriter(w io.Writer) *ArchiveWriter {
+	gz := gzip.NewWriter(w)
+	return &ArchiveWriter{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+// WriteManifest должен вызываться до WriteFile.
+func (a *ArchiveWriter) WriteManifest(m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.WriteFile(manifestName, m.CreatedAt, int64(len(data)), bytes.NewReader(data))
+}
+
+func (a *ArchiveWriter) WriteFile(name string, modTime time.Time, size int64, r io.Reader) error {
+	if err := a.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0o600,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return fmt.Errorf("write header %s: %w", name, err)
+	}
+	if _, err := io.Copy(a.tw, r); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+func (a *ArchiveWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// ArchiveReader читает архив потоком: файлы отдаются по одному в порядке манифеста.
+type ArchiveReader struct {
+	tr       *tar.Reader
+	manifest *Manifest
+	next     int
+}
+
+// OpenArchive читает и проверяет манифест.
+func OpenArchive(r io.Reader) (*ArchiveReader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	tr := tar.NewReader(gz)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	if header.Name != manifestName {
+		return nil, fmt.Errorf("%w: first entry is %q, want %s", ErrInvalidArchive, header.Name, manifestName)
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("%w: manifest: %w", ErrInvalidArchive, err)
+	}
+	if m.Version < 1 || m.Version > FormatVersion {
+		return nil, fmt.Errorf("%w %d, supported up to %d", ErrUnsupportedVersion, m.Version, FormatVersion)
+	}
+	return &ArchiveReader{tr: tr, manifest: &m}, nil
+}
+
+func (a *ArchiveReader) Manifest() *Manifest {
+	return a.manifest
+}
+
+// Next возвращает следующий файл из манифеста, io.EOF - файлов больше нет.
+func (a *ArchiveReader) Next() (*FileReader, error) {
+	if a.next >= len(a.manifest.Files) {
+		return nil, io.EOF
+	}
+	file := a.manifest.Files[a.next]
+	header, err := a.tr.Next()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %s is missing", ErrInvalidArchive, file.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	if header.Name != file.Name {
+		return nil, fmt.Errorf("%w: entry %q, want %q", ErrInvalidArchive, header.Name, file.Name)
+	}
+	a.next++
+	h := sha256.New()
+	return &FileReader{File: file, r: bufio.NewReader(io.TeeReader(a.tr, h)), hash: h}, nil
+}
+
+// FileReader отдаёт строки файла и считает контрольную сумму прочитанного.
+type FileReader struct {
+	File File
+	r    *bufio.Reader
+	hash hash.Hash
+	rows int64
+}
+
+// ReadRow возвращает следующую строку, io.EOF - строки кончились.
+func (f *FileReader) ReadRow() (map[string]json.RawMessage, error) {
+	for {
+		line, err := f.r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var row map[string]json.RawMessage
+			if err := json.Unmarshal(line, &row); err != nil {
+				return nil, fmt.Errorf("%w: %s row %d: %w", ErrInvalidArchive, f.File.Name, f.rows+1, err)
+			}
+			f.rows++
+			return row, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Verify дочитывает файл и сверяет число строк и SHA-256 с манифестом.
+func (f *FileReader) Verify() error {
+	if _, err := io.Copy(io.Discard, f.r); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(f.hash.Sum(nil)); sum != f.File.SHA256 {
+		return fmt.Errorf("%w: %s sha256 %s, manifest %s", ErrChecksum, f.File.Name, sum, f.File.SHA256)
+	}
+	if f.rows != f.File.Rows {
+		return fmt.Errorf("%w: %s has %d rows, manifest %d", ErrChecksum, f.File.Name, f.rows, f.File.Rows)
+	}
+	return nil
+}
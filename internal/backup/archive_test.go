@@ -0,0 +1,131 @@
+package backup_test
+
+import (
+	"bytes"
+	"code/internal/backup"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const linksNDJSON = `{"id": 1, "short_name": "a", "original_url": "https://example.com/a"}
+{"id": 2, "short_name": "b", "original_url": "https://example.com/b"}
+`
+
+func writeArchive(t *testing.T, m *backup.Manifest, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	aw := backup.NewArchiveWriter(&buf)
+	require.NoError(t, aw.WriteManifest(m))
+	require.NoError(t, aw.WriteFile(m.Files[0].Name, m.CreatedAt, int64(len(content)), bytes.NewReader([]byte(content))))
+	require.NoError(t, aw.Close())
+	return buf.Bytes()
+}
+
+func manifest() *backup.Manifest {
+	sum := sha256.Sum256([]byte(linksNDJSON))
+	return &backup.Manifest{
+		Version:       backup.FormatVersion,
+		CreatedAt:     time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC),
+		SchemaVersion: 13,
+		Files: []backup.File{{
+			Name:    "links.ndjson",
+			Table:   "links",
+			Columns: []string{"id", "original_url", "short_name"},
+			Rows:    2,
+			SHA256:  hex.EncodeToString(sum[:]),
+		}},
+	}
+}
+
+func readAll(ar *backup.ArchiveReader) ([]map[string]json.RawMessage, error) {
+	var rows []map[string]json.RawMessage
+	for {
+		f, err := ar.Next()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for {
+			row, err := f.ReadRow()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+		if err := f.Verify(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestArchive_RoundTrip(t *testing.T) {
+	t.Parallel()
+	ar, err := backup.OpenArchive(bytes.NewReader(writeArchive(t, manifest(), linksNDJSON)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), ar.Manifest().SchemaVersion)
+
+	rows, err := readAll(ar)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.JSONEq(t, `"b"`, string(rows[1]["short_name"]))
+}
+
+func TestArchive_Corrupted(t *testing.T) {
+	t.Parallel()
+
+	t.Run("checksum", func(t *testing.T) {
+		t.Parallel()
+		content := linksNDJSON[:len(linksNDJSON)-3] + "x\"}\n"
+		ar, err := backup.OpenArchive(bytes.NewReader(writeArchive(t, manifest(), content)))
+		require.NoError(t, err)
+		_, err = readAll(ar)
+		assert.ErrorIs(t, err, backup.ErrChecksum)
+	})
+
+	t.Run("rows", func(t *testing.T) {
+		t.Parallel()
+		m := manifest()
+		m.Files[0].Rows = 3
+		ar, err := backup.OpenArchive(bytes.NewReader(writeArchive(t, m, linksNDJSON)))
+		require.NoError(t, err)
+		_, err = readAll(ar)
+		assert.ErrorIs(t, err, backup.ErrChecksum)
+	})
+
+	t.Run("newer version", func(t *testing.T) {
+		t.Parallel()
+		m := manifest()
+		m.Version = backup.FormatVersion + 1
+		_, err := backup.OpenArchive(bytes.NewReader(writeArchive(t, m, linksNDJSON)))
+		assert.ErrorIs(t, err, backup.ErrUnsupportedVersion)
+	})
+
+	t.Run("not gzip", func(t *testing.T) {
+		t.Parallel()
+		_, err := backup.OpenArchive(bytes.NewReader([]byte("plain text")))
+		assert.ErrorIs(t, err, backup.ErrInvalidArchive)
+	})
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	t.Parallel()
+	p, err := backup.ParseConflictPolicy("Rename")
+	require.NoError(t, err)
+	assert.Equal(t, backup.OnConflictRename, p)
+
+	_, err = backup.ParseConflictPolicy("merge")
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Tables - таблицы в архиве. Порядок важен: при восстановлении посещения и ревизии
+// привязываются к уже восстановленным ссылкам.
+var Tables = []string{"links", "link_revisions", "visits"}
+
+// DB - источник соединений, *pgxpool.Pool подходит.
+type DB interface {
+	BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error)
+}
+
+// Backup пишет архив всех Tables в w. Таблицы читаются в одном снимке REPEATABLE READ,
+// так что посещения в архиве согласованы со ссылками.
+func Backup(ctx context.Context, db DB, w io.Writer) (*Manifest, error) {
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	m := &Manifest{Version: FormatVersion, CreatedAt: time.Now().UTC()}
+	if m.SchemaVersion, err = schemaVersion(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	tmp := make([]*os.File, 0, len(Tables))
+	defer func() {
+		for _, f := range tmp {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+	for _, table := range Tables {
+		f, err := os.CreateTemp("", "lshortener-backup-*.ndjson")
+		if err != nil {
+			return nil, err
+		}
+		tmp = append(tmp, f)
+		file, err := dumpTable(ctx, tx, table, f)
+		if err != nil {
+			return nil, fmt.Errorf("dump %s: %w", table, err)
+		}
+		m.Files = append(m.Files, file)
+	}
+
+	aw := NewArchiveWriter(w)
+	if err := aw.WriteManifest(m); err != nil {
+		return nil, err
+	}
+	for i, f := range tmp {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := aw.WriteFile(m.Files[i].Name, m.CreatedAt, info.Size(), f); err != nil {
+			return nil, err
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func dumpTable(ctx context.Context, tx pgx.Tx, table string, w io.Writer) (File, error) {
+	file := File{Name: table + ".ndjson", Table: table}
+	var err error
+	if file.Columns, err = tableColumns(ctx, tx, table); err != nil {
+		return File{}, err
+	}
+	rows, err := tx.Query(ctx, fmt.Sprintf("SELECT to_jsonb(t) FROM %s t ORDER BY id", pgx.Identifier{table}.Sanitize()))
+	if err != nil {
+		return File{}, err
+	}
+	defer rows.Close()
+
+	h := sha256.New()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+	for rows.Next() {
+		var line []byte
+		if err := rows.Scan(&line); err != nil {
+			return File{}, err
+		}
+		if _, err := bw.Write(append(line, '\n')); err != nil {
+			return File{}, err
+		}
+		file.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return File{}, err
+	}
+	if err := bw.Flush(); err != nil {
+		return File{}, err
+	}
+	file.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return file, nil
+}
+
+func tableColumns(ctx context.Context, tx pgx.Tx, table string) ([]string, error) {
+	rows, err := tx.Query(ctx, `SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+		ORDER BY ordinal_position`, table)
+	if err != nil {
+		return nil, fmt.Errorf("columns of %s: %w", table, err)
+	}
+	columns, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("columns of %s: %w", table, err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	return columns, nil
+}
+
+// schemaVersion - последняя применённая миграция goose.
+func schemaVersion(ctx context.Context, tx pgx.Tx) (int64, error) {
+	var version int64
+	err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("schema version: %w", err)
+	}
+	return version, nil
+}
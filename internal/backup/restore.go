@@ -0,0 +1,405 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ConflictPolicy - что делать со строкой архива, которая уже есть в БД.
+type ConflictPolicy string
+
+const (
+	// OnConflictSkip оставляет строку БД, строка архива пропускается. Посещения и история
+	// ссылки из архива добавляются к ссылке БД, если их там ещё нет.
+	OnConflictSkip ConflictPolicy = "skip"
+	// OnConflictOverwrite заменяет строку БД строкой архива.
+	OnConflictOverwrite ConflictPolicy = "overwrite"
+	// OnConflictRename восстанавливает ссылку под свободным коротким именем name-2, name-3...
+	// Ссылка на уже существующий original_url не переименовывается: это та же ссылка, как при skip.
+	OnConflictRename ConflictPolicy = "rename"
+)
+
+var ConflictPolicies = []ConflictPolicy{OnConflictSkip, OnConflictOverwrite, OnConflictRename}
+
+// ErrSchemaTooOld - архив снят с более новой схемы, сначала нужно применить миграции.
+var ErrSchemaTooOld = errors.New("database schema is older than the backup")
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	p := ConflictPolicy(strings.ToLower(strings.TrimSpace(s)))
+	if !slices.Contains(ConflictPolicies, p) {
+		return "", fmt.Errorf("unknown conflict policy %q, allowed: skip, overwrite, rename", s)
+	}
+	return p, nil
+}
+
+// TableResult - итог восстановления таблицы.
+type TableResult struct {
+	Table    string `json:"table"`
+	Inserted int64  `json:"inserted"`
+	Updated  int64  `json:"updated"`
+	Renamed  int64  `json:"renamed"`
+	Skipped  int64  `json:"skipped"`
+}
+
+type RestoreResult struct {
+	Manifest *Manifest     `json:"manifest"`
+	Tables   []TableResult `json:"tables"`
+}
+
+// Restore восстанавливает архив в одной транзакции: при ошибке или несовпадении
+// контрольной суммы любого файла БД остаётся нетронутой.
+// В пустую БД строки ложатся с прежними id, в заполненную - с новыми там, где id занят.
+func Restore(ctx context.Context, db DB, r io.Reader, policy ConflictPolicy) (*RestoreResult, error) {
+	archive, err := OpenArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	m := archive.Manifest()
+
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	version, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if version < m.SchemaVersion {
+		return nil, fmt.Errorf("%w: database %d, backup %d", ErrSchemaTooOld, version, m.SchemaVersion)
+	}
+
+	rs := &restorer{tx: tx, policy: policy, linkIDs: make(map[int64]int64)}
+	result := &RestoreResult{Manifest: m}
+	for {
+		f, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		tr, err := rs.restoreFile(ctx, f)
+		if err != nil {
+			return nil, fmt.Errorf("restore %s: %w", f.File.Table, err)
+		}
+		if err := f.Verify(); err != nil {
+			return nil, err
+		}
+		result.Tables = append(result.Tables, tr)
+	}
+	for _, table := range Tables {
+		if err := resetIdentity(ctx, tx, table); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return result, nil
+}
+
+type restorer struct {
+	tx     pgx.Tx
+	policy ConflictPolicy
+	// linkIDs - id ссылки в архиве -> id в БД: восстановленной или уже существовавшей.
+	// Ссылки без записи пропущены вместе с их историей.
+	linkIDs map[int64]int64
+}
+
+// table - колонки, которые есть и в архиве, и в БД. Колонок, которых нет в архиве,
+// строка не задаёт, и они получают значения по умолчанию.
+type table struct {
+	name    string
+	columns []string
+}
+
+func (t table) list(skip string) string {
+	cols := make([]string, 0, len(t.columns))
+	for _, c := range t.columns {
+		if c != skip {
+			cols = append(cols, pgx.Identifier{c}.Sanitize())
+		}
+	}
+	return strings.Join(cols, ", ")
+}
+
+// insertSQL вставляет строку из jsonb $1. Без колонки id она берётся из последовательности.
+func (t table) insertSQL(withID bool, suffix string) string {
+	skip := ""
+	if !withID {
+		skip = "id"
+	}
+	name := pgx.Identifier{t.name}.Sanitize()
+	return fmt.Sprintf("INSERT INTO %s (%s) OVERRIDING SYSTEM VALUE SELECT %s FROM jsonb_populate_record(NULL::%s, $1) %s",
+		name, t.list(skip), t.list(skip), name, suffix)
+}
+
+func (t table) updateSet() string {
+	sets := make([]string, 0, len(t.columns))
+	for _, c := range t.columns {
+		if c != "id" {
+			col := pgx.Identifier{c}.Sanitize()
+			sets = append(sets, col+" = EXCLUDED."+col)
+		}
+	}
+	return strings.Join(sets, ", ")
+}
+
+func (rs *restorer) restoreFile(ctx context.Context, f *FileReader) (TableResult, error) {
+	dbColumns, err := tableColumns(ctx, rs.tx, f.File.Table)
+	if err != nil {
+		return TableResult{}, err
+	}
+	t := table{name: f.File.Table}
+	for _, c := range f.File.Columns {
+		if slices.Contains(dbColumns, c) {
+			t.columns = append(t.columns, c)
+		}
+	}
+	result := TableResult{Table: t.name}
+	var restore func(ctx context.Context, t table, row map[string]json.RawMessage, result *TableResult) error
+	switch t.name {
+	case "links":
+		restore = rs.restoreLink
+	case "visits":
+		restore = rs.restoreVisit
+	case "link_revisions":
+		restore = rs.restoreRevision
+	default:
+		return TableResult{}, fmt.Errorf("unknown table %s", t.name)
+	}
+	for {
+		row, err := f.ReadRow()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return TableResult{}, err
+		}
+		if err := restore(ctx, t, row, &result); err != nil {
+			return TableResult{}, err
+		}
+	}
+}
+
+// restoreLink сопоставляет ссылки по short_name и original_url, а не по id:
+// id в другой БД может принадлежать совсем другой ссылке. Если ссылка архива не восстановлена
+// отдельной строкой, её посещения и история переносятся на найденную ссылку БД.
+func (rs *restorer) restoreLink(ctx context.Context, t table, row map[string]json.RawMessage, result *TableResult) error {
+	var key struct {
+		ID          int64  `json:"id"`
+		ShortName   string `json:"short_name"`
+		OriginalURL string `json:"original_url"`
+	}
+	raw, _ := json.Marshal(row)
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	id, shortName, originalURL := key.ID, key.ShortName, key.OriginalURL
+	var existingID int64
+	var existingURL string
+	err := rs.tx.QueryRow(ctx, `SELECT id, original_url FROM links
+		WHERE short_name = $1 OR original_url = $2
+		ORDER BY short_name = $1 DESC LIMIT 1`, shortName, originalURL).Scan(&existingID, &existingURL)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("find link %s: %w", shortName, err)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		newID, ok, err := rs.insertLink(ctx, t, row, id)
+		if err != nil || !ok {
+			result.Skipped++
+			return err
+		}
+		rs.linkIDs[id] = newID
+		result.Inserted++
+		return nil
+	}
+
+	switch rs.policy {
+	case OnConflictOverwrite:
+		ok, err := rs.savepoint(ctx, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, fmt.Sprintf("UPDATE links SET (%s) = (SELECT %s FROM jsonb_populate_record(NULL::links, $1)) WHERE id = $2",
+				t.list("id"), t.list("id")), string(raw), existingID)
+			return err
+		})
+		if err != nil || !ok {
+			result.Skipped++
+			return err
+		}
+		rs.linkIDs[id] = existingID
+		result.Updated++
+	case OnConflictRename:
+		if existingURL == originalURL {
+			rs.linkIDs[id] = existingID
+			result.Skipped++
+			return nil
+		}
+		name, err := rs.freeShortName(ctx, shortName)
+		if err != nil {
+			return err
+		}
+		row["short_name"], _ = json.Marshal(name)
+		newID, ok, err := rs.insertLink(ctx, t, row, id)
+		if err != nil || !ok {
+			result.Skipped++
+			return err
+		}
+		rs.linkIDs[id] = newID
+		result.Renamed++
+	default:
+		rs.linkIDs[id] = existingID
+		result.Skipped++
+	}
+	return nil
+}
+
+// insertLink сохраняет id из архива, если он свободен. false - строка нарушает
+// ограничение уникальности и пропущена.
+func (rs *restorer) insertLink(ctx context.Context, t table, row map[string]json.RawMessage, id int64) (int64, bool, error) {
+	var taken bool
+	if err := rs.tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM links WHERE id = $1)`, id).Scan(&taken); err != nil {
+		return 0, false, fmt.Errorf("check link id: %w", err)
+	}
+	raw, _ := json.Marshal(row)
+	var newID int64
+	ok, err := rs.savepoint(ctx, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, t.insertSQL(!taken, "RETURNING id"), string(raw)).Scan(&newID)
+	})
+	return newID, ok, err
+}
+
+// freeShortName подбирает name-2, name-3... Имя обрезается, чтобы влезть в VARCHAR(100).
+func (rs *restorer) freeShortName(ctx context.Context, name string) (string, error) {
+	for n := 2; ; n++ {
+		suffix := fmt.Sprintf("-%d", n)
+		candidate := name
+		if len(candidate)+len(suffix) > 100 {
+			candidate = candidate[:100-len(suffix)]
+		}
+		candidate += suffix
+		var taken bool
+		if err := rs.tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM links WHERE short_name = $1)`, candidate).Scan(&taken); err != nil {
+			return "", fmt.Errorf("check short name: %w", err)
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
+
+// restoreVisit переносит посещение на восстановленную ссылку. Совпадение по id -
+// конфликт: skip оставляет посещение БД, overwrite заменяет, rename сохраняет под новым id.
+// Посещение, которое уже есть у той же ссылки (архив восстанавливается повторно), не дублируется.
+func (rs *restorer) restoreVisit(ctx context.Context, t table, row map[string]json.RawMessage, result *TableResult) error {
+	if !rs.relink(row) {
+		result.Skipped++
+		return nil
+	}
+	raw, _ := json.Marshal(row)
+	suffix := "ON CONFLICT (id) DO NOTHING"
+	if rs.policy == OnConflictOverwrite {
+		suffix = "ON CONFLICT (id) DO UPDATE SET " + t.updateSet()
+	}
+	tag, err := rs.tx.Exec(ctx, t.insertSQL(true, suffix), string(raw))
+	if err != nil {
+		return fmt.Errorf("insert visit: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		result.Inserted++
+		return nil
+	}
+	if rs.policy != OnConflictRename {
+		result.Skipped++
+		return nil
+	}
+	var sameLink bool
+	if err := rs.tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM visits WHERE id = ($1::jsonb->>'id')::bigint AND link_id = ($1::jsonb->>'link_id')::bigint)`,
+		string(raw)).Scan(&sameLink); err != nil {
+		return fmt.Errorf("check visit: %w", err)
+	}
+	if sameLink {
+		result.Skipped++
+		return nil
+	}
+	if _, err := rs.tx.Exec(ctx, t.insertSQL(false, ""), string(raw)); err != nil {
+		return fmt.Errorf("insert visit: %w", err)
+	}
+	result.Renamed++
+	return nil
+}
+
+// restoreRevision: ревизия ссылки однозначно задаётся (link_id, revision), id на неё никто не ссылается.
+func (rs *restorer) restoreRevision(ctx context.Context, t table, row map[string]json.RawMessage, result *TableResult) error {
+	if !rs.relink(row) {
+		result.Skipped++
+		return nil
+	}
+	raw, _ := json.Marshal(row)
+	suffix := "ON CONFLICT (link_id, revision) DO NOTHING"
+	if rs.policy == OnConflictOverwrite {
+		suffix = "ON CONFLICT (link_id, revision) DO UPDATE SET " + t.updateSet()
+	}
+	tag, err := rs.tx.Exec(ctx, t.insertSQL(false, suffix), string(raw))
+	if err != nil {
+		return fmt.Errorf("insert revision: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		result.Skipped++
+		return nil
+	}
+	result.Inserted++
+	return nil
+}
+
+// relink заменяет link_id на id восстановленной ссылки. false - ссылка пропущена.
+func (rs *restorer) relink(row map[string]json.RawMessage) bool {
+	var linkID int64
+	if err := json.Unmarshal(row["link_id"], &linkID); err != nil {
+		return false
+	}
+	newID, ok := rs.linkIDs[linkID]
+	if !ok {
+		return false
+	}
+	row["link_id"], _ = json.Marshal(newID)
+	return true
+}
+
+// savepoint выполняет fn так, чтобы нарушение уникальности не обрывало всю транзакцию.
+// false - fn нарушила ограничение и откатана.
+func (rs *restorer) savepoint(ctx context.Context, fn func(tx pgx.Tx) error) (bool, error) {
+	sp, err := rs.tx.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	if err := fn(sp); err != nil {
+		_ = sp.Rollback(ctx)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, sp.Commit(ctx)
+}
+
+// resetIdentity сдвигает последовательность id за максимальный восстановленный id.
+func resetIdentity(ctx context.Context, tx pgx.Tx, table string) error {
+	name := pgx.Identifier{table}.Sanitize()
+	_, err := tx.Exec(ctx, fmt.Sprintf(
+		"SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE((SELECT MAX(id) FROM %s), 0) + 1, false)", name), table)
+	if err != nil {
+		return fmt.Errorf("reset %s id: %w", table, err)
+	}
+	return nil
+}
@@ -2,27 +2,69 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/joho/godotenv"
 )
 
+const DefaultRedirectPrefix = "/r"
+
+// Что делать с посещениями при удалении ссылки
+const (
+	VisitsOnDeleteCascade = "cascade"
+	VisitsOnDeleteArchive = "archive"
+)
+
 type AppConfig struct {
-	APPEnv       string
-	ServerPort   string
-	BaseURL      string
-	DBConfig     DBConfig
-	PoolConfig   PoolConfig
-	GooseConfig  GooseConfig
-	SentryConfig SentryConfig
+	APPEnv     string
+	ServerPort int
+	BaseURL    string
+	// RedirectPrefix - путь, под которым отдаются редиректы: "" (корень) или, например, "/r"
+	RedirectPrefix    string
+	ServerConfig      ServerConfig
+	DBConfig          DBConfig
+	PoolConfig        PoolConfig
+	GooseConfig       GooseConfig
+	SentryConfig      SentryConfig
+	QRConfig          QRConfig
+	PreviewConfig     PreviewConfig
+	HealthConfig      HealthConfig
+	VisitsConfig      VisitsConfig
+	TrashConfig       TrashConfig
+	IdempotencyConfig IdempotencyConfig
+	ImportConfig      ImportConfig
+	MetricsConfig     MetricsConfig
+	TracingConfig     TracingConfig
+	LogConfig         LogConfig
+	CORSConfig        CORSConfig
+	APIKeysConfig     APIKeysConfig
+}
+
+// ServerConfig - таймауты HTTP-сервера. 0 отключает таймаут.
+type ServerConfig struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout не действует на выгрузки: они пишутся потоком сколько потребуется
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout - сколько при остановке ждать начатые запросы и фоновые задачи
+	ShutdownTimeout time.Duration
+	// DrainDelay - сколько после сигнала остановки принимать запросы с неготовым /readyz,
+	// чтобы балансировщик успел убрать экземпляр
+	DrainDelay time.Duration
 }
 
 type DBConfig struct {
 	DATABASE_URL string
 	DBHost       string
-	DBPort       string
+	DBPort       int
 	DBName       string
 	DBUser       string
 	DBPassword   string
@@ -30,20 +72,120 @@ type DBConfig struct {
 }
 
 type PoolConfig struct {
-	DBMaxConns        string
-	DBMaxIdleConns    string
-	DBConnMaxLifetime string
+	DBMaxConns int32
+	// DBMaxIdleConns - сколько соединений пул держит открытыми без нагрузки
+	DBMaxIdleConns int32
+	// DBConnMaxLifetime - через сколько соединение закрывается и открывается заново, 0 - по умолчанию pgx (1 час)
+	DBConnMaxLifetime time.Duration
 }
 
 type GooseConfig struct {
 	GooseDBString string
 	GooseDriver   string
+	// AutoMigrate применяет встроенные миграции при запуске сервера
+	AutoMigrate bool
+	// LockTimeout - сколько ждать advisory lock, пока миграции применяет другой экземпляр
+	LockTimeout time.Duration
+}
+
+type CORSConfig struct {
+	// AllowOrigins - сайты, с которых разрешены запросы к API, например https://admin.example.com
+	AllowOrigins []string
 }
 
 type SentryConfig struct {
 	SentryDSN string
 }
 
+type QRConfig struct {
+	// LogoPath - PNG/JPEG, который накладывается по центру QR-кода при logo=true
+	LogoPath string
+	// CacheSize - сколько готовых картинок держать в памяти
+	CacheSize int
+}
+
+type PreviewConfig struct {
+	// Enabled включает фоновую загрузку title/description/og:image страницы назначения
+	Enabled      bool
+	Workers      int
+	Timeout      time.Duration
+	MaxBodyBytes int64
+}
+
+type HealthConfig struct {
+	// Enabled включает периодическую проверку адресов назначения
+	Enabled          bool
+	Interval         time.Duration
+	Concurrency      int
+	HostDelay        time.Duration
+	Timeout          time.Duration
+	FailureThreshold int32
+}
+
+type VisitsConfig struct {
+	// OnLinkDelete - cascade удаляет посещения вместе со ссылкой, archive переносит их в visits_archive
+	OnLinkDelete string
+	// OrphanBatchSize - сколько посещений без ссылки разбирается за один запрос при очистке
+	OrphanBatchSize int32
+}
+
+type TrashConfig struct {
+	// Retention - сколько удалённая ссылка хранится в корзине, 0 отключает очистку
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+type IdempotencyConfig struct {
+	// TTL - сколько хранится ответ на запрос с Idempotency-Key
+	TTL time.Duration
+}
+
+type ImportConfig struct {
+	// MaxSize - самый большой файл импорта в байтах
+	MaxSize int64
+	// PollInterval - как часто проверять очередь импорта, поставленную другими экземплярами сервиса
+	PollInterval time.Duration
+}
+
+type APIKeysConfig struct {
+	// Required закрывает /api ключами доступа (lshortener keys create), редиректы остаются открытыми
+	Required bool
+}
+
+type MetricsConfig struct {
+	// Enabled включает отдачу метрик Prometheus
+	Enabled bool
+	// Path - маршрут, по которому отдаются метрики
+	Path string
+}
+
+type TracingConfig struct {
+	// Enabled включает экспорт спанов OpenTelemetry по OTLP/HTTP
+	Enabled bool
+	// Endpoint - полный адрес приёмника спанов, например http://otel-collector:4318/v1/traces
+	Endpoint    string
+	ServiceName string
+	// SampleRatio - доля записываемых трассировок от 0 до 1 для запросов без traceparent
+	SampleRatio float64
+}
+
+// Что писать в логи вместо IP-адреса клиента
+const (
+	LogIPFull      = "full"
+	LogIPTruncated = "truncated"
+	LogIPNone      = "none"
+)
+
+type LogConfig struct {
+	Level slog.Level
+	// IPs - full пишет адрес как есть, truncated - только сеть (/24 для IPv4, /48 для IPv6), none - ничего
+	IPs string
+	// QueryStrings - писать ли query string запросов: в ней бывают токены и персональные данные
+	QueryStrings bool
+}
+
+// Load собирает настройки из переменных окружения и, если задан CONFIG_FILE, из файла YAML или TOML.
+// Переменные окружения важнее файла. Все неверные значения перечисляются в одной ошибке ErrInvalidConfig.
 func Load() (*AppConfig, error) {
 	env := os.Getenv("APP_ENV")
 	if env == "" {
@@ -59,61 +201,228 @@ func Load() (*AppConfig, error) {
 		}
 	}
 
-	dbConfig := DBConfig{
-		DATABASE_URL: getEnv("DATABASE_URL", ""),
-		DBHost:       getEnv("DB_HOST", "localhost"),
-		DBPort:       getEnv("DB_PORT", "5432"),
-		DBName:       getEnv("DB_NAME", ""),
-		DBUser:       getEnv("DB_USER", ""),
-		DBPassword:   getEnv("DB_PASSWORD", ""),
-		DBSSLMode:    getEnv("DB_SSL_MODE", "disable"),
+	s := &source{used: map[string]bool{"APP_ENV": true, "CONFIG_FILE": true}, failed: map[string]bool{}}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		file, err := loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s.file = file
+		// APP_ENV из файла действует, если не задан в окружении
+		if os.Getenv("APP_ENV") == "" && file["APP_ENV"] != "" {
+			env = file["APP_ENV"]
+		}
 	}
 
-	// Получаем значения из переменных окружения
 	config := &AppConfig{
-		APPEnv:     env,
-		ServerPort: getEnv("APP_PORT", "8080"),
-		BaseURL:    getEnv("BASE_URL", "http://localhost:8080"),
-		DBConfig:   dbConfig,
-		PoolConfig: PoolConfig{
-			DBMaxConns:        getEnv("DB_MAX_CONNS", "10"),
-			DBMaxIdleConns:    getEnv("DB_MAX_IDLE_CONNS", "5"),
-			DBConnMaxLifetime: getEnv("DB_CONN_MAX_LIFETIME", "30m"),
-		},
-		GooseConfig: GooseConfig{
-			GooseDBString: dbConfig.DATABASE_URL,
-			GooseDriver:   getEnv("GOOSE_DRIVER", "postgres"),
-		},
-		SentryConfig: SentryConfig{
-			SentryDSN: getEnv("SENTRY_DSN", ""),
-		},
+		APPEnv:         env,
+		ServerPort:     int(s.int("APP_PORT", "8080", 0)),
+		BaseURL:        strings.TrimRight(s.str("BASE_URL", "http://localhost:8080"), "/"),
+		RedirectPrefix: NormalizeRedirectPrefix(s.str("REDIRECT_PREFIX", DefaultRedirectPrefix)),
 	}
+	s.check(config.ServerPort > 0 && config.ServerPort < 65536, "APP_PORT", "must be between 1 and 65535, got %d", config.ServerPort)
 
+	config.DBConfig = DBConfig{
+		DATABASE_URL: s.str("DATABASE_URL", ""),
+		DBHost:       s.str("DB_HOST", "localhost"),
+		DBPort:       int(s.int("DB_PORT", "5432", 0)),
+		DBName:       s.str("DB_NAME", ""),
+		DBUser:       s.str("DB_USER", ""),
+		DBPassword:   s.str("DB_PASSWORD", ""),
+		DBSSLMode:    s.oneOf("DB_SSL_MODE", "disable", "disable", "allow", "prefer", "require", "verify-ca", "verify-full"),
+	}
+	if config.DBConfig.DATABASE_URL == "" {
+		// Без DATABASE_URL строка подключения собирается из DB_*
+		s.check(config.DBConfig.DBName != "", "DB_NAME", "required when DATABASE_URL is empty")
+		s.check(config.DBConfig.DBUser != "", "DB_USER", "required when DATABASE_URL is empty")
+		s.check(config.DBConfig.DBPort > 0 && config.DBConfig.DBPort < 65536, "DB_PORT", "must be between 1 and 65535, got %d", config.DBConfig.DBPort)
+		config.DBConfig.DATABASE_URL = config.DBConfig.DSN()
+	}
+
+	config.PoolConfig = PoolConfig{
+		DBMaxConns:        int32(s.int("DB_MAX_CONNS", "10", 32)),
+		DBMaxIdleConns:    int32(s.int("DB_MAX_IDLE_CONNS", "5", 32)),
+		DBConnMaxLifetime: s.duration("DB_CONN_MAX_LIFETIME", "30m"),
+	}
+	s.check(config.PoolConfig.DBMaxConns > 0, "DB_MAX_CONNS", "must be positive, got %d", config.PoolConfig.DBMaxConns)
+	s.check(s.failed["DB_MAX_CONNS"] || config.PoolConfig.DBMaxIdleConns >= 0 && config.PoolConfig.DBMaxIdleConns <= config.PoolConfig.DBMaxConns,
+		"DB_MAX_IDLE_CONNS", "must be between 0 and DB_MAX_CONNS (%d), got %d", config.PoolConfig.DBMaxConns, config.PoolConfig.DBMaxIdleConns)
+	s.check(config.PoolConfig.DBConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME", "must not be negative, got %s", config.PoolConfig.DBConnMaxLifetime)
+
+	config.GooseConfig = GooseConfig{
+		GooseDBString: config.DBConfig.DATABASE_URL,
+		GooseDriver:   s.str("GOOSE_DRIVER", "postgres"),
+		AutoMigrate:   s.bool("MIGRATE_ON_START", "false"),
+		LockTimeout:   s.duration("MIGRATE_LOCK_TIMEOUT", "5m"),
+	}
+	s.check(config.GooseConfig.LockTimeout > 0, "MIGRATE_LOCK_TIMEOUT", "must be positive, got %s", config.GooseConfig.LockTimeout)
+
+	config.SentryConfig = SentryConfig{
+		SentryDSN: s.str("SENTRY_DSN", ""),
+	}
+
+	defaultOrigins := "http://localhost:5173"
+	if env == "production" {
+		defaultOrigins = "https://go-project-278.onrender.com"
+	}
+	config.CORSConfig = CORSConfig{AllowOrigins: s.list("CORS_ALLOWED_ORIGINS", defaultOrigins)}
+	s.check(len(config.CORSConfig.AllowOrigins) > 0, "CORS_ALLOWED_ORIGINS", "at least one origin is required")
+	for _, origin := range config.CORSConfig.AllowOrigins {
+		// "*" не допускается: запросы идут с учётными данными, а браузеры не принимают их вместе с "*"
+		u, err := url.Parse(origin)
+		s.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "",
+			"CORS_ALLOWED_ORIGINS", "origin must look like https://example.com, got %q", origin)
+	}
+
+	config.QRConfig = QRConfig{
+		LogoPath:  s.str("QR_LOGO_PATH", ""),
+		CacheSize: int(s.int("QR_CACHE_SIZE", "512", 0)),
+	}
+	s.check(config.QRConfig.CacheSize >= 0, "QR_CACHE_SIZE", "must not be negative, got %d", config.QRConfig.CacheSize)
+
+	config.PreviewConfig = PreviewConfig{
+		Enabled:      s.bool("PREVIEW_ENABLED", "true"),
+		Workers:      int(s.int("PREVIEW_WORKERS", "2", 0)),
+		Timeout:      s.duration("PREVIEW_TIMEOUT", "5s"),
+		MaxBodyBytes: s.int("PREVIEW_MAX_BODY_BYTES", "1048576", 64),
+	}
+	s.check(config.PreviewConfig.Workers > 0, "PREVIEW_WORKERS", "must be positive, got %d", config.PreviewConfig.Workers)
+	s.check(config.PreviewConfig.Timeout > 0, "PREVIEW_TIMEOUT", "must be positive, got %s", config.PreviewConfig.Timeout)
+	s.check(config.PreviewConfig.MaxBodyBytes > 0, "PREVIEW_MAX_BODY_BYTES", "must be positive, got %d", config.PreviewConfig.MaxBodyBytes)
+
+	config.HealthConfig = HealthConfig{
+		Enabled:          s.bool("HEALTH_CHECK_ENABLED", "true"),
+		Interval:         s.duration("HEALTH_CHECK_INTERVAL", "5m"),
+		Concurrency:      int(s.int("HEALTH_CHECK_CONCURRENCY", "4", 0)),
+		HostDelay:        s.duration("HEALTH_CHECK_HOST_DELAY", "1s"),
+		Timeout:          s.duration("HEALTH_CHECK_TIMEOUT", "10s"),
+		FailureThreshold: int32(s.int("HEALTH_FAILURE_THRESHOLD", "3", 32)),
+	}
+	s.check(config.HealthConfig.Interval > 0, "HEALTH_CHECK_INTERVAL", "must be positive, got %s", config.HealthConfig.Interval)
+	s.check(config.HealthConfig.Concurrency > 0, "HEALTH_CHECK_CONCURRENCY", "must be positive, got %d", config.HealthConfig.Concurrency)
+	s.check(config.HealthConfig.Timeout > 0, "HEALTH_CHECK_TIMEOUT", "must be positive, got %s", config.HealthConfig.Timeout)
+	s.check(config.HealthConfig.FailureThreshold > 0, "HEALTH_FAILURE_THRESHOLD", "must be positive, got %d", config.HealthConfig.FailureThreshold)
+
+	config.VisitsConfig = VisitsConfig{
+		OnLinkDelete:    s.oneOf("VISITS_ON_LINK_DELETE", VisitsOnDeleteArchive, VisitsOnDeleteCascade, VisitsOnDeleteArchive),
+		OrphanBatchSize: int32(s.int("VISITS_ORPHAN_BATCH_SIZE", "1000", 32)),
+	}
+	s.check(config.VisitsConfig.OrphanBatchSize > 0, "VISITS_ORPHAN_BATCH_SIZE", "must be positive, got %d", config.VisitsConfig.OrphanBatchSize)
+
+	config.TrashConfig = TrashConfig{
+		Retention:     s.duration("TRASH_RETENTION", "720h"),
+		PurgeInterval: s.duration("TRASH_PURGE_INTERVAL", "1h"),
+	}
+	s.check(config.TrashConfig.Retention >= 0, "TRASH_RETENTION", "must not be negative, got %s", config.TrashConfig.Retention)
+	s.check(config.TrashConfig.PurgeInterval > 0, "TRASH_PURGE_INTERVAL", "must be positive, got %s", config.TrashConfig.PurgeInterval)
+
+	config.IdempotencyConfig = IdempotencyConfig{TTL: s.duration("IDEMPOTENCY_TTL", "24h")}
+	s.check(config.IdempotencyConfig.TTL > 0, "IDEMPOTENCY_TTL", "must be positive, got %s", config.IdempotencyConfig.TTL)
+
+	serverTimeouts := []struct {
+		env, def string
+		dst      *time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", "30s", &config.ServerConfig.ReadTimeout},
+		{"HTTP_READ_HEADER_TIMEOUT", "10s", &config.ServerConfig.ReadHeaderTimeout},
+		{"HTTP_WRITE_TIMEOUT", "60s", &config.ServerConfig.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", "120s", &config.ServerConfig.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", "30s", &config.ServerConfig.ShutdownTimeout},
+		{"SHUTDOWN_DRAIN_DELAY", "0s", &config.ServerConfig.DrainDelay},
+	}
+	for _, t := range serverTimeouts {
+		*t.dst = s.duration(t.env, t.def)
+		s.check(*t.dst >= 0, t.env, "must not be negative, got %s", *t.dst)
+	}
+	s.check(config.ServerConfig.ShutdownTimeout != 0, "SHUTDOWN_TIMEOUT", "must be positive")
+
+	config.MetricsConfig = MetricsConfig{
+		Enabled: s.bool("METRICS_ENABLED", "true"),
+		Path:    s.str("METRICS_PATH", "/metrics"),
+	}
+	s.check(strings.HasPrefix(config.MetricsConfig.Path, "/"), "METRICS_PATH", "must start with /, got %q", config.MetricsConfig.Path)
+
+	config.TracingConfig = TracingConfig{
+		Enabled:     s.bool("OTEL_TRACES_ENABLED", "false"),
+		Endpoint:    s.str("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", ""),
+		ServiceName: s.str("OTEL_SERVICE_NAME", "lshortener"),
+		SampleRatio: s.float("OTEL_TRACES_SAMPLE_RATIO", "1"),
+	}
+	s.check(config.TracingConfig.SampleRatio >= 0 && config.TracingConfig.SampleRatio <= 1,
+		"OTEL_TRACES_SAMPLE_RATIO", "must be between 0 and 1, got %v", config.TracingConfig.SampleRatio)
+	if endpoint := config.TracingConfig.Endpoint; endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			s.parseErr("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", err)
+		} else {
+			s.check(u.Scheme == "http" || u.Scheme == "https", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+				"scheme must be http or https, got %q", endpoint)
+		}
+	}
+
+	config.LogConfig = LogConfig{
+		IPs:          s.oneOf("LOG_IPS", LogIPTruncated, LogIPFull, LogIPTruncated, LogIPNone),
+		QueryStrings: s.bool("LOG_QUERY_STRINGS", "false"),
+	}
+	if err := config.LogConfig.Level.UnmarshalText([]byte(s.str("LOG_LEVEL", "info"))); err != nil {
+		s.parseErr("LOG_LEVEL", err)
+	}
+
+	config.ImportConfig = ImportConfig{
+		MaxSize:      s.int("IMPORT_MAX_SIZE", "10485760", 64),
+		PollInterval: s.duration("IMPORT_POLL_INTERVAL", "10s"),
+	}
+	s.check(config.ImportConfig.MaxSize > 0, "IMPORT_MAX_SIZE", "must be positive, got %d", config.ImportConfig.MaxSize)
+	s.check(config.ImportConfig.PollInterval > 0, "IMPORT_POLL_INTERVAL", "must be positive, got %s", config.ImportConfig.PollInterval)
+
+	config.APIKeysConfig = APIKeysConfig{Required: s.bool("API_KEYS_REQUIRED", "false")}
+
+	s.unknownKeys()
+	if err := s.err(); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
-// getEnv получает значение переменной окружения или значение по умолчанию
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// DSN собирает строку подключения из DB_HOST, DB_PORT, DB_NAME, DB_USER, DB_PASSWORD и DB_SSL_MODE.
+func (c DBConfig) DSN() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.DBUser, c.DBPassword),
+		Host:     net.JoinHostPort(c.DBHost, strconv.Itoa(c.DBPort)),
+		Path:     "/" + c.DBName,
+		RawQuery: url.Values{"sslmode": {c.DBSSLMode}}.Encode(),
+	}
+	if c.DBPassword == "" {
+		u.User = url.User(c.DBUser)
+	}
+	return u.String()
+}
+
+// NormalizeRedirectPrefix приводит префикс к виду "/r" без завершающего слеша.
+// Значения "" и "/" означают, что редиректы обслуживаются с корня.
+func NormalizeRedirectPrefix(prefix string) string {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return ""
 	}
-	return value
+	return "/" + prefix
 }
 
-func SetCORSConfig(env string) cors.Config {
+// SetCORSConfig разрешает запросы с origins. В production разрешены только нужные API методы и заголовки.
+func SetCORSConfig(env string, origins []string) cors.Config {
 	if env == "production" {
 		return cors.Config{
-			AllowOrigins:     []string{"https://go-project-278.onrender.com"},
+			AllowOrigins:     origins,
 			AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-			AllowHeaders:     []string{"Origin", "Content-Length", "Content-Range", "Content-Type", "Authorization", "Accept", "Range"},
-			ExposeHeaders:    []string{"Content-Range"},
+			AllowHeaders:     []string{"Origin", "Content-Length", "Content-Range", "Content-Type", "Authorization", "Accept", "Range", "X-Actor", "If-Match", "Idempotency-Key", "X-Request-ID"},
+			ExposeHeaders:    []string{"Content-Range", "ETag", "Idempotent-Replayed", "Location", "Content-Disposition", "X-Export-Last-ID", "X-Export-Error", "X-Request-ID"},
 			AllowCredentials: true,
 			MaxAge:           12 * time.Hour,
 		}
 	}
 	return cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173"},
+		AllowOrigins:     origins,
 		AllowMethods:     []string{"*"},
 		AllowHeaders:     []string{"*"},
 		AllowCredentials: true,
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidConfig оборачивает список всех неверных настроек, найденных при загрузке.
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// source отдаёт настройки по имени переменной окружения: сначала окружение, затем файл,
+// затем значение по умолчанию. Ошибки разбора копятся, чтобы сообщить обо всех сразу.
+type source struct {
+	file map[string]string
+	used map[string]bool
+	// failed - настройки с ошибкой: проверки их значений уже не нужны
+	failed map[string]bool
+	errs   []error
+}
+
+// loadFile читает YAML или TOML. Вложенные ключи склеиваются через "_" и приводятся
+// к верхнему регистру: db: {max_conns: 20} равносильно DB_MAX_CONNS=20. Списки склеиваются через запятую.
+func loadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	out := map[string]string{}
+	flatten("", raw, out)
+	return out, nil
+}
+
+func flatten(prefix string, m map[string]any, out map[string]string) {
+	for k, v := range m {
+		key := strings.ToUpper(k)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(key, v, out)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func (s *source) str(key, def string) string {
+	s.used[key] = true
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	if v := s.file[key]; v != "" {
+		return v
+	}
+	return def
+}
+
+func (s *source) fail(key, format string, args ...any) {
+	s.failed[key] = true
+	s.errs = append(s.errs, fmt.Errorf("parse %s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (s *source) parseErr(key string, err error) {
+	s.failed[key] = true
+	s.errs = append(s.errs, fmt.Errorf("parse %s: %w", key, err))
+}
+
+// check добавляет ошибку, если условие не выполнено и значение удалось разобрать.
+func (s *source) check(ok bool, key, format string, args ...any) {
+	if !ok && !s.failed[key] {
+		s.fail(key, format, args...)
+	}
+}
+
+func (s *source) int(key, def string, bits int) int64 {
+	v, err := strconv.ParseInt(s.str(key, def), 10, bits)
+	if err != nil {
+		s.parseErr(key, err)
+	}
+	return v
+}
+
+func (s *source) bool(key, def string) bool {
+	v, err := strconv.ParseBool(s.str(key, def))
+	if err != nil {
+		s.parseErr(key, err)
+	}
+	return v
+}
+
+func (s *source) float(key, def string) float64 {
+	v, err := strconv.ParseFloat(s.str(key, def), 64)
+	if err != nil {
+		s.parseErr(key, err)
+	}
+	return v
+}
+
+func (s *source) duration(key, def string) time.Duration {
+	v, err := time.ParseDuration(s.str(key, def))
+	if err != nil {
+		s.parseErr(key, err)
+	}
+	return v
+}
+
+// list разбирает значение через запятую, пустые элементы отбрасываются.
+func (s *source) list(key, def string) []string {
+	var out []string
+	for item := range strings.SplitSeq(s.str(key, def), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// oneOf проверяет, что значение входит в allowed.
+func (s *source) oneOf(key, def string, allowed ...string) string {
+	v := s.str(key, def)
+	for _, a := range allowed {
+		if v == a {
+			return v
+		}
+	}
+	s.fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), v)
+	return v
+}
+
+// unknownKeys сообщает о ключах файла, которые не соответствуют ни одной настройке: чаще всего это опечатка.
+func (s *source) unknownKeys() {
+	var unknown []string
+	for key := range s.file {
+		if !s.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		s.errs = append(s.errs, fmt.Errorf("config file: unknown setting %s", key))
+	}
+}
+
+func (s *source) err() error {
+	if len(s.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w:\n%w", ErrInvalidConfig, errors.Join(s.errs...))
+}
@@ -0,0 +1,91 @@
+package postgres_db
+
+import (
+	"bytes"
+	"code/internal/backup"
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// savepointDB открывает "транзакции" бэкапа и восстановления точками сохранения внутри
+// транзакции теста, чтобы всё откатилось вместе с ней.
+type savepointDB struct {
+	tx pgx.Tx
+}
+
+func (db savepointDB) BeginTx(ctx context.Context, _ pgx.TxOptions) (pgx.Tx, error) {
+	return db.tx.Begin(ctx)
+}
+
+func countVisits(t *testing.T, ctx context.Context, tx pgx.Tx, linkID int64) int {
+	t.Helper()
+	var n int
+	require.NoError(t, tx.QueryRow(ctx, `SELECT COUNT(*) FROM visits WHERE link_id = $1`, linkID).Scan(&n))
+	return n
+}
+
+func tableResult(t *testing.T, result *backup.RestoreResult, table string) backup.TableResult {
+	t.Helper()
+	for _, tr := range result.Tables {
+		if tr.Table == table {
+			return tr
+		}
+	}
+	t.Fatalf("no result for table %s", table)
+	return backup.TableResult{}
+}
+
+// Восстановление в заполненную БД: совпавшие ссылки не дублируются,
+// а недостающие посещения и ревизии переносятся на них.
+func Test_RestoreIntoNonEmptyDatabase(t *testing.T) {
+	for _, policy := range []backup.ConflictPolicy{backup.OnConflictSkip, backup.OnConflictRename} {
+		t.Run(string(policy), func(t *testing.T) {
+			withTx(t, func(ctx context.Context, q *Queries) {
+				tx := q.db.(pgx.Tx)
+				db := savepointDB{tx: tx}
+				links, err := CreateTestLinks(t, ctx, q)
+				require.NoError(t, err)
+				id := links[0].ID
+				_, err = tx.Exec(ctx, `INSERT INTO visits (link_id, ip, user_agent, status)
+					VALUES ($1, '10.0.0.1', 'test', 302), ($1, '10.0.0.2', 'test', 302)`, id)
+				require.NoError(t, err)
+
+				var archive bytes.Buffer
+				_, err = backup.Backup(ctx, db, &archive)
+				require.NoError(t, err)
+
+				// После бэкапа одно посещение и одна ревизия пропали
+				_, err = tx.Exec(ctx, `DELETE FROM visits WHERE id = (SELECT MIN(id) FROM visits WHERE link_id = $1)`, id)
+				require.NoError(t, err)
+				_, err = tx.Exec(ctx, `DELETE FROM link_revisions WHERE link_id = $1`, links[1].ID)
+				require.NoError(t, err)
+
+				result, err := backup.Restore(ctx, db, bytes.NewReader(archive.Bytes()), policy)
+				require.NoError(t, err)
+
+				linksResult := tableResult(t, result, "links")
+				assert.Equal(t, int64(3), linksResult.Skipped)
+				assert.Zero(t, linksResult.Inserted+linksResult.Renamed)
+
+				visitsResult := tableResult(t, result, "visits")
+				assert.Equal(t, int64(1), visitsResult.Inserted)
+				assert.Equal(t, int64(1), visitsResult.Skipped)
+				assert.Zero(t, visitsResult.Renamed)
+				assert.Equal(t, 2, countVisits(t, ctx, tx, id))
+
+				revisions, err := q.GetLinkRevisions(ctx, links[1].ID)
+				require.NoError(t, err)
+				assert.Len(t, revisions, 1)
+				assert.Equal(t, int64(1), tableResult(t, result, "link_revisions").Inserted)
+
+				total, err := q.GetTotalLinks(ctx, GetTotalLinksParams{})
+				require.NoError(t, err)
+				assert.Equal(t, int64(3), total)
+			})
+		})
+	}
+}
@@ -20,8 +20,6 @@ import (
 	"github.com/testcontainers/testcontainers-go/wait"
 )
 
-const BASE_URL = "http://localhost:8080"
-
 var (
 	pool *pgxpool.Pool
 )
@@ -119,21 +117,18 @@ func withTx(t *testing.T, fn func(ctx context.Context, q *Queries)) {
 	fn(ctx, qtx)
 }
 
-func CreateTestLinks(t *testing.T, ctx context.Context, q *Queries, baseURL string) ([]*CreateLinkRow, error) {
+func CreateTestLinks(t *testing.T, ctx context.Context, q *Queries) ([]*CreateLinkRow, error) {
 	t.Helper()
 	params := []CreateLinkParams{
 		{
 			OriginalUrl: "https://example1.net/very-very-long-short-name?with=queries",
-			ShortName:   "test-short1",
-			ShortUrl:    baseURL + "/test-short1"},
+			ShortName:   "test-short1"},
 		{
 			OriginalUrl: "https://example2.net/very-very-long-short-name?with=queries",
-			ShortName:   "test-short2",
-			ShortUrl:    baseURL + "/test-short2"},
+			ShortName:   "test-short2"},
 		{
 			OriginalUrl: "https://example3.net/very-very-long-short-name?with=queries",
-			ShortName:   "test-short3",
-			ShortUrl:    baseURL + "/test-short3"},
+			ShortName:   "test-short3"},
 	}
 	links := make([]*CreateLinkRow, 0, len(params))
 	for _, v := range params {
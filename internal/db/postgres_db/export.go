@@ -0,0 +1,103 @@
+package postgres_db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Запросы выгрузки написаны вручную, а не в queries/links.sql: sqlc :many собирает все строки в срез,
+// а выгрузке нужен поток. pgx читает строки из соединения по мере rows.Next.
+
+// Exporter отдаёт ссылки потоком по возрастанию id.
+type Exporter interface {
+	ExportLinks(ctx context.Context, arg ExportLinksParams, fn func(row ExportLinksRow) error) error
+}
+
+var _ Exporter = (*Queries)(nil)
+
+const exportLinks = `-- name: ExportLinks
+SELECT id, original_url, short_name, title, description, og_title, og_description, og_image,
+    health_status, created_at, deleted_at, revision
+FROM links
+WHERE ($1::text IS NULL OR health_status = $1)
+    AND ($2::text IS NULL
+        OR original_url ILIKE '%' || $2 || '%'
+        OR short_name ILIKE '%' || $2 || '%'
+        OR title ILIKE '%' || $2 || '%')
+    AND ($3::bigint[] IS NULL OR id = ANY($3::bigint[]))
+    AND ($4::text IS NULL OR short_name = $4)
+    AND ($5::timestamptz IS NULL OR created_at >= $5)
+    AND ($6::timestamptz IS NULL OR created_at <= $6)
+    AND (deleted_at IS NOT NULL) = $7::boolean
+    AND id > $8
+ORDER BY id
+`
+
+// ExportLinksParams - фильтры как у GetTotalLinks. AfterID продолжает прерванную выгрузку.
+type ExportLinksParams struct {
+	Health      pgtype.Text        `json:"health"`
+	Query       pgtype.Text        `json:"query"`
+	Ids         []int64            `json:"ids"`
+	ShortName   pgtype.Text        `json:"short_name"`
+	CreatedFrom pgtype.Timestamptz `json:"created_from"`
+	CreatedTo   pgtype.Timestamptz `json:"created_to"`
+	Deleted     bool               `json:"deleted"`
+	AfterID     int64              `json:"after_id"`
+}
+
+type ExportLinksRow struct {
+	ID            int64              `json:"id"`
+	OriginalUrl   string             `json:"original_url"`
+	ShortName     string             `json:"short_name"`
+	Title         pgtype.Text        `json:"title"`
+	Description   pgtype.Text        `json:"description"`
+	OgTitle       pgtype.Text        `json:"og_title"`
+	OgDescription pgtype.Text        `json:"og_description"`
+	OgImage       pgtype.Text        `json:"og_image"`
+	HealthStatus  string             `json:"health_status"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	DeletedAt     pgtype.Timestamptz `json:"deleted_at"`
+	Revision      int32              `json:"revision"`
+}
+
+// ExportLinks вызывает fn для каждой строки. Ошибка fn прерывает выгрузку и возвращается как есть.
+func (q *Queries) ExportLinks(ctx context.Context, arg ExportLinksParams, fn func(row ExportLinksRow) error) error {
+	rows, err := q.db.Query(ctx, exportLinks,
+		arg.Health,
+		arg.Query,
+		arg.Ids,
+		arg.ShortName,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Deleted,
+		arg.AfterID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i ExportLinksRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.OriginalUrl,
+			&i.ShortName,
+			&i.Title,
+			&i.Description,
+			&i.OgTitle,
+			&i.OgDescription,
+			&i.OgImage,
+			&i.HealthStatus,
+			&i.CreatedAt,
+			&i.DeletedAt,
+			&i.Revision,
+		); err != nil {
+			return err
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
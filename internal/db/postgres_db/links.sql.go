@@ -7,65 +7,419 @@ package postgres_db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const createLink = `-- name: CreateLink :one
-INSERT INTO links(original_url, short_name, short_url)
+const claimIdempotencyKey = `-- name: ClaimIdempotencyKey :execrows
+INSERT INTO idempotency_keys (key, fingerprint, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (key) DO UPDATE
+SET fingerprint = EXCLUDED.fingerprint,
+    status_code = NULL,
+    content_type = NULL,
+    response = NULL,
+    created_at = NOW(),
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at < NOW()
+`
+
+type ClaimIdempotencyKeyParams struct {
+	Key         string             `json:"key"`
+	Fingerprint string             `json:"fingerprint"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+}
+
+// Занимает ключ. Просроченный ключ можно занять заново, 0 строк - ключ уже используется.
+func (q *Queries) ClaimIdempotencyKey(ctx context.Context, arg ClaimIdempotencyKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, claimIdempotencyKey, arg.Key, arg.Fingerprint, arg.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const claimImportJob = `-- name: ClaimImportJob :one
+UPDATE import_jobs
+SET status = 'running', started_at = NOW(), updated_at = NOW()
+WHERE id = (
+    SELECT id FROM import_jobs
+    WHERE status = 'pending'
+    ORDER BY id
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, format, dry_run, status, actor, mapping, payload, total_rows, processed_rows, created_rows, failed_rows, errors, error, created_at, started_at, updated_at, finished_at
+`
+
+// Берёт самую старую задачу из очереди. Другие экземпляры сервиса её пропустят.
+func (q *Queries) ClaimImportJob(ctx context.Context) (ImportJob, error) {
+	row := q.db.QueryRow(ctx, claimImportJob)
+	var i ImportJob
+	err := row.Scan(
+		&i.ID,
+		&i.Format,
+		&i.DryRun,
+		&i.Status,
+		&i.Actor,
+		&i.Mapping,
+		&i.Payload,
+		&i.TotalRows,
+		&i.ProcessedRows,
+		&i.CreatedRows,
+		&i.FailedRows,
+		&i.Errors,
+		&i.Error,
+		&i.CreatedAt,
+		&i.StartedAt,
+		&i.UpdatedAt,
+		&i.FinishedAt,
+	)
+	return i, err
+}
+
+const createAPIKey = `-- name: CreateAPIKey :one
+INSERT INTO api_keys (name, prefix, key_hash)
 VALUES ($1, $2, $3)
-RETURNING id, original_url, short_name, short_url
+RETURNING id, name, prefix, key_hash, created_at, revoked_at
+`
+
+type CreateAPIKeyParams struct {
+	Name    string `json:"name"`
+	Prefix  string `json:"prefix"`
+	KeyHash string `json:"key_hash"`
+}
+
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, createAPIKey, arg.Name, arg.Prefix, arg.KeyHash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const createImportJob = `-- name: CreateImportJob :one
+INSERT INTO import_jobs (format, dry_run, actor, mapping, payload)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id
+`
+
+type CreateImportJobParams struct {
+	Format  string `json:"format"`
+	DryRun  bool   `json:"dry_run"`
+	Actor   string `json:"actor"`
+	Mapping []byte `json:"mapping"`
+	Payload []byte `json:"payload"`
+}
+
+func (q *Queries) CreateImportJob(ctx context.Context, arg CreateImportJobParams) (int64, error) {
+	row := q.db.QueryRow(ctx, createImportJob,
+		arg.Format,
+		arg.DryRun,
+		arg.Actor,
+		arg.Mapping,
+		arg.Payload,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createLink = `-- name: CreateLink :one
+WITH created AS (
+    INSERT INTO links (original_url, short_name)
+    VALUES ($1, $2)
+    RETURNING id, original_url, short_name, revision
+), rev AS (
+    INSERT INTO link_revisions (link_id, revision, action, new_original_url, new_short_name, actor)
+    SELECT id, revision, 'create', original_url, short_name, $3 FROM created
+)
+SELECT id, original_url, short_name FROM created
 `
 
 type CreateLinkParams struct {
 	OriginalUrl string `json:"original_url"`
 	ShortName   string `json:"short_name"`
-	ShortUrl    string `json:"short_url"`
+	Actor       string `json:"actor"`
 }
 
 type CreateLinkRow struct {
 	ID          int64  `json:"id"`
 	OriginalUrl string `json:"original_url"`
 	ShortName   string `json:"short_name"`
-	ShortUrl    string `json:"short_url"`
 }
 
 func (q *Queries) CreateLink(ctx context.Context, arg CreateLinkParams) (CreateLinkRow, error) {
-	row := q.db.QueryRow(ctx, createLink, arg.OriginalUrl, arg.ShortName, arg.ShortUrl)
+	row := q.db.QueryRow(ctx, createLink, arg.OriginalUrl, arg.ShortName, arg.Actor)
 	var i CreateLinkRow
-	err := row.Scan(
-		&i.ID,
-		&i.OriginalUrl,
-		&i.ShortName,
-		&i.ShortUrl,
+	err := row.Scan(&i.ID, &i.OriginalUrl, &i.ShortName)
+	return i, err
+}
+
+const createLinkCheck = `-- name: CreateLinkCheck :exec
+INSERT INTO link_checks (link_id, ok, status_code, latency_ms, redirect_chain, error)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type CreateLinkCheckParams struct {
+	LinkID        int64       `json:"link_id"`
+	Ok            bool        `json:"ok"`
+	StatusCode    pgtype.Int4 `json:"status_code"`
+	LatencyMs     int32       `json:"latency_ms"`
+	RedirectChain []string    `json:"redirect_chain"`
+	Error         pgtype.Text `json:"error"`
+}
+
+func (q *Queries) CreateLinkCheck(ctx context.Context, arg CreateLinkCheckParams) error {
+	_, err := q.db.Exec(ctx, createLinkCheck,
+		arg.LinkID,
+		arg.Ok,
+		arg.StatusCode,
+		arg.LatencyMs,
+		arg.RedirectChain,
+		arg.Error,
 	)
+	return err
+}
+
+const deleteExpiredIdempotencyKeys = `-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredIdempotencyKeys)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteLinkByID = `-- name: DeleteLinkByID :one
+WITH removed AS (
+    DELETE FROM visits
+    WHERE link_id = $1 AND EXISTS (SELECT 1 FROM links WHERE id = $1)
+    RETURNING id
+), deleted AS (
+    DELETE FROM links WHERE id = $1 RETURNING id
+), checks AS (
+    DELETE FROM link_checks WHERE link_id = $1
+), revisions AS (
+    DELETE FROM link_revisions WHERE link_id = $1
+)
+SELECT
+    (SELECT COUNT(*) FROM deleted) AS links_deleted,
+    (SELECT COUNT(*) FROM removed) AS visits_deleted
+`
+
+type DeleteLinkByIDRow struct {
+	LinksDeleted  int64 `json:"links_deleted"`
+	VisitsDeleted int64 `json:"visits_deleted"`
+}
+
+func (q *Queries) DeleteLinkByID(ctx context.Context, id int64) (DeleteLinkByIDRow, error) {
+	row := q.db.QueryRow(ctx, deleteLinkByID, id)
+	var i DeleteLinkByIDRow
+	err := row.Scan(&i.LinksDeleted, &i.VisitsDeleted)
+	return i, err
+}
+
+const deleteLinkByIDArchivingVisits = `-- name: DeleteLinkByIDArchivingVisits :one
+WITH moved AS (
+    DELETE FROM visits
+    WHERE link_id = $1 AND EXISTS (SELECT 1 FROM links WHERE id = $1)
+    RETURNING id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision
+), archived AS (
+    INSERT INTO visits_archive (id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision, reason)
+    SELECT id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision, 'link_deleted'
+    FROM moved
+    RETURNING id
+), deleted AS (
+    DELETE FROM links WHERE id = $1 RETURNING id
+), checks AS (
+    DELETE FROM link_checks WHERE link_id = $1
+), revisions AS (
+    DELETE FROM link_revisions WHERE link_id = $1
+)
+SELECT
+    (SELECT COUNT(*) FROM deleted) AS links_deleted,
+    (SELECT COUNT(*) FROM archived) AS visits_archived
+`
+
+type DeleteLinkByIDArchivingVisitsRow struct {
+	LinksDeleted   int64 `json:"links_deleted"`
+	VisitsArchived int64 `json:"visits_archived"`
+}
+
+func (q *Queries) DeleteLinkByIDArchivingVisits(ctx context.Context, id int64) (DeleteLinkByIDArchivingVisitsRow, error) {
+	row := q.db.QueryRow(ctx, deleteLinkByIDArchivingVisits, id)
+	var i DeleteLinkByIDArchivingVisitsRow
+	err := row.Scan(&i.LinksDeleted, &i.VisitsArchived)
 	return i, err
 }
 
-const deleteLinkByID = `-- name: DeleteLinkByID :execrows
-DELETE FROM links WHERE id = $1
+const failStaleImportJobs = `-- name: FailStaleImportJobs :execrows
+UPDATE import_jobs
+SET status = 'failed', error = 'import was interrupted', payload = NULL, finished_at = NOW()
+WHERE status = 'running' AND updated_at < $1
 `
 
-func (q *Queries) DeleteLinkByID(ctx context.Context, id int64) (int64, error) {
-	result, err := q.db.Exec(ctx, deleteLinkByID, id)
+// Задачи, которые давно не обновляли прогресс: экземпляр сервиса остановился посреди импорта.
+// Повторять их нельзя, часть ссылок уже создана.
+func (q *Queries) FailStaleImportJobs(ctx context.Context, updatedAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, failStaleImportJobs, updatedAt)
 	if err != nil {
 		return 0, err
 	}
 	return result.RowsAffected(), nil
 }
 
+const finishImportJob = `-- name: FinishImportJob :exec
+UPDATE import_jobs
+SET status = $2, error = $3, payload = NULL, updated_at = NOW(), finished_at = NOW()
+WHERE id = $1
+`
+
+type FinishImportJobParams struct {
+	ID     int64       `json:"id"`
+	Status string      `json:"status"`
+	Error  pgtype.Text `json:"error"`
+}
+
+func (q *Queries) FinishImportJob(ctx context.Context, arg FinishImportJobParams) error {
+	_, err := q.db.Exec(ctx, finishImportJob, arg.ID, arg.Status, arg.Error)
+	return err
+}
+
+const getActiveAPIKeyByHash = `-- name: GetActiveAPIKeyByHash :one
+SELECT id, name, prefix, key_hash, created_at, revoked_at
+FROM api_keys
+WHERE key_hash = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) GetActiveAPIKeyByHash(ctx context.Context, keyHash string) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, getActiveAPIKeyByHash, keyHash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.KeyHash,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getIdempotencyKey = `-- name: GetIdempotencyKey :one
+SELECT key, fingerprint, status_code, content_type, response, created_at, expires_at
+FROM idempotency_keys
+WHERE key = $1
+`
+
+func (q *Queries) GetIdempotencyKey(ctx context.Context, key string) (IdempotencyKey, error) {
+	row := q.db.QueryRow(ctx, getIdempotencyKey, key)
+	var i IdempotencyKey
+	err := row.Scan(
+		&i.Key,
+		&i.Fingerprint,
+		&i.StatusCode,
+		&i.ContentType,
+		&i.Response,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getImportJob = `-- name: GetImportJob :one
+SELECT id, format, dry_run, status, actor, mapping, total_rows, processed_rows, created_rows, failed_rows, errors, error, created_at, started_at, updated_at, finished_at
+FROM import_jobs
+WHERE id = $1
+`
+
+type GetImportJobRow struct {
+	ID            int64              `json:"id"`
+	Format        string             `json:"format"`
+	DryRun        bool               `json:"dry_run"`
+	Status        string             `json:"status"`
+	Actor         string             `json:"actor"`
+	Mapping       []byte             `json:"mapping"`
+	TotalRows     int32              `json:"total_rows"`
+	ProcessedRows int32              `json:"processed_rows"`
+	CreatedRows   int32              `json:"created_rows"`
+	FailedRows    int32              `json:"failed_rows"`
+	Errors        []byte             `json:"errors"`
+	Error         pgtype.Text        `json:"error"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	StartedAt     pgtype.Timestamptz `json:"started_at"`
+	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+	FinishedAt    pgtype.Timestamptz `json:"finished_at"`
+}
+
+func (q *Queries) GetImportJob(ctx context.Context, id int64) (GetImportJobRow, error) {
+	row := q.db.QueryRow(ctx, getImportJob, id)
+	var i GetImportJobRow
+	err := row.Scan(
+		&i.ID,
+		&i.Format,
+		&i.DryRun,
+		&i.Status,
+		&i.Actor,
+		&i.Mapping,
+		&i.TotalRows,
+		&i.ProcessedRows,
+		&i.CreatedRows,
+		&i.FailedRows,
+		&i.Errors,
+		&i.Error,
+		&i.CreatedAt,
+		&i.StartedAt,
+		&i.UpdatedAt,
+		&i.FinishedAt,
+	)
+	return i, err
+}
+
 const getLinkByID = `-- name: GetLinkByID :one
 SELECT
     id,
     original_url,
     short_name,
-    short_url
+    title,
+    description,
+    favicon_url,
+    og_image_url,
+    og_title,
+    og_description,
+    og_image,
+    health_status,
+    created_at,
+    deleted_at,
+    revision
 FROM links WHERE id = $1
 `
 
 type GetLinkByIDRow struct {
-	ID          int64  `json:"id"`
-	OriginalUrl string `json:"original_url"`
-	ShortName   string `json:"short_name"`
-	ShortUrl    string `json:"short_url"`
+	ID            int64              `json:"id"`
+	OriginalUrl   string             `json:"original_url"`
+	ShortName     string             `json:"short_name"`
+	Title         pgtype.Text        `json:"title"`
+	Description   pgtype.Text        `json:"description"`
+	FaviconUrl    pgtype.Text        `json:"favicon_url"`
+	OgImageUrl    pgtype.Text        `json:"og_image_url"`
+	OgTitle       pgtype.Text        `json:"og_title"`
+	OgDescription pgtype.Text        `json:"og_description"`
+	OgImage       pgtype.Text        `json:"og_image"`
+	HealthStatus  string             `json:"health_status"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	DeletedAt     pgtype.Timestamptz `json:"deleted_at"`
+	Revision      int32              `json:"revision"`
 }
 
 func (q *Queries) GetLinkByID(ctx context.Context, id int64) (GetLinkByIDRow, error) {
@@ -75,36 +429,274 @@ func (q *Queries) GetLinkByID(ctx context.Context, id int64) (GetLinkByIDRow, er
 		&i.ID,
 		&i.OriginalUrl,
 		&i.ShortName,
-		&i.ShortUrl,
+		&i.Title,
+		&i.Description,
+		&i.FaviconUrl,
+		&i.OgImageUrl,
+		&i.OgTitle,
+		&i.OgDescription,
+		&i.OgImage,
+		&i.HealthStatus,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Revision,
+	)
+	return i, err
+}
+
+const getLinkChecks = `-- name: GetLinkChecks :many
+SELECT id, checked_at, ok, status_code, latency_ms, redirect_chain, error
+FROM link_checks
+WHERE link_id = $1
+ORDER BY checked_at DESC, id DESC
+LIMIT $2
+`
+
+type GetLinkChecksParams struct {
+	LinkID int64 `json:"link_id"`
+	Limit  int32 `json:"limit"`
+}
+
+type GetLinkChecksRow struct {
+	ID            int64              `json:"id"`
+	CheckedAt     pgtype.Timestamptz `json:"checked_at"`
+	Ok            bool               `json:"ok"`
+	StatusCode    pgtype.Int4        `json:"status_code"`
+	LatencyMs     int32              `json:"latency_ms"`
+	RedirectChain []string           `json:"redirect_chain"`
+	Error         pgtype.Text        `json:"error"`
+}
+
+func (q *Queries) GetLinkChecks(ctx context.Context, arg GetLinkChecksParams) ([]GetLinkChecksRow, error) {
+	rows, err := q.db.Query(ctx, getLinkChecks, arg.LinkID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetLinkChecksRow
+	for rows.Next() {
+		var i GetLinkChecksRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CheckedAt,
+			&i.Ok,
+			&i.StatusCode,
+			&i.LatencyMs,
+			&i.RedirectChain,
+			&i.Error,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLinkHealth = `-- name: GetLinkHealth :one
+SELECT health_status, consecutive_failures, last_checked_at FROM links WHERE id = $1
+`
+
+type GetLinkHealthRow struct {
+	HealthStatus        string             `json:"health_status"`
+	ConsecutiveFailures int32              `json:"consecutive_failures"`
+	LastCheckedAt       pgtype.Timestamptz `json:"last_checked_at"`
+}
+
+func (q *Queries) GetLinkHealth(ctx context.Context, id int64) (GetLinkHealthRow, error) {
+	row := q.db.QueryRow(ctx, getLinkHealth, id)
+	var i GetLinkHealthRow
+	err := row.Scan(&i.HealthStatus, &i.ConsecutiveFailures, &i.LastCheckedAt)
+	return i, err
+}
+
+const getLinkRevision = `-- name: GetLinkRevision :one
+SELECT
+    id,
+    link_id,
+    revision,
+    action,
+    old_original_url,
+    old_short_name,
+    new_original_url,
+    new_short_name,
+    actor,
+    created_at
+FROM link_revisions
+WHERE link_id = $1 AND revision = $2
+`
+
+type GetLinkRevisionParams struct {
+	LinkID   int64 `json:"link_id"`
+	Revision int32 `json:"revision"`
+}
+
+func (q *Queries) GetLinkRevision(ctx context.Context, arg GetLinkRevisionParams) (LinkRevision, error) {
+	row := q.db.QueryRow(ctx, getLinkRevision, arg.LinkID, arg.Revision)
+	var i LinkRevision
+	err := row.Scan(
+		&i.ID,
+		&i.LinkID,
+		&i.Revision,
+		&i.Action,
+		&i.OldOriginalUrl,
+		&i.OldShortName,
+		&i.NewOriginalUrl,
+		&i.NewShortName,
+		&i.Actor,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
+const getLinkRevisions = `-- name: GetLinkRevisions :many
+SELECT
+    id,
+    link_id,
+    revision,
+    action,
+    old_original_url,
+    old_short_name,
+    new_original_url,
+    new_short_name,
+    actor,
+    created_at
+FROM link_revisions
+WHERE link_id = $1
+ORDER BY revision DESC
+`
+
+func (q *Queries) GetLinkRevisions(ctx context.Context, linkID int64) ([]LinkRevision, error) {
+	rows, err := q.db.Query(ctx, getLinkRevisions, linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LinkRevision
+	for rows.Next() {
+		var i LinkRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.LinkID,
+			&i.Revision,
+			&i.Action,
+			&i.OldOriginalUrl,
+			&i.OldShortName,
+			&i.NewOriginalUrl,
+			&i.NewShortName,
+			&i.Actor,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getLinks = `-- name: GetLinks :many
 SELECT
     id,
     original_url,
     short_name,
-    short_url
+    title,
+    description,
+    favicon_url,
+    og_image_url,
+    og_title,
+    og_description,
+    og_image,
+    health_status,
+    created_at,
+    deleted_at,
+    revision
 FROM links
-ORDER BY id
-LIMIT $1 OFFSET $2
+WHERE ($1::text IS NULL OR health_status = $1)
+    AND ($2::text IS NULL
+        OR original_url ILIKE '%' || $2 || '%'
+        OR short_name ILIKE '%' || $2 || '%'
+        OR title ILIKE '%' || $2 || '%')
+    AND ($3::bigint[] IS NULL OR id = ANY($3::bigint[]))
+    AND ($4::text IS NULL OR short_name = $4)
+    AND ($5::timestamptz IS NULL OR created_at >= $5)
+    AND ($6::timestamptz IS NULL OR created_at <= $6)
+    AND (deleted_at IS NOT NULL) = $7::boolean
+ORDER BY
+    CASE WHEN NOT $8::boolean THEN
+        CASE $9::text
+            WHEN 'original_url' THEN original_url
+            WHEN 'short_name' THEN short_name
+            WHEN 'title' THEN title
+            WHEN 'health_status' THEN health_status
+        END
+    END ASC,
+    CASE WHEN $8::boolean THEN
+        CASE $9::text
+            WHEN 'original_url' THEN original_url
+            WHEN 'short_name' THEN short_name
+            WHEN 'title' THEN title
+            WHEN 'health_status' THEN health_status
+        END
+    END DESC,
+    CASE WHEN $9::text = 'created_at' AND NOT $8::boolean THEN created_at END ASC,
+    CASE WHEN $9::text = 'created_at' AND $8::boolean THEN created_at END DESC,
+    CASE WHEN $9::text = 'deleted_at' AND NOT $8::boolean THEN deleted_at END ASC,
+    CASE WHEN $9::text = 'deleted_at' AND $8::boolean THEN deleted_at END DESC,
+    CASE WHEN NOT $8::boolean THEN id END ASC,
+    CASE WHEN $8::boolean THEN id END DESC
+LIMIT $10 OFFSET $11
 `
 
 type GetLinksParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+	Health      pgtype.Text        `json:"health"`
+	Query       pgtype.Text        `json:"query"`
+	Ids         []int64            `json:"ids"`
+	ShortName   pgtype.Text        `json:"short_name"`
+	CreatedFrom pgtype.Timestamptz `json:"created_from"`
+	CreatedTo   pgtype.Timestamptz `json:"created_to"`
+	Deleted     bool               `json:"deleted"`
+	SortDesc    bool               `json:"sort_desc"`
+	SortField   string             `json:"sort_field"`
+	Limit       int32              `json:"limit"`
+	Offset      int32              `json:"offset"`
 }
 
 type GetLinksRow struct {
-	ID          int64  `json:"id"`
-	OriginalUrl string `json:"original_url"`
-	ShortName   string `json:"short_name"`
-	ShortUrl    string `json:"short_url"`
+	ID            int64              `json:"id"`
+	OriginalUrl   string             `json:"original_url"`
+	ShortName     string             `json:"short_name"`
+	Title         pgtype.Text        `json:"title"`
+	Description   pgtype.Text        `json:"description"`
+	FaviconUrl    pgtype.Text        `json:"favicon_url"`
+	OgImageUrl    pgtype.Text        `json:"og_image_url"`
+	OgTitle       pgtype.Text        `json:"og_title"`
+	OgDescription pgtype.Text        `json:"og_description"`
+	OgImage       pgtype.Text        `json:"og_image"`
+	HealthStatus  string             `json:"health_status"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	DeletedAt     pgtype.Timestamptz `json:"deleted_at"`
+	Revision      int32              `json:"revision"`
 }
 
 func (q *Queries) GetLinks(ctx context.Context, arg GetLinksParams) ([]GetLinksRow, error) {
-	rows, err := q.db.Query(ctx, getLinks, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, getLinks,
+		arg.Health,
+		arg.Query,
+		arg.Ids,
+		arg.ShortName,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Deleted,
+		arg.SortDesc,
+		arg.SortField,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -116,7 +708,17 @@ func (q *Queries) GetLinks(ctx context.Context, arg GetLinksParams) ([]GetLinksR
 			&i.ID,
 			&i.OriginalUrl,
 			&i.ShortName,
-			&i.ShortUrl,
+			&i.Title,
+			&i.Description,
+			&i.FaviconUrl,
+			&i.OgImageUrl,
+			&i.OgTitle,
+			&i.OgDescription,
+			&i.OgImage,
+			&i.HealthStatus,
+			&i.CreatedAt,
+			&i.DeletedAt,
+			&i.Revision,
 		); err != nil {
 			return nil, err
 		}
@@ -128,67 +730,474 @@ func (q *Queries) GetLinks(ctx context.Context, arg GetLinksParams) ([]GetLinksR
 	return items, nil
 }
 
-const getOriginalURLByShortName = `-- name: GetOriginalURLByShortName :one
-SELECT id, original_url FROM links WHERE short_name = $1
+const getLinksForHealthCheck = `-- name: GetLinksForHealthCheck :many
+SELECT id, original_url FROM links
+WHERE deleted_at IS NULL
+    AND (last_checked_at IS NULL OR last_checked_at < $1)
+ORDER BY last_checked_at NULLS FIRST, id
+LIMIT $2
 `
 
-type GetOriginalURLByShortNameRow struct {
+type GetLinksForHealthCheckParams struct {
+	CheckedBefore pgtype.Timestamptz `json:"checked_before"`
+	Limit         int32              `json:"limit"`
+}
+
+type GetLinksForHealthCheckRow struct {
 	ID          int64  `json:"id"`
 	OriginalUrl string `json:"original_url"`
 }
 
+func (q *Queries) GetLinksForHealthCheck(ctx context.Context, arg GetLinksForHealthCheckParams) ([]GetLinksForHealthCheckRow, error) {
+	rows, err := q.db.Query(ctx, getLinksForHealthCheck, arg.CheckedBefore, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetLinksForHealthCheckRow
+	for rows.Next() {
+		var i GetLinksForHealthCheckRow
+		if err := rows.Scan(&i.ID, &i.OriginalUrl); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOriginalURLByShortName = `-- name: GetOriginalURLByShortName :one
+SELECT
+    id,
+    original_url,
+    title,
+    description,
+    og_image_url,
+    og_title,
+    og_description,
+    og_image
+FROM links WHERE short_name = $1 AND deleted_at IS NULL
+`
+
+type GetOriginalURLByShortNameRow struct {
+	ID            int64       `json:"id"`
+	OriginalUrl   string      `json:"original_url"`
+	Title         pgtype.Text `json:"title"`
+	Description   pgtype.Text `json:"description"`
+	OgImageUrl    pgtype.Text `json:"og_image_url"`
+	OgTitle       pgtype.Text `json:"og_title"`
+	OgDescription pgtype.Text `json:"og_description"`
+	OgImage       pgtype.Text `json:"og_image"`
+}
+
 func (q *Queries) GetOriginalURLByShortName(ctx context.Context, shortName string) (GetOriginalURLByShortNameRow, error) {
 	row := q.db.QueryRow(ctx, getOriginalURLByShortName, shortName)
 	var i GetOriginalURLByShortNameRow
-	err := row.Scan(&i.ID, &i.OriginalUrl)
+	err := row.Scan(
+		&i.ID,
+		&i.OriginalUrl,
+		&i.Title,
+		&i.Description,
+		&i.OgImageUrl,
+		&i.OgTitle,
+		&i.OgDescription,
+		&i.OgImage,
+	)
 	return i, err
 }
 
 const getTotalLinks = `-- name: GetTotalLinks :one
-    SELECT COUNT(id) AS total_links FROM links
+SELECT COUNT(id) AS total_links FROM links
+WHERE ($1::text IS NULL OR health_status = $1)
+    AND ($2::text IS NULL
+        OR original_url ILIKE '%' || $2 || '%'
+        OR short_name ILIKE '%' || $2 || '%'
+        OR title ILIKE '%' || $2 || '%')
+    AND ($3::bigint[] IS NULL OR id = ANY($3::bigint[]))
+    AND ($4::text IS NULL OR short_name = $4)
+    AND ($5::timestamptz IS NULL OR created_at >= $5)
+    AND ($6::timestamptz IS NULL OR created_at <= $6)
+    AND (deleted_at IS NOT NULL) = $7::boolean
 `
 
-func (q *Queries) GetTotalLinks(ctx context.Context) (int64, error) {
-	row := q.db.QueryRow(ctx, getTotalLinks)
+type GetTotalLinksParams struct {
+	Health      pgtype.Text        `json:"health"`
+	Query       pgtype.Text        `json:"query"`
+	Ids         []int64            `json:"ids"`
+	ShortName   pgtype.Text        `json:"short_name"`
+	CreatedFrom pgtype.Timestamptz `json:"created_from"`
+	CreatedTo   pgtype.Timestamptz `json:"created_to"`
+	Deleted     bool               `json:"deleted"`
+}
+
+func (q *Queries) GetTotalLinks(ctx context.Context, arg GetTotalLinksParams) (int64, error) {
+	row := q.db.QueryRow(ctx, getTotalLinks,
+		arg.Health,
+		arg.Query,
+		arg.Ids,
+		arg.ShortName,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Deleted,
+	)
 	var total_links int64
 	err := row.Scan(&total_links)
 	return total_links, err
 }
 
+const isShortNameTrashed = `-- name: IsShortNameTrashed :one
+SELECT EXISTS (SELECT 1 FROM links WHERE short_name = $1 AND deleted_at IS NOT NULL) AS trashed
+`
+
+func (q *Queries) IsShortNameTrashed(ctx context.Context, shortName string) (bool, error) {
+	row := q.db.QueryRow(ctx, isShortNameTrashed, shortName)
+	var trashed bool
+	err := row.Scan(&trashed)
+	return trashed, err
+}
+
+const listAPIKeys = `-- name: ListAPIKeys :many
+SELECT id, name, prefix, key_hash, created_at, revoked_at
+FROM api_keys
+ORDER BY id
+`
+
+func (q *Queries) ListAPIKeys(ctx context.Context) ([]ApiKey, error) {
+	rows, err := q.db.Query(ctx, listAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiKey
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Prefix,
+			&i.KeyHash,
+			&i.CreatedAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedLinks = `-- name: PurgeDeletedLinks :one
+WITH purged AS (
+    SELECT id FROM links
+    WHERE deleted_at < $1
+    ORDER BY deleted_at
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+), removed AS (
+    DELETE FROM visits WHERE link_id IN (SELECT id FROM purged) RETURNING id
+), checks AS (
+    DELETE FROM link_checks WHERE link_id IN (SELECT id FROM purged)
+), revisions AS (
+    DELETE FROM link_revisions WHERE link_id IN (SELECT id FROM purged)
+), deleted AS (
+    DELETE FROM links WHERE id IN (SELECT id FROM purged) RETURNING id
+)
+SELECT
+    (SELECT COUNT(*) FROM deleted) AS links_deleted,
+    (SELECT COUNT(*) FROM removed) AS visits_deleted
+`
+
+type PurgeDeletedLinksParams struct {
+	DeletedBefore pgtype.Timestamptz `json:"deleted_before"`
+	Limit         int32              `json:"limit"`
+}
+
+type PurgeDeletedLinksRow struct {
+	LinksDeleted  int64 `json:"links_deleted"`
+	VisitsDeleted int64 `json:"visits_deleted"`
+}
+
+func (q *Queries) PurgeDeletedLinks(ctx context.Context, arg PurgeDeletedLinksParams) (PurgeDeletedLinksRow, error) {
+	row := q.db.QueryRow(ctx, purgeDeletedLinks, arg.DeletedBefore, arg.Limit)
+	var i PurgeDeletedLinksRow
+	err := row.Scan(&i.LinksDeleted, &i.VisitsDeleted)
+	return i, err
+}
+
+const releaseIdempotencyKey = `-- name: ReleaseIdempotencyKey :exec
+DELETE FROM idempotency_keys WHERE key = $1 AND status_code IS NULL
+`
+
+func (q *Queries) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := q.db.Exec(ctx, releaseIdempotencyKey, key)
+	return err
+}
+
+const restoreLinkByID = `-- name: RestoreLinkByID :execrows
+WITH restored AS (
+    UPDATE links SET deleted_at = NULL, revision = revision + 1
+    WHERE id = $1 AND deleted_at IS NOT NULL
+    RETURNING id, original_url, short_name, revision
+)
+INSERT INTO link_revisions (link_id, revision, action, new_original_url, new_short_name, actor)
+SELECT id, revision, 'restore', original_url, short_name, $2 FROM restored
+`
+
+type RestoreLinkByIDParams struct {
+	ID    int64  `json:"id"`
+	Actor string `json:"actor"`
+}
+
+func (q *Queries) RestoreLinkByID(ctx context.Context, arg RestoreLinkByIDParams) (int64, error) {
+	result, err := q.db.Exec(ctx, restoreLinkByID, arg.ID, arg.Actor)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeAPIKey = `-- name: RevokeAPIKey :execrows
+UPDATE api_keys SET revoked_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAPIKey(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeAPIKey, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const saveIdempotencyResponse = `-- name: SaveIdempotencyResponse :exec
+UPDATE idempotency_keys
+SET status_code = $2, content_type = $3, response = $4
+WHERE key = $1
+`
+
+type SaveIdempotencyResponseParams struct {
+	Key         string      `json:"key"`
+	StatusCode  pgtype.Int4 `json:"status_code"`
+	ContentType pgtype.Text `json:"content_type"`
+	Response    []byte      `json:"response"`
+}
+
+func (q *Queries) SaveIdempotencyResponse(ctx context.Context, arg SaveIdempotencyResponseParams) error {
+	_, err := q.db.Exec(ctx, saveIdempotencyResponse,
+		arg.Key,
+		arg.StatusCode,
+		arg.ContentType,
+		arg.Response,
+	)
+	return err
+}
+
+const softDeleteLinkByID = `-- name: SoftDeleteLinkByID :execrows
+WITH deleted AS (
+    UPDATE links SET deleted_at = NOW(), revision = revision + 1
+    WHERE id = $1 AND deleted_at IS NULL
+    RETURNING id, original_url, short_name, revision
+)
+INSERT INTO link_revisions (link_id, revision, action, old_original_url, old_short_name, actor)
+SELECT id, revision, 'delete', original_url, short_name, $2 FROM deleted
+`
+
+type SoftDeleteLinkByIDParams struct {
+	ID    int64  `json:"id"`
+	Actor string `json:"actor"`
+}
+
+func (q *Queries) SoftDeleteLinkByID(ctx context.Context, arg SoftDeleteLinkByIDParams) (int64, error) {
+	result, err := q.db.Exec(ctx, softDeleteLinkByID, arg.ID, arg.Actor)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateImportJobProgress = `-- name: UpdateImportJobProgress :exec
+UPDATE import_jobs
+SET total_rows = $2,
+    processed_rows = $3,
+    created_rows = $4,
+    failed_rows = $5,
+    errors = $6,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateImportJobProgressParams struct {
+	ID            int64  `json:"id"`
+	TotalRows     int32  `json:"total_rows"`
+	ProcessedRows int32  `json:"processed_rows"`
+	CreatedRows   int32  `json:"created_rows"`
+	FailedRows    int32  `json:"failed_rows"`
+	Errors        []byte `json:"errors"`
+}
+
+func (q *Queries) UpdateImportJobProgress(ctx context.Context, arg UpdateImportJobProgressParams) error {
+	_, err := q.db.Exec(ctx, updateImportJobProgress,
+		arg.ID,
+		arg.TotalRows,
+		arg.ProcessedRows,
+		arg.CreatedRows,
+		arg.FailedRows,
+		arg.Errors,
+	)
+	return err
+}
+
 const updateLinkByID = `-- name: UpdateLinkByID :one
-UPDATE links
-SET original_url = $1, short_name = $2, short_url = $3
-WHERE id = $4
-RETURNING id, original_url, short_name, short_url
+WITH old AS (
+    SELECT id, original_url, short_name FROM links
+    WHERE id = $1 AND deleted_at IS NULL
+        AND ($2::integer[] IS NULL OR revision = ANY($2::integer[]))
+    FOR UPDATE
+), updated AS (
+    UPDATE links l
+    SET original_url = $3, short_name = $4, revision = l.revision + 1
+    FROM old
+    WHERE l.id = old.id
+    RETURNING l.id, l.original_url, l.short_name, l.revision
+), rev AS (
+    INSERT INTO link_revisions (link_id, revision, action, old_original_url, old_short_name, new_original_url, new_short_name, actor)
+    SELECT u.id, u.revision, $5, old.original_url, old.short_name, u.original_url, u.short_name, $6
+    FROM updated u JOIN old ON old.id = u.id
+)
+SELECT id, original_url, short_name, revision FROM updated
 `
 
 type UpdateLinkByIDParams struct {
-	OriginalUrl string `json:"original_url"`
-	ShortName   string `json:"short_name"`
-	ShortUrl    string `json:"short_url"`
-	ID          int64  `json:"id"`
+	ID                int64   `json:"id"`
+	ExpectedRevisions []int32 `json:"expected_revisions"`
+	OriginalUrl       string  `json:"original_url"`
+	ShortName         string  `json:"short_name"`
+	Action            string  `json:"action"`
+	Actor             string  `json:"actor"`
 }
 
 type UpdateLinkByIDRow struct {
 	ID          int64  `json:"id"`
 	OriginalUrl string `json:"original_url"`
 	ShortName   string `json:"short_name"`
-	ShortUrl    string `json:"short_url"`
+	Revision    int32  `json:"revision"`
 }
 
+// action - update или revert, старые и новые значения попадают в link_revisions.
+// expected_revisions (If-Match): если задан, ссылка обновляется, только если её ревизия в этом списке.
 func (q *Queries) UpdateLinkByID(ctx context.Context, arg UpdateLinkByIDParams) (UpdateLinkByIDRow, error) {
 	row := q.db.QueryRow(ctx, updateLinkByID,
+		arg.ID,
+		arg.ExpectedRevisions,
 		arg.OriginalUrl,
 		arg.ShortName,
-		arg.ShortUrl,
-		arg.ID,
+		arg.Action,
+		arg.Actor,
 	)
 	var i UpdateLinkByIDRow
 	err := row.Scan(
 		&i.ID,
 		&i.OriginalUrl,
 		&i.ShortName,
-		&i.ShortUrl,
+		&i.Revision,
 	)
 	return i, err
 }
+
+const updateLinkHealth = `-- name: UpdateLinkHealth :one
+UPDATE links
+SET consecutive_failures = CASE WHEN $1::boolean THEN 0 ELSE consecutive_failures + 1 END,
+    health_status = CASE
+        WHEN $1::boolean THEN 'healthy'
+        WHEN consecutive_failures + 1 >= $2::integer THEN 'broken'
+        ELSE health_status
+    END,
+    last_checked_at = NOW()
+WHERE id = $3
+RETURNING health_status, consecutive_failures
+`
+
+type UpdateLinkHealthParams struct {
+	Ok               bool  `json:"ok"`
+	FailureThreshold int32 `json:"failure_threshold"`
+	ID               int64 `json:"id"`
+}
+
+type UpdateLinkHealthRow struct {
+	HealthStatus        string `json:"health_status"`
+	ConsecutiveFailures int32  `json:"consecutive_failures"`
+}
+
+func (q *Queries) UpdateLinkHealth(ctx context.Context, arg UpdateLinkHealthParams) (UpdateLinkHealthRow, error) {
+	row := q.db.QueryRow(ctx, updateLinkHealth, arg.Ok, arg.FailureThreshold, arg.ID)
+	var i UpdateLinkHealthRow
+	err := row.Scan(&i.HealthStatus, &i.ConsecutiveFailures)
+	return i, err
+}
+
+const updateLinkMetadata = `-- name: UpdateLinkMetadata :exec
+UPDATE links
+SET title = $2, description = $3, favicon_url = $4, og_image_url = $5, metadata_fetched_at = NOW()
+WHERE id = $1 AND original_url = $6
+`
+
+type UpdateLinkMetadataParams struct {
+	ID          int64       `json:"id"`
+	Title       pgtype.Text `json:"title"`
+	Description pgtype.Text `json:"description"`
+	FaviconUrl  pgtype.Text `json:"favicon_url"`
+	OgImageUrl  pgtype.Text `json:"og_image_url"`
+	OriginalUrl string      `json:"original_url"`
+}
+
+func (q *Queries) UpdateLinkMetadata(ctx context.Context, arg UpdateLinkMetadataParams) error {
+	_, err := q.db.Exec(ctx, updateLinkMetadata,
+		arg.ID,
+		arg.Title,
+		arg.Description,
+		arg.FaviconUrl,
+		arg.OgImageUrl,
+		arg.OriginalUrl,
+	)
+	return err
+}
+
+const updateLinkSocial = `-- name: UpdateLinkSocial :execrows
+WITH updated AS (
+    UPDATE links
+    SET og_title = $1, og_description = $2, og_image = $3,
+        revision = revision + 1
+    WHERE id = $4 AND deleted_at IS NULL
+    RETURNING id, original_url, short_name, revision
+)
+INSERT INTO link_revisions (link_id, revision, action, old_original_url, old_short_name, new_original_url, new_short_name, actor)
+SELECT id, revision, 'social', original_url, short_name, original_url, short_name, $5 FROM updated
+`
+
+type UpdateLinkSocialParams struct {
+	OgTitle       pgtype.Text `json:"og_title"`
+	OgDescription pgtype.Text `json:"og_description"`
+	OgImage       pgtype.Text `json:"og_image"`
+	ID            int64       `json:"id"`
+	Actor         string      `json:"actor"`
+}
+
+// Свои Open Graph теги - тоже ревизия ссылки: адрес и короткое имя в ней не меняются.
+func (q *Queries) UpdateLinkSocial(ctx context.Context, arg UpdateLinkSocialParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateLinkSocial,
+		arg.OgTitle,
+		arg.OgDescription,
+		arg.OgImage,
+		arg.ID,
+		arg.Actor,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -8,20 +8,113 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-type Link struct {
-	ID          int64              `json:"id"`
-	OriginalUrl string             `json:"original_url"`
-	ShortName   string             `json:"short_name"`
-	ShortUrl    string             `json:"short_url"`
+type ApiKey struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name"`
+	Prefix    string             `json:"prefix"`
+	KeyHash   string             `json:"key_hash"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	RevokedAt pgtype.Timestamptz `json:"revoked_at"`
+}
+
+type IdempotencyKey struct {
+	Key         string             `json:"key"`
+	Fingerprint string             `json:"fingerprint"`
+	StatusCode  pgtype.Int4        `json:"status_code"`
+	ContentType pgtype.Text        `json:"content_type"`
+	Response    []byte             `json:"response"`
 	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt   pgtype.Timestamptz `json:"expires_at"`
+}
+
+type ImportJob struct {
+	ID            int64              `json:"id"`
+	Format        string             `json:"format"`
+	DryRun        bool               `json:"dry_run"`
+	Status        string             `json:"status"`
+	Actor         string             `json:"actor"`
+	Mapping       []byte             `json:"mapping"`
+	Payload       []byte             `json:"payload"`
+	TotalRows     int32              `json:"total_rows"`
+	ProcessedRows int32              `json:"processed_rows"`
+	CreatedRows   int32              `json:"created_rows"`
+	FailedRows    int32              `json:"failed_rows"`
+	Errors        []byte             `json:"errors"`
+	Error         pgtype.Text        `json:"error"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	StartedAt     pgtype.Timestamptz `json:"started_at"`
+	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+	FinishedAt    pgtype.Timestamptz `json:"finished_at"`
+}
+
+type Link struct {
+	ID                  int64              `json:"id"`
+	OriginalUrl         string             `json:"original_url"`
+	ShortName           string             `json:"short_name"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
+	Title               pgtype.Text        `json:"title"`
+	Description         pgtype.Text        `json:"description"`
+	FaviconUrl          pgtype.Text        `json:"favicon_url"`
+	OgImageUrl          pgtype.Text        `json:"og_image_url"`
+	MetadataFetchedAt   pgtype.Timestamptz `json:"metadata_fetched_at"`
+	OgTitle             pgtype.Text        `json:"og_title"`
+	OgDescription       pgtype.Text        `json:"og_description"`
+	OgImage             pgtype.Text        `json:"og_image"`
+	HealthStatus        string             `json:"health_status"`
+	ConsecutiveFailures int32              `json:"consecutive_failures"`
+	LastCheckedAt       pgtype.Timestamptz `json:"last_checked_at"`
+	DeletedAt           pgtype.Timestamptz `json:"deleted_at"`
+	Revision            int32              `json:"revision"`
+}
+
+type LinkCheck struct {
+	ID            int64              `json:"id"`
+	LinkID        int64              `json:"link_id"`
+	CheckedAt     pgtype.Timestamptz `json:"checked_at"`
+	Ok            bool               `json:"ok"`
+	StatusCode    pgtype.Int4        `json:"status_code"`
+	LatencyMs     int32              `json:"latency_ms"`
+	RedirectChain []string           `json:"redirect_chain"`
+	Error         pgtype.Text        `json:"error"`
+}
+
+type LinkRevision struct {
+	ID             int64              `json:"id"`
+	LinkID         int64              `json:"link_id"`
+	Revision       int32              `json:"revision"`
+	Action         string             `json:"action"`
+	OldOriginalUrl pgtype.Text        `json:"old_original_url"`
+	OldShortName   pgtype.Text        `json:"old_short_name"`
+	NewOriginalUrl pgtype.Text        `json:"new_original_url"`
+	NewShortName   pgtype.Text        `json:"new_short_name"`
+	Actor          string             `json:"actor"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
 }
 
 type Visit struct {
-	ID        int64              `json:"id"`
-	LinkID    int64              `json:"link_id"`
-	Ip        string             `json:"ip"`
-	UserAgent string             `json:"user_agent"`
-	Referer   pgtype.Text        `json:"referer"`
-	Status    int32              `json:"status"`
-	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	ID           int64              `json:"id"`
+	LinkID       int64              `json:"link_id"`
+	Ip           string             `json:"ip"`
+	UserAgent    string             `json:"user_agent"`
+	Referer      pgtype.Text        `json:"referer"`
+	Status       int32              `json:"status"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	IsCrawler    bool               `json:"is_crawler"`
+	RefererHost  pgtype.Text        `json:"referer_host"`
+	LinkRevision pgtype.Int4        `json:"link_revision"`
+}
+
+type VisitsArchive struct {
+	ID           int64              `json:"id"`
+	LinkID       int64              `json:"link_id"`
+	Ip           string             `json:"ip"`
+	UserAgent    string             `json:"user_agent"`
+	Referer      pgtype.Text        `json:"referer"`
+	Status       int32              `json:"status"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	IsCrawler    bool               `json:"is_crawler"`
+	RefererHost  pgtype.Text        `json:"referer_host"`
+	ArchivedAt   pgtype.Timestamptz `json:"archived_at"`
+	Reason       string             `json:"reason"`
+	LinkRevision pgtype.Int4        `json:"link_revision"`
 }
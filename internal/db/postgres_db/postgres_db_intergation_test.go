@@ -5,7 +5,10 @@ package postgres_db
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -13,10 +16,10 @@ import (
 func Test_CreateLink(t *testing.T) {
 	t.Parallel()
 	withTx(t, func(ctx context.Context, q *Queries) {
-		links, err := CreateTestLinks(t, ctx, q, BASE_URL)
+		links, err := CreateTestLinks(t, ctx, q)
 		require.NoError(t, err)
 
-		assert.Equal(t, BASE_URL+"/test-short1", links[0].ShortUrl)
+		assert.Equal(t, "test-short1", links[0].ShortName)
 
 		getLink, err := q.GetLinkByID(ctx, links[0].ID)
 		require.NoError(t, err)
@@ -27,22 +30,207 @@ func Test_CreateLink(t *testing.T) {
 func Test_DeleteLinkByID(t *testing.T) {
 	t.Parallel()
 	withTx(t, func(ctx context.Context, q *Queries) {
-		links, err := CreateTestLinks(t, ctx, q, BASE_URL)
+		links, err := CreateTestLinks(t, ctx, q)
 		require.NoError(t, err)
 
-		n, err := q.DeleteLinkByID(ctx, links[0].ID)
+		_, err = q.db.Exec(ctx, `INSERT INTO visits (link_id, ip, user_agent, status) VALUES ($1, '192.0.2.1', 'curl', 302)`, links[0].ID)
+		require.NoError(t, err)
+		require.NoError(t, q.CreateLinkCheck(ctx, CreateLinkCheckParams{LinkID: links[0].ID, Ok: true, RedirectChain: []string{}}))
+
+		row, err := q.DeleteLinkByID(ctx, links[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, DeleteLinkByIDRow{LinksDeleted: 1, VisitsDeleted: 1}, row)
+		assert.Zero(t, countLinkChecks(t, ctx, q, links[0].ID))
+
+		_, err = q.GetLinkByID(ctx, links[0].ID)
+		require.Error(t, err)
+
+		row, err = q.DeleteLinkByID(ctx, links[0].ID)
+		require.NoError(t, err)
+		assert.Zero(t, row.LinksDeleted)
+	})
+}
+
+func Test_DeleteLinkByIDArchivingVisits(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *Queries) {
+		links, err := CreateTestLinks(t, ctx, q)
+		require.NoError(t, err)
+		for range 2 {
+			_, err = q.db.Exec(ctx, `INSERT INTO visits (link_id, ip, user_agent, status) VALUES ($1, '192.0.2.1', 'curl', 302)`, links[1].ID)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, q.CreateLinkCheck(ctx, CreateLinkCheckParams{LinkID: links[1].ID, Ok: true, RedirectChain: []string{}}))
+
+		row, err := q.DeleteLinkByIDArchivingVisits(ctx, links[1].ID)
+		require.NoError(t, err)
+		assert.Equal(t, DeleteLinkByIDArchivingVisitsRow{LinksDeleted: 1, VisitsArchived: 2}, row)
+		assert.Zero(t, countLinkChecks(t, ctx, q, links[1].ID))
+
+		var archived int
+		require.NoError(t, q.db.QueryRow(ctx,
+			`SELECT COUNT(*) FROM visits_archive WHERE link_id = $1 AND reason = 'link_deleted'`, links[1].ID).Scan(&archived))
+		assert.Equal(t, 2, archived)
+	})
+}
+
+func Test_SoftDeleteAndRestoreLink(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *Queries) {
+		links, err := CreateTestLinks(t, ctx, q)
+		require.NoError(t, err)
+		id := links[0].ID
+
+		n, err := q.SoftDeleteLinkByID(ctx, SoftDeleteLinkByIDParams{ID: id, Actor: "test"})
 		require.NoError(t, err)
 		assert.Equal(t, int64(1), n)
 
+		// Из корзины ссылка не редиректит и не видна в обычном списке
+		_, err = q.GetOriginalURLByShortName(ctx, links[0].ShortName)
+		require.Error(t, err)
+		trashed, err := q.IsShortNameTrashed(ctx, links[0].ShortName)
+		require.NoError(t, err)
+		assert.True(t, trashed)
+		trashed, err = q.IsShortNameTrashed(ctx, links[1].ShortName)
+		require.NoError(t, err)
+		assert.False(t, trashed)
+		active, err := q.GetLinks(ctx, GetLinksParams{Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, active, len(links)-1)
+
+		trash, err := q.GetLinks(ctx, GetLinksParams{Deleted: true, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, trash, 1)
+		assert.Equal(t, id, trash[0].ID)
+		assert.True(t, trash[0].DeletedAt.Valid)
+
+		n, err = q.RestoreLinkByID(ctx, RestoreLinkByIDParams{ID: id, Actor: "test"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		_, err = q.GetOriginalURLByShortName(ctx, links[0].ShortName)
+		require.NoError(t, err)
+	})
+}
+
+// countLinkChecks - сколько проверок осталось у ссылки после удаления.
+func countLinkChecks(t *testing.T, ctx context.Context, q *Queries, linkID int64) int {
+	t.Helper()
+	var n int
+	require.NoError(t, q.db.QueryRow(ctx, `SELECT COUNT(*) FROM link_checks WHERE link_id = $1`, linkID).Scan(&n))
+	return n
+}
+
+func Test_PurgeDeletedLinks(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *Queries) {
+		links, err := CreateTestLinks(t, ctx, q)
+		require.NoError(t, err)
+		_, err = q.db.Exec(ctx, `INSERT INTO visits (link_id, ip, user_agent, status) VALUES ($1, '192.0.2.1', 'curl', 302)`, links[0].ID)
+		require.NoError(t, err)
+		_, err = q.db.Exec(ctx, `UPDATE links SET deleted_at = NOW() - INTERVAL '40 days' WHERE id = $1`, links[0].ID)
+		require.NoError(t, err)
+		_, err = q.SoftDeleteLinkByID(ctx, SoftDeleteLinkByIDParams{ID: links[1].ID, Actor: "test"})
+		require.NoError(t, err)
+
+		row, err := q.PurgeDeletedLinks(ctx, PurgeDeletedLinksParams{
+			DeletedBefore: pgtype.Timestamptz{Time: time.Now().AddDate(0, 0, -30), Valid: true},
+			Limit:         10,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, PurgeDeletedLinksRow{LinksDeleted: 1, VisitsDeleted: 1}, row)
+
 		_, err = q.GetLinkByID(ctx, links[0].ID)
 		require.Error(t, err)
+		// Недавно удалённая ссылка ещё в корзине
+		got, err := q.GetLinkByID(ctx, links[1].ID)
+		require.NoError(t, err)
+		assert.True(t, got.DeletedAt.Valid)
+	})
+}
+
+func Test_LinkRevisions(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *Queries) {
+		links, err := CreateTestLinks(t, ctx, q)
+		require.NoError(t, err)
+		id := links[0].ID
+
+		updated, err := q.UpdateLinkByID(ctx, UpdateLinkByIDParams{
+			ID:          id,
+			OriginalUrl: "https://moved.example.com",
+			ShortName:   links[0].ShortName,
+			Action:      "update",
+			Actor:       "editor",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), updated.Revision)
+
+		revisions, err := q.GetLinkRevisions(ctx, id)
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+		assert.Equal(t, "update", revisions[0].Action)
+		assert.Equal(t, links[0].OriginalUrl, revisions[0].OldOriginalUrl.String)
+		assert.Equal(t, "https://moved.example.com", revisions[0].NewOriginalUrl.String)
+		assert.Equal(t, "editor", revisions[0].Actor)
+		assert.Equal(t, "create", revisions[1].Action)
+
+		first, err := q.GetLinkRevision(ctx, GetLinkRevisionParams{LinkID: id, Revision: 1})
+		require.NoError(t, err)
+		assert.Equal(t, links[0].OriginalUrl, first.NewOriginalUrl.String)
+
+		// Устаревшая ревизия в If-Match - обновление не проходит
+		_, err = q.UpdateLinkByID(ctx, UpdateLinkByIDParams{
+			ID:                id,
+			ExpectedRevisions: []int32{1},
+			OriginalUrl:       "https://stale.example.com",
+			ShortName:         links[0].ShortName,
+			Action:            "update",
+		})
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+}
+
+func Test_IdempotencyKeys(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *Queries) {
+		params := ClaimIdempotencyKeyParams{
+			Key:         "retry-1",
+			Fingerprint: "fp",
+			ExpiresAt:   pgtype.Timestamptz{Time: time.Now().Add(time.Hour), Valid: true},
+		}
+		n, err := q.ClaimIdempotencyKey(ctx, params)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		// Действующий ключ повторно не занимается
+		n, err = q.ClaimIdempotencyKey(ctx, params)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+
+		require.NoError(t, q.SaveIdempotencyResponse(ctx, SaveIdempotencyResponseParams{
+			Key:        "retry-1",
+			StatusCode: pgtype.Int4{Int32: 201, Valid: true},
+			Response:   []byte(`{"id":1}`),
+		}))
+		got, err := q.GetIdempotencyKey(ctx, "retry-1")
+		require.NoError(t, err)
+		assert.Equal(t, int32(201), got.StatusCode.Int32)
+		assert.JSONEq(t, `{"id":1}`, string(got.Response))
+
+		// Просроченный ключ занимается заново
+		_, err = q.db.Exec(ctx, `UPDATE idempotency_keys SET expires_at = NOW() - INTERVAL '1 minute'`)
+		require.NoError(t, err)
+		n, err = q.ClaimIdempotencyKey(ctx, params)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
 	})
 }
 
 func Test_GetLinkByID(t *testing.T) {
 	t.Parallel()
 	withTx(t, func(ctx context.Context, q *Queries) {
-		links, err := CreateTestLinks(t, ctx, q, BASE_URL)
+		links, err := CreateTestLinks(t, ctx, q)
 		require.NoError(t, err)
 		got, err := q.GetLinkByID(ctx, links[0].ID)
 		require.NoError(t, err)
@@ -53,7 +241,7 @@ func Test_GetLinkByID(t *testing.T) {
 func Test_GetLinks(t *testing.T) {
 	t.Parallel()
 	withTx(t, func(ctx context.Context, q *Queries) {
-		links, err := CreateTestLinks(t, ctx, q, BASE_URL)
+		links, err := CreateTestLinks(t, ctx, q)
 		require.NoError(t, err)
 		got, err := q.GetLinks(ctx, GetLinksParams{
 			Limit:  3,
@@ -64,33 +252,63 @@ func Test_GetLinks(t *testing.T) {
 	})
 }
 
+func Test_GetLinks_SortAndFilter(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *Queries) {
+		links, err := CreateTestLinks(t, ctx, q)
+		require.NoError(t, err)
+
+		got, err := q.GetLinks(ctx, GetLinksParams{SortField: "short_name", SortDesc: true, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		assert.Equal(t, "test-short3", got[0].ShortName)
+		assert.Equal(t, "test-short1", got[2].ShortName)
+
+		filter := GetTotalLinksParams{
+			Query: pgtype.Text{String: "example2", Valid: true},
+			Ids:   []int64{links[0].ID, links[1].ID},
+		}
+		got, err = q.GetLinks(ctx, GetLinksParams{Query: filter.Query, Ids: filter.Ids, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, links[1].ID, got[0].ID)
+
+		total, err := q.GetTotalLinks(ctx, filter)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+
+		got, err = q.GetLinks(ctx, GetLinksParams{Ids: []int64{}, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+}
+
 func Test_UpdateLinkByID(t *testing.T) {
 	t.Parallel()
 	withTx(t, func(ctx context.Context, q *Queries) {
-		links, err := CreateTestLinks(t, ctx, q, BASE_URL)
+		links, err := CreateTestLinks(t, ctx, q)
 		require.NoError(t, err)
 
 		updateParams := UpdateLinkByIDParams{
 			ID:          links[1].ID,
 			OriginalUrl: "https://example2.net/very-very-long-short-name?with=queries",
 			ShortName:   "new_short_name2",
-			ShortUrl:    BASE_URL + "/new_short_name2",
 		}
 		got, err := q.UpdateLinkByID(ctx, updateParams)
 		require.NoError(t, err)
 
 		link, err := q.GetLinkByID(ctx, got.ID)
 		require.NoError(t, err)
-		assert.Equal(t, BASE_URL+"/new_short_name2", got.ShortUrl)
-		assert.Equal(t, link.ShortUrl, got.ShortUrl)
-		assert.NotEqual(t, links[got.ID].ShortUrl, link.ShortUrl)
+		assert.Equal(t, "new_short_name2", got.ShortName)
+		assert.Equal(t, link.ShortName, got.ShortName)
+		assert.NotEqual(t, links[got.ID].ShortName, link.ShortName)
 	})
 }
 
 func Test_GetOriginalURLByShortName(t *testing.T) {
 	t.Parallel()
 	withTx(t, func(ctx context.Context, q *Queries) {
-		_, err := CreateTestLinks(t, ctx, q, BASE_URL)
+		_, err := CreateTestLinks(t, ctx, q)
 		require.NoError(t, err)
 		shortName := "test-short3"
 		expectedOriginalURL := "https://example3.net/very-very-long-short-name?with=queries"
@@ -100,3 +318,187 @@ func Test_GetOriginalURLByShortName(t *testing.T) {
 		assert.Equal(t, expectedOriginalURL, got.OriginalUrl)
 	})
 }
+
+func Test_UpdateLinkMetadata(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *Queries) {
+		links, err := CreateTestLinks(t, ctx, q)
+		require.NoError(t, err)
+
+		err = q.UpdateLinkMetadata(ctx, UpdateLinkMetadataParams{
+			ID:          links[0].ID,
+			Title:       pgtype.Text{String: "Example", Valid: true},
+			OriginalUrl: links[0].OriginalUrl,
+		})
+		require.NoError(t, err)
+		// Превью для устаревшего адреса не должно перезаписать данные
+		err = q.UpdateLinkMetadata(ctx, UpdateLinkMetadataParams{
+			ID:          links[0].ID,
+			Title:       pgtype.Text{String: "Stale", Valid: true},
+			OriginalUrl: "https://old.example.com",
+		})
+		require.NoError(t, err)
+
+		got, err := q.GetLinkByID(ctx, links[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Example", got.Title.String)
+		assert.False(t, got.OgImageUrl.Valid)
+	})
+}
+
+func Test_UpdateLinkSocial(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *Queries) {
+		links, err := CreateTestLinks(t, ctx, q)
+		require.NoError(t, err)
+
+		n, err := q.UpdateLinkSocial(ctx, UpdateLinkSocialParams{
+			ID:      links[2].ID,
+			OgTitle: pgtype.Text{String: "Custom title", Valid: true},
+			Actor:   "tester",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		got, err := q.GetOriginalURLByShortName(ctx, links[2].ShortName)
+		require.NoError(t, err)
+		assert.Equal(t, "Custom title", got.OgTitle.String)
+		assert.False(t, got.OgImage.Valid)
+
+		// Изменение попадает в историю новой ревизией
+		revs, err := q.GetLinkRevisions(ctx, links[2].ID)
+		require.NoError(t, err)
+		require.Len(t, revs, 2)
+		assert.Equal(t, "social", revs[0].Action)
+		assert.Equal(t, "tester", revs[0].Actor)
+		assert.Equal(t, links[2].OriginalUrl, revs[0].NewOriginalUrl.String)
+
+		// Ссылку в корзине изменить нельзя
+		_, err = q.SoftDeleteLinkByID(ctx, SoftDeleteLinkByIDParams{ID: links[2].ID, Actor: "tester"})
+		require.NoError(t, err)
+		n, err = q.UpdateLinkSocial(ctx, UpdateLinkSocialParams{ID: links[2].ID, Actor: "tester"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+	})
+}
+
+func Test_LinkHealth(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *Queries) {
+		links, err := CreateTestLinks(t, ctx, q)
+		require.NoError(t, err)
+		id := links[0].ID
+
+		for range 2 {
+			require.NoError(t, q.CreateLinkCheck(ctx, CreateLinkCheckParams{
+				LinkID:        id,
+				StatusCode:    pgtype.Int4{Int32: 404, Valid: true},
+				LatencyMs:     10,
+				RedirectChain: []string{},
+				Error:         pgtype.Text{String: "unexpected status 404", Valid: true},
+			}))
+			_, err = q.UpdateLinkHealth(ctx, UpdateLinkHealthParams{FailureThreshold: 2, ID: id})
+			require.NoError(t, err)
+		}
+
+		health, err := q.GetLinkHealth(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, "broken", health.HealthStatus)
+		assert.Equal(t, int32(2), health.ConsecutiveFailures)
+		assert.True(t, health.LastCheckedAt.Valid)
+
+		checks, err := q.GetLinkChecks(ctx, GetLinkChecksParams{LinkID: id, Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, checks, 2)
+
+		broken, err := q.GetLinks(ctx, GetLinksParams{Health: pgtype.Text{String: "broken", Valid: true}, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, broken, 1)
+		assert.Equal(t, id, broken[0].ID)
+
+		row, err := q.UpdateLinkHealth(ctx, UpdateLinkHealthParams{Ok: true, FailureThreshold: 2, ID: id})
+		require.NoError(t, err)
+		assert.Equal(t, "healthy", row.HealthStatus)
+		assert.Equal(t, int32(0), row.ConsecutiveFailures)
+	})
+}
+
+// Test_TxRunner коммитит по-настоящему, поэтому не параллельный и удаляет свои ссылки сам.
+func Test_TxRunner(t *testing.T) {
+	ctx := t.Context()
+	runner := NewTxRunner(pool)
+	q := New(pool)
+
+	var created CreateLinkRow
+	err := runner.InTx(ctx, func(tx Tx) error {
+		var err error
+		created, err = tx.CreateLink(ctx, CreateLinkParams{OriginalUrl: "https://example.com/tx", ShortName: "tx-runner"})
+		require.NoError(t, err)
+
+		// Дубликат откатывает только свой savepoint, транзакция продолжает работать
+		err = tx.Savepoint(ctx, func(q Querier) error {
+			_, err := q.CreateLink(ctx, CreateLinkParams{OriginalUrl: "https://example.com/dup", ShortName: "tx-runner"})
+			return err
+		})
+		require.Error(t, err)
+		_, err = tx.GetLinkByID(ctx, created.ID)
+		return err
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _, _ = q.DeleteLinkByID(context.Background(), created.ID) })
+
+	_, err = q.GetLinkByID(ctx, created.ID)
+	require.NoError(t, err)
+
+	// Ошибка fn откатывает всю транзакцию
+	var rolledBack CreateLinkRow
+	err = runner.InTx(ctx, func(tx Tx) error {
+		rolledBack, err = tx.CreateLink(ctx, CreateLinkParams{OriginalUrl: "https://example.com/tx", ShortName: "tx-rollback"})
+		require.NoError(t, err)
+		return assert.AnError
+	})
+	require.ErrorIs(t, err, assert.AnError)
+	_, err = q.GetLinkByID(ctx, rolledBack.ID)
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func Test_ImportJobs(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *Queries) {
+		id, err := q.CreateImportJob(ctx, CreateImportJobParams{
+			Format:  "csv",
+			Actor:   "tester",
+			Mapping: []byte(`{"original_url":"Destination"}`),
+			Payload: []byte("Destination\nhttps://example.com\n"),
+		})
+		require.NoError(t, err)
+
+		job, err := q.ClaimImportJob(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, id, job.ID)
+		assert.Equal(t, "running", job.Status)
+		assert.True(t, job.StartedAt.Valid)
+		assert.NotEmpty(t, job.Payload)
+
+		// Задача уже взята, очередь пуста
+		_, err = q.ClaimImportJob(ctx)
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+
+		require.NoError(t, q.UpdateImportJobProgress(ctx, UpdateImportJobProgressParams{
+			ID: id, TotalRows: 2, ProcessedRows: 2, CreatedRows: 1, FailedRows: 1,
+			Errors: []byte(`[{"line":3,"error":"bad url"}]`),
+		}))
+		require.NoError(t, q.FinishImportJob(ctx, FinishImportJobParams{ID: id, Status: "done"}))
+
+		row, err := q.GetImportJob(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, "done", row.Status)
+		assert.Equal(t, int32(1), row.FailedRows)
+		assert.JSONEq(t, `[{"line":3,"error":"bad url"}]`, string(row.Errors))
+		assert.True(t, row.FinishedAt.Valid)
+
+		n, err := q.FailStaleImportJobs(ctx, pgtype.Timestamptz{Time: time.Now().Add(time.Hour), Valid: true})
+		require.NoError(t, err)
+		assert.Zero(t, n, "finished jobs are not touched")
+	})
+}
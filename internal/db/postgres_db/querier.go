@@ -6,16 +6,54 @@ package postgres_db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
+	// Занимает ключ. Просроченный ключ можно занять заново, 0 строк - ключ уже используется.
+	ClaimIdempotencyKey(ctx context.Context, arg ClaimIdempotencyKeyParams) (int64, error)
+	// Берёт самую старую задачу из очереди. Другие экземпляры сервиса её пропустят.
+	ClaimImportJob(ctx context.Context) (ImportJob, error)
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error)
+	CreateImportJob(ctx context.Context, arg CreateImportJobParams) (int64, error)
 	CreateLink(ctx context.Context, arg CreateLinkParams) (CreateLinkRow, error)
-	DeleteLinkByID(ctx context.Context, id int64) (int64, error)
+	CreateLinkCheck(ctx context.Context, arg CreateLinkCheckParams) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+	DeleteLinkByID(ctx context.Context, id int64) (DeleteLinkByIDRow, error)
+	DeleteLinkByIDArchivingVisits(ctx context.Context, id int64) (DeleteLinkByIDArchivingVisitsRow, error)
+	// Задачи, которые давно не обновляли прогресс: экземпляр сервиса остановился посреди импорта.
+	// Повторять их нельзя, часть ссылок уже создана.
+	FailStaleImportJobs(ctx context.Context, updatedAt pgtype.Timestamptz) (int64, error)
+	FinishImportJob(ctx context.Context, arg FinishImportJobParams) error
+	GetActiveAPIKeyByHash(ctx context.Context, keyHash string) (ApiKey, error)
+	GetIdempotencyKey(ctx context.Context, key string) (IdempotencyKey, error)
+	GetImportJob(ctx context.Context, id int64) (GetImportJobRow, error)
 	GetLinkByID(ctx context.Context, id int64) (GetLinkByIDRow, error)
+	GetLinkChecks(ctx context.Context, arg GetLinkChecksParams) ([]GetLinkChecksRow, error)
+	GetLinkHealth(ctx context.Context, id int64) (GetLinkHealthRow, error)
+	GetLinkRevision(ctx context.Context, arg GetLinkRevisionParams) (LinkRevision, error)
+	GetLinkRevisions(ctx context.Context, linkID int64) ([]LinkRevision, error)
 	GetLinks(ctx context.Context, arg GetLinksParams) ([]GetLinksRow, error)
+	GetLinksForHealthCheck(ctx context.Context, arg GetLinksForHealthCheckParams) ([]GetLinksForHealthCheckRow, error)
 	GetOriginalURLByShortName(ctx context.Context, shortName string) (GetOriginalURLByShortNameRow, error)
-	GetTotalLinks(ctx context.Context) (int64, error)
+	GetTotalLinks(ctx context.Context, arg GetTotalLinksParams) (int64, error)
+	IsShortNameTrashed(ctx context.Context, shortName string) (bool, error)
+	ListAPIKeys(ctx context.Context) ([]ApiKey, error)
+	PurgeDeletedLinks(ctx context.Context, arg PurgeDeletedLinksParams) (PurgeDeletedLinksRow, error)
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	RestoreLinkByID(ctx context.Context, arg RestoreLinkByIDParams) (int64, error)
+	RevokeAPIKey(ctx context.Context, id int64) (int64, error)
+	SaveIdempotencyResponse(ctx context.Context, arg SaveIdempotencyResponseParams) error
+	SoftDeleteLinkByID(ctx context.Context, arg SoftDeleteLinkByIDParams) (int64, error)
+	UpdateImportJobProgress(ctx context.Context, arg UpdateImportJobProgressParams) error
+	// action - update или revert, старые и новые значения попадают в link_revisions.
+	// expected_revisions (If-Match): если задан, ссылка обновляется, только если её ревизия в этом списке.
 	UpdateLinkByID(ctx context.Context, arg UpdateLinkByIDParams) (UpdateLinkByIDRow, error)
+	UpdateLinkHealth(ctx context.Context, arg UpdateLinkHealthParams) (UpdateLinkHealthRow, error)
+	UpdateLinkMetadata(ctx context.Context, arg UpdateLinkMetadataParams) error
+	// Свои Open Graph теги - тоже ревизия ссылки: адрес и короткое имя в ней не меняются.
+	UpdateLinkSocial(ctx context.Context, arg UpdateLinkSocialParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
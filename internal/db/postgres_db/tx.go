@@ -0,0 +1,61 @@
+package postgres_db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Tx - запросы внутри транзакции.
+type Tx interface {
+	Querier
+	// Savepoint выполняет fn во вложенной транзакции (SAVEPOINT).
+	// Ошибка fn откатывает только её, внешняя транзакция остаётся рабочей.
+	Savepoint(ctx context.Context, fn func(q Querier) error) error
+}
+
+// TxRunner выполняет функции в транзакции.
+type TxRunner interface {
+	// InTx коммитит транзакцию, если fn вернула nil, иначе откатывает.
+	InTx(ctx context.Context, fn func(tx Tx) error) error
+}
+
+// PoolTxRunner открывает транзакции в пуле соединений pgx.
+type PoolTxRunner struct {
+	pool *pgxpool.Pool
+}
+
+func NewTxRunner(pool *pgxpool.Pool) *PoolTxRunner {
+	return &PoolTxRunner{pool: pool}
+}
+
+func (r *PoolTxRunner) InTx(ctx context.Context, fn func(tx Tx) error) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// После Commit откат ничего не делает
+	defer func() { _ = tx.Rollback(ctx) }()
+	if err := fn(&txQueries{Queries: New(tx), tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+type txQueries struct {
+	*Queries
+	tx pgx.Tx
+}
+
+func (t *txQueries) Savepoint(ctx context.Context, fn func(q Querier) error) error {
+	sp, err := t.tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = sp.Rollback(ctx) }()
+	if err := fn(New(sp)); err != nil {
+		return err
+	}
+	return sp.Commit(ctx)
+}
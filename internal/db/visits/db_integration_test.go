@@ -114,7 +114,12 @@ func withTx(t *testing.T, fn func(ctx context.Context, q *visits.Queries)) {
 	t.Cleanup(func() { _ = tx.Rollback(ctx) })
 
 	// Сброс последовательности перед тестом
-	_, err = tx.Exec(ctx, `TRUNCATE TABLE visits RESTART IDENTITY CASCADE`)
+	_, err = tx.Exec(ctx, `TRUNCATE TABLE links, visits, visits_archive RESTART IDENTITY CASCADE`)
+	require.NoError(t, err)
+
+	// visits.link_id ссылается на links, поэтому заводим ссылки с id 1 и 2 для CreateTestVisits
+	_, err = tx.Exec(ctx, `INSERT INTO links (original_url, short_name)
+		VALUES ('https://example1.net', 'visits-1'), ('https://example2.net', 'visits-2')`)
 	require.NoError(t, err)
 
 	qtx := visits.New(tx) // все вызовы sqlc пойдут внутри этой транзакции
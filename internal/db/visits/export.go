@@ -0,0 +1,88 @@
+package visits
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Запрос выгрузки написан вручную, а не в queries/visits.sql: sqlc :many собирает все строки в срез,
+// а выгрузке нужен поток. pgx читает строки из соединения по мере rows.Next.
+
+// Exporter отдаёт посещения потоком по возрастанию id.
+type Exporter interface {
+	ExportVisits(ctx context.Context, arg ExportVisitsParams, fn func(row Visit) error) error
+}
+
+var _ Exporter = (*Queries)(nil)
+
+const exportVisits = `-- name: ExportVisits
+SELECT id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision
+FROM visits
+WHERE ($1::text IS NULL
+        OR ip ILIKE '%' || $1 || '%'
+        OR user_agent ILIKE '%' || $1 || '%'
+        OR referer ILIKE '%' || $1 || '%')
+    AND ($2::bigint[] IS NULL OR id = ANY($2::bigint[]))
+    AND ($3::bigint[] IS NULL OR link_id = ANY($3::bigint[]))
+    AND ($4::timestamptz IS NULL OR created_at >= $4)
+    AND ($5::timestamptz IS NULL OR created_at <= $5)
+    AND ($6::integer IS NULL OR status = $6)
+    AND ($7::text IS NULL OR ip = $7)
+    AND ($8::text IS NULL OR referer_host = $8)
+    AND id > $9
+ORDER BY id
+`
+
+// ExportVisitsParams - фильтры как у GetTotalVisits. AfterID продолжает прерванную выгрузку.
+type ExportVisitsParams struct {
+	Query       pgtype.Text        `json:"query"`
+	Ids         []int64            `json:"ids"`
+	LinkIds     []int64            `json:"link_ids"`
+	CreatedFrom pgtype.Timestamptz `json:"created_from"`
+	CreatedTo   pgtype.Timestamptz `json:"created_to"`
+	Status      pgtype.Int4        `json:"status"`
+	Ip          pgtype.Text        `json:"ip"`
+	RefererHost pgtype.Text        `json:"referer_host"`
+	AfterID     int64              `json:"after_id"`
+}
+
+// ExportVisits вызывает fn для каждой строки. Ошибка fn прерывает выгрузку и возвращается как есть.
+func (q *Queries) ExportVisits(ctx context.Context, arg ExportVisitsParams, fn func(row Visit) error) error {
+	rows, err := q.db.Query(ctx, exportVisits,
+		arg.Query,
+		arg.Ids,
+		arg.LinkIds,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Status,
+		arg.Ip,
+		arg.RefererHost,
+		arg.AfterID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i Visit
+		if err := rows.Scan(
+			&i.ID,
+			&i.LinkID,
+			&i.Ip,
+			&i.UserAgent,
+			&i.Referer,
+			&i.Status,
+			&i.CreatedAt,
+			&i.IsCrawler,
+			&i.RefererHost,
+			&i.LinkRevision,
+		); err != nil {
+			return err
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
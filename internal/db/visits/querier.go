@@ -9,9 +9,14 @@ import (
 )
 
 type Querier interface {
+	ArchiveOrphanVisits(ctx context.Context, limit int32) (int64, error)
 	CreateVisit(ctx context.Context, arg CreateVisitParams) error
-	GetTotalVisits(ctx context.Context) (int64, error)
+	DeleteOrphanVisits(ctx context.Context, limit int32) (int64, error)
+	EstimateTotalVisits(ctx context.Context) (int64, error)
+	GetTotalVisits(ctx context.Context, arg GetTotalVisitsParams) (int64, error)
 	GetVisits(ctx context.Context, arg GetVisitsParams) ([]GetVisitsRow, error)
+	GetVisitsPage(ctx context.Context, arg GetVisitsPageParams) ([]GetVisitsPageRow, error)
+	ValidateVisitsLinkFK(ctx context.Context) error
 }
 
 var _ Querier = (*Queries)(nil)
@@ -11,17 +11,42 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const archiveOrphanVisits = `-- name: ArchiveOrphanVisits :execrows
+WITH moved AS (
+    DELETE FROM visits
+    WHERE id IN (
+        SELECT v.id FROM visits v
+        WHERE NOT EXISTS (SELECT 1 FROM links l WHERE l.id = v.link_id)
+        LIMIT $1
+    )
+    RETURNING id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision
+)
+INSERT INTO visits_archive (id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision, reason)
+SELECT id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision, 'orphan'
+FROM moved
+`
+
+func (q *Queries) ArchiveOrphanVisits(ctx context.Context, limit int32) (int64, error) {
+	result, err := q.db.Exec(ctx, archiveOrphanVisits, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const createVisit = `-- name: CreateVisit :exec
-INSERT INTO visits (link_id, ip, user_agent, referer, status)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO visits (link_id, ip, user_agent, referer, status, is_crawler, referer_host, link_revision)
+VALUES ($1, $2, $3, $4, $5, $6, $7, (SELECT revision FROM links WHERE id = $1))
 `
 
 type CreateVisitParams struct {
-	LinkID    int64       `json:"link_id"`
-	Ip        string      `json:"ip"`
-	UserAgent string      `json:"user_agent"`
-	Referer   pgtype.Text `json:"referer"`
-	Status    int32       `json:"status"`
+	LinkID      int64       `json:"link_id"`
+	Ip          string      `json:"ip"`
+	UserAgent   string      `json:"user_agent"`
+	Referer     pgtype.Text `json:"referer"`
+	Status      int32       `json:"status"`
+	IsCrawler   bool        `json:"is_crawler"`
+	RefererHost pgtype.Text `json:"referer_host"`
 }
 
 func (q *Queries) CreateVisit(ctx context.Context, arg CreateVisitParams) error {
@@ -31,16 +56,77 @@ func (q *Queries) CreateVisit(ctx context.Context, arg CreateVisitParams) error
 		arg.UserAgent,
 		arg.Referer,
 		arg.Status,
+		arg.IsCrawler,
+		arg.RefererHost,
 	)
 	return err
 }
 
+const deleteOrphanVisits = `-- name: DeleteOrphanVisits :execrows
+DELETE FROM visits
+WHERE id IN (
+    SELECT v.id FROM visits v
+    WHERE NOT EXISTS (SELECT 1 FROM links l WHERE l.id = v.link_id)
+    LIMIT $1
+)
+`
+
+func (q *Queries) DeleteOrphanVisits(ctx context.Context, limit int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteOrphanVisits, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const estimateTotalVisits = `-- name: EstimateTotalVisits :one
+SELECT reltuples::bigint AS estimate FROM pg_class WHERE oid = 'visits'::regclass
+`
+
+func (q *Queries) EstimateTotalVisits(ctx context.Context) (int64, error) {
+	row := q.db.QueryRow(ctx, estimateTotalVisits)
+	var estimate int64
+	err := row.Scan(&estimate)
+	return estimate, err
+}
+
 const getTotalVisits = `-- name: GetTotalVisits :one
 SELECT COUNT(id) AS total_visits FROM visits
+WHERE ($1::text IS NULL
+        OR ip ILIKE '%' || $1 || '%'
+        OR user_agent ILIKE '%' || $1 || '%'
+        OR referer ILIKE '%' || $1 || '%')
+    AND ($2::bigint[] IS NULL OR id = ANY($2::bigint[]))
+    AND ($3::bigint[] IS NULL OR link_id = ANY($3::bigint[]))
+    AND ($4::timestamptz IS NULL OR created_at >= $4)
+    AND ($5::timestamptz IS NULL OR created_at <= $5)
+    AND ($6::integer IS NULL OR status = $6)
+    AND ($7::text IS NULL OR ip = $7)
+    AND ($8::text IS NULL OR referer_host = $8)
 `
 
-func (q *Queries) GetTotalVisits(ctx context.Context) (int64, error) {
-	row := q.db.QueryRow(ctx, getTotalVisits)
+type GetTotalVisitsParams struct {
+	Query       pgtype.Text        `json:"query"`
+	Ids         []int64            `json:"ids"`
+	LinkIds     []int64            `json:"link_ids"`
+	CreatedFrom pgtype.Timestamptz `json:"created_from"`
+	CreatedTo   pgtype.Timestamptz `json:"created_to"`
+	Status      pgtype.Int4        `json:"status"`
+	Ip          pgtype.Text        `json:"ip"`
+	RefererHost pgtype.Text        `json:"referer_host"`
+}
+
+func (q *Queries) GetTotalVisits(ctx context.Context, arg GetTotalVisitsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, getTotalVisits,
+		arg.Query,
+		arg.Ids,
+		arg.LinkIds,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Status,
+		arg.Ip,
+		arg.RefererHost,
+	)
 	var total_visits int64
 	err := row.Scan(&total_visits)
 	return total_visits, err
@@ -53,28 +139,84 @@ SELECT
     created_at,
     ip,
     user_agent,
-    status
+    status,
+    is_crawler,
+    link_revision
 FROM visits
-ORDER BY created_at DESC, id DESC
-LIMIT $1 OFFSET $2
+WHERE ($1::text IS NULL
+        OR ip ILIKE '%' || $1 || '%'
+        OR user_agent ILIKE '%' || $1 || '%'
+        OR referer ILIKE '%' || $1 || '%')
+    AND ($2::bigint[] IS NULL OR id = ANY($2::bigint[]))
+    AND ($3::bigint[] IS NULL OR link_id = ANY($3::bigint[]))
+    AND ($4::timestamptz IS NULL OR created_at >= $4)
+    AND ($5::timestamptz IS NULL OR created_at <= $5)
+    AND ($6::integer IS NULL OR status = $6)
+    AND ($7::text IS NULL OR ip = $7)
+    AND ($8::text IS NULL OR referer_host = $8)
+ORDER BY
+    CASE WHEN NOT $9::boolean THEN
+        CASE $10::text
+            WHEN 'link_id' THEN link_id
+            WHEN 'status' THEN status
+        END
+    END ASC,
+    CASE WHEN $9::boolean THEN
+        CASE $10::text
+            WHEN 'link_id' THEN link_id
+            WHEN 'status' THEN status
+        END
+    END DESC,
+    CASE WHEN $10::text = 'ip' AND NOT $9::boolean THEN ip END ASC,
+    CASE WHEN $10::text = 'ip' AND $9::boolean THEN ip END DESC,
+    CASE WHEN $10::text = 'created_at' AND NOT $9::boolean THEN created_at END ASC,
+    CASE WHEN $10::text = 'created_at' AND $9::boolean THEN created_at END DESC,
+    CASE WHEN NOT $9::boolean THEN id END ASC,
+    CASE WHEN $9::boolean THEN id END DESC
+LIMIT $11 OFFSET $12
 `
 
 type GetVisitsParams struct {
-	Limit  int32 `json:"limit"`
-	Offset int32 `json:"offset"`
+	Query       pgtype.Text        `json:"query"`
+	Ids         []int64            `json:"ids"`
+	LinkIds     []int64            `json:"link_ids"`
+	CreatedFrom pgtype.Timestamptz `json:"created_from"`
+	CreatedTo   pgtype.Timestamptz `json:"created_to"`
+	Status      pgtype.Int4        `json:"status"`
+	Ip          pgtype.Text        `json:"ip"`
+	RefererHost pgtype.Text        `json:"referer_host"`
+	SortDesc    bool               `json:"sort_desc"`
+	SortField   string             `json:"sort_field"`
+	Limit       int32              `json:"limit"`
+	Offset      int32              `json:"offset"`
 }
 
 type GetVisitsRow struct {
-	ID        int64              `json:"id"`
-	LinkID    int64              `json:"link_id"`
-	CreatedAt pgtype.Timestamptz `json:"created_at"`
-	Ip        string             `json:"ip"`
-	UserAgent string             `json:"user_agent"`
-	Status    int32              `json:"status"`
+	ID           int64              `json:"id"`
+	LinkID       int64              `json:"link_id"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	Ip           string             `json:"ip"`
+	UserAgent    string             `json:"user_agent"`
+	Status       int32              `json:"status"`
+	IsCrawler    bool               `json:"is_crawler"`
+	LinkRevision pgtype.Int4        `json:"link_revision"`
 }
 
 func (q *Queries) GetVisits(ctx context.Context, arg GetVisitsParams) ([]GetVisitsRow, error) {
-	rows, err := q.db.Query(ctx, getVisits, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, getVisits,
+		arg.Query,
+		arg.Ids,
+		arg.LinkIds,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Status,
+		arg.Ip,
+		arg.RefererHost,
+		arg.SortDesc,
+		arg.SortField,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +231,102 @@ func (q *Queries) GetVisits(ctx context.Context, arg GetVisitsParams) ([]GetVisi
 			&i.Ip,
 			&i.UserAgent,
 			&i.Status,
+			&i.IsCrawler,
+			&i.LinkRevision,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVisitsPage = `-- name: GetVisitsPage :many
+SELECT
+    id,
+    link_id,
+    created_at,
+    ip,
+    user_agent,
+    status,
+    is_crawler,
+    link_revision
+FROM visits
+WHERE ($1::text IS NULL
+        OR ip ILIKE '%' || $1 || '%'
+        OR user_agent ILIKE '%' || $1 || '%'
+        OR referer ILIKE '%' || $1 || '%')
+    AND ($2::bigint[] IS NULL OR id = ANY($2::bigint[]))
+    AND ($3::bigint[] IS NULL OR link_id = ANY($3::bigint[]))
+    AND ($4::timestamptz IS NULL OR created_at >= $4)
+    AND ($5::timestamptz IS NULL OR created_at <= $5)
+    AND ($6::integer IS NULL OR status = $6)
+    AND ($7::text IS NULL OR ip = $7)
+    AND ($8::text IS NULL OR referer_host = $8)
+    AND ($9::timestamptz IS NULL
+        OR (created_at, id) < ($9, $10::bigint))
+ORDER BY created_at DESC, id DESC
+LIMIT $11
+`
+
+type GetVisitsPageParams struct {
+	Query          pgtype.Text        `json:"query"`
+	Ids            []int64            `json:"ids"`
+	LinkIds        []int64            `json:"link_ids"`
+	CreatedFrom    pgtype.Timestamptz `json:"created_from"`
+	CreatedTo      pgtype.Timestamptz `json:"created_to"`
+	Status         pgtype.Int4        `json:"status"`
+	Ip             pgtype.Text        `json:"ip"`
+	RefererHost    pgtype.Text        `json:"referer_host"`
+	AfterCreatedAt pgtype.Timestamptz `json:"after_created_at"`
+	AfterID        int64              `json:"after_id"`
+	Limit          int32              `json:"limit"`
+}
+
+type GetVisitsPageRow struct {
+	ID           int64              `json:"id"`
+	LinkID       int64              `json:"link_id"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	Ip           string             `json:"ip"`
+	UserAgent    string             `json:"user_agent"`
+	Status       int32              `json:"status"`
+	IsCrawler    bool               `json:"is_crawler"`
+	LinkRevision pgtype.Int4        `json:"link_revision"`
+}
+
+func (q *Queries) GetVisitsPage(ctx context.Context, arg GetVisitsPageParams) ([]GetVisitsPageRow, error) {
+	rows, err := q.db.Query(ctx, getVisitsPage,
+		arg.Query,
+		arg.Ids,
+		arg.LinkIds,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Status,
+		arg.Ip,
+		arg.RefererHost,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetVisitsPageRow
+	for rows.Next() {
+		var i GetVisitsPageRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.LinkID,
+			&i.CreatedAt,
+			&i.Ip,
+			&i.UserAgent,
+			&i.Status,
+			&i.IsCrawler,
+			&i.LinkRevision,
 		); err != nil {
 			return nil, err
 		}
@@ -99,3 +337,12 @@ func (q *Queries) GetVisits(ctx context.Context, arg GetVisitsParams) ([]GetVisi
 	}
 	return items, nil
 }
+
+const validateVisitsLinkFK = `-- name: ValidateVisitsLinkFK :exec
+ALTER TABLE visits VALIDATE CONSTRAINT visits_link_id_fkey
+`
+
+func (q *Queries) ValidateVisitsLinkFK(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, validateVisitsLinkFK)
+	return err
+}
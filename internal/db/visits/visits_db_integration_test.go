@@ -5,6 +5,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -22,12 +23,12 @@ func Test_GetTotalVisits(t *testing.T) {
 	t.Parallel()
 	withTx(t, func(ctx context.Context, q *visits.Queries) {
 		expectedTotal := int64(3)
-		visits := CreateTestVisits(t)
-		for _, v := range visits {
+		testVisits := CreateTestVisits(t)
+		for _, v := range testVisits {
 			err := q.CreateVisit(ctx, *v)
 			require.NoError(t, err)
 		}
-		total, err := q.GetTotalVisits(ctx)
+		total, err := q.GetTotalVisits(ctx, visits.GetTotalVisitsParams{})
 		require.NoError(t, err)
 		assert.Equal(t, expectedTotal, total)
 	})
@@ -36,8 +37,10 @@ func Test_GetTotalVisits(t *testing.T) {
 func Test_GetVisits(t *testing.T) {
 	t.Parallel()
 	params := visits.GetVisitsParams{
-		Limit:  2,
-		Offset: 0,
+		SortField: "created_at",
+		SortDesc:  true,
+		Limit:     2,
+		Offset:    0,
 	}
 	withTx(t, func(ctx context.Context, q *visits.Queries) {
 		visits := CreateTestVisits(t)
@@ -53,3 +56,98 @@ func Test_GetVisits(t *testing.T) {
 		assert.Equal(t, expectedIP, rows[1].Ip)
 	})
 }
+
+func Test_GetVisitsPage(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *visits.Queries) {
+		for _, v := range CreateTestVisits(t) {
+			require.NoError(t, q.CreateVisit(ctx, *v))
+		}
+		first, err := q.GetVisitsPage(ctx, visits.GetVisitsPageParams{Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, first, 2)
+
+		last := first[len(first)-1]
+		rest, err := q.GetVisitsPage(ctx, visits.GetVisitsPageParams{
+			AfterCreatedAt: last.CreatedAt,
+			AfterID:        last.ID,
+			Limit:          2,
+		})
+		require.NoError(t, err)
+		require.Len(t, rest, 1)
+		assert.Less(t, rest[0].ID, last.ID)
+
+		filtered, err := q.GetVisitsPage(ctx, visits.GetVisitsPageParams{LinkIds: []int64{1}, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, filtered, 1)
+		assert.Equal(t, "192.168.31.145", filtered[0].Ip)
+
+		_, err = q.EstimateTotalVisits(ctx)
+		require.NoError(t, err)
+	})
+}
+
+func Test_GetVisits_Filters(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *visits.Queries) {
+		for _, v := range CreateTestVisits(t) {
+			require.NoError(t, q.CreateVisit(ctx, *v))
+		}
+		require.NoError(t, q.CreateVisit(ctx, visits.CreateVisitParams{
+			LinkID:      2,
+			Ip:          "203.0.113.7",
+			UserAgent:   "TelegramBot",
+			Referer:     pgtype.Text{String: "https://t.me/channel", Valid: true},
+			Status:      200,
+			RefererHost: pgtype.Text{String: "t.me", Valid: true},
+		}))
+
+		where := visits.GetTotalVisitsParams{
+			LinkIds:     []int64{2},
+			Status:      pgtype.Int4{Int32: 200, Valid: true},
+			RefererHost: pgtype.Text{String: "t.me", Valid: true},
+		}
+		rows, err := q.GetVisits(ctx, visits.GetVisitsParams{
+			LinkIds:     where.LinkIds,
+			Status:      where.Status,
+			RefererHost: where.RefererHost,
+			Limit:       10,
+		})
+		require.NoError(t, err)
+		require.Len(t, rows, 1)
+		assert.Equal(t, "203.0.113.7", rows[0].Ip)
+
+		total, err := q.GetTotalVisits(ctx, where)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+
+		total, err = q.GetTotalVisits(ctx, visits.GetTotalVisitsParams{Ip: pgtype.Text{String: "192.168.31.145", Valid: true}})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+	})
+}
+
+func Test_ExportVisits(t *testing.T) {
+	t.Parallel()
+	withTx(t, func(ctx context.Context, q *visits.Queries) {
+		for _, v := range CreateTestVisits(t) {
+			require.NoError(t, q.CreateVisit(ctx, *v))
+		}
+		var ids []int64
+		err := q.ExportVisits(ctx, visits.ExportVisitsParams{}, func(row visits.Visit) error {
+			ids = append(ids, row.ID)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, ids, 3)
+		assert.IsIncreasing(t, ids)
+
+		var rest []int64
+		err = q.ExportVisits(ctx, visits.ExportVisitsParams{AfterID: ids[0]}, func(row visits.Visit) error {
+			rest = append(rest, row.ID)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, ids[1:], rest)
+	})
+}
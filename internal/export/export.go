@@ -0,0 +1,244 @@
+// Package export пишет ссылки и посещения в CSV, NDJSON и Parquet построчно,
+// не собирая выгрузку в памяти.
+package export
+
+import (
+	"bufio"
+	"code/internal/service"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatNDJSON  Format = "ndjson"
+	FormatParquet Format = "parquet"
+)
+
+var Formats = []Format{FormatCSV, FormatNDJSON, FormatParquet}
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// ParquetRowGroupSize - сколько строк попадает в одну группу Parquet.
+// Группа держится в памяти до записи, поэтому размер ограничен.
+const ParquetRowGroupSize = 10000
+
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(strings.TrimSpace(s)))
+	if !slices.Contains(Formats, f) {
+		return "", fmt.Errorf("%w %q, allowed: csv, ndjson, parquet", ErrUnknownFormat, s)
+	}
+	return f, nil
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+func (f Format) Extension() string {
+	return string(f)
+}
+
+// Row - строка выгрузки. Для JSON и Parquet используются теги структуры, для CSV - эти методы.
+type Row interface {
+	CSVHeader() []string
+	CSVRecord() []string
+}
+
+// LinkRow - ссылка в выгрузке.
+type LinkRow struct {
+	ID            int64      `json:"id" parquet:"id"`
+	OriginalUrl   string     `json:"original_url" parquet:"original_url"`
+	ShortName     string     `json:"short_name" parquet:"short_name"`
+	ShortUrl      string     `json:"short_url" parquet:"short_url"`
+	Title         string     `json:"title" parquet:"title"`
+	Description   string     `json:"description" parquet:"description"`
+	OgTitle       string     `json:"og_title" parquet:"og_title"`
+	OgDescription string     `json:"og_description" parquet:"og_description"`
+	OgImage       string     `json:"og_image" parquet:"og_image"`
+	HealthStatus  string     `json:"health_status" parquet:"health_status"`
+	Revision      int64      `json:"revision" parquet:"revision"`
+	CreatedAt     *time.Time `json:"created_at" parquet:"created_at,optional,timestamp(millisecond)"`
+	DeletedAt     *time.Time `json:"deleted_at" parquet:"deleted_at,optional,timestamp(millisecond)"`
+}
+
+func NewLinkRow(link *service.Link) LinkRow {
+	return LinkRow{
+		ID:            link.ID,
+		OriginalUrl:   link.OriginalUrl,
+		ShortName:     link.ShortName,
+		ShortUrl:      link.ShortUrl,
+		Title:         link.Title,
+		Description:   link.Description,
+		OgTitle:       link.OgTitle,
+		OgDescription: link.OgDescription,
+		OgImage:       link.OgImage,
+		HealthStatus:  link.HealthStatus,
+		Revision:      int64(link.Revision),
+		CreatedAt:     link.CreatedAt,
+		DeletedAt:     link.DeletedAt,
+	}
+}
+
+func (LinkRow) CSVHeader() []string {
+	return []string{"id", "original_url", "short_name", "short_url", "title", "description",
+		"og_title", "og_description", "og_image", "health_status", "revision", "created_at", "deleted_at"}
+}
+
+func (r LinkRow) CSVRecord() []string {
+	return []string{strconv.FormatInt(r.ID, 10), r.OriginalUrl, r.ShortName, r.ShortUrl, r.Title, r.Description,
+		r.OgTitle, r.OgDescription, r.OgImage, r.HealthStatus, strconv.FormatInt(r.Revision, 10),
+		formatTime(r.CreatedAt), formatTime(r.DeletedAt)}
+}
+
+// VisitRow - посещение в выгрузке.
+type VisitRow struct {
+	ID           int64     `json:"id" parquet:"id"`
+	LinkID       int64     `json:"link_id" parquet:"link_id"`
+	LinkRevision int64     `json:"link_revision" parquet:"link_revision"`
+	CreatedAt    time.Time `json:"created_at" parquet:"created_at,timestamp(millisecond)"`
+	IP           string    `json:"ip" parquet:"ip"`
+	UserAgent    string    `json:"user_agent" parquet:"user_agent"`
+	Referer      string    `json:"referer" parquet:"referer"`
+	RefererHost  string    `json:"referer_host" parquet:"referer_host"`
+	Status       int32     `json:"status" parquet:"status"`
+	IsCrawler    bool      `json:"is_crawler" parquet:"is_crawler"`
+}
+
+func NewVisitRow(visit *service.Visit) VisitRow {
+	return VisitRow{
+		ID:           int64(visit.ID),
+		LinkID:       int64(visit.Link_ID),
+		LinkRevision: int64(visit.LinkRevision),
+		CreatedAt:    visit.CreatedAt,
+		IP:           visit.IP,
+		UserAgent:    visit.UserAgent,
+		Referer:      visit.Referer,
+		RefererHost:  visit.RefererHost,
+		Status:       int32(visit.Status),
+		IsCrawler:    visit.IsCrawler,
+	}
+}
+
+func (VisitRow) CSVHeader() []string {
+	return []string{"id", "link_id", "link_revision", "created_at", "ip", "user_agent", "referer", "referer_host", "status", "is_crawler"}
+}
+
+func (r VisitRow) CSVRecord() []string {
+	return []string{strconv.FormatInt(r.ID, 10), strconv.FormatInt(r.LinkID, 10), strconv.FormatInt(r.LinkRevision, 10),
+		formatTime(&r.CreatedAt), r.IP, r.UserAgent, r.Referer, r.RefererHost,
+		strconv.Itoa(int(r.Status)), strconv.FormatBool(r.IsCrawler)}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Writer пишет строки в выбранном формате. Flush отправляет накопленное в w,
+// Close дописывает окончание файла (для Parquet - метаданные) и обязателен.
+type Writer[T Row] interface {
+	Write(row T) error
+	Flush() error
+	Close() error
+}
+
+// NewWriter создаёт Writer. Заголовок CSV пишется сразу, так что пустая выгрузка - это файл с заголовком.
+func NewWriter[T Row](format Format, w io.Writer) (Writer[T], error) {
+	switch format {
+	case FormatCSV:
+		cw := &csvWriter[T]{w: csv.NewWriter(w)}
+		var zero T
+		if err := cw.w.Write(zero.CSVHeader()); err != nil {
+			return nil, err
+		}
+		return cw, nil
+	case FormatNDJSON:
+		bw := bufio.NewWriter(w)
+		return &ndjsonWriter[T]{w: bw, enc: json.NewEncoder(bw)}, nil
+	case FormatParquet:
+		return &parquetWriter[T]{w: parquet.NewGenericWriter[T](w)}, nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+}
+
+type csvWriter[T Row] struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter[T]) Write(row T) error {
+	return c.w.Write(row.CSVRecord())
+}
+
+func (c *csvWriter[T]) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter[T]) Close() error {
+	return c.Flush()
+}
+
+type ndjsonWriter[T Row] struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter[T]) Write(row T) error {
+	return n.enc.Encode(row)
+}
+
+func (n *ndjsonWriter[T]) Flush() error {
+	return n.w.Flush()
+}
+
+func (n *ndjsonWriter[T]) Close() error {
+	return n.Flush()
+}
+
+// parquetWriter закрывает группу строк каждые ParquetRowGroupSize строк.
+// Flush между группами ничего не отправляет: незаконченная группа не может уйти в поток.
+type parquetWriter[T Row] struct {
+	w    *parquet.GenericWriter[T]
+	rows int
+}
+
+func (p *parquetWriter[T]) Write(row T) error {
+	if _, err := p.w.Write([]T{row}); err != nil {
+		return err
+	}
+	p.rows++
+	if p.rows%ParquetRowGroupSize == 0 {
+		return p.w.Flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter[T]) Flush() error {
+	return nil
+}
+
+func (p *parquetWriter[T]) Close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,82 @@
+package export_test
+
+import (
+	"bytes"
+	"code/internal/export"
+	"code/internal/service"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+	f, err := export.ParseFormat(" Parquet ")
+	require.NoError(t, err)
+	assert.Equal(t, export.FormatParquet, f)
+
+	_, err = export.ParseFormat("xlsx")
+	assert.ErrorIs(t, err, export.ErrUnknownFormat)
+}
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+	created := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	rows := []export.LinkRow{
+		export.NewLinkRow(&service.Link{ID: 1, OriginalUrl: "https://example.com/1", ShortName: "one", CreatedAt: &created}),
+		export.NewLinkRow(&service.Link{ID: 2, OriginalUrl: "https://example.com/2", ShortName: "two", DeletedAt: &created}),
+	}
+	write := func(t *testing.T, format export.Format) []byte {
+		var buf bytes.Buffer
+		w, err := export.NewWriter[export.LinkRow](format, &buf)
+		require.NoError(t, err)
+		for _, row := range rows {
+			require.NoError(t, w.Write(row))
+		}
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		t.Parallel()
+		lines := strings.Split(strings.TrimSpace(string(write(t, export.FormatCSV))), "\n")
+		require.Len(t, lines, 3)
+		assert.Equal(t, "1,https://example.com/1,one,,,,,,,,0,2026-03-04T05:06:07Z,", lines[1])
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		t.Parallel()
+		lines := strings.Split(strings.TrimSpace(string(write(t, export.FormatNDJSON))), "\n")
+		require.Len(t, lines, 2)
+		var got export.LinkRow
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &got))
+		assert.Equal(t, "two", got.ShortName)
+		assert.Nil(t, got.CreatedAt)
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		t.Parallel()
+		data := write(t, export.FormatParquet)
+		got, err := parquet.Read[export.LinkRow](bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, "one", got[0].ShortName)
+		require.NotNil(t, got[0].CreatedAt)
+		assert.True(t, created.Equal(*got[0].CreatedAt))
+		assert.Nil(t, got[1].CreatedAt)
+	})
+
+	t.Run("empty csv has header", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		w, err := export.NewWriter[export.VisitRow](export.FormatCSV, &buf)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Equal(t, "id,link_id,link_revision,created_at,ip,user_agent,referer,referer_host,status,is_crawler\n", buf.String())
+	})
+}
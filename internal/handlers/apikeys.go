@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"code/internal/logging"
+	"code/internal/service"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyAuthenticator проверяет ключи доступа, выданные командой lshortener keys create.
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, secret string) (*service.APIKey, error)
+}
+
+// RequireAPIKey пропускает только запросы с действующим ключом в заголовке Authorization: Bearer <ключ>.
+// Без ключа, с неизвестным или отозванным ключом - 401.
+func RequireAPIKey(auth APIKeyAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, secret, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(secret) == "" {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "api key required"})
+			return
+		}
+		key, err := auth.Authenticate(c.Request.Context(), strings.TrimSpace(secret))
+		switch {
+		case errors.Is(err, service.ErrInvalidAPIKey):
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			logging.FromContext(c.Request.Context()).Error("authenticate api key", "err", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		logging.FromContext(c.Request.Context()).Debug("api key accepted", "api_key_id", key.ID)
+		c.Next()
+	}
+}
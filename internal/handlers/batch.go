@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"code/internal/service"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Max_Batch_Size - сколько элементов можно передать в одном пакетном запросе
+const Max_Batch_Size = 1000
+
+// BatchLinkRequest - элемент POST /api/links/batch. С id ссылка изменяется, без - создаётся.
+type BatchLinkRequest struct {
+	ID int64 `json:"id"`
+	LinkRequest
+}
+
+// CreateLinksBatch создаёт и изменяет ссылки из массива в одной транзакции.
+// ?mode=atomic (по умолчанию) откатывает всё при любой ошибке, ?mode=best_effort сохраняет удавшиеся.
+func (h *Handler) CreateLinksBatch(c *gin.Context) {
+	mode, err := ParseBatchMode(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var requests []BatchLinkRequest
+	if err := c.ShouldBindJSON(&requests); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkBatchSize(len(requests)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inputs := make([]service.BatchLinkInput, 0, len(requests))
+	var invalid []service.BatchItemResult
+	for i, request := range requests {
+		if err := ValidateLinkRequest(&request.LinkRequest); err != nil {
+			invalid = append(invalid, service.BatchItemResult{Index: i, ID: request.ID, Status: service.BatchFailed, Error: err.Error()})
+			continue
+		}
+		shortName := request.Short_name
+		if shortName == "" && request.ID == 0 {
+			if shortName, err = service.GenerateShortName(Short_name_length); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		inputs = append(inputs, service.BatchLinkInput{Index: i, ID: request.ID, OriginalUrl: request.Original_url, ShortName: shortName})
+	}
+
+	if mode == service.BatchAtomic && len(invalid) > 0 {
+		result := &service.BatchResult{Mode: mode, Failed: len(invalid), Items: invalid}
+		for _, input := range inputs {
+			result.Items = append(result.Items, service.BatchItemResult{Index: input.Index, ID: input.ID, Status: service.BatchSkipped})
+		}
+		writeBatchResult(c, result)
+		return
+	}
+	result, err := h.linkService.CreateLinksBatch(ActorContext(c), inputs, mode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result.Items = append(result.Items, invalid...)
+	result.Failed += len(invalid)
+	writeBatchResult(c, result)
+}
+
+// DeleteLinksBatch удаляет ссылки по массиву id в одной транзакции.
+// permanent и mode - как у DeleteLinkByID и CreateLinksBatch.
+func (h *Handler) DeleteLinksBatch(c *gin.Context) {
+	mode, err := ParseBatchMode(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	permanent := false
+	if v := c.Query("permanent"); v != "" {
+		if permanent, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "permanent must be true or false"})
+			return
+		}
+	}
+	var ids []int64
+	if err := c.ShouldBindJSON(&ids); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkBatchSize(len(ids)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := h.linkService.DeleteLinksBatch(ActorContext(c), ids, permanent, mode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeBatchResult(c, result)
+}
+
+// ParseBatchMode разбирает mode=atomic|best_effort, по умолчанию atomic.
+func ParseBatchMode(c *gin.Context) (service.BatchMode, error) {
+	switch mode := service.BatchMode(c.Query("mode")); mode {
+	case "":
+		return service.BatchAtomic, nil
+	case service.BatchAtomic, service.BatchBestEffort:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("mode must be one of atomic, best_effort")
+	}
+}
+
+func checkBatchSize(n int) error {
+	switch {
+	case n == 0:
+		return errors.New("batch is empty")
+	case n > Max_Batch_Size:
+		return fmt.Errorf("batch is too large, max %d items", Max_Batch_Size)
+	}
+	return nil
+}
+
+// writeBatchResult отвечает 422, если пакет откатили, иначе 200 с результатом по каждому элементу.
+func writeBatchResult(c *gin.Context, result *service.BatchResult) {
+	slices.SortFunc(result.Items, func(a, b service.BatchItemResult) int { return a.Index - b.Index })
+	status := http.StatusOK
+	if !result.Committed {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, result)
+}
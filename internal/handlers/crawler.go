@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"code/internal/service"
+	"html/template"
+	"strings"
+)
+
+// crawlerTokens - подстроки User-Agent краулеров, которые строят превью ссылок в чатах и соцсетях.
+// Поисковые роботы сюда не входят: им отдаётся обычный редирект, а не страница с тегами превью.
+var crawlerTokens = []string{
+	"facebookexternalhit",
+	"facebot",
+	"twitterbot",
+	"slackbot",
+	"slack-imgproxy",
+	"discordbot",
+	"telegrambot",
+	"whatsapp",
+	"linkedinbot",
+	"skypeuripreview",
+	"pinterest",
+	"redditbot",
+	"vkshare",
+	"viber",
+	"embedly",
+	"iframely",
+	"mastodon",
+}
+
+// IsCrawler сообщает, что запрос пришёл от известного краулера превью.
+func IsCrawler(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, token := range crawlerTokens {
+		if strings.Contains(ua, token) {
+			return true
+		}
+	}
+	return false
+}
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta property="og:type" content="website">
+<meta property="og:url" content="{{.ShortURL}}">
+{{- if .Title}}
+<meta property="og:title" content="{{.Title}}">
+<meta name="twitter:title" content="{{.Title}}">
+{{- end}}
+{{- if .Description}}
+<meta property="og:description" content="{{.Description}}">
+<meta name="twitter:description" content="{{.Description}}">
+{{- end}}
+{{- if .Image}}
+<meta property="og:image" content="{{.Image}}">
+<meta name="twitter:image" content="{{.Image}}">
+<meta name="twitter:card" content="summary_large_image">
+{{- else}}
+<meta name="twitter:card" content="summary">
+{{- end}}
+<meta http-equiv="refresh" content="0; url={{.URL}}">
+</head>
+<body><a href="{{.URL}}">{{.URL}}</a></body>
+</html>
+`))
+
+type previewPage struct {
+	Title       string
+	Description string
+	Image       string
+	URL         string
+	ShortURL    string
+}
+
+// renderPreviewPage собирает страницу с Open Graph тегами: свои значения ссылки имеют приоритет
+// над данными, загруженными со страницы назначения.
+func renderPreviewPage(link *service.Link) ([]byte, error) {
+	page := previewPage{
+		Title:       firstNonEmpty(link.OgTitle, link.Title),
+		Description: firstNonEmpty(link.OgDescription, link.Description),
+		Image:       firstNonEmpty(link.OgImage, link.ImageURL),
+		URL:         link.OriginalUrl,
+		ShortURL:    link.ShortUrl,
+	}
+	var buf bytes.Buffer
+	if err := previewTemplate.Execute(&buf, page); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
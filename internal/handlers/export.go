@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"code/internal/export"
+	"code/internal/logging"
+	"code/internal/service"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export_Flush_Rows - через сколько строк выгрузка отправляется клиенту
+const Export_Flush_Rows = 1000
+
+// Трейлеры выгрузки. По X-Export-Last-ID прерванную выгрузку можно продолжить с after_id,
+// X-Export-Error говорит, что файл неполный.
+const (
+	exportLastIDTrailer = "X-Export-Last-ID"
+	exportErrorTrailer  = "X-Export-Error"
+	// exportFailed - что видит клиент вместо ошибки БД, сама ошибка пишется в лог
+	exportFailed = "export failed"
+)
+
+// ExportLinks выгружает ссылки с фильтрами как у GetLinks, по возрастанию id.
+// Параметры: format=csv|ndjson|parquet (по умолчанию csv), after_id - продолжить после этой ссылки.
+func (h *Handler) ExportLinks(c *gin.Context) {
+	filter, err := ParseLinkFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	streamExport(c, "links", func(ctx context.Context, afterID int64, fn func(row export.LinkRow) error) error {
+		return h.linkService.ExportLinks(ctx, filter, afterID, func(link *service.Link) error {
+			return fn(export.NewLinkRow(link))
+		})
+	}, func(row export.LinkRow) int64 { return row.ID })
+}
+
+// ExportVisits выгружает посещения с фильтрами как у GetVisits (link_id, from, to и т.д.), по возрастанию id.
+func (h *Handler) ExportVisits(c *gin.Context) {
+	filter, err := ParseVisitFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	streamExport(c, "visits", func(ctx context.Context, afterID int64, fn func(row export.VisitRow) error) error {
+		return h.visitService.ExportVisits(ctx, filter, afterID, func(visit *service.Visit) error {
+			return fn(export.NewVisitRow(visit))
+		})
+	}, func(row export.VisitRow) int64 { return row.ID })
+}
+
+// streamExport пишет строки в ответ по мере чтения из БД. Заголовки отправляются с первой строкой,
+// так что ошибку до неё клиент получает обычным JSON. После неё статус уже отправлен,
+// и об ошибке сообщает трейлер X-Export-Error. Текст ошибки клиенту не отдаётся, только в лог.
+func streamExport[T export.Row](
+	c *gin.Context,
+	name string,
+	run func(ctx context.Context, afterID int64, fn func(row T) error) error,
+	rowID func(row T) int64,
+) {
+	format, err := export.ParseFormat(c.DefaultQuery("format", string(export.FormatCSV)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var afterID int64
+	if v := c.Query("after_id"); v != "" {
+		if afterID, err = strconv.ParseInt(v, 10, 64); err != nil || afterID < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "after_id must be a non-negative integer"})
+			return
+		}
+	}
+
+	// Выгрузка может идти дольше HTTP_WRITE_TIMEOUT сервера. Ошибку игнорируем:
+	// без поддержки дедлайнов (как в httptest) снимать нечего.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	var w export.Writer[T]
+	start := func() error {
+		filename := fmt.Sprintf("%s-%s", name, time.Now().UTC().Format("20060102T150405Z"))
+		if afterID > 0 {
+			filename += fmt.Sprintf("-after-%d", afterID)
+		}
+		header := c.Writer.Header()
+		header.Set("Content-Type", format.ContentType())
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format.Extension()))
+		header.Set("Cache-Control", "no-store")
+		header.Set("Trailer", exportLastIDTrailer+", "+exportErrorTrailer)
+		c.Status(http.StatusOK)
+		var err error
+		w, err = export.NewWriter[T](format, c.Writer)
+		return err
+	}
+
+	lastID, rows := afterID, 0
+	err = run(c.Request.Context(), afterID, func(row T) error {
+		if w == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+		lastID = rowID(row)
+		if rows++; rows%Export_Flush_Rows == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	logger := logging.FromContext(c.Request.Context())
+	if w == nil {
+		if err == nil {
+			err = start()
+		}
+		if err != nil {
+			logger.Error("export", "table", name, "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": exportFailed})
+			return
+		}
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	header := c.Writer.Header()
+	header.Set(exportLastIDTrailer, strconv.FormatInt(lastID, 10))
+	if err != nil {
+		logger.Error("export interrupted", "table", name, "rows", rows, "last_id", lastID, "err", err)
+		header.Set(exportErrorTrailer, exportFailed)
+	}
+}
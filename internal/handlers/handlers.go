@@ -1,14 +1,17 @@
 package handlers
 
 import (
+	"code/internal/logging"
+	"code/internal/metrics"
+	"code/internal/qr"
 	"code/internal/service"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 
@@ -23,10 +26,17 @@ const (
 	Default_Limit     = 10
 	Default_Offset    = 0
 	Max_Limit         = 30
+	// Max_Cursor_Limit - потолок limit при пагинации по курсору
+	Max_Cursor_Limit = 100
+
+	LegacyRedirectPrefix = "/r"
+
+	// ActorHeader - кто меняет ссылку, попадает в историю ревизий
+	ActorHeader = "X-Actor"
 )
 
 type LinkRequest struct {
-	Original_url string `json:"original_url" validate:"required,url"`
+	Original_url string `json:"original_url"`
 	Short_name   string `json:"short_name"`
 }
 
@@ -57,8 +67,16 @@ func (h *Handler) CreateLink(c *gin.Context) {
 		}
 		shortName = short
 	}
-	link, err := h.linkService.CreateShortLink(c.Request.Context(), shortName, request.Original_url)
+	link, err := h.linkService.CreateShortLink(ActorContext(c), shortName, request.Original_url)
 	if err != nil {
+		if errors.Is(err, service.ErrShortNameReserved) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrShortNameTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -68,7 +86,19 @@ func (h *Handler) CreateLink(c *gin.Context) {
 }
 
 func (h *Handler) GetLinks(c *gin.Context) {
-	handleGetWithRange[*service.Link](c, h.linkService.GetLinks, "links")
+	filter, err := ParseLinkFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sort, err := ParseSort(c, service.LinkSortFields, service.DefaultLinkSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	handleGetWithRange[*service.Link](c, func(ctx context.Context, limit, offset int32) ([]*service.Link, int64, error) {
+		return h.linkService.GetLinks(ctx, filter, sort, limit, offset)
+	}, "links")
 }
 
 func (h *Handler) GetLinkByID(c *gin.Context) {
@@ -80,6 +110,9 @@ func (h *Handler) GetLinkByID(c *gin.Context) {
 		})
 		return
 	}
+	if link.Revision > 0 {
+		c.Header("ETag", LinkETag(link.Revision))
+	}
 	c.JSON(http.StatusOK, &link)
 }
 
@@ -100,8 +133,12 @@ func (h *Handler) UpdateLinkByID(c *gin.Context) {
 		shortName = short
 	}
 
-	link, err := h.linkService.UpdateLinkByID(c.Request.Context(), shortName, request.Original_url, id)
+	link, err := h.linkService.UpdateLinkByID(ActorContext(c), shortName, request.Original_url, id)
 	if err != nil {
+		if errors.Is(err, service.ErrShortNameReserved) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -110,16 +147,163 @@ func (h *Handler) UpdateLinkByID(c *gin.Context) {
 	c.JSON(http.StatusOK, &link)
 }
 
+func (h *Handler) GetLinkQR(c *gin.Context) {
+	id := GetIDFromRequest(c)
+	opts, err := ParseQROptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	img, err := h.linkService.GetLinkQR(c.Request.Context(), id, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+		case errors.Is(err, qr.ErrInvalidOption):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.Header("ETag", img.ETag)
+	// Картинка меняется при смене short_name, поэтому клиенты перепроверяют её по ETag при каждом запросе
+	c.Header("Cache-Control", "no-cache")
+	if c.GetHeader("If-None-Match") == img.ETag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, img.ContentType, img.Data)
+}
+
+type SocialPreviewRequest struct {
+	OgTitle       string `json:"og_title" validate:"max=300"`
+	OgDescription string `json:"og_description" validate:"max=1000"`
+	OgImage       string `json:"og_image" validate:"omitempty,url"`
+}
+
+func (h *Handler) UpdateLinkSocial(c *gin.Context) {
+	id := GetIDFromRequest(c)
+	var request SocialPreviewRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validator.New().Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link, err := h.linkService.UpdateLinkSocial(ActorContext(c), id, service.SocialPreview{
+		OgTitle:       request.OgTitle,
+		OgDescription: request.OgDescription,
+		OgImage:       request.OgImage,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, &link)
+}
+
+func (h *Handler) GetLinkHealth(c *gin.Context) {
+	id := GetIDFromRequest(c)
+	health, err := h.linkService.GetLinkHealth(c.Request.Context(), id, service.DefaultHealthHistory)
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, health)
+}
+
+// DeleteLinkByID переносит ссылку в корзину, ?permanent=true удаляет её окончательно.
 func (h *Handler) DeleteLinkByID(c *gin.Context) {
 	id := GetIDFromRequest(c)
-	deleted, err := h.linkService.DeleteLinkByID(c.Request.Context(), id)
+	permanent := false
+	if v := c.Query("permanent"); v != "" {
+		var err error
+		if permanent, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "permanent must be true or false"})
+			return
+		}
+	}
+	result, err := h.linkService.DeleteLinkByID(ActorContext(c), id, permanent)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
 		return
 	}
-	c.JSON(http.StatusNoContent, &deleted)
+	if result.Deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) RestoreLinkByID(c *gin.Context) {
+	id := GetIDFromRequest(c)
+	link, err := h.linkService.RestoreLinkByID(ActorContext(c), id)
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found in trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, &link)
+}
+
+func (h *Handler) GetLinkHistory(c *gin.Context) {
+	id := GetIDFromRequest(c)
+	history, err := h.linkService.GetLinkHistory(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+type RevertRequest struct {
+	Revision int32 `json:"revision" validate:"required,min=1"`
+}
+
+func (h *Handler) RevertLink(c *gin.Context) {
+	id := GetIDFromRequest(c)
+	var request RevertRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validator.New().Struct(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link, err := h.linkService.RevertLink(ActorContext(c), id, request.Revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "link or revision not found"})
+		case errors.Is(err, service.ErrRevisionNotRevertible), errors.Is(err, service.ErrShortNameReserved):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, &link)
 }
 
 func (h *Handler) RedirectByShortName(c *gin.Context) {
@@ -133,6 +317,9 @@ func (h *Handler) RedirectByShortName(c *gin.Context) {
 	link, err := h.linkService.GetOriginalURLByShortName(c.Request.Context(), shortName)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
+			if errors.Is(err, service.ErrLinkTrashed) {
+				metrics.SetRedirectOutcome(c, metrics.RedirectExpired)
+			}
 			c.JSON(http.StatusNotFound, gin.H{
 				"error": "link not found",
 			})
@@ -145,6 +332,28 @@ func (h *Handler) RedirectByShortName(c *gin.Context) {
 	}
 	userAgent := c.GetHeader("User-Agent")
 	referer := c.GetHeader("Referer")
+	isCrawler := IsCrawler(userAgent)
+
+	// Краулерам мессенджеров отдаём страницу со своими OG тегами, если они заданы для ссылки
+	if isCrawler && !link.SocialPreview.IsEmpty() {
+		page, err := renderPreviewPage(link)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err := h.visitService.CreateVisit(c.Request.Context(), link.ID, c.ClientIP(), userAgent, referer,
+			http.StatusOK, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+		return
+	}
+
 	status, err := SaveConvertToInt32(http.StatusFound)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -152,7 +361,7 @@ func (h *Handler) RedirectByShortName(c *gin.Context) {
 		})
 		return
 	}
-	err = h.visitService.CreateVisit(c.Request.Context(), link.ID, c.ClientIP(), userAgent, referer, status)
+	err = h.visitService.CreateVisit(c.Request.Context(), link.ID, c.ClientIP(), userAgent, referer, status, isCrawler)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
@@ -162,8 +371,93 @@ func (h *Handler) RedirectByShortName(c *gin.Context) {
 	c.Redirect(http.StatusFound, link.OriginalUrl)
 }
 
+// RegisterRedirectRoutes регистрирует маршруты редиректа под заданным префиксом.
+// /r/:code обслуживается всегда, чтобы ранее выданные ссылки не сломались.
+func RegisterRedirectRoutes(router gin.IRoutes, h *Handler, prefix string) {
+	router.GET(LegacyRedirectPrefix+"/:code", h.RedirectByShortName)
+	if prefix != LegacyRedirectPrefix {
+		router.GET(prefix+"/:code", h.RedirectByShortName)
+	}
+}
+
+// GetVisits отдаёт посещения в режиме range (react-admin) или, если передан cursor, постранично по курсору.
 func (h *Handler) GetVisits(c *gin.Context) {
-	handleGetWithRange[*service.Visit](c, h.visitService.GetVisits, "link_visits")
+	filter, err := ParseVisitFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.listVisits(c, filter)
+}
+
+// GetLinkVisits отдаёт посещения одной ссылки с теми же фильтрами и пагинацией, что и GetVisits.
+func (h *Handler) GetLinkVisits(c *gin.Context) {
+	id := GetIDFromRequest(c)
+	if c.IsAborted() || c.Writer.Written() {
+		return
+	}
+	if _, err := h.linkService.GetLinkByID(c.Request.Context(), id); err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := ParseVisitFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.LinkIDs = []int64{id}
+	h.listVisits(c, filter)
+}
+
+func (h *Handler) listVisits(c *gin.Context, filter service.VisitFilter) {
+	sort, err := ParseSort(c, service.VisitSortFields, service.DefaultVisitSort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		h.getVisitsPage(c, filter, sort, cursor)
+		return
+	}
+	count, err := ParseCountMode(c, service.CountExact)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	handleGetWithRange[*service.Visit](c, func(ctx context.Context, limit, offset int32) ([]*service.Visit, int64, error) {
+		return h.visitService.GetVisits(ctx, filter, sort, count, limit, offset)
+	}, "link_visits")
+}
+
+func (h *Handler) getVisitsPage(c *gin.Context, filter service.VisitFilter, sort service.Sort, cursor string) {
+	if sort != service.DefaultVisitSort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cursor pagination supports only sort by created_at DESC"})
+		return
+	}
+	limit, err := ParseLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	count, err := ParseCountMode(c, service.CountNone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := h.visitService.GetVisitsPage(c.Request.Context(), filter, cursor, limit, count)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 func GetRequestAndValidate(c *gin.Context) *LinkRequest {
@@ -176,8 +470,7 @@ func GetRequestAndValidate(c *gin.Context) *LinkRequest {
 		return &LinkRequest{}
 	}
 
-	validate := validator.New()
-	if err := validate.Struct(&request); err != nil {
+	if err := ValidateLinkRequest(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
 		})
@@ -186,6 +479,14 @@ func GetRequestAndValidate(c *gin.Context) *LinkRequest {
 	return &request
 }
 
+// ValidateLinkRequest проверяет ссылку из запроса, общая для одиночного и пакетного создания.
+func ValidateLinkRequest(request *LinkRequest) error {
+	return service.ValidateLinkInput(service.CreateLinkInput{
+		OriginalUrl: request.Original_url,
+		ShortName:   request.Short_name,
+	})
+}
+
 func GetIDFromRequest(c *gin.Context) int64 {
 	id := c.Param("id")
 	intID, err := strconv.Atoi(id)
@@ -198,18 +499,25 @@ func GetIDFromRequest(c *gin.Context) int64 {
 	return int64(intID)
 }
 
-func SetupRouter() *gin.Engine {
+// ActorContext передаёт в сервис автора изменения из заголовка X-Actor.
+func ActorContext(c *gin.Context) context.Context {
+	return service.WithActor(c.Request.Context(), strings.TrimSpace(c.GetHeader(ActorHeader)))
+}
+
+func SetupRouter(sentryDSN string) *gin.Engine {
 	// To initialize Sentry's handler, you need to initialize Sentry itself beforehand
 	if err := sentry.Init(sentry.ClientOptions{
-		Dsn: os.Getenv("SENTRY_DSN"),
+		Dsn: sentryDSN,
 		// Enable structured logs to Sentry
 		EnableLogs: true,
 	}); err != nil {
-		fmt.Printf("Sentry initialization failed: %v\n", err)
+		slog.Warn("sentry initialization failed", "err", err)
 	}
 
 	// Create my app
-	router := gin.Default()
+	router := gin.New()
+	// Recovery снаружи Sentry, чтобы Sentry успел отправить панику до того, как её перехватят
+	router.Use(logging.Recovery())
 
 	// Once it's done, you can attach the handler as one of your middleware
 	router.Use(sentrygin.New(sentrygin.Options{
@@ -264,6 +572,47 @@ func ParseAndValidateQuery(c *gin.Context) (int32, int32, error) {
 	return limit, offset, nil
 }
 
+// ParseQROptions читает параметры QR-кода из query: format, size, level, margin, fg, bg, logo.
+func ParseQROptions(c *gin.Context) (qr.Options, error) {
+	opts := qr.DefaultOptions()
+	if format := c.Query("format"); format != "" {
+		opts.Format = strings.ToLower(format)
+	}
+	if level := c.Query("level"); level != "" {
+		opts.Level = level
+	}
+	var err error
+	if size := c.Query("size"); size != "" {
+		if opts.Size, err = strconv.Atoi(size); err != nil {
+			return qr.Options{}, fmt.Errorf("invalid size: %w", err)
+		}
+	}
+	if margin := c.Query("margin"); margin != "" {
+		if opts.Margin, err = strconv.Atoi(margin); err != nil {
+			return qr.Options{}, fmt.Errorf("invalid margin: %w", err)
+		}
+	}
+	if fg := c.Query("fg"); fg != "" {
+		if opts.Foreground, err = qr.ParseColor(fg); err != nil {
+			return qr.Options{}, err
+		}
+	}
+	if bg := c.Query("bg"); bg != "" {
+		if opts.Background, err = qr.ParseColor(bg); err != nil {
+			return qr.Options{}, err
+		}
+	}
+	if logo := c.Query("logo"); logo != "" {
+		if opts.WithLogo, err = strconv.ParseBool(logo); err != nil {
+			return qr.Options{}, fmt.Errorf("invalid logo: %w", err)
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return qr.Options{}, err
+	}
+	return opts, nil
+}
+
 func SaveConvertToInt32(n int) (int32, error) {
 	if n > math.MaxInt32 || n < math.MinInt32 {
 		return 0, fmt.Errorf("integer overflow: %d", n)
@@ -286,7 +635,12 @@ func handleGetWithRange[T any](
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// При неизвестном total отдаём "*", как допускает RFC 9110
+	totalStr := "*"
+	if total != service.UnknownTotal {
+		totalStr = strconv.FormatInt(total, 10)
+	}
 	c.Header("Content-Range",
-		fmt.Sprintf("%s %d-%d/%d", resourceName, offset, limit+offset, total))
+		fmt.Sprintf("%s %d-%d/%s", resourceName, offset, limit+offset, totalStr))
 	c.JSON(http.StatusOK, items)
 }
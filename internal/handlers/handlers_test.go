@@ -4,13 +4,22 @@ import (
 	"bytes"
 	"code/internal/handlers"
 	"code/internal/handlers/mocks"
+	"code/internal/importer"
+	"code/internal/qr"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image/color"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"code/internal/service"
 
@@ -35,11 +44,23 @@ func setUpRouter(t *testing.T) (*gin.Engine, *mocks.MockLinkService, *mocks.Mock
 	// Зададим тестовые маршруты
 	router.POST("/api/links", handler.CreateLink)
 	router.GET("/api/links", handler.GetLinks)
+	router.POST("/api/links/batch", handler.CreateLinksBatch)
+	router.DELETE("/api/links/batch", handler.DeleteLinksBatch)
 	router.GET("/api/links/:id", handler.GetLinkByID)
 	router.PUT("/api/links/:id", handler.UpdateLinkByID)
 	router.DELETE("/api/links/:id", handler.DeleteLinkByID)
+	router.POST("/api/links/:id/restore", handler.RestoreLinkByID)
+	router.PATCH("/api/links/:id", handler.PatchLink)
+	router.GET("/api/links/:id/history", handler.GetLinkHistory)
+	router.POST("/api/links/:id/revert", handler.RevertLink)
+	router.GET("/api/links/:id/qr", handler.GetLinkQR)
+	router.GET("/api/links/:id/health", handler.GetLinkHealth)
+	router.GET("/api/links/:id/visits", handler.GetLinkVisits)
+	router.PUT("/api/links/:id/social", handler.UpdateLinkSocial)
 	router.GET("/r/:code", handler.RedirectByShortName)
 	router.GET("/api/link_visits", handler.GetVisits)
+	router.GET("/api/export/links", handler.ExportLinks)
+	router.GET("/api/export/visits", handler.ExportVisits)
 
 	return router, linkMock, visitMock
 }
@@ -86,6 +107,125 @@ func TestHandler_CreateLink(t *testing.T) {
 	m.AssertExpectations(t)
 }
 
+func TestHandler_CreateLink_Errors(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	m.On("CreateShortLink", mock.Anything, "taken", "https://example.com").
+		Return(&service.Link{}, service.ErrShortNameTaken).Once()
+	m.On("CreateShortLink", mock.Anything, "api", "https://example.com").
+		Return(&service.Link{}, service.ErrShortNameReserved).Once()
+
+	for name, want := range map[string]int{"taken": http.StatusConflict, "api": http.StatusBadRequest} {
+		body := `{"original_url":"https://example.com","short_name":"` + name + `"}`
+		req := httptest.NewRequest("POST", "/api/links", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, name)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestIdempotent_CreateLink(t *testing.T) {
+	t.Parallel()
+	linkMock := new(mocks.MockLinkService)
+	store := new(mocks.MockIdempotencyStore)
+	handler := handlers.NewHandler(linkMock, new(mocks.MockVisitService))
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/links", handlers.Idempotent(store), handler.CreateLink)
+
+	body := `{"original_url":"https://example.com/a","short_name":"idem"}`
+	fingerprint := service.RequestFingerprint("POST", "/api/links", []byte(body))
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/links", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(handlers.IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Первый запрос выполняется, ответ сохраняется
+	store.On("Begin", mock.Anything, "k1", fingerprint).Return(nil, nil).Once()
+	linkMock.On("CreateShortLink", mock.Anything, "idem", "https://example.com/a").
+		Return(&service.Link{ID: 1, ShortName: "idem"}, nil).Once()
+	store.On("Complete", mock.Anything, "k1", mock.MatchedBy(func(resp service.IdempotentResponse) bool {
+		return resp.StatusCode == http.StatusCreated && strings.Contains(string(resp.Body), `"short_name":"idem"`)
+	})).Return(nil).Once()
+	w := send("k1", body)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(handlers.IdempotentReplayedHeader))
+
+	// Повтор получает сохранённый ответ без создания ссылки
+	store.On("Begin", mock.Anything, "k1", fingerprint).Return(&service.IdempotentResponse{
+		StatusCode:  http.StatusCreated,
+		ContentType: "application/json; charset=utf-8",
+		Body:        []byte(`{"id":1,"short_name":"idem"}`),
+	}, nil).Once()
+	w = send("k1", body)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get(handlers.IdempotentReplayedHeader))
+	assert.JSONEq(t, `{"id":1,"short_name":"idem"}`, w.Body.String())
+
+	store.On("Begin", mock.Anything, "k1", mock.Anything).Return(nil, service.ErrIdempotencyKeyReused).Once()
+	w = send("k1", `{"original_url":"https://example.com/b"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	store.On("Begin", mock.Anything, "k2", fingerprint).Return(nil, service.ErrIdempotencyInProgress).Once()
+	w = send("k2", body)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Ошибка сервера освобождает ключ для повтора
+	store.On("Begin", mock.Anything, "k3", fingerprint).Return(nil, nil).Once()
+	linkMock.On("CreateShortLink", mock.Anything, "idem", "https://example.com/a").
+		Return(&service.Link{}, errors.New("db is down")).Once()
+	store.On("Release", mock.Anything, "k3").Return(nil).Once()
+	w = send("k3", body)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	linkMock.AssertExpectations(t)
+	store.AssertExpectations(t)
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	auth := new(mocks.MockAPIKeyAuthenticator)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/links", handlers.RequireAPIKey(auth), func(c *gin.Context) { c.Status(http.StatusOK) })
+	send := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/links", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	auth.On("Authenticate", mock.Anything, "lsk_good").Return(&service.APIKey{ID: 1, Name: "ci"}, nil).Once()
+	auth.On("Authenticate", mock.Anything, "lsk_revoked").Return(nil, service.ErrInvalidAPIKey).Once()
+	auth.On("Authenticate", mock.Anything, "lsk_db").Return(nil, errors.New("connection refused")).Once()
+
+	assert.Equal(t, http.StatusOK, send("Bearer lsk_good").Code)
+
+	// Без ключа и с чужой схемой запрос не доходит до сервиса
+	w := send("")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, send("Basic dXNlcjpwYXNz").Code)
+
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer lsk_revoked").Code)
+
+	// Ошибка базы не раскрывается клиенту
+	w = send("Bearer lsk_db")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "connection refused")
+
+	auth.AssertExpectations(t)
+}
+
 func TestHandler_GetLinks(t *testing.T) {
 	t.Parallel()
 	//Arrange
@@ -94,7 +234,7 @@ func TestHandler_GetLinks(t *testing.T) {
 	expectedShortUrl1 := "http://localhost:8080/test1"
 	expectedShortUrl2 := "http://localhost:8080/test2"
 
-	m.On("GetLinks", mock.Anything, int32(2), int32(0)).Return([]*service.Link{
+	m.On("GetLinks", mock.Anything, service.LinkFilter{}, service.DefaultLinkSort, int32(2), int32(0)).Return([]*service.Link{
 		{ID: 1, OriginalUrl: "http://test1@gmail.com/long1", ShortName: "test1", ShortUrl: "http://localhost:8080/test1"},
 		{ID: 2, OriginalUrl: "http://test2@gmail.com/long2", ShortName: "test2", ShortUrl: "http://localhost:8080/test2"},
 	}, int64(2), nil)
@@ -117,6 +257,60 @@ func TestHandler_GetLinks(t *testing.T) {
 	m.AssertExpectations(t)
 }
 
+func TestHandler_GetLinks_HealthFilter(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	m.On("GetLinks", mock.Anything, service.LinkFilter{Health: service.HealthBroken}, service.DefaultLinkSort, int32(10), int32(0)).
+		Return([]*service.Link{{ID: 3, ShortName: "dead", HealthStatus: service.HealthBroken}}, int64(1), nil).Once()
+
+	req := httptest.NewRequest("GET", "/api/links?health=broken", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response []service.Link
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response, 1)
+	assert.Equal(t, service.HealthBroken, response[0].HealthStatus)
+
+	req = httptest.NewRequest("GET", "/api/links?health=dead", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	m.AssertExpectations(t)
+}
+
+func TestHandler_GetLinkHealth(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	m.On("GetLinkHealth", mock.Anything, int64(5), int32(service.DefaultHealthHistory)).Return(&service.LinkHealth{
+		Status:              service.HealthHealthy,
+		ConsecutiveFailures: 0,
+		Checks:              []service.LinkCheck{{OK: true, StatusCode: 200, LatencyMs: 42, RedirectChain: []string{}}},
+	}, nil).Once()
+	m.On("GetLinkHealth", mock.Anything, int64(6), int32(service.DefaultHealthHistory)).
+		Return((*service.LinkHealth)(nil), service.ErrNotFound).Once()
+
+	req := httptest.NewRequest("GET", "/api/links/5/health", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response service.LinkHealth
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, service.HealthHealthy, response.Status)
+	require.Len(t, response.Checks, 1)
+	assert.Equal(t, 42, response.Checks[0].LatencyMs)
+
+	req = httptest.NewRequest("GET", "/api/links/6/health", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	m.AssertExpectations(t)
+}
+
 func TestHandler_GetLinkByID(t *testing.T) {
 	t.Parallel()
 	router, m, _ := setUpRouter(t)
@@ -176,21 +370,300 @@ func TestHandler_UpdateLinkByID(t *testing.T) {
 	m.AssertExpectations(t)
 }
 
+func TestHandler_GetLinkQR(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	linkID := int64(6)
+	opts := qr.DefaultOptions()
+	opts.Format = qr.FormatSVG
+	opts.Size = 512
+	opts.Level = "H"
+	opts.Foreground = color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+	img := &qr.Image{Data: []byte("<svg></svg>"), ContentType: "image/svg+xml", ETag: `"abc"`}
+
+	m.On("GetLinkQR", mock.Anything, linkID, opts).Return(img, nil).Twice()
+
+	url := fmt.Sprintf("/api/links/%d/qr?format=svg&size=512&level=H&fg=112233", linkID)
+	req := httptest.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	assert.Equal(t, `"abc"`, w.Header().Get("ETag"))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "<svg></svg>", w.Body.String())
+
+	req = httptest.NewRequest("GET", url, nil)
+	req.Header.Set("If-None-Match", `"abc"`)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	m.AssertExpectations(t)
+}
+
+func TestHandler_GetLinkQR_InvalidOptions(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	for _, query := range []string{"format=gif", "size=1", "level=Z", "fg=zzz", "margin=x"} {
+		req := httptest.NewRequest("GET", "/api/links/1/qr?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	m.AssertNotCalled(t, "GetLinkQR")
+}
+
 func TestHandler_DeleteLinkByID(t *testing.T) {
 	t.Parallel()
 	router, m, _ := setUpRouter(t)
 
 	linkID := int64(5)
-	expectedCode := http.StatusNoContent
+	expectedCode := http.StatusOK
 
-	m.On("DeleteLinkByID", mock.Anything, linkID).
-		Return(int64(1), nil).Once()
+	m.On("DeleteLinkByID", mock.Anything, linkID, true).
+		Return(&service.DeleteLinkResult{Deleted: 1, Permanent: true, VisitsArchived: 4}, nil).Once()
+	m.On("DeleteLinkByID", mock.Anything, int64(6), false).
+		Return(&service.DeleteLinkResult{}, nil).Once()
 
-	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/links/%d", linkID), nil)
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/links/%d?permanent=true", linkID), nil)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, expectedCode, w.Code)
+	var result service.DeleteLinkResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, int64(4), result.VisitsArchived)
+
+	req = httptest.NewRequest("DELETE", "/api/links/6", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req = httptest.NewRequest("DELETE", "/api/links/6?permanent=maybe", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	m.AssertExpectations(t)
+}
+
+func TestHandler_PatchLink(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	newURL := "https://example.com/new"
+	m.On("PatchLink", mock.Anything, int64(12), service.LinkPatch{OriginalUrl: &newURL}, []int32{4}).
+		Return(&service.Link{ID: 12, OriginalUrl: newURL, ShortName: "keep", Revision: 5}, nil).Once()
+	m.On("PatchLink", mock.Anything, int64(12), mock.Anything, []int32{3}).
+		Return(&service.Link{}, service.ErrVersionMismatch).Once()
+
+	req := httptest.NewRequest("PATCH", "/api/links/12", strings.NewReader(`{"original_url":"https://example.com/new"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"4"`)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"short_name":"keep"`)
+
+	req = httptest.NewRequest("PATCH", "/api/links/12", strings.NewReader(`{"short_name":"other"}`))
+	req.Header.Set("If-Match", `"3"`)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Адрес уже занят другой ссылкой - конфликт, а не ошибка сервера
+	takenURL := "https://example.com/taken"
+	m.On("PatchLink", mock.Anything, int64(12), service.LinkPatch{OriginalUrl: &takenURL}, []int32(nil)).
+		Return(&service.Link{}, service.ErrOriginalURLTaken).Once()
+	req = httptest.NewRequest("PATCH", "/api/links/12", strings.NewReader(`{"original_url":"https://example.com/taken"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Неверный id - один ответ, до сервиса запрос не доходит
+	req = httptest.NewRequest("PATCH", "/api/links/abc", strings.NewReader(`{"short_name":"x"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"null_field", `{"original_url":null}`, http.StatusUnprocessableEntity},
+		{"unknown_field", `{"title":"x"}`, http.StatusBadRequest},
+		{"invalid_url", `{"original_url":"not a url"}`, http.StatusBadRequest},
+		{"not_object", `["x"]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", "/api/links/12", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+	m.AssertExpectations(t)
+}
+
+func TestParseIfMatch(t *testing.T) {
+	t.Parallel()
+	assert.Nil(t, handlers.ParseIfMatch(""))
+	assert.Nil(t, handlers.ParseIfMatch("*"))
+	assert.Equal(t, []int32{3, 4}, handlers.ParseIfMatch(`"3", W/"4"`))
+	assert.Equal(t, []int32{}, handlers.ParseIfMatch(`"abc"`))
+}
+
+func TestHandler_GetLinkHistory(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	m.On("GetLinkHistory", mock.Anything, int64(9)).Return([]service.LinkRevision{
+		{Revision: 2, Action: service.RevisionUpdate, Actor: "editor"},
+		{Revision: 1, Action: service.RevisionCreate},
+	}, nil).Once()
+	m.On("GetLinkHistory", mock.Anything, int64(10)).Return([]service.LinkRevision(nil), service.ErrNotFound).Once()
+
+	req := httptest.NewRequest("GET", "/api/links/9/history", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var history []service.LinkRevision
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Len(t, history, 2)
+
+	req = httptest.NewRequest("GET", "/api/links/10/history", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	m.AssertExpectations(t)
+}
+
+func TestHandler_RevertLink(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	m.On("RevertLink", mock.MatchedBy(func(ctx context.Context) bool {
+		return service.ActorFromContext(ctx) == "editor"
+	}), int64(11), int32(1)).Return(&service.Link{ID: 11, Revision: 3}, nil).Once()
+	m.On("RevertLink", mock.Anything, int64(11), int32(2)).
+		Return(&service.Link{}, service.ErrRevisionNotRevertible).Once()
+
+	req := httptest.NewRequest("POST", "/api/links/11/revert", strings.NewReader(`{"revision":1}`))
+	req.Header.Set(handlers.ActorHeader, "editor")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"revision":3`)
+
+	req = httptest.NewRequest("POST", "/api/links/11/revert", strings.NewReader(`{"revision":2}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	req = httptest.NewRequest("POST", "/api/links/11/revert", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	m.AssertExpectations(t)
+}
+
+func TestHandler_RestoreLinkByID(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	m.On("RestoreLinkByID", mock.Anything, int64(7)).
+		Return(&service.Link{ID: 7, ShortName: "back"}, nil).Once()
+	m.On("RestoreLinkByID", mock.Anything, int64(8)).
+		Return(&service.Link{}, service.ErrNotFound).Once()
+
+	req := httptest.NewRequest("POST", "/api/links/7/restore", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"short_name":"back"`)
+
+	req = httptest.NewRequest("POST", "/api/links/8/restore", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	m.AssertExpectations(t)
+}
+
+func TestHandler_CreateLinksBatch(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	m.On("CreateLinksBatch", mock.Anything, []service.BatchLinkInput{
+		{Index: 0, OriginalUrl: "https://example.com/a", ShortName: "a"},
+		{Index: 2, ID: 5, OriginalUrl: "https://example.com/b"},
+	}, service.BatchBestEffort).Return(&service.BatchResult{
+		Mode:      service.BatchBestEffort,
+		Committed: true,
+		Succeeded: 2,
+		Items: []service.BatchItemResult{
+			{Index: 0, ID: 1, Status: service.BatchCreated},
+			{Index: 2, ID: 5, Status: service.BatchUpdated},
+		},
+	}, nil).Once()
+
+	body := `[{"original_url":"https://example.com/a","short_name":"a"},{"original_url":"not a url"},{"id":5,"original_url":"https://example.com/b"}]`
+	req := httptest.NewRequest("POST", "/api/links/batch?mode=best_effort", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var result service.BatchResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.Items, 3)
+	assert.Equal(t, service.BatchFailed, result.Items[1].Status)
+	assert.Equal(t, 1, result.Items[1].Index)
+	m.AssertExpectations(t)
+
+	// atomic с невалидным элементом отклоняется без транзакции
+	req = httptest.NewRequest("POST", "/api/links/batch", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"skipped"`)
+
+	for _, tc := range []struct{ url, body string }{
+		{"/api/links/batch", `[]`},
+		{"/api/links/batch?mode=some", `[{"original_url":"https://example.com"}]`},
+	} {
+		req = httptest.NewRequest("POST", tc.url, strings.NewReader(tc.body))
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, tc.url)
+	}
+}
+
+func TestHandler_DeleteLinksBatch(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	m.On("DeleteLinksBatch", mock.Anything, []int64{1, 2}, true, service.BatchAtomic).Return(&service.BatchResult{
+		Mode:   service.BatchAtomic,
+		Failed: 1,
+		Items: []service.BatchItemResult{
+			{Index: 0, ID: 1, Status: service.BatchRolledBack},
+			{Index: 1, ID: 2, Status: service.BatchFailed, Error: "link not found"},
+		},
+	}, nil).Once()
+
+	req := httptest.NewRequest("DELETE", "/api/links/batch?permanent=true", strings.NewReader(`[1,2]`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"committed":false`)
 	m.AssertExpectations(t)
 }
 
@@ -208,7 +681,7 @@ func TestHandler_RedirectByShortName(t *testing.T) {
 			ShortName:   shortName,
 		}, nil).Once()
 
-	visitMock.On("CreateVisit", mock.Anything, int64(1), "192.0.2.1", "curl/8.14.1", "", int32(302)).
+	visitMock.On("CreateVisit", mock.Anything, int64(1), "192.0.2.1", "curl/8.14.1", "", int32(302), false).
 		Return(nil).Once()
 
 	req := httptest.NewRequest("GET", fmt.Sprintf("/r/%s", shortName), nil)
@@ -222,6 +695,125 @@ func TestHandler_RedirectByShortName(t *testing.T) {
 	visitMock.AssertExpectations(t)
 }
 
+func TestHandler_RedirectByShortName_Crawler(t *testing.T) {
+	t.Parallel()
+	const crawlerUA = "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)"
+	router, linkMock, visitMock := setUpRouter(t)
+
+	linkMock.On("GetOriginalURLByShortName", mock.Anything, "promo").
+		Return(&service.Link{
+			ID:          2,
+			OriginalUrl: "https://shop.example.com/spring",
+			ShortName:   "promo",
+			ShortUrl:    "http://localhost:8080/r/promo",
+			Title:       "Shop",
+			Description: "Destination description",
+			SocialPreview: service.SocialPreview{
+				OgTitle: "Spring <sale>",
+				OgImage: "https://cdn.example.com/sale.png",
+			},
+		}, nil).Once()
+	linkMock.On("GetOriginalURLByShortName", mock.Anything, "plain").
+		Return(&service.Link{ID: 3, OriginalUrl: "https://example.com/plain", ShortName: "plain"}, nil).Twice()
+
+	visitMock.On("CreateVisit", mock.Anything, int64(2), "192.0.2.1", crawlerUA, "", int32(200), true).Return(nil).Once()
+	visitMock.On("CreateVisit", mock.Anything, int64(3), "192.0.2.1", crawlerUA, "", int32(302), true).Return(nil).Once()
+	visitMock.On("CreateVisit", mock.Anything, int64(3), "192.0.2.1", "Mozilla/5.0", "", int32(302), false).Return(nil).Once()
+
+	// Краулер и ссылка со своими OG тегами - страница превью
+	req := httptest.NewRequest("GET", "/r/promo", nil)
+	req.Header.Set("User-Agent", crawlerUA)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `<meta property="og:title" content="Spring &lt;sale&gt;">`)
+	assert.Contains(t, body, `<meta property="og:description" content="Destination description">`)
+	assert.Contains(t, body, `<meta property="og:image" content="https://cdn.example.com/sale.png">`)
+
+	// Краулер, но переопределений нет - обычный редирект с пометкой в visits
+	req = httptest.NewRequest("GET", "/r/plain", nil)
+	req.Header.Set("User-Agent", crawlerUA)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	// Человек - редирект
+	req = httptest.NewRequest("GET", "/r/plain", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	linkMock.AssertExpectations(t)
+	visitMock.AssertExpectations(t)
+}
+
+func TestHandler_UpdateLinkSocial(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+	preview := service.SocialPreview{OgTitle: "Title", OgDescription: "Description"}
+
+	m.On("UpdateLinkSocial", mock.Anything, int64(4), preview).
+		Return(&service.Link{ID: 4, SocialPreview: preview}, nil).Once()
+
+	jsonBody, _ := json.Marshal(map[string]string{"og_title": "Title", "og_description": "Description"})
+	req := httptest.NewRequest("PUT", "/api/links/4/social", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response service.Link
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, preview, response.SocialPreview)
+
+	jsonBody, _ = json.Marshal(map[string]string{"og_image": "not a url"})
+	req = httptest.NewRequest("PUT", "/api/links/4/social", bytes.NewBuffer(jsonBody))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	m.AssertExpectations(t)
+}
+
+func TestIsCrawler(t *testing.T) {
+	t.Parallel()
+	assert.True(t, handlers.IsCrawler("Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)"))
+	assert.True(t, handlers.IsCrawler("TelegramBot (like TwitterBot)"))
+	assert.False(t, handlers.IsCrawler("Mozilla/5.0 (X11; Linux x86_64) Chrome/120.0.0.0 Safari/537.36"))
+	assert.False(t, handlers.IsCrawler("curl/8.14.1"))
+}
+
+func TestRegisterRedirectRoutes_RootPrefix(t *testing.T) {
+	t.Parallel()
+	linkMock := new(mocks.MockLinkService)
+	visitMock := new(mocks.MockVisitService)
+	handler := handlers.NewHandler(linkMock, visitMock)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/links", handler.GetLinks)
+	handlers.RegisterRedirectRoutes(router, handler, "")
+
+	shortName := "root1"
+	expectedOriginalUrl := "https://example.com/from-root"
+	linkMock.On("GetOriginalURLByShortName", mock.Anything, shortName).
+		Return(&service.Link{ID: 7, OriginalUrl: expectedOriginalUrl, ShortName: shortName}, nil).Twice()
+	visitMock.On("CreateVisit", mock.Anything, int64(7), "192.0.2.1", "", "", int32(302), false).
+		Return(nil).Twice()
+
+	for _, path := range []string{"/" + shortName, "/r/" + shortName} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code, path)
+		assert.Equal(t, expectedOriginalUrl, w.Header().Get("Location"), path)
+	}
+	linkMock.AssertExpectations(t)
+	visitMock.AssertExpectations(t)
+}
+
 func TestHandler_GetVisits(t *testing.T) {
 	t.Parallel()
 	router, _, visitMock := setUpRouter(t)
@@ -241,7 +833,7 @@ func TestHandler_GetVisits(t *testing.T) {
 		},
 	}
 
-	visitMock.On("GetVisits", mock.Anything, int32(2), int32(0)).
+	visitMock.On("GetVisits", mock.Anything, service.VisitFilter{}, service.DefaultVisitSort, service.CountExact, int32(2), int32(0)).
 		Return(expected, int64(2), nil).Once()
 
 	req := httptest.NewRequest("GET", "/api/link_visits?range=[0,2]", nil)
@@ -258,6 +850,184 @@ func TestHandler_GetVisits(t *testing.T) {
 	visitMock.AssertExpectations(t)
 }
 
+func TestHandler_GetLinks_SortAndFilter(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC).Add(-time.Microsecond)
+	m.On("GetLinks", mock.Anything, service.LinkFilter{
+		Query:       "sale",
+		IDs:         []int64{1, 2},
+		CreatedFrom: &from,
+		CreatedTo:   &to,
+	}, service.Sort{Field: "short_name", Desc: true}, int32(10), int32(0)).
+		Return([]*service.Link{{ID: 2}, {ID: 1}}, int64(2), nil).Once()
+
+	query := url.Values{
+		"sort":   {`["short_name","DESC"]`},
+		"filter": {`{"q":"sale","id":[1,"2"],"created_at_gte":"2026-10-01T00:00:00Z","created_at_lte":"2026-10-01"}`},
+	}
+	req := httptest.NewRequest("GET", "/api/links?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	m.AssertExpectations(t)
+}
+
+func TestHandler_GetLinks_InvalidSortOrFilter(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name  string
+		query url.Values
+	}{
+		{name: "unknown_sort_field", query: url.Values{"sort": {`["password","ASC"]`}}},
+		{name: "bad_sort_order", query: url.Values{"sort": {`["id","UP"]`}}},
+		{name: "malformed_sort", query: url.Values{"sort": {`id`}}},
+		{name: "unknown_filter", query: url.Values{"filter": {`{"owner":"me"}`}}},
+		{name: "bad_id", query: url.Values{"filter": {`{"id":["abc"]}`}}},
+		{name: "bad_date", query: url.Values{"filter": {`{"created_at_gte":"yesterday"}`}}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			router, m, _ := setUpRouter(t)
+
+			req := httptest.NewRequest("GET", "/api/links?"+tc.query.Encode(), nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			m.AssertNotCalled(t, "GetLinks")
+		})
+	}
+}
+
+func TestHandler_GetVisits_FilterByLink(t *testing.T) {
+	t.Parallel()
+	router, _, visitMock := setUpRouter(t)
+
+	visitMock.On("GetVisits", mock.Anything, service.VisitFilter{LinkIDs: []int64{7}},
+		service.Sort{Field: "status"}, service.CountExact, int32(10), int32(0)).
+		Return([]*service.Visit{{ID: 1, Link_ID: 7}}, int64(1), nil).Once()
+
+	query := url.Values{
+		"sort":   {`["status","ASC"]`},
+		"filter": {`{"link_id":7}`},
+	}
+	req := httptest.NewRequest("GET", "/api/link_visits?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "link_visits 0-10/1", w.Header().Get("Content-Range"))
+	visitMock.AssertExpectations(t)
+}
+
+func TestHandler_GetVisits_Cursor(t *testing.T) {
+	t.Parallel()
+	router, _, visitMock := setUpRouter(t)
+
+	visitMock.On("GetVisitsPage", mock.Anything, service.VisitFilter{}, "", int32(100), service.CountNone).
+		Return(&service.VisitPage{Items: []*service.Visit{{ID: 3}}, NextCursor: "next"}, nil).Once()
+	visitMock.On("GetVisitsPage", mock.Anything, service.VisitFilter{}, "broken", int32(10), service.CountNone).
+		Return((*service.VisitPage)(nil), service.ErrInvalidCursor).Once()
+
+	req := httptest.NewRequest("GET", "/api/link_visits?cursor=&limit=500", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var page service.VisitPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, "next", page.NextCursor)
+	require.Len(t, page.Items, 1)
+
+	req = httptest.NewRequest("GET", "/api/link_visits?cursor=broken", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	query := url.Values{"cursor": {""}, "sort": {`["status","ASC"]`}}
+	req = httptest.NewRequest("GET", "/api/link_visits?"+query.Encode(), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	visitMock.AssertExpectations(t)
+}
+
+func TestHandler_GetVisits_WithoutCount(t *testing.T) {
+	t.Parallel()
+	router, _, visitMock := setUpRouter(t)
+
+	visitMock.On("GetVisits", mock.Anything, service.VisitFilter{}, service.DefaultVisitSort, service.CountNone, int32(10), int32(0)).
+		Return([]*service.Visit{}, service.UnknownTotal, nil).Once()
+
+	req := httptest.NewRequest("GET", "/api/link_visits?count=none", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "link_visits 0-10/*", w.Header().Get("Content-Range"))
+	visitMock.AssertExpectations(t)
+}
+
+func TestHandler_GetLinkVisits(t *testing.T) {
+	t.Parallel()
+	router, linkMock, visitMock := setUpRouter(t)
+
+	from := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC).Add(-time.Microsecond)
+	linkMock.On("GetLinkByID", mock.Anything, int64(5)).Return(&service.Link{ID: 5}, nil).Once()
+	linkMock.On("GetLinkByID", mock.Anything, int64(6)).Return(&service.Link{}, service.ErrNotFound).Once()
+	visitMock.On("GetVisits", mock.Anything, service.VisitFilter{
+		LinkIDs:     []int64{5},
+		CreatedFrom: &from,
+		CreatedTo:   &to,
+		Status:      302,
+		IP:          "203.0.113.7",
+		RefererHost: "t.me",
+	}, service.DefaultVisitSort, service.CountExact, int32(10), int32(0)).
+		Return([]*service.Visit{{ID: 1, Link_ID: 5}}, int64(1), nil).Once()
+
+	query := url.Values{
+		"from":         {"2026-10-01T08:00:00Z"},
+		"to":           {"2026-10-01"},
+		"status":       {"302"},
+		"ip":           {"203.0.113.7"},
+		"referer_host": {"t.me"},
+		// link_id из запроса не может расширить выборку за пределы ссылки из пути
+		"link_id": {"9"},
+	}
+	req := httptest.NewRequest("GET", "/api/links/5/visits?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "link_visits 0-10/1", w.Header().Get("Content-Range"))
+
+	req = httptest.NewRequest("GET", "/api/links/6/visits", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	linkMock.AssertExpectations(t)
+	visitMock.AssertExpectations(t)
+}
+
+func TestHandler_GetVisits_InvalidStatus(t *testing.T) {
+	t.Parallel()
+	router, _, visitMock := setUpRouter(t)
+
+	req := httptest.NewRequest("GET", "/api/link_visits?status=ok", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	visitMock.AssertNotCalled(t, "GetVisits")
+}
+
 func TestSaveConvertToInt32(t *testing.T) {
 	t.Parallel()
 	var testCases = []struct {
@@ -336,3 +1106,175 @@ func TestGetIDFromRequest(t *testing.T) {
 	got := handlers.GetIDFromRequest(c)
 	assert.Equal(t, want, got)
 }
+
+func TestImportHandler(t *testing.T) {
+	t.Parallel()
+	m := new(mocks.MockImportService)
+	h := handlers.NewImportHandler(m, 64)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/imports", h.CreateImport)
+	router.GET("/api/imports/:id", h.GetImport)
+
+	body := "url\nhttps://example.com\n"
+	m.On("CreateImport", mock.Anything, importer.FormatYOURLS, importer.Mapping{"original_url": "url"}, []byte(body), true).
+		Return(&service.ImportJob{ID: 3, Format: "yourls", DryRun: true, Status: service.ImportPending}, nil).Once()
+	m.On("GetImport", mock.Anything, int64(3)).
+		Return(&service.ImportJob{ID: 3, Status: service.ImportDone, Total: 1, Created: 1}, nil).Once()
+	m.On("GetImport", mock.Anything, int64(4)).Return(nil, service.ErrNotFound).Once()
+
+	req := httptest.NewRequest("POST", `/api/imports?format=yourls&dry_run=true&mapping={"original_url":"url"}`, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "/api/imports/3", w.Header().Get("Location"))
+
+	req = httptest.NewRequest("GET", "/api/imports/3", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"created_rows":1`)
+
+	req = httptest.NewRequest("GET", "/api/imports/4", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	for _, tc := range []struct {
+		url, body string
+		code      int
+	}{
+		{"/api/imports?format=xlsx", body, http.StatusBadRequest},
+		{"/api/imports", "", http.StatusBadRequest},
+		{"/api/imports", strings.Repeat("x", 65), http.StatusRequestEntityTooLarge},
+	} {
+		req = httptest.NewRequest("POST", tc.url, strings.NewReader(tc.body))
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.code, w.Code, tc.url)
+	}
+	m.AssertExpectations(t)
+}
+
+func TestHandler_ExportLinks(t *testing.T) {
+	t.Parallel()
+	router, m, _ := setUpRouter(t)
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	links := []*service.Link{
+		{ID: 5, OriginalUrl: "https://example.com/a", ShortName: "a", ShortUrl: "http://localhost:8080/a", CreatedAt: &created, Revision: 1},
+		{ID: 7, OriginalUrl: "https://example.com/b,c", ShortName: "b", ShortUrl: "http://localhost:8080/b", CreatedAt: &created, Revision: 2},
+	}
+	m.On("ExportLinks", mock.Anything, service.LinkFilter{Health: service.HealthBroken}, int64(3)).Return(links, nil).Once()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/export/links?format=csv&after_id=3&health=broken", nil)
+	router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="links-\d{8}T\d{6}Z-after-3\.csv"$`, resp.Header.Get("Content-Disposition"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "id,original_url,short_name"))
+	assert.Equal(t, `7,"https://example.com/b,c",b,http://localhost:8080/b,,,,,,,2,2026-01-02T03:04:05Z,`, lines[2])
+	assert.Equal(t, "7", resp.Trailer.Get("X-Export-Last-ID"))
+	assert.Empty(t, resp.Trailer.Get("X-Export-Error"))
+	m.AssertExpectations(t)
+}
+
+func TestHandler_ExportVisits(t *testing.T) {
+	t.Parallel()
+
+	t.Run("error before first row", func(t *testing.T) {
+		t.Parallel()
+		router, _, vm := setUpRouter(t)
+		vm.On("ExportVisits", mock.Anything, service.VisitFilter{LinkIDs: []int64{4}}, int64(0)).
+			Return([]*service.Visit{}, errors.New("db down")).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/export/visits?link_id=4", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Empty(t, w.Header().Get("Content-Disposition"))
+		assert.NotContains(t, w.Body.String(), "db down")
+	})
+
+	t.Run("error mid-stream", func(t *testing.T) {
+		t.Parallel()
+		router, _, vm := setUpRouter(t)
+		visits := []*service.Visit{{ID: 10, Link_ID: 4, Status: 302}, {ID: 11, Link_ID: 4, Status: 302}}
+		vm.On("ExportVisits", mock.Anything, service.VisitFilter{}, int64(0)).Return(visits, errors.New("db down")).Once()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/export/visits?format=ndjson", nil)
+		router.ServeHTTP(w, req)
+
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+		assert.Len(t, strings.Split(strings.TrimSpace(w.Body.String()), "\n"), 2)
+		assert.Equal(t, "11", resp.Trailer.Get("X-Export-Last-ID"))
+		assert.Equal(t, "export failed", resp.Trailer.Get("X-Export-Error"))
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		t.Parallel()
+		router, _, _ := setUpRouter(t)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/export/visits?format=xlsx", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestProbes(t *testing.T) {
+	t.Parallel()
+	probes := handlers.NewProbes()
+	dbErr := errors.New("connection refused")
+	var failing atomic.Bool
+	probes.AddCheck("database", func(ctx context.Context) error {
+		if failing.Load() {
+			return dbErr
+		}
+		return nil
+	})
+	probes.AddCheck("workers", func(ctx context.Context) error { return nil })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/healthz", probes.Healthz)
+	router.GET("/readyz", probes.Readyz)
+
+	get := func(path string) (int, handlers.ReadinessReport) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, req)
+		var report handlers.ReadinessReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+
+	code, report := get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, handlers.ProbeOK, report.Status)
+	assert.Len(t, report.Components, 2)
+
+	failing.Store(true)
+	code, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, handlers.ProbeFail, report.Status)
+	assert.Equal(t, handlers.ComponentStatus{Status: handlers.ProbeFail, Error: dbErr.Error()},
+		handlers.ComponentStatus{Status: report.Components["database"].Status, Error: report.Components["database"].Error})
+	assert.Equal(t, handlers.ProbeOK, report.Components["workers"].Status)
+
+	failing.Store(false)
+	probes.SetShuttingDown()
+	code, report = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, handlers.ProbeShuttingDown, report.Status)
+
+	code, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+}
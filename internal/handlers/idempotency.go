@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bytes"
+	"code/internal/logging"
+	"code/internal/service"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader помечает ответ, повторённый из сохранённого
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// IdempotencyStore хранит ответы на запросы с Idempotency-Key.
+type IdempotencyStore interface {
+	Begin(ctx context.Context, key, fingerprint string) (*service.IdempotentResponse, error)
+	Complete(ctx context.Context, key string, resp service.IdempotentResponse) error
+	Release(ctx context.Context, key string) error
+}
+
+// Idempotent повторяет сохранённый ответ для запросов с уже встречавшимся Idempotency-Key.
+// Тот же ключ с другим телом - 422, пока первый запрос выполняется - 409.
+// Ответы 5xx не сохраняются, такой запрос можно повторить с тем же ключом.
+func Idempotent(store IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		replay, err := store.Begin(c.Request.Context(), key, service.RequestFingerprint(c.Request.Method, path, body))
+		switch {
+		case errors.Is(err, service.ErrIdempotencyKeyReused):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, service.ErrIdempotencyInProgress):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if replay != nil {
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(replay.StatusCode, replay.ContentType, replay.Body)
+			c.Abort()
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = rec
+		// Ответ сохраняется и после отмены запроса клиентом
+		ctx := context.WithoutCancel(c.Request.Context())
+		completed := false
+		defer func() {
+			if !completed {
+				if err := store.Release(ctx, key); err != nil {
+					logging.FromContext(ctx).Error("release idempotency key", "err", err)
+				}
+			}
+		}()
+		c.Next()
+
+		if rec.Status() >= http.StatusInternalServerError {
+			return
+		}
+		if err := store.Complete(ctx, key, service.IdempotentResponse{
+			StatusCode:  rec.Status(),
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body.Bytes(),
+		}); err != nil {
+			logging.FromContext(ctx).Error("save idempotent response", "err", err)
+			return
+		}
+		completed = true
+	}
+}
+
+// responseRecorder копирует тело ответа, чтобы его можно было сохранить.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
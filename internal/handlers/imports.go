@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"code/internal/importer"
+	"code/internal/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportHandler принимает файлы для импорта ссылок и показывает прогресс задач.
+type ImportHandler struct {
+	imports service.ImportServer
+	maxSize int64
+}
+
+func NewImportHandler(imports service.ImportServer, maxSize int64) *ImportHandler {
+	return &ImportHandler{imports: imports, maxSize: maxSize}
+}
+
+// CreateImport ставит файл в очередь импорта и сразу отвечает 202 с задачей.
+// Файл - тело запроса или поле file в multipart/form-data.
+// Параметры: format=csv|ndjson|bitly|yourls (по умолчанию csv), dry_run=true,
+// mapping={"original_url":"Destination"} - колонки файла для полей ссылки.
+func (h *ImportHandler) CreateImport(c *gin.Context) {
+	format, err := importer.ParseFormat(c.DefaultQuery("format", string(importer.FormatCSV)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	dryRun := false
+	if v := c.Query("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+			return
+		}
+	}
+	var mapping importer.Mapping
+	if v := c.Query("mapping"); v != "" {
+		if err := json.Unmarshal([]byte(v), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid mapping: %v", err)})
+			return
+		}
+	}
+
+	payload, err := h.readPayload(c)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file is larger than %d bytes", h.maxSize)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(payload) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is empty"})
+		return
+	}
+
+	job, err := h.imports.CreateImport(ActorContext(c), format, mapping, payload, dryRun)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidImport) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Location", fmt.Sprintf("/api/imports/%d", job.ID))
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *ImportHandler) readPayload(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxSize)
+	if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		return io.ReadAll(c.Request.Body)
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// GetImport отдаёт статус, прогресс и отчёт об ошибках задачи импорта.
+func (h *ImportHandler) GetImport(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid import id"})
+		return
+	}
+	job, err := h.imports.GetImport(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "import not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
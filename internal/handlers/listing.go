@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bytes"
+	"code/internal/service"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseSort разбирает параметр react-admin sort=["field","ASC"].
+// Поле должно входить в allowed, без параметра возвращается def.
+func ParseSort(c *gin.Context, allowed []string, def service.Sort) (service.Sort, error) {
+	query := c.Query("sort")
+	if query == "" {
+		return def, nil
+	}
+	var parts []string
+	if err := json.Unmarshal([]byte(query), &parts); err != nil || len(parts) != 2 {
+		return service.Sort{}, fmt.Errorf(`sort must look like ["field","ASC"]`)
+	}
+	if !slices.Contains(allowed, parts[0]) {
+		return service.Sort{}, fmt.Errorf("can't sort by %q, allowed: %s", parts[0], strings.Join(allowed, ", "))
+	}
+	switch strings.ToUpper(parts[1]) {
+	case "ASC":
+		return service.Sort{Field: parts[0]}, nil
+	case "DESC":
+		return service.Sort{Field: parts[0], Desc: true}, nil
+	default:
+		return service.Sort{}, fmt.Errorf("sort order must be ASC or DESC")
+	}
+}
+
+type linkFilterQuery struct {
+	Q            string    `json:"q"`
+	ID           idList    `json:"id"`
+	ShortName    string    `json:"short_name"`
+	Health       string    `json:"health"`
+	CreatedAtGte *dateTime `json:"created_at_gte"`
+	CreatedAtLte *dateTime `json:"created_at_lte"`
+	Deleted      bool      `json:"deleted"`
+}
+
+type visitFilterQuery struct {
+	Q            string    `json:"q"`
+	ID           idList    `json:"id"`
+	LinkID       idList    `json:"link_id"`
+	CreatedAtGte *dateTime `json:"created_at_gte"`
+	CreatedAtLte *dateTime `json:"created_at_lte"`
+	Status       int32     `json:"status"`
+	IP           string    `json:"ip"`
+	RefererHost  string    `json:"referer_host"`
+}
+
+// ParseLinkFilter разбирает filter={...} для списка ссылок. {"deleted":true} показывает корзину.
+// Для совместимости поддерживается и отдельный параметр health.
+func ParseLinkFilter(c *gin.Context) (service.LinkFilter, error) {
+	var query linkFilterQuery
+	if err := decodeFilter(c, &query); err != nil {
+		return service.LinkFilter{}, err
+	}
+	filter := service.LinkFilter{
+		Health:      firstNonEmpty(query.Health, c.Query("health")),
+		Query:       query.Q,
+		IDs:         query.ID,
+		ShortName:   query.ShortName,
+		CreatedFrom: query.CreatedAtGte.from(),
+		CreatedTo:   query.CreatedAtLte.to(),
+		Deleted:     query.Deleted,
+	}
+	switch filter.Health {
+	case "", service.HealthUnknown, service.HealthHealthy, service.HealthBroken:
+	default:
+		return service.LinkFilter{}, fmt.Errorf("health must be one of unknown, healthy, broken")
+	}
+	return filter, nil
+}
+
+// ParseVisitFilter разбирает filter={...} для списка посещений, а также отдельные параметры
+// link_id, from, to, status, ip и referer_host. Отдельные параметры имеют приоритет над filter.
+func ParseVisitFilter(c *gin.Context) (service.VisitFilter, error) {
+	var query visitFilterQuery
+	if err := decodeFilter(c, &query); err != nil {
+		return service.VisitFilter{}, err
+	}
+	if v := c.Query("link_id"); v != "" {
+		if err := query.LinkID.UnmarshalJSON([]byte(v)); err != nil {
+			return service.VisitFilter{}, fmt.Errorf("link_id: %w", err)
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := parseDateTime(v)
+		if err != nil {
+			return service.VisitFilter{}, fmt.Errorf("from: %w", err)
+		}
+		query.CreatedAtGte = from
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := parseDateTime(v)
+		if err != nil {
+			return service.VisitFilter{}, fmt.Errorf("to: %w", err)
+		}
+		query.CreatedAtLte = to
+	}
+	if v := c.Query("status"); v != "" {
+		status, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || status < 100 || status > 599 {
+			return service.VisitFilter{}, fmt.Errorf("status must be an HTTP status code")
+		}
+		query.Status = int32(status)
+	}
+	if v := c.Query("ip"); v != "" {
+		query.IP = v
+	}
+	if v := c.Query("referer_host"); v != "" {
+		query.RefererHost = v
+	}
+	return service.VisitFilter{
+		Query:       query.Q,
+		IDs:         query.ID,
+		LinkIDs:     query.LinkID,
+		CreatedFrom: query.CreatedAtGte.from(),
+		CreatedTo:   query.CreatedAtLte.to(),
+		Status:      query.Status,
+		IP:          query.IP,
+		RefererHost: query.RefererHost,
+	}, nil
+}
+
+// decodeFilter не пропускает неизвестные поля, чтобы опечатка в фильтре не возвращала все записи.
+func decodeFilter(c *gin.Context, dst any) error {
+	query := c.Query("filter")
+	if query == "" {
+		return nil
+	}
+	dec := json.NewDecoder(strings.NewReader(query))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+	return nil
+}
+
+// idList принимает как одиночный id (getManyReference), так и массив (getMany).
+type idList []int64
+
+func (l *idList) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var raw []json.RawMessage
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+	} else {
+		raw = []json.RawMessage{data}
+	}
+	ids := make([]int64, 0, len(raw))
+	for _, r := range raw {
+		id, err := strconv.ParseInt(strings.Trim(string(r), `"`), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid id %s", r)
+		}
+		ids = append(ids, id)
+	}
+	*l = ids
+	return nil
+}
+
+// dateTime - граница диапазона дат: RFC 3339 или просто дата (2006-01-02).
+type dateTime struct {
+	t        time.Time
+	dateOnly bool
+}
+
+func (d *dateTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("date must be a string: %w", err)
+	}
+	parsed, err := parseDateTime(s)
+	if err != nil {
+		return err
+	}
+	*d = *parsed
+	return nil
+}
+
+func parseDateTime(s string) (*dateTime, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &dateTime{t: t}, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q", s)
+	}
+	return &dateTime{t: t, dateOnly: true}, nil
+}
+
+func (d *dateTime) from() *time.Time {
+	if d == nil {
+		return nil
+	}
+	return &d.t
+}
+
+// to для даты без времени включает весь этот день.
+func (d *dateTime) to() *time.Time {
+	if d == nil {
+		return nil
+	}
+	t := d.t
+	if d.dateOnly {
+		t = t.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return &t
+}
+
+// ParseLimit разбирает limit для пагинации по курсору.
+func ParseLimit(c *gin.Context) (int32, error) {
+	query := c.Query("limit")
+	if query == "" {
+		return Default_Limit, nil
+	}
+	limit, err := strconv.Atoi(query)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("limit must be a positive integer")
+	}
+	return int32(min(limit, Max_Cursor_Limit)), nil
+}
+
+// ParseCountMode разбирает count=exact|estimate|none.
+func ParseCountMode(c *gin.Context, def service.CountMode) (service.CountMode, error) {
+	switch mode := service.CountMode(c.Query("count")); mode {
+	case "":
+		return def, nil
+	case service.CountExact, service.CountEstimate, service.CountNone:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("count must be one of exact, estimate, none")
+	}
+}
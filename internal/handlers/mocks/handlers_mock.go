@@ -1,6 +1,8 @@
 package mocks
 
 import (
+	"code/internal/importer"
+	"code/internal/qr"
 	"code/internal/service"
 	"context"
 
@@ -16,8 +18,8 @@ func (m *MockLinkService) CreateShortLink(ctx context.Context, shortname, origin
 	return args.Get(0).(*service.Link), args.Error(1)
 }
 
-func (m *MockLinkService) GetLinks(ctx context.Context, limit, offset int32) ([]*service.Link, int64, error) {
-	args := m.Called(ctx, limit, offset)
+func (m *MockLinkService) GetLinks(ctx context.Context, filter service.LinkFilter, sort service.Sort, limit, offset int32) ([]*service.Link, int64, error) {
+	args := m.Called(ctx, filter, sort, limit, offset)
 	return args.Get(0).([]*service.Link), args.Get(1).(int64), args.Error(2)
 }
 
@@ -31,9 +33,29 @@ func (m *MockLinkService) UpdateLinkByID(ctx context.Context, shortName, origina
 	return args.Get(0).(*service.Link), args.Error(1)
 }
 
-func (m *MockLinkService) DeleteLinkByID(ctx context.Context, id int64) (int64, error) {
+func (m *MockLinkService) DeleteLinkByID(ctx context.Context, id int64, permanent bool) (*service.DeleteLinkResult, error) {
+	args := m.Called(ctx, id, permanent)
+	return args.Get(0).(*service.DeleteLinkResult), args.Error(1)
+}
+
+func (m *MockLinkService) GetLinkHistory(ctx context.Context, id int64) ([]service.LinkRevision, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).([]service.LinkRevision), args.Error(1)
+}
+
+func (m *MockLinkService) RevertLink(ctx context.Context, id int64, revision int32) (*service.Link, error) {
+	args := m.Called(ctx, id, revision)
+	return args.Get(0).(*service.Link), args.Error(1)
+}
+
+func (m *MockLinkService) PatchLink(ctx context.Context, id int64, patch service.LinkPatch, expectedRevisions []int32) (*service.Link, error) {
+	args := m.Called(ctx, id, patch, expectedRevisions)
+	return args.Get(0).(*service.Link), args.Error(1)
+}
+
+func (m *MockLinkService) RestoreLinkByID(ctx context.Context, id int64) (*service.Link, error) {
 	args := m.Called(ctx, id)
-	return args.Get(0).(int64), args.Error(1)
+	return args.Get(0).(*service.Link), args.Error(1)
 }
 
 func (m *MockLinkService) GetOriginalURLByShortName(ctx context.Context, shortName string) (*service.Link, error) {
@@ -41,16 +63,113 @@ func (m *MockLinkService) GetOriginalURLByShortName(ctx context.Context, shortNa
 	return args.Get(0).(*service.Link), args.Error(1)
 }
 
+func (m *MockLinkService) GetLinkQR(ctx context.Context, id int64, opts qr.Options) (*qr.Image, error) {
+	args := m.Called(ctx, id, opts)
+	return args.Get(0).(*qr.Image), args.Error(1)
+}
+
+func (m *MockLinkService) UpdateLinkSocial(ctx context.Context, id int64, preview service.SocialPreview) (*service.Link, error) {
+	args := m.Called(ctx, id, preview)
+	return args.Get(0).(*service.Link), args.Error(1)
+}
+
+func (m *MockLinkService) GetLinkHealth(ctx context.Context, id int64, limit int32) (*service.LinkHealth, error) {
+	args := m.Called(ctx, id, limit)
+	return args.Get(0).(*service.LinkHealth), args.Error(1)
+}
+
 type MockVisitService struct {
 	mock.Mock
 }
 
-func (vm *MockVisitService) CreateVisit(ctx context.Context, id int64, ip, agent string, referer string, status int32) error {
-	args := vm.Called(ctx, id, ip, agent, referer, status)
+func (vm *MockVisitService) CreateVisit(ctx context.Context, id int64, ip, agent string, referer string, status int32, isCrawler bool) error {
+	args := vm.Called(ctx, id, ip, agent, referer, status, isCrawler)
 	return args.Error(0)
 }
 
-func (vm *MockVisitService) GetVisits(ctx context.Context, limit, offset int32) ([]*service.Visit, int64, error) {
-	args := vm.Called(ctx, limit, offset)
+func (vm *MockVisitService) GetVisits(ctx context.Context, filter service.VisitFilter, sort service.Sort, count service.CountMode, limit, offset int32) ([]*service.Visit, int64, error) {
+	args := vm.Called(ctx, filter, sort, count, limit, offset)
 	return args.Get(0).([]*service.Visit), args.Get(1).(int64), args.Error(2)
 }
+
+func (vm *MockVisitService) GetVisitsPage(ctx context.Context, filter service.VisitFilter, cursor string, limit int32, count service.CountMode) (*service.VisitPage, error) {
+	args := vm.Called(ctx, filter, cursor, limit, count)
+	return args.Get(0).(*service.VisitPage), args.Error(1)
+}
+
+type MockIdempotencyStore struct {
+	mock.Mock
+}
+
+func (m *MockIdempotencyStore) Begin(ctx context.Context, key, fingerprint string) (*service.IdempotentResponse, error) {
+	args := m.Called(ctx, key, fingerprint)
+	resp, _ := args.Get(0).(*service.IdempotentResponse)
+	return resp, args.Error(1)
+}
+
+func (m *MockIdempotencyStore) Complete(ctx context.Context, key string, resp service.IdempotentResponse) error {
+	args := m.Called(ctx, key, resp)
+	return args.Error(0)
+}
+
+func (m *MockIdempotencyStore) Release(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+type MockAPIKeyAuthenticator struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyAuthenticator) Authenticate(ctx context.Context, secret string) (*service.APIKey, error) {
+	args := m.Called(ctx, secret)
+	key, _ := args.Get(0).(*service.APIKey)
+	return key, args.Error(1)
+}
+
+func (m *MockLinkService) CreateLinksBatch(ctx context.Context, items []service.BatchLinkInput, mode service.BatchMode) (*service.BatchResult, error) {
+	args := m.Called(ctx, items, mode)
+	return args.Get(0).(*service.BatchResult), args.Error(1)
+}
+
+func (m *MockLinkService) DeleteLinksBatch(ctx context.Context, ids []int64, permanent bool, mode service.BatchMode) (*service.BatchResult, error) {
+	args := m.Called(ctx, ids, permanent, mode)
+	return args.Get(0).(*service.BatchResult), args.Error(1)
+}
+
+type MockImportService struct {
+	mock.Mock
+}
+
+func (m *MockImportService) CreateImport(ctx context.Context, format importer.Format, mapping importer.Mapping, payload []byte, dryRun bool) (*service.ImportJob, error) {
+	args := m.Called(ctx, format, mapping, payload, dryRun)
+	job, _ := args.Get(0).(*service.ImportJob)
+	return job, args.Error(1)
+}
+
+func (m *MockImportService) GetImport(ctx context.Context, id int64) (*service.ImportJob, error) {
+	args := m.Called(ctx, id)
+	job, _ := args.Get(0).(*service.ImportJob)
+	return job, args.Error(1)
+}
+
+// ExportLinks передаёт в fn ссылки, заданные в Return, и возвращает ошибку из Return.
+func (m *MockLinkService) ExportLinks(ctx context.Context, filter service.LinkFilter, afterID int64, fn func(link *service.Link) error) error {
+	args := m.Called(ctx, filter, afterID)
+	for _, link := range args.Get(0).([]*service.Link) {
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (vm *MockVisitService) ExportVisits(ctx context.Context, filter service.VisitFilter, afterID int64, fn func(visit *service.Visit) error) error {
+	args := vm.Called(ctx, filter, afterID)
+	for _, visit := range args.Get(0).([]*service.Visit) {
+		if err := fn(visit); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
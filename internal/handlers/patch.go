@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"code/internal/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// errNullField - merge patch пытается удалить обязательное поле
+var errNullField = errors.New("field can't be null")
+
+// PatchLink частично обновляет ссылку по JSON Merge Patch (RFC 7396).
+// Если передан If-Match, а ссылку уже изменили, возвращается 412.
+func (h *Handler) PatchLink(c *gin.Context) {
+	id := GetIDFromRequest(c)
+	if c.IsAborted() || c.Writer.Written() {
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	patch, err := ParseLinkPatch(body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errNullField) {
+			status = http.StatusUnprocessableEntity
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	link, err := h.linkService.PatchLink(ActorContext(c), id, patch, ParseIfMatch(c.GetHeader("If-Match")))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "link not found"})
+		case errors.Is(err, service.ErrVersionMismatch):
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrShortNameTaken), errors.Is(err, service.ErrOriginalURLTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrShortNameReserved):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.Header("ETag", LinkETag(link.Revision))
+	c.JSON(http.StatusOK, &link)
+}
+
+// ParseLinkPatch разбирает тело merge patch. Отсутствующее поле не меняется,
+// null для original_url и short_name недопустим, неизвестные поля - ошибка.
+func ParseLinkPatch(body []byte) (service.LinkPatch, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return service.LinkPatch{}, fmt.Errorf("merge patch must be a JSON object: %w", err)
+	}
+	var patch service.LinkPatch
+	for key, value := range raw {
+		switch key {
+		case "original_url":
+			v, err := patchString(key, value)
+			if err != nil {
+				return service.LinkPatch{}, err
+			}
+			if err := validator.New().Var(v, "required,url"); err != nil {
+				return service.LinkPatch{}, fmt.Errorf("original_url must be a valid URL")
+			}
+			patch.OriginalUrl = &v
+		case "short_name":
+			v, err := patchString(key, value)
+			if err != nil {
+				return service.LinkPatch{}, err
+			}
+			if v == "" {
+				return service.LinkPatch{}, fmt.Errorf("short_name can't be empty")
+			}
+			patch.ShortName = &v
+		default:
+			return service.LinkPatch{}, fmt.Errorf("unknown field %q", key)
+		}
+	}
+	return patch, nil
+}
+
+func patchString(key string, value json.RawMessage) (string, error) {
+	if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+		return "", fmt.Errorf("%s: %w", key, errNullField)
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// LinkETag - ETag ссылки, построенный по её ревизии.
+func LinkETag(revision int) string {
+	return strconv.Quote(strconv.Itoa(revision))
+}
+
+// ParseIfMatch возвращает ревизии из If-Match. nil - заголовка нет или "*", версия не проверяется.
+// Чужие ETag пропускаются: если не разобрался ни один, вернётся пустой список и обновление не пройдёт.
+func ParseIfMatch(header string) []int32 {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil
+	}
+	revisions := []int32{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		unquoted, err := strconv.Unquote(tag)
+		if err != nil {
+			continue
+		}
+		revision, err := strconv.ParseInt(unquoted, 10, 32)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, int32(revision))
+	}
+	return revisions
+}
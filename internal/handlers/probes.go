@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Readiness_Check_Timeout - сколько ждать одну проверку готовности
+const Readiness_Check_Timeout = 2 * time.Second
+
+// Статусы проверок /readyz
+const (
+	ProbeOK           = "ok"
+	ProbeFail         = "fail"
+	ProbeShuttingDown = "shutting_down"
+)
+
+// ComponentStatus - итог проверки одной части сервиса.
+type ComponentStatus struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+type ReadinessReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// Probes отвечает на /healthz и /readyz. /healthz говорит только, что процесс жив,
+// /readyz - что он может обслуживать запросы: все проверки прошли и остановка не началась.
+type Probes struct {
+	checks       []readinessCheck
+	shuttingDown atomic.Bool
+}
+
+func NewProbes() *Probes {
+	return &Probes{}
+}
+
+// AddCheck добавляет проверку готовности. Вызывается до регистрации маршрутов.
+func (p *Probes) AddCheck(name string, check func(ctx context.Context) error) {
+	p.checks = append(p.checks, readinessCheck{name: name, check: check})
+}
+
+// SetShuttingDown переводит /readyz в 503, чтобы балансировщик перестал слать запросы.
+func (p *Probes) SetShuttingDown() {
+	p.shuttingDown.Store(true)
+}
+
+func (p *Probes) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": ProbeOK})
+}
+
+// Readyz выполняет проверки параллельно и отвечает 503, если хотя бы одна не прошла.
+func (p *Probes) Readyz(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	if p.shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, ReadinessReport{Status: ProbeShuttingDown, Components: map[string]ComponentStatus{}})
+		return
+	}
+	report := ReadinessReport{Status: ProbeOK, Components: make(map[string]ComponentStatus, len(p.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, rc := range p.checks {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), Readiness_Check_Timeout)
+			defer cancel()
+			start := time.Now()
+			err := rc.check(ctx)
+			status := ComponentStatus{Status: ProbeOK, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Status, status.Error = ProbeFail, err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[rc.name] = status
+			if err != nil {
+				report.Status = ProbeFail
+			}
+		})
+	}
+	wg.Wait()
+	code := http.StatusOK
+	if report.Status != ProbeOK {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, report)
+}
@@ -0,0 +1,141 @@
+// Package healthcheck проверяет, что адрес назначения ссылки отвечает.
+package healthcheck
+
+import (
+	"code/internal/netguard"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	DefaultTimeout      = 10 * time.Second
+	DefaultMaxRedirects = 10
+
+	// drainLimit - сколько байт тела GET-ответа дочитываем, чтобы переиспользовать соединение
+	drainLimit = 64 << 10
+)
+
+// Result - итог одной проверки.
+type Result struct {
+	OK            bool
+	StatusCode    int
+	Latency       time.Duration
+	RedirectChain []string
+	Err           error
+}
+
+type Options struct {
+	Timeout      time.Duration
+	MaxRedirects int
+	// AllowPrivateNetworks отключает защиту от SSRF. Нужно только в тестах с httptest.
+	AllowPrivateNetworks bool
+}
+
+type Prober struct {
+	client       *http.Client
+	maxRedirects int
+}
+
+func NewProber(opts Options) *Prober {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxRedirects <= 0 {
+		opts.MaxRedirects = DefaultMaxRedirects
+	}
+	dialer := netguard.NewDialer(opts.Timeout, opts.AllowPrivateNetworks)
+	return &Prober{
+		client: &http.Client{
+			Timeout: opts.Timeout,
+			Transport: &http.Transport{
+				DialContext:           dialer.DialContext,
+				TLSHandshakeTimeout:   opts.Timeout,
+				ResponseHeaderTimeout: opts.Timeout,
+				MaxIdleConnsPerHost:   2,
+				IdleConnTimeout:       30 * time.Second,
+			},
+			// Редиректы проходим сами, чтобы записать всю цепочку
+			CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxRedirects: opts.MaxRedirects,
+	}
+}
+
+// Check отправляет HEAD (или GET, если сервер не поддерживает HEAD) и проходит по редиректам.
+// Ссылка считается рабочей, если конечный ответ имеет статус ниже 400.
+func (p *Prober) Check(ctx context.Context, rawURL string) Result {
+	start := time.Now()
+	res := p.follow(ctx, rawURL)
+	res.Latency = time.Since(start)
+	return res
+}
+
+func (p *Prober) follow(ctx context.Context, rawURL string) Result {
+	var res Result
+	current, err := url.Parse(rawURL)
+	if err != nil {
+		res.Err = fmt.Errorf("parse url: %w", err)
+		return res
+	}
+	for range p.maxRedirects + 1 {
+		if err := netguard.CheckScheme(current); err != nil {
+			res.Err = err
+			return res
+		}
+		status, location, err := p.request(ctx, current)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.StatusCode = status
+		if status < http.StatusMultipleChoices || status >= http.StatusBadRequest || location == "" {
+			res.OK = status < http.StatusBadRequest
+			if !res.OK {
+				res.Err = fmt.Errorf("unexpected status %d", status)
+			}
+			return res
+		}
+		next, err := current.Parse(location)
+		if err != nil {
+			res.Err = fmt.Errorf("parse redirect location: %w", err)
+			return res
+		}
+		res.RedirectChain = append(res.RedirectChain, next.String())
+		current = next
+	}
+	res.Err = fmt.Errorf("stopped after %d redirects", p.maxRedirects)
+	return res
+}
+
+func (p *Prober) request(ctx context.Context, u *url.URL) (int, string, error) {
+	status, location, err := p.do(ctx, http.MethodHead, u)
+	if err != nil {
+		return 0, "", err
+	}
+	// Часть серверов не умеет HEAD - повторяем через GET
+	if status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented {
+		return p.do(ctx, http.MethodGet, u)
+	}
+	return status, location, nil
+}
+
+func (p *Prober) do(ctx context.Context, method string, u *url.URL) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("User-Agent", "lshortener-healthcheck/1.0")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s %s: %w", method, u.Host, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, drainLimit))
+	return resp.StatusCode, resp.Header.Get("Location"), nil
+}
@@ -0,0 +1,88 @@
+package healthcheck_test
+
+import (
+	"code/internal/healthcheck"
+	"code/internal/netguard"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/step1", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/step2", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/step2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProber_Check(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+	p := healthcheck.NewProber(healthcheck.Options{AllowPrivateNetworks: true, MaxRedirects: 3})
+
+	t.Run("redirect chain", func(t *testing.T) {
+		t.Parallel()
+		res := p.Check(t.Context(), srv.URL+"/step1")
+		require.NoError(t, res.Err)
+		assert.True(t, res.OK)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, []string{srv.URL + "/step2", srv.URL + "/ok"}, res.RedirectChain)
+		assert.Positive(t, res.Latency)
+	})
+
+	t.Run("head not allowed falls back to get", func(t *testing.T) {
+		t.Parallel()
+		res := p.Check(t.Context(), srv.URL+"/get-only")
+		require.NoError(t, res.Err)
+		assert.True(t, res.OK)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		t.Parallel()
+		res := p.Check(t.Context(), srv.URL+"/missing")
+		assert.False(t, res.OK)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		assert.Error(t, res.Err)
+	})
+
+	t.Run("too many redirects", func(t *testing.T) {
+		t.Parallel()
+		res := p.Check(t.Context(), srv.URL+"/loop")
+		assert.False(t, res.OK)
+		assert.Len(t, res.RedirectChain, 4)
+		assert.Error(t, res.Err)
+	})
+}
+
+func TestProber_Check_BlocksPrivateNetworks(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+	p := healthcheck.NewProber(healthcheck.Options{})
+
+	res := p.Check(t.Context(), srv.URL+"/ok")
+	assert.False(t, res.OK)
+	assert.ErrorIs(t, res.Err, netguard.ErrForbiddenAddress)
+}
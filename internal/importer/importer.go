@@ -0,0 +1,320 @@
+// Package importer разбирает файлы со ссылками: CSV, NDJSON и выгрузки Bitly и YOURLS.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+	// FormatBitly - CSV-выгрузка Bitly: long_url и bitlink, из которого берётся короткое имя
+	FormatBitly Format = "bitly"
+	// FormatYOURLS - CSV-выгрузка YOURLS: keyword, url, title. Заголовок может отсутствовать.
+	FormatYOURLS Format = "yourls"
+)
+
+var Formats = []Format{FormatCSV, FormatNDJSON, FormatBitly, FormatYOURLS}
+
+// Поля ссылки, в которые отображаются колонки файла.
+const (
+	FieldOriginalURL = "original_url"
+	FieldShortName   = "short_name"
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	// Open Graph теги ссылки. Своих названий колонок у них нет, берутся только по Mapping
+	FieldOgTitle       = "og_title"
+	FieldOgDescription = "og_description"
+)
+
+var Fields = []string{FieldOriginalURL, FieldShortName, FieldTitle, FieldDescription, FieldOgTitle, FieldOgDescription}
+
+var (
+	ErrUnknownFormat = errors.New("unknown import format")
+	// ErrNoURLColumn - в заголовке нет колонки, из которой брать original_url
+	ErrNoURLColumn = errors.New("no original_url column")
+)
+
+// maxLineSize - самая длинная строка NDJSON
+const maxLineSize = 1 << 20
+
+// Record - одна строка файла. Line - номер строки в файле для отчёта об ошибках.
+type Record struct {
+	Line          int
+	OriginalURL   string
+	ShortName     string
+	Title         string
+	Description   string
+	OgTitle       string
+	OgDescription string
+	// Err - строку не удалось разобрать, остальные поля пустые
+	Err error
+}
+
+// Mapping задаёт колонку файла для поля: {"original_url": "Destination"}.
+// Поля без явной колонки ищутся среди привычных названий формата.
+type Mapping map[string]string
+
+// Validate проверяет, что в Mapping только известные поля.
+func (m Mapping) Validate() error {
+	for field, column := range m {
+		if !slices.Contains(Fields, field) {
+			return fmt.Errorf("unknown field %q in mapping, allowed: %s", field, strings.Join(Fields, ", "))
+		}
+		if strings.TrimSpace(column) == "" {
+			return fmt.Errorf("empty column for field %q in mapping", field)
+		}
+	}
+	return nil
+}
+
+// aliases - названия колонок по умолчанию, сравниваются после normalizeColumn.
+var aliases = map[Format]map[string][]string{
+	FormatCSV: {
+		FieldOriginalURL: {"original_url", "url", "long_url", "destination", "target"},
+		FieldShortName:   {"short_name", "keyword", "slug", "alias", "code"},
+		FieldTitle:       {"title"},
+		FieldDescription: {"description"},
+	},
+	FormatBitly: {
+		FieldOriginalURL: {"long_url", "original_url"},
+		FieldShortName:   {"bitlink", "link", "short_url", "id"},
+		FieldTitle:       {"title"},
+	},
+	FormatYOURLS: {
+		FieldOriginalURL: {"url"},
+		FieldShortName:   {"keyword"},
+		FieldTitle:       {"title"},
+	},
+}
+
+// yourlsColumns - порядок колонок YOURLS, если в файле нет заголовка.
+var yourlsColumns = []string{FieldShortName, FieldOriginalURL, FieldTitle}
+
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(strings.TrimSpace(s)))
+	if !slices.Contains(Formats, f) {
+		return "", fmt.Errorf("%w %q, allowed: csv, ndjson, bitly, yourls", ErrUnknownFormat, s)
+	}
+	return f, nil
+}
+
+// Parse читает файл целиком. Ошибка возвращается, только если файл нельзя разобрать вообще,
+// проблемы отдельных строк попадают в Record.Err.
+func Parse(format Format, r io.Reader, mapping Mapping) ([]Record, error) {
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatNDJSON:
+		return parseNDJSON(r, mapping)
+	case FormatCSV, FormatBitly, FormatYOURLS:
+		return parseCSV(format, r, mapping)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+}
+
+func parseCSV(format Format, r io.Reader, mapping Mapping) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	// Excel дописывает BOM в начало CSV
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	columns, err := resolveColumns(format, header, mapping)
+	var records []Record
+	if errors.Is(err, ErrNoURLColumn) && format == FormatYOURLS && len(mapping) == 0 {
+		// YOURLS без заголовка: первая строка - уже данные
+		columns = make(map[string]int, len(yourlsColumns))
+		for i, field := range yourlsColumns {
+			columns[field] = i
+		}
+		line, _ := cr.FieldPos(0)
+		records = append(records, recordFromColumns(format, line, header, columns))
+	} else if err != nil {
+		return nil, err
+	}
+
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			records = append(records, Record{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if isBlank(row) {
+			continue
+		}
+		records = append(records, recordFromColumns(format, line, row, columns))
+	}
+}
+
+// resolveColumns находит номера колонок для полей: сначала по mapping, потом по названиям формата.
+func resolveColumns(format Format, header []string, mapping Mapping) (map[string]int, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		if _, ok := index[normalizeColumn(name)]; !ok {
+			index[normalizeColumn(name)] = i
+		}
+	}
+	columns := make(map[string]int)
+	for field, column := range mapping {
+		i, ok := index[normalizeColumn(column)]
+		if !ok {
+			return nil, fmt.Errorf("column %q for field %s not found", column, field)
+		}
+		columns[field] = i
+	}
+	for field, names := range aliases[format] {
+		if _, ok := columns[field]; ok {
+			continue
+		}
+		for _, name := range names {
+			if i, ok := index[name]; ok {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	if _, ok := columns[FieldOriginalURL]; !ok {
+		return nil, ErrNoURLColumn
+	}
+	return columns, nil
+}
+
+func recordFromColumns(format Format, line int, row []string, columns map[string]int) Record {
+	get := func(field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+	rec := Record{
+		Line:          line,
+		OriginalURL:   get(FieldOriginalURL),
+		ShortName:     get(FieldShortName),
+		Title:         get(FieldTitle),
+		Description:   get(FieldDescription),
+		OgTitle:       get(FieldOgTitle),
+		OgDescription: get(FieldOgDescription),
+	}
+	if format == FormatBitly {
+		rec.ShortName = shortNameFromURL(rec.ShortName)
+	}
+	return rec
+}
+
+func parseNDJSON(r io.Reader, mapping Mapping) ([]Record, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	var records []Record
+	for line := 1; sc.Scan(); line++ {
+		data := bytes.TrimSpace(sc.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal(data, &obj); err != nil {
+			records = append(records, Record{Line: line, Err: fmt.Errorf("invalid json: %w", err)})
+			continue
+		}
+		values := make(map[string]any, len(obj))
+		for key, v := range obj {
+			values[normalizeColumn(key)] = v
+		}
+		rec, err := recordFromObject(values, mapping)
+		if err != nil {
+			records = append(records, Record{Line: line, Err: err})
+			continue
+		}
+		rec.Line = line
+		records = append(records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func recordFromObject(values map[string]any, mapping Mapping) (Record, error) {
+	out := make(map[string]string, len(Fields))
+	for _, field := range Fields {
+		names := aliases[FormatCSV][field]
+		if column, ok := mapping[field]; ok {
+			names = []string{normalizeColumn(column)}
+		}
+		for _, name := range names {
+			v, ok := values[name]
+			if !ok || v == nil {
+				continue
+			}
+			s, ok := v.(string)
+			if !ok {
+				return Record{}, fmt.Errorf("%s must be a string", name)
+			}
+			out[field] = strings.TrimSpace(s)
+			break
+		}
+	}
+	return Record{
+		OriginalURL:   out[FieldOriginalURL],
+		ShortName:     out[FieldShortName],
+		Title:         out[FieldTitle],
+		Description:   out[FieldDescription],
+		OgTitle:       out[FieldOgTitle],
+		OgDescription: out[FieldOgDescription],
+	}, nil
+}
+
+// normalizeColumn приводит "Long URL" и "long-url" к "long_url".
+func normalizeColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+}
+
+// shortNameFromURL достаёт короткое имя из bitlink: "https://bit.ly/3abc" -> "3abc".
+func shortNameFromURL(s string) string {
+	s = strings.TrimRight(s, "/")
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
+
+func isBlank(row []string) bool {
+	for _, v := range row {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package importer_test
+
+import (
+	"code/internal/importer"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_CSV(t *testing.T) {
+	t.Parallel()
+	data := "\ufeffURL,Slug,Title,Clicks\n" +
+		"https://example.com/a,a,First,10\n" +
+		"\n" +
+		"https://example.com/b,,,3\n"
+
+	records, err := importer.Parse(importer.FormatCSV, strings.NewReader(data), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []importer.Record{
+		{Line: 2, OriginalURL: "https://example.com/a", ShortName: "a", Title: "First"},
+		{Line: 4, OriginalURL: "https://example.com/b"},
+	}, records)
+}
+
+func TestParse_Mapping(t *testing.T) {
+	t.Parallel()
+	data := "Destination,Code\nhttps://example.com,abc\n"
+
+	records, err := importer.Parse(importer.FormatCSV, strings.NewReader(data),
+		importer.Mapping{importer.FieldOriginalURL: "destination", importer.FieldShortName: "Code"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "https://example.com", records[0].OriginalURL)
+	assert.Equal(t, "abc", records[0].ShortName)
+
+	_, err = importer.Parse(importer.FormatCSV, strings.NewReader(data), importer.Mapping{"clicks": "Code"})
+	require.Error(t, err)
+	_, err = importer.Parse(importer.FormatCSV, strings.NewReader("Name,Code\nx,y\n"), nil)
+	require.ErrorIs(t, err, importer.ErrNoURLColumn)
+}
+
+// OG теги заполняются только по явному mapping, даже если колонка называется так же.
+func TestParse_OgFieldsOnlyByMapping(t *testing.T) {
+	t.Parallel()
+	data := "url,title,og_title,Share Text\nhttps://example.com,Example,Ignored,Shared\n"
+
+	records, err := importer.Parse(importer.FormatCSV, strings.NewReader(data), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []importer.Record{{Line: 2, OriginalURL: "https://example.com", Title: "Example"}}, records)
+
+	records, err = importer.Parse(importer.FormatCSV, strings.NewReader(data), importer.Mapping{importer.FieldOgDescription: "share text"})
+	require.NoError(t, err)
+	assert.Equal(t, []importer.Record{{Line: 2, OriginalURL: "https://example.com", Title: "Example", OgDescription: "Shared"}}, records)
+
+	records, err = importer.Parse(importer.FormatNDJSON, strings.NewReader(`{"url":"https://example.com","og_title":"Ignored","share":"Shared"}`+"\n"),
+		importer.Mapping{importer.FieldOgTitle: "share"})
+	require.NoError(t, err)
+	assert.Equal(t, []importer.Record{{Line: 1, OriginalURL: "https://example.com", OgTitle: "Shared"}}, records)
+}
+
+func TestParse_Bitly(t *testing.T) {
+	t.Parallel()
+	data := "title,bitlink,long_url,created_at\n" +
+		"Promo,https://bit.ly/3aBcD,https://example.com/promo,2024-01-01\n" +
+		"Custom,bit.ly/spring-sale/,https://example.com/sale,2024-02-01\n"
+
+	records, err := importer.Parse(importer.FormatBitly, strings.NewReader(data), nil)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, importer.Record{Line: 2, OriginalURL: "https://example.com/promo", ShortName: "3aBcD", Title: "Promo"}, records[0])
+	assert.Equal(t, "spring-sale", records[1].ShortName)
+}
+
+func TestParse_YOURLS(t *testing.T) {
+	t.Parallel()
+	withHeader := "keyword,url,title,timestamp,ip,clicks\nabc,https://example.com,Example,2024-01-01 10:00:00,127.0.0.1,5\n"
+	withoutHeader := "abc,https://example.com,Example\n"
+	want := importer.Record{OriginalURL: "https://example.com", ShortName: "abc", Title: "Example"}
+
+	records, err := importer.Parse(importer.FormatYOURLS, strings.NewReader(withHeader), nil)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	want.Line = 2
+	assert.Equal(t, want, records[0])
+
+	records, err = importer.Parse(importer.FormatYOURLS, strings.NewReader(withoutHeader), nil)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	want.Line = 1
+	assert.Equal(t, want, records[0])
+}
+
+func TestParse_NDJSON(t *testing.T) {
+	t.Parallel()
+	data := `{"url":"https://example.com/a","short_name":"a","description":"About"}` + "\n" +
+		"\n" +
+		`{"original_url":"https://example.com/b",` + "\n" +
+		`{"original_url":42}` + "\n"
+
+	records, err := importer.Parse(importer.FormatNDJSON, strings.NewReader(data), nil)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, importer.Record{Line: 1, OriginalURL: "https://example.com/a", ShortName: "a", Description: "About"}, records[0])
+	assert.Equal(t, 3, records[1].Line)
+	require.Error(t, records[1].Err)
+	assert.Equal(t, 4, records[2].Line)
+	require.Error(t, records[2].Err)
+}
+
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+	f, err := importer.ParseFormat(" NDJSON ")
+	require.NoError(t, err)
+	assert.Equal(t, importer.FormatNDJSON, f)
+
+	_, err = importer.ParseFormat("xlsx")
+	require.ErrorIs(t, err, importer.ErrUnknownFormat)
+}
@@ -0,0 +1,99 @@
+// Package logging настраивает slog: JSON в stderr, логгер запроса в context
+// и вычистку IP-адресов и query string по настройкам приватности.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/netip"
+	"strings"
+
+	"code/internal/config"
+)
+
+// Ключи атрибутов, значения которых вычищаются автоматически
+const (
+	KeyClientIP = "client_ip"
+	KeyQuery    = "query"
+	KeyPath     = "path"
+	KeyReferer  = "referer"
+)
+
+// New создаёт JSON-логгер. Атрибуты client_ip, query, path и referer проходят через
+// вычистку по cfg, где бы в записи они ни встретились.
+func New(w io.Writer, cfg config.LogConfig) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       cfg.Level,
+		ReplaceAttr: redactor(cfg),
+	}))
+}
+
+func redactor(cfg config.LogConfig) func(groups []string, a slog.Attr) slog.Attr {
+	return func(_ []string, a slog.Attr) slog.Attr {
+		switch a.Key {
+		case KeyClientIP:
+			ip := RedactIP(a.Value.String(), cfg.IPs)
+			if ip == "" {
+				return slog.Attr{}
+			}
+			return slog.String(a.Key, ip)
+		case KeyQuery:
+			if !cfg.QueryStrings {
+				return slog.Attr{}
+			}
+		case KeyPath, KeyReferer:
+			if !cfg.QueryStrings {
+				return slog.String(a.Key, StripQuery(a.Value.String()))
+			}
+		}
+		return a
+	}
+}
+
+// RedactIP приводит адрес к виду, разрешённому mode. Для LogIPNone и пустого адреса возвращает "".
+func RedactIP(ip, mode string) string {
+	switch mode {
+	case config.LogIPFull:
+		return ip
+	case config.LogIPNone:
+		return ""
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		// Нераспознанный адрес целиком не пишем
+		return ""
+	}
+	bits := 24
+	if addr.Is6() && !addr.Is4In6() {
+		bits = 48
+	}
+	prefix, err := addr.Unmap().Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
+
+// StripQuery отрезает query string и фрагмент.
+func StripQuery(s string) string {
+	if i := strings.IndexAny(s, "?#"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+type ctxKey struct{}
+
+// WithLogger кладёт логгер в ctx.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext возвращает логгер запроса или slog.Default, если его нет.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
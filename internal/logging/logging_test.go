@@ -0,0 +1,137 @@
+package logging_test
+
+import (
+	"bytes"
+	"code/internal/config"
+	"code/internal/logging"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestRedactIP(t *testing.T) {
+	tests := []struct {
+		ip, mode, want string
+	}{
+		{"203.0.113.57", config.LogIPFull, "203.0.113.57"},
+		{"203.0.113.57", config.LogIPTruncated, "203.0.113.0/24"},
+		{"2001:db8:1234:5678::1", config.LogIPTruncated, "2001:db8:1234::/48"},
+		{"::ffff:203.0.113.57", config.LogIPTruncated, "203.0.113.0/24"},
+		{"not-an-ip", config.LogIPTruncated, ""},
+		{"203.0.113.57", config.LogIPNone, ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, logging.RedactIP(tt.ip, tt.mode), "%s %s", tt.ip, tt.mode)
+	}
+}
+
+func TestNew_Redaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, config.LogConfig{Level: slog.LevelInfo, IPs: config.LogIPTruncated})
+	logger.Info("request",
+		logging.KeyClientIP, "198.51.100.7",
+		logging.KeyPath, "/api/links?token=secret",
+		logging.KeyQuery, "token=secret",
+		logging.KeyReferer, "https://example.com/page?utm=1#top",
+	)
+	logger.Debug("hidden")
+
+	recs := decodeLines(t, &buf)
+	require.Len(t, recs, 1)
+	assert.Equal(t, "198.51.100.0/24", recs[0]["client_ip"])
+	assert.Equal(t, "/api/links", recs[0]["path"])
+	assert.Equal(t, "https://example.com/page", recs[0]["referer"])
+	assert.NotContains(t, recs[0], "query")
+	assert.NotContains(t, buf.String(), "secret")
+
+	buf.Reset()
+	logger = logging.New(&buf, config.LogConfig{Level: slog.LevelDebug, IPs: config.LogIPNone, QueryStrings: true})
+	logger.Debug("request", logging.KeyClientIP, "198.51.100.7", logging.KeyQuery, "page=2")
+	recs = decodeLines(t, &buf)
+	require.Len(t, recs, 1)
+	assert.NotContains(t, recs[0], "client_ip")
+	assert.Equal(t, "page=2", recs[0]["query"])
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger := logging.New(&buf, config.LogConfig{Level: slog.LevelInfo, IPs: config.LogIPTruncated})
+
+	router := gin.New()
+	router.Use(logging.Middleware(logger), logging.Recovery())
+	router.GET("/api/links/:id", func(c *gin.Context) {
+		logging.FromContext(c.Request.Context()).Info("inside handler")
+		c.String(http.StatusOK, logging.RequestID(c))
+	})
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	t.Run("accepts request id", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/api/links/5?token=secret", nil)
+		req.Header.Set(logging.RequestIDHeader, "abc-123")
+		req.RemoteAddr = "192.0.2.10:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "abc-123", w.Header().Get(logging.RequestIDHeader))
+		assert.Equal(t, "abc-123", w.Body.String())
+		recs := decodeLines(t, &buf)
+		require.Len(t, recs, 2)
+		assert.Equal(t, "inside handler", recs[0]["msg"])
+		assert.Equal(t, "abc-123", recs[0]["request_id"])
+		assert.Equal(t, "request", recs[1]["msg"])
+		assert.Equal(t, "/api/links/:id", recs[1]["route"])
+		assert.Equal(t, "/api/links/5", recs[1]["path"])
+		assert.Equal(t, "192.0.2.0/24", recs[1]["client_ip"])
+		assert.EqualValues(t, http.StatusOK, recs[1]["status"])
+		assert.NotContains(t, buf.String(), "secret")
+	})
+
+	t.Run("replaces invalid request id", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/api/links/5", nil)
+		req.Header.Set(logging.RequestIDHeader, "bad id\nwith newline")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		id := w.Header().Get(logging.RequestIDHeader)
+		assert.Len(t, id, 32)
+		assert.Equal(t, id, w.Body.String())
+	})
+
+	t.Run("logs panics", func(t *testing.T) {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		recs := decodeLines(t, &buf)
+		require.Len(t, recs, 2)
+		assert.Equal(t, "panic recovered", recs[0]["msg"])
+		assert.Equal(t, "boom", recs[0]["panic"])
+		assert.Equal(t, "ERROR", recs[1]["level"])
+	})
+}
+
+func TestFromContext_Default(t *testing.T) {
+	assert.Same(t, slog.Default(), logging.FromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()))
+}
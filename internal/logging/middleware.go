@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader - заголовок с идентификатором запроса, принимается от клиента и возвращается в ответе.
+const RequestIDHeader = "X-Request-ID"
+
+// Max_Request_ID_Length - идентификаторы длиннее заменяются своими, чтобы не раздувать логи
+const Max_Request_ID_Length = 128
+
+const requestIDKey = "request_id"
+
+// Middleware присваивает запросу идентификатор, кладёт в context логгер с request_id
+// и trace_id и пишет строку access-лога по завершении. Подключается после tracing.Middleware,
+// иначе trace_id в логгер не попадёт.
+func Middleware(base *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+
+		logger := base.With(requestIDKey, id)
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.HasTraceID() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		c.Request = c.Request.WithContext(WithLogger(c.Request.Context(), logger))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String(KeyPath, c.Request.URL.Path),
+			slog.String(KeyQuery, c.Request.URL.RawQuery),
+			slog.Int("status", status),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String(KeyClientIP, c.ClientIP()),
+		}
+		if errs := c.Errors.String(); errs != "" {
+			attrs = append(attrs, slog.String("errors", errs))
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// RequestID возвращает идентификатор текущего запроса.
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// Recovery отвечает 500 на панику и пишет её в лог запроса вместо текстового вывода gin.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		FromContext(c.Request.Context()).Error("panic recovered",
+			slog.Any("panic", err), slog.String("stack", string(debug.Stack())))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > Max_Request_ID_Length {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		// Только печатный ASCII без пробелов, чтобы идентификатор нельзя было использовать для подделки строк лога
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
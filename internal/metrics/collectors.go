@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector снимает pgxpool.Stat при каждом опросе /metrics.
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired, idle, total, max    *prometheus.Desc
+	acquires, emptyAcquires       *prometheus.Desc
+	canceledAcquires, acquireWait *prometheus.Desc
+}
+
+func NewPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &poolCollector{
+		pool:             pool,
+		acquired:         desc("acquired_connections", "Connections currently in use."),
+		idle:             desc("idle_connections", "Idle connections in the pool."),
+		total:            desc("total_connections", "All open connections."),
+		max:              desc("max_connections", "Pool size limit."),
+		acquires:         desc("acquires_total", "Successful connection acquires."),
+		emptyAcquires:    desc("empty_acquires_total", "Acquires that had to wait because the pool was empty."),
+		canceledAcquires: desc("canceled_acquires_total", "Acquires canceled by context."),
+		acquireWait:      desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.acquired, c.idle, c.total, c.max, c.acquires, c.emptyAcquires, c.canceledAcquires, c.acquireWait} {
+		ch <- d
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquires, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireWait, prometheus.CounterValue, s.AcquireDuration().Seconds())
+}
+
+// CacheStats возвращает накопленные попадания и промахи кэша.
+type CacheStats func() (hits, misses uint64)
+
+type cacheCollector struct {
+	stats        CacheStats
+	hits, misses *prometheus.Desc
+}
+
+// NewCacheCollector экспортирует счётчики кэша с меткой cache=name. Доля попаданий -
+// rate(hits) / (rate(hits) + rate(misses)) в запросе.
+func NewCacheCollector(name string, stats CacheStats) prometheus.Collector {
+	labels := prometheus.Labels{"cache": name}
+	return &cacheCollector{
+		stats:  stats,
+		hits:   prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", "hits_total"), "Cache hits.", nil, labels),
+		misses: prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", "misses_total"), "Cache misses.", nil, labels),
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	hits, misses := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(misses))
+}
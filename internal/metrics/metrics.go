@@ -0,0 +1,166 @@
+// Package metrics собирает метрики Prometheus: HTTP-запросы, редиректы, запись посещений,
+// пул соединений и кэши. Метки ограничены шаблонами маршрутов и статусами,
+// короткие имена ссылок в метки не попадают, чтобы число рядов не росло с числом ссылок.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "lshortener"
+
+// Исходы редиректа
+const (
+	RedirectFound    = "found"
+	RedirectPreview  = "preview"
+	RedirectNotFound = "not_found"
+	RedirectExpired  = "expired"
+	RedirectError    = "error"
+)
+
+// redirectOutcomeKey - ключ gin-контекста, под которым обработчик редиректа оставляет исход
+const redirectOutcomeKey = "metrics.redirect_outcome"
+
+// unmatchedRoute - метка для запросов мимо всех маршрутов, вместо их путей
+const unmatchedRoute = "unmatched"
+
+// otherMethod - метка для нестандартных методов: метод задаёт клиент, и произвольные
+// значения плодили бы новые ряды
+const otherMethod = "other"
+
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	redirects       *prometheus.CounterVec
+	visitWrites     *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route template, method and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route template, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Short link redirects by outcome: found, preview, not_found, expired (link is in trash), error.",
+		}, []string{"outcome"}),
+		visitWrites: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "visit_write_duration_seconds",
+			Help:      "Latency of visit writes by result: ok or error.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"result"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.redirects, m.visitWrites,
+	)
+	// Исходы заранее, чтобы ряды с нулями были видны до первого редиректа
+	for _, outcome := range []string{RedirectFound, RedirectPreview, RedirectNotFound, RedirectExpired, RedirectError} {
+		m.redirects.WithLabelValues(outcome)
+	}
+	return m
+}
+
+// Register добавляет свой коллектор, например NewPoolCollector.
+func (m *Metrics) Register(c prometheus.Collector) error {
+	return m.registry.Register(c)
+}
+
+// Handler отдаёт метрики для /metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware считает запросы и их длительность. Маршрут - шаблон gin вроде /api/links/:id.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		if !knownMethods[method] {
+			method = otherMethod
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		m.requests.WithLabelValues(method, route, status).Inc()
+		m.requestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Redirects - middleware для маршрутов редиректа. Исход берётся из SetRedirectOutcome,
+// а если обработчик его не задал - определяется по статусу ответа.
+func (m *Metrics) Redirects() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		outcome := c.GetString(redirectOutcomeKey)
+		if outcome == "" {
+			outcome = RedirectOutcome(c.Writer.Status())
+		}
+		m.redirects.WithLabelValues(outcome).Inc()
+	}
+}
+
+// SetRedirectOutcome сообщает Redirects исход, который не виден по статусу ответа,
+// например RedirectExpired для ссылки из корзины.
+func SetRedirectOutcome(c *gin.Context, outcome string) {
+	c.Set(redirectOutcomeKey, outcome)
+}
+
+// RedirectOutcome переводит статус ответа RedirectByShortName в исход редиректа.
+func RedirectOutcome(status int) string {
+	switch {
+	case status == http.StatusFound:
+		return RedirectFound
+	case status == http.StatusOK:
+		return RedirectPreview
+	case status == http.StatusNotFound:
+		return RedirectNotFound
+	default:
+		return RedirectError
+	}
+}
+
+// ObserveVisitWrite учитывает одну запись посещения.
+func (m *Metrics) ObserveVisitWrite(d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.visitWrites.WithLabelValues(result).Observe(d.Seconds())
+}
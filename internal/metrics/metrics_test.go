@@ -0,0 +1,107 @@
+package metrics_test
+
+import (
+	"code/internal/handlers/mocks"
+	"code/internal/metrics"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := metrics.New()
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/api/links/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	redirects := router.Group("", m.Redirects())
+	redirects.GET("/r/:code", func(c *gin.Context) {
+		switch c.Param("code") {
+		case "known":
+			c.Redirect(http.StatusFound, "https://example.com")
+			return
+		case "trashed":
+			metrics.SetRedirectOutcome(c, metrics.RedirectExpired)
+		}
+		c.Status(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/api/links/1", "/api/links/2", "/r/known", "/r/missing", "/r/trashed", "/nowhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PROPFIND-123", "/nowhere", nil))
+
+	out := scrape(t, m)
+	assert.Contains(t, out, `lshortener_http_requests_total{method="GET",route="/api/links/:id",status="200"} 2`)
+	assert.Contains(t, out, `lshortener_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	// Произвольный метод клиента не становится новой меткой
+	assert.Contains(t, out, `lshortener_http_requests_total{method="other",route="unmatched",status="404"} 1`)
+	assert.NotContains(t, out, "PROPFIND")
+	assert.Contains(t, out, `lshortener_http_request_duration_seconds_count{method="GET",route="/r/:code",status="302"} 1`)
+	assert.Contains(t, out, `lshortener_redirects_total{outcome="found"} 1`)
+	// Ссылка из корзины отдаёт тот же 404, но считается отдельно
+	assert.Contains(t, out, `lshortener_redirects_total{outcome="not_found"} 1`)
+	assert.Contains(t, out, `lshortener_redirects_total{outcome="expired"} 1`)
+	assert.Contains(t, out, `lshortener_redirects_total{outcome="error"} 0`)
+	// Короткие имена и конкретные пути в метки не попадают
+	assert.NotContains(t, out, "known")
+	assert.NotContains(t, out, "trashed")
+	assert.NotContains(t, out, "/api/links/1")
+}
+
+func TestRedirectOutcome(t *testing.T) {
+	assert.Equal(t, metrics.RedirectFound, metrics.RedirectOutcome(http.StatusFound))
+	assert.Equal(t, metrics.RedirectPreview, metrics.RedirectOutcome(http.StatusOK))
+	assert.Equal(t, metrics.RedirectNotFound, metrics.RedirectOutcome(http.StatusNotFound))
+	assert.Equal(t, metrics.RedirectError, metrics.RedirectOutcome(http.StatusInternalServerError))
+}
+
+func TestMetrics_InstrumentVisits(t *testing.T) {
+	m := metrics.New()
+	vs := new(mocks.MockVisitService)
+	vs.On("CreateVisit", mock.Anything, int64(1), "1.2.3.4", "agent", "", int32(302), false).Return(nil)
+	vs.On("CreateVisit", mock.Anything, int64(2), "1.2.3.4", "agent", "", int32(302), false).Return(errors.New("db down"))
+
+	instrumented := m.InstrumentVisits(vs)
+	require.NoError(t, instrumented.CreateVisit(context.Background(), 1, "1.2.3.4", "agent", "", 302, false))
+	require.Error(t, instrumented.CreateVisit(context.Background(), 2, "1.2.3.4", "agent", "", 302, false))
+
+	out := scrape(t, m)
+	assert.Contains(t, out, `lshortener_visit_write_duration_seconds_count{result="ok"} 1`)
+	assert.Contains(t, out, `lshortener_visit_write_duration_seconds_count{result="error"} 1`)
+	vs.AssertExpectations(t)
+}
+
+func TestCacheCollector(t *testing.T) {
+	m := metrics.New()
+	require.NoError(t, m.Register(metrics.NewCacheCollector("qr", func() (uint64, uint64) { return 3, 1 })))
+
+	out := scrape(t, m)
+	assert.Contains(t, out, `lshortener_cache_hits_total{cache="qr"} 3`)
+	assert.Contains(t, out, `lshortener_cache_misses_total{cache="qr"} 1`)
+}
+
+func TestMetrics_ObserveVisitWrite(t *testing.T) {
+	m := metrics.New()
+	m.ObserveVisitWrite(20*time.Millisecond, nil)
+	assert.Contains(t, scrape(t, m), `lshortener_visit_write_duration_seconds_bucket{result="ok",le="0.025"} 1`)
+}
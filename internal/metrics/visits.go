@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"code/internal/service"
+)
+
+// visitServer измеряет запись посещений, остальные методы передаются как есть.
+type visitServer struct {
+	service.VisitServer
+	m *Metrics
+}
+
+// InstrumentVisits оборачивает сервис посещений, чтобы учитывать время и ошибки записи.
+func (m *Metrics) InstrumentVisits(vs service.VisitServer) service.VisitServer {
+	return &visitServer{VisitServer: vs, m: m}
+}
+
+func (v *visitServer) CreateVisit(ctx context.Context, id int64, ip, agent string, referer string, status int32, isCrawler bool) error {
+	start := time.Now()
+	err := v.VisitServer.CreateVisit(ctx, id, ip, agent, referer, status, isCrawler)
+	v.m.ObserveVisitWrite(time.Since(start), err)
+	return err
+}
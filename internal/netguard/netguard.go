@@ -0,0 +1,59 @@
+// Package netguard защищает исходящие HTTP-запросы к адресам пользователей от SSRF.
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress возвращается, если адрес назначения указывает во внутреннюю сеть.
+var ErrForbiddenAddress = errors.New("destination address is not allowed")
+
+// IsPublicIP сообщает, можно ли ходить на этот адрес: запрещены loopback, частные,
+// link-local, multicast и прочие служебные диапазоны.
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	// 100.64.0.0/10 - carrier-grade NAT, часто используется внутри облаков
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64 {
+		return false
+	}
+	return true
+}
+
+// CheckScheme разрешает только http и https.
+func CheckScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrForbiddenAddress, u.Scheme)
+	}
+	return nil
+}
+
+// NewDialer возвращает dialer, который отказывается соединяться с непубличными адресами.
+// IP проверяется уже после резолва прямо перед соединением, поэтому DNS rebinding не поможет.
+// allowPrivate отключает проверку - нужно только в тестах с httptest.
+func NewDialer(timeout time.Duration, allowPrivate bool) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if allowPrivate {
+		return dialer
+	}
+	dialer.Control = func(_, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || !IsPublicIP(ip) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+		}
+		return nil
+	}
+	return dialer
+}
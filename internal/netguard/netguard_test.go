@@ -0,0 +1,51 @@
+package netguard_test
+
+import (
+	"code/internal/netguard"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	t.Parallel()
+	var testCases = []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:4700::1111", want: true},
+		{ip: "127.0.0.1", want: false},
+		{ip: "10.1.2.3", want: false},
+		{ip: "192.168.0.10", want: false},
+		{ip: "169.254.169.254", want: false},
+		{ip: "100.64.0.1", want: false},
+		{ip: "::1", want: false},
+		{ip: "fd00::1", want: false},
+		{ip: "0.0.0.0", want: false},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.ip, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, netguard.IsPublicIP(net.ParseIP(tc.ip)))
+		})
+	}
+}
+
+func TestCheckScheme(t *testing.T) {
+	t.Parallel()
+	for _, raw := range []string{"http://example.com", "https://example.com"} {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		require.NoError(t, netguard.CheckScheme(u))
+	}
+	for _, raw := range []string{"file:///etc/passwd", "gopher://example.com", "ftp://example.com"} {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		require.ErrorIs(t, netguard.CheckScheme(u), netguard.ErrForbiddenAddress)
+	}
+}
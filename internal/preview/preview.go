@@ -0,0 +1,226 @@
+// Package preview загружает страницу назначения и достаёт из неё данные для превью ссылки.
+package preview
+
+import (
+	"code/internal/netguard"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	DefaultTimeout      = 5 * time.Second
+	DefaultMaxBodyBytes = 1 << 20
+	DefaultMaxRedirects = 5
+
+	maxTitleLen       = 300
+	maxDescriptionLen = 1000
+)
+
+// ErrNotHTML возвращается, если по ссылке лежит не HTML-страница.
+var ErrNotHTML = errors.New("destination is not an html page")
+
+// Metadata - данные превью. Пустые поля означают, что на странице их не нашлось.
+type Metadata struct {
+	Title       string
+	Description string
+	FaviconURL  string
+	ImageURL    string
+}
+
+type Options struct {
+	Timeout      time.Duration
+	MaxBodyBytes int64
+	MaxRedirects int
+	// AllowPrivateNetworks отключает защиту от SSRF. Нужно только в тестах с httptest.
+	AllowPrivateNetworks bool
+}
+
+type Fetcher struct {
+	client       *http.Client
+	maxBodyBytes int64
+}
+
+func NewFetcher(opts Options) *Fetcher {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if opts.MaxRedirects <= 0 {
+		opts.MaxRedirects = DefaultMaxRedirects
+	}
+
+	dialer := netguard.NewDialer(opts.Timeout, opts.AllowPrivateNetworks)
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	maxRedirects := opts.MaxRedirects
+	return &Fetcher{
+		client: &http.Client{
+			Timeout:   opts.Timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				return netguard.CheckScheme(req.URL)
+			},
+		},
+		maxBodyBytes: opts.MaxBodyBytes,
+	}
+}
+
+// Fetch загружает rawURL и разбирает <head> страницы.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Metadata, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+	if err := netguard.CheckScheme(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("User-Agent", "lshortener-preview/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("fetch: unexpected status %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("%w: %s", ErrNotHTML, mediaType)
+	}
+
+	meta := parse(io.LimitReader(resp.Body, f.maxBodyBytes), resp.Request.URL)
+	return meta, nil
+}
+
+// parse читает токены до конца <head> и собирает title, description, og:image и иконку.
+func parse(r io.Reader, base *url.URL) *Metadata {
+	var (
+		title, ogTitle, description, ogDescription, image, icon string
+		inTitle                                                 bool
+	)
+	z := html.NewTokenizer(r)
+loop:
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			break loop
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = strings.TrimSpace(string(z.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break loop
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[strings.ToLower(string(k))] = string(v)
+			}
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "body":
+				break loop
+			case "meta":
+				content := strings.TrimSpace(attrs["content"])
+				key := strings.ToLower(attrs["property"])
+				if key == "" {
+					key = strings.ToLower(attrs["name"])
+				}
+				switch key {
+				case "og:title":
+					ogTitle = content
+				case "og:description":
+					ogDescription = content
+				case "description":
+					description = content
+				case "og:image", "og:image:url":
+					if image == "" {
+						image = content
+					}
+				}
+			case "link":
+				rel := strings.ToLower(attrs["rel"])
+				if icon == "" && strings.Contains(rel, "icon") {
+					icon = attrs["href"]
+				}
+			}
+		}
+	}
+
+	meta := &Metadata{
+		Title:       truncate(firstNonEmpty(ogTitle, title), maxTitleLen),
+		Description: truncate(firstNonEmpty(ogDescription, description), maxDescriptionLen),
+		ImageURL:    resolve(base, image),
+		FaviconURL:  resolve(base, icon),
+	}
+	if meta.FaviconURL == "" {
+		meta.FaviconURL = resolve(base, "/favicon.ico")
+	}
+	return meta
+}
+
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,103 @@
+package preview_test
+
+import (
+	"code/internal/netguard"
+	"code/internal/preview"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const page = `<!doctype html>
+<html><head>
+<title> Plain title </title>
+<meta name="description" content="Plain description">
+<meta property="og:title" content="OG title">
+<meta property="og:image" content="/images/cover.png">
+<link rel="shortcut icon" href="/static/icon.png">
+</head><body><meta property="og:description" content="ignored"></body></html>`
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><head><title>" + strings.Repeat("a", 4096) + "</title></head></html>"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+	f := preview.NewFetcher(preview.Options{AllowPrivateNetworks: true})
+
+	meta, err := f.Fetch(t.Context(), srv.URL+"/redirect")
+	require.NoError(t, err)
+	assert.Equal(t, "OG title", meta.Title)
+	assert.Equal(t, "Plain description", meta.Description)
+	assert.Equal(t, srv.URL+"/images/cover.png", meta.ImageURL)
+	assert.Equal(t, srv.URL+"/static/icon.png", meta.FaviconURL)
+}
+
+func TestFetcher_NotHTML(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+	f := preview.NewFetcher(preview.Options{AllowPrivateNetworks: true})
+
+	_, err := f.Fetch(t.Context(), srv.URL+"/json")
+	require.ErrorIs(t, err, preview.ErrNotHTML)
+}
+
+func TestFetcher_SizeCap(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+	f := preview.NewFetcher(preview.Options{AllowPrivateNetworks: true, MaxBodyBytes: 100})
+
+	meta, err := f.Fetch(t.Context(), srv.URL+"/huge")
+	require.NoError(t, err)
+	assert.Less(t, len(meta.Title), 100)
+}
+
+func TestFetcher_Timeout(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+	f := preview.NewFetcher(preview.Options{AllowPrivateNetworks: true, Timeout: 50 * time.Millisecond})
+
+	_, err := f.Fetch(t.Context(), srv.URL+"/slow")
+	require.Error(t, err)
+}
+
+func TestFetcher_BlocksPrivateNetworks(t *testing.T) {
+	t.Parallel()
+	srv := newServer(t)
+	f := preview.NewFetcher(preview.Options{})
+
+	_, err := f.Fetch(t.Context(), srv.URL+"/page")
+	require.ErrorIs(t, err, netguard.ErrForbiddenAddress)
+
+	_, err = f.Fetch(t.Context(), "file:///etc/passwd")
+	require.ErrorIs(t, err, netguard.ErrForbiddenAddress)
+}
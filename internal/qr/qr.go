@@ -0,0 +1,349 @@
+// Package qr рисует QR-коды коротких ссылок в PNG и SVG.
+package qr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // логотип может быть в JPEG
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/boombuler/barcode/qr"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 16
+
+	// logoRatio - доля ширины кода, которую занимает логотип
+	logoRatio = 5
+)
+
+// ErrInvalidOption возвращается при некорректных параметрах рендеринга.
+var ErrInvalidOption = errors.New("invalid qr option")
+
+// Options описывает внешний вид QR-кода.
+type Options struct {
+	Format     string
+	Size       int
+	Level      string
+	Margin     int
+	Foreground color.RGBA
+	Background color.RGBA
+	WithLogo   bool
+}
+
+// Image - готовый QR-код вместе с заголовками для ответа.
+type Image struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+}
+
+// DefaultOptions возвращает параметры по умолчанию: чёрный PNG 256px на белом фоне.
+func DefaultOptions() Options {
+	return Options{
+		Format:     FormatPNG,
+		Size:       DefaultSize,
+		Level:      "M",
+		Margin:     DefaultMargin,
+		Foreground: color.RGBA{A: 0xff},
+		Background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+// Validate проверяет параметры и возвращает ошибку, обёрнутую в ErrInvalidOption.
+func (o Options) Validate() error {
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return fmt.Errorf("%w: format must be png or svg", ErrInvalidOption)
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("%w: size must be between %d and %d", ErrInvalidOption, MinSize, MaxSize)
+	}
+	if _, err := parseLevel(o.Level); err != nil {
+		return err
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("%w: margin must be between 0 and %d", ErrInvalidOption, MaxMargin)
+	}
+	return nil
+}
+
+// ParseColor разбирает цвет в формате RRGGBB или #RRGGBB.
+func ParseColor(s string) (color.RGBA, error) {
+	hexStr := strings.TrimPrefix(s, "#")
+	if len(hexStr) != 6 {
+		return color.RGBA{}, fmt.Errorf("%w: color %q must be in RRGGBB format", ErrInvalidOption, s)
+	}
+	v, err := strconv.ParseUint(hexStr, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("%w: color %q: %w", ErrInvalidOption, s, err)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+func parseLevel(level string) (qr.ErrorCorrectionLevel, error) {
+	switch strings.ToUpper(level) {
+	case "L":
+		return qr.L, nil
+	case "M":
+		return qr.M, nil
+	case "Q":
+		return qr.Q, nil
+	case "H":
+		return qr.H, nil
+	}
+	return 0, fmt.Errorf("%w: level must be one of L, M, Q, H", ErrInvalidOption)
+}
+
+// Generator рисует QR-коды и кэширует результат по содержимому и параметрам.
+type Generator struct {
+	logoPath string
+	logoOnce sync.Once
+	logo     image.Image
+	logoErr  error
+
+	mu         sync.Mutex
+	cache      map[string]*Image
+	order      []string
+	maxEntries int
+
+	hits, misses atomic.Uint64
+}
+
+// NewGenerator создаёт генератор. Логотип из logoPath читается один раз при первом запросе с логотипом.
+func NewGenerator(logoPath string, maxEntries int) *Generator {
+	return &Generator{
+		logoPath:   logoPath,
+		cache:      make(map[string]*Image),
+		maxEntries: maxEntries,
+	}
+}
+
+func (g *Generator) loadLogo() (image.Image, error) {
+	g.logoOnce.Do(func() {
+		if g.logoPath == "" {
+			g.logoErr = fmt.Errorf("%w: logo is not configured", ErrInvalidOption)
+			return
+		}
+		f, err := os.Open(g.logoPath)
+		if err != nil {
+			g.logoErr = fmt.Errorf("open logo: %w", err)
+			return
+		}
+		defer f.Close()
+		g.logo, _, g.logoErr = image.Decode(f)
+		if g.logoErr != nil {
+			g.logoErr = fmt.Errorf("decode logo: %w", g.logoErr)
+		}
+	})
+	return g.logo, g.logoErr
+}
+
+// Render возвращает QR-код для content. version - версия ссылки: при её смене кэш не используется.
+func (g *Generator) Render(content, version string, opts Options) (*Image, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	var logo image.Image
+	if opts.WithLogo {
+		var err error
+		if logo, err = g.loadLogo(); err != nil {
+			return nil, err
+		}
+	}
+	key := cacheKey(content, version, opts)
+	if img, ok := g.get(key); ok {
+		return img, nil
+	}
+
+	level, err := parseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	code, err := qr.Encode(content, level, qr.Auto)
+	if err != nil {
+		return nil, fmt.Errorf("encode qr: %w", err)
+	}
+
+	var out *Image
+	switch opts.Format {
+	case FormatSVG:
+		out, err = renderSVG(code, logo, opts)
+	default:
+		out, err = renderPNG(code, logo, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out.ETag = `"` + key + `"`
+	g.put(key, out)
+	return out, nil
+}
+
+func (g *Generator) get(key string) (*Image, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	img, ok := g.cache[key]
+	if ok {
+		g.hits.Add(1)
+	} else {
+		g.misses.Add(1)
+	}
+	return img, ok
+}
+
+// CacheStats возвращает число попаданий и промахов кэша с момента создания генератора.
+func (g *Generator) CacheStats() (hits, misses uint64) {
+	return g.hits.Load(), g.misses.Load()
+}
+
+func (g *Generator) put(key string, img *Image) {
+	if g.maxEntries <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.cache[key]; ok {
+		return
+	}
+	// Вытесняем самые старые записи, чтобы кэш не рос бесконечно
+	for len(g.order) >= g.maxEntries {
+		delete(g.cache, g.order[0])
+		g.order = g.order[1:]
+	}
+	g.cache[key] = img
+	g.order = append(g.order, key)
+}
+
+func cacheKey(content, version string, opts Options) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%s|%d|%s|%d|%v|%v|%t",
+		content, version, opts.Format, opts.Size, strings.ToUpper(opts.Level),
+		opts.Margin, opts.Foreground, opts.Background, opts.WithLogo)
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// modules возвращает матрицу модулей QR-кода (true - тёмный модуль).
+func modules(code image.Image) [][]bool {
+	n := code.Bounds().Dx()
+	m := make([][]bool, n)
+	for y := range n {
+		m[y] = make([]bool, n)
+		for x := range n {
+			r, _, _, _ := code.At(x, y).RGBA()
+			m[y][x] = r < 0x8000
+		}
+	}
+	return m
+}
+
+func renderPNG(code, logo image.Image, opts Options) (*Image, error) {
+	m := modules(code)
+	total := len(m) + 2*opts.Margin
+	scale := max(1, opts.Size/total)
+	// Остаток распределяем по краям, чтобы картинка была ровно Size x Size
+	offset := (opts.Size - total*scale) / 2
+	if offset < 0 {
+		offset = 0
+	}
+	side := max(opts.Size, total*scale)
+
+	img := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: opts.Background}, image.Point{}, draw.Src)
+	fg := &image.Uniform{C: opts.Foreground}
+	for y, row := range m {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			px := offset + (x+opts.Margin)*scale
+			py := offset + (y+opts.Margin)*scale
+			draw.Draw(img, image.Rect(px, py, px+scale, py+scale), fg, image.Point{}, draw.Src)
+		}
+	}
+	if logo != nil {
+		codeSide := len(m) * scale
+		logoSide := codeSide / logoRatio
+		start := (side - logoSide) / 2
+		pad := scale
+		draw.Draw(img, image.Rect(start-pad, start-pad, start+logoSide+pad, start+logoSide+pad),
+			&image.Uniform{C: opts.Background}, image.Point{}, draw.Src)
+		draw.Draw(img, image.Rect(start, start, start+logoSide, start+logoSide),
+			scaleImage(logo, logoSide), image.Point{}, draw.Over)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+	return &Image{Data: buf.Bytes(), ContentType: "image/png"}, nil
+}
+
+func renderSVG(code, logo image.Image, opts Options) (*Image, error) {
+	m := modules(code)
+	total := len(m) + 2*opts.Margin
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`,
+		total, total, opts.Size, opts.Size)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"/>`, total, total, hexColor(opts.Background))
+	fmt.Fprintf(&b, `<path fill="%s" d="`, hexColor(opts.Foreground))
+	for y, row := range m {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+	b.WriteString(`"/>`)
+	if logo != nil {
+		var logoPNG bytes.Buffer
+		if err := png.Encode(&logoPNG, logo); err != nil {
+			return nil, fmt.Errorf("encode logo: %w", err)
+		}
+		side := float64(len(m)) / logoRatio
+		start := (float64(total) - side) / 2
+		fmt.Fprintf(&b, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="%s"/>`,
+			start-1, start-1, side+2, side+2, hexColor(opts.Background))
+		fmt.Fprintf(&b, `<image x="%.2f" y="%.2f" width="%.2f" height="%.2f" href="data:image/png;base64,%s"/>`,
+			start, start, side, side, base64.StdEncoding.EncodeToString(logoPNG.Bytes()))
+	}
+	b.WriteString(`</svg>`)
+	return &Image{Data: []byte(b.String()), ContentType: "image/svg+xml"}, nil
+}
+
+// scaleImage масштабирует картинку в квадрат side x side методом ближайшего соседа.
+func scaleImage(src image.Image, side int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	sb := src.Bounds()
+	for y := range side {
+		for x := range side {
+			sx := sb.Min.X + x*sb.Dx()/side
+			sy := sb.Min.Y + y*sb.Dy()/side
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+	return dst
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
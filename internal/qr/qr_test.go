@@ -0,0 +1,145 @@
+package qr_test
+
+import (
+	"bytes"
+	"code/internal/qr"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const content = "http://localhost:8080/r/abc123"
+
+func TestGenerator_RenderPNG(t *testing.T) {
+	t.Parallel()
+	g := qr.NewGenerator("", 10)
+	opts := qr.DefaultOptions()
+	opts.Foreground = color.RGBA{R: 0xff, A: 0xff}
+
+	img, err := g.Render(content, "1", opts)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", img.ContentType)
+	assert.NotEmpty(t, img.ETag)
+
+	decoded, err := png.Decode(bytes.NewReader(img.Data))
+	require.NoError(t, err)
+	assert.Equal(t, qr.DefaultSize, decoded.Bounds().Dx())
+	// Левый верхний угол - поле (фон), по диагонали дальше начинается finder pattern
+	assert.Equal(t, opts.Background, color.RGBAModel.Convert(decoded.At(0, 0)))
+	found := false
+	for i := range decoded.Bounds().Dx() / 2 {
+		if color.RGBAModel.Convert(decoded.At(i, i)) == opts.Foreground {
+			found = true
+			break
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestGenerator_RenderSVG(t *testing.T) {
+	t.Parallel()
+	g := qr.NewGenerator("", 10)
+	opts := qr.DefaultOptions()
+	opts.Format = qr.FormatSVG
+	opts.Background, _ = qr.ParseColor("#00ff00")
+
+	img, err := g.Render(content, "1", opts)
+	require.NoError(t, err)
+	assert.Equal(t, "image/svg+xml", img.ContentType)
+	svg := string(img.Data)
+	assert.True(t, strings.HasPrefix(svg, "<svg"))
+	assert.Contains(t, svg, `fill="#00ff00"`)
+	assert.NotContains(t, svg, "<image")
+}
+
+func TestGenerator_Cache(t *testing.T) {
+	t.Parallel()
+	g := qr.NewGenerator("", 10)
+	opts := qr.DefaultOptions()
+
+	first, err := g.Render(content, "1", opts)
+	require.NoError(t, err)
+	second, err := g.Render(content, "1", opts)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	changed, err := g.Render(content, "2", opts)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ETag, changed.ETag)
+
+	hits, misses := g.CacheStats()
+	assert.Equal(t, uint64(1), hits)
+	assert.Equal(t, uint64(2), misses)
+}
+
+func TestGenerator_Logo(t *testing.T) {
+	t.Parallel()
+	logo := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := range logo.Pix {
+		logo.Pix[i] = 0xff
+	}
+	path := filepath.Join(t.TempDir(), "logo.png")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, logo))
+	require.NoError(t, f.Close())
+
+	opts := qr.DefaultOptions()
+	opts.Level = "H"
+	opts.WithLogo = true
+
+	_, err = qr.NewGenerator("", 10).Render(content, "1", opts)
+	require.ErrorIs(t, err, qr.ErrInvalidOption)
+
+	opts.Format = qr.FormatSVG
+	img, err := qr.NewGenerator(path, 10).Render(content, "1", opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(img.Data), "data:image/png;base64,")
+}
+
+func TestOptions_Validate(t *testing.T) {
+	t.Parallel()
+	var testCases = []struct {
+		name   string
+		modify func(o *qr.Options)
+		err    bool
+	}{
+		{name: "defaults", modify: func(_ *qr.Options) {}, err: false},
+		{name: "unknown_format", modify: func(o *qr.Options) { o.Format = "gif" }, err: true},
+		{name: "too_small", modify: func(o *qr.Options) { o.Size = 10 }, err: true},
+		{name: "too_big", modify: func(o *qr.Options) { o.Size = qr.MaxSize + 1 }, err: true},
+		{name: "unknown_level", modify: func(o *qr.Options) { o.Level = "X" }, err: true},
+		{name: "negative_margin", modify: func(o *qr.Options) { o.Margin = -1 }, err: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			opts := qr.DefaultOptions()
+			tc.modify(&opts)
+			err := opts.Validate()
+			if tc.err {
+				require.ErrorIs(t, err, qr.ErrInvalidOption)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	t.Parallel()
+	c, err := qr.ParseColor("#1a2B3c")
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0xff}, c)
+
+	_, err = qr.ParseColor("red")
+	require.ErrorIs(t, err, qr.ErrInvalidOption)
+}
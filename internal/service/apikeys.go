@@ -0,0 +1,122 @@
+package service
+
+import (
+	store "code/internal/db/postgres_db"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// APIKeyPrefix начинает каждый ключ, чтобы его было видно в логах и сканерах секретов
+	APIKeyPrefix = "lsk_"
+	// apiKeyBytes - случайная часть ключа, 32 байта в hex
+	apiKeyBytes = 32
+	// apiKeyShownPrefix - сколько первых символов ключа хранится и показывается в списке
+	apiKeyShownPrefix = len(APIKeyPrefix) + 8
+)
+
+// ErrInvalidAPIKey - ключ не передан, неизвестен или отозван.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKey - ключ доступа без секрета. Секрет показывается один раз при создании.
+type APIKey struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyService выдаёт, отзывает и проверяет ключи доступа к API.
+// В базе хранится только sha256 ключа.
+type APIKeyService struct {
+	q store.Querier
+}
+
+func NewAPIKeyService(q store.Querier) *APIKeyService {
+	return &APIKeyService{q: q}
+}
+
+// Create выдаёт новый ключ и возвращает его вместе с секретом.
+func (s *APIKeyService) Create(ctx context.Context, name string) (*APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.New("api key name is required")
+	}
+	buf := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("rand.Read: %w", err)
+	}
+	secret := APIKeyPrefix + hex.EncodeToString(buf)
+	row, err := s.q.CreateAPIKey(ctx, store.CreateAPIKeyParams{
+		Name:    name,
+		Prefix:  secret[:apiKeyShownPrefix],
+		KeyHash: hashAPIKey(secret),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("createAPIKey: %w", err)
+	}
+	return toAPIKey(row), secret, nil
+}
+
+// List возвращает все ключи, включая отозванные.
+func (s *APIKeyService) List(ctx context.Context) ([]*APIKey, error) {
+	rows, err := s.q.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listAPIKeys: %w", err)
+	}
+	keys := make([]*APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, toAPIKey(row))
+	}
+	return keys, nil
+}
+
+// Revoke отзывает ключ. Неизвестный или уже отозванный ключ - ErrNotFound.
+func (s *APIKeyService) Revoke(ctx context.Context, id int64) error {
+	n, err := s.q.RevokeAPIKey(ctx, id)
+	if err != nil {
+		return fmt.Errorf("revokeAPIKey: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate находит действующий ключ по секрету.
+func (s *APIKeyService) Authenticate(ctx context.Context, secret string) (*APIKey, error) {
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	row, err := s.q.GetActiveAPIKeyByHash(ctx, hashAPIKey(secret))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("getActiveAPIKeyByHash: %w", err)
+	}
+	return toAPIKey(row), nil
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func toAPIKey(row store.ApiKey) *APIKey {
+	return &APIKey{
+		ID:        row.ID,
+		Name:      row.Name,
+		Prefix:    row.Prefix,
+		CreatedAt: timePtr(row.CreatedAt),
+		RevokedAt: timePtr(row.RevokedAt),
+	}
+}
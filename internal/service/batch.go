@@ -0,0 +1,251 @@
+package service
+
+import (
+	store "code/internal/db/postgres_db"
+	"code/internal/logging"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// BatchMode - что делать с пакетом, если часть элементов не удалась.
+type BatchMode string
+
+const (
+	// BatchAtomic - всё или ничего: любая ошибка откатывает весь пакет.
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort сохраняет удавшиеся элементы, неудачные откатываются по отдельности.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+// Статусы элементов пакета.
+const (
+	BatchCreated = "created"
+	BatchUpdated = "updated"
+	BatchDeleted = "deleted"
+	BatchFailed  = "failed"
+	// BatchRolledBack - элемент выполнился, но пакет откатили из-за ошибок в других элементах
+	BatchRolledBack = "rolled_back"
+	// BatchSkipped - элемент не выполнялся, пакет отклонён ещё до транзакции
+	BatchSkipped = "skipped"
+)
+
+// ErrBatchUnavailable - сервису не передали TxRunner.
+var ErrBatchUnavailable = errors.New("batch operations are not configured")
+
+// errBatchRollback откатывает транзакцию пакета в режиме atomic.
+var errBatchRollback = errors.New("batch rolled back")
+
+// BatchLinkInput - элемент пакетного создания. С ID ссылка изменяется,
+// пустой ShortName при изменении оставляет прежнее имя.
+type BatchLinkInput struct {
+	// Index - позиция элемента в запросе, возвращается в результате
+	Index       int
+	ID          int64
+	OriginalUrl string
+	ShortName   string
+	// Title и Description пишутся в колонки метаданных, как если бы их загрузил MetadataWorker
+	Title       string
+	Description string
+	// Preview - Open Graph теги, пустые не меняются
+	Preview SocialPreview
+}
+
+// hasMetadata - заголовок или описание пришли вместе со ссылкой, загружать их со страницы не нужно.
+func (in BatchLinkInput) hasMetadata() bool {
+	return in.Title != "" || in.Description != ""
+}
+
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	ID     int64  `json:"id,omitempty"`
+	Status string `json:"status"`
+	Link   *Link  `json:"link,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchResult - итог пакета. Committed false означает, что в БД ничего не изменилось.
+type BatchResult struct {
+	Mode      BatchMode         `json:"mode"`
+	Committed bool              `json:"committed"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Items     []BatchItemResult `json:"items"`
+}
+
+type batchOp struct {
+	index int
+	id    int64
+	run   func(ctx context.Context, s *LinkService) (BatchItemResult, error)
+}
+
+// CreateLinksBatch создаёт и изменяет ссылки в одной транзакции.
+// Входные данные должны быть уже проверены, как для CreateShortLink.
+func (l *LinkService) CreateLinksBatch(ctx context.Context, items []BatchLinkInput, mode BatchMode) (*BatchResult, error) {
+	return l.createLinksBatch(ctx, items, mode, false)
+}
+
+// createLinksBatch с dryRun выполняет пакет и всегда откатывает транзакцию:
+// результат показывает, что случилось бы, включая занятые короткие имена.
+func (l *LinkService) createLinksBatch(ctx context.Context, items []BatchLinkInput, mode BatchMode, dryRun bool) (*BatchResult, error) {
+	ops := make([]batchOp, 0, len(items))
+	for _, item := range items {
+		ops = append(ops, batchOp{index: item.Index, id: item.ID, run: func(ctx context.Context, s *LinkService) (BatchItemResult, error) {
+			result := BatchItemResult{Status: BatchUpdated}
+			var link *Link
+			var err error
+			if item.ID == 0 {
+				result.Status = BatchCreated
+				link, err = s.createLink(ctx, item.ShortName, item.OriginalUrl)
+			} else {
+				patch := LinkPatch{OriginalUrl: &item.OriginalUrl}
+				if item.ShortName != "" {
+					patch.ShortName = &item.ShortName
+				}
+				link, err = s.PatchLink(ctx, item.ID, patch, nil)
+			}
+			if err == nil && item.hasMetadata() {
+				err = s.updateLinkMetadata(ctx, link, item.Title, item.Description)
+			}
+			if err == nil && !item.Preview.IsEmpty() {
+				link, err = s.UpdateLinkSocial(ctx, link.ID, item.Preview)
+			}
+			if err != nil {
+				return BatchItemResult{}, err
+			}
+			result.ID, result.Link = link.ID, link
+			return result, nil
+		}})
+	}
+	result, err := l.runBatch(ctx, mode, ops, dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("createLinksBatch: %w", err)
+	}
+	if result.Committed {
+		for i, item := range result.Items {
+			// Загруженное превью перезаписало бы заголовок и описание из запроса
+			if (item.Status == BatchCreated || item.Status == BatchUpdated) && !items[i].hasMetadata() {
+				l.enqueueMetadata(item.Link.ID, item.Link.OriginalUrl)
+			}
+		}
+	}
+	return result, nil
+}
+
+// updateLinkMetadata сохраняет заголовок и описание ссылки без ревизии: это метаданные, а не правка ссылки.
+func (l *LinkService) updateLinkMetadata(ctx context.Context, link *Link, title, description string) error {
+	if err := l.q.UpdateLinkMetadata(ctx, store.UpdateLinkMetadataParams{
+		ID:          link.ID,
+		Title:       StrToText(title),
+		Description: StrToText(description),
+		OriginalUrl: link.OriginalUrl,
+	}); err != nil {
+		return fmt.Errorf("updateLinkMetadata: %w", err)
+	}
+	link.Title, link.Description = title, description
+	return nil
+}
+
+// DeleteLinksBatch удаляет ссылки в одной транзакции, permanent - как у DeleteLinkByID.
+func (l *LinkService) DeleteLinksBatch(ctx context.Context, ids []int64, permanent bool, mode BatchMode) (*BatchResult, error) {
+	ops := make([]batchOp, 0, len(ids))
+	for i, id := range ids {
+		ops = append(ops, batchOp{index: i, id: id, run: func(ctx context.Context, s *LinkService) (BatchItemResult, error) {
+			res, err := s.DeleteLinkByID(ctx, id, permanent)
+			if err != nil {
+				return BatchItemResult{}, err
+			}
+			if res.Deleted == 0 {
+				return BatchItemResult{}, ErrNotFound
+			}
+			return BatchItemResult{Status: BatchDeleted}, nil
+		}})
+	}
+	result, err := l.runBatch(ctx, mode, ops, false)
+	if err != nil {
+		return nil, fmt.Errorf("deleteLinksBatch: %w", err)
+	}
+	return result, nil
+}
+
+// runBatch выполняет каждый элемент в своём SAVEPOINT, чтобы ошибка одного не ломала транзакцию.
+// В режиме atomic при любой ошибке транзакция откатывается целиком, с dryRun - всегда,
+// но статусы элементов остаются такими, какими были бы после коммита.
+func (l *LinkService) runBatch(ctx context.Context, mode BatchMode, ops []batchOp, dryRun bool) (*BatchResult, error) {
+	if l.tx == nil {
+		return nil, ErrBatchUnavailable
+	}
+	result := &BatchResult{Mode: mode, Items: make([]BatchItemResult, len(ops))}
+	err := l.tx.InTx(ctx, func(tx store.Tx) error {
+		result.Succeeded, result.Failed = 0, 0
+		for i, op := range ops {
+			var item BatchItemResult
+			err := tx.Savepoint(ctx, func(q store.Querier) error {
+				var err error
+				item, err = op.run(ctx, l.withQuerier(q))
+				return err
+			})
+			if err != nil {
+				item = BatchItemResult{Status: BatchFailed, Error: batchError(ctx, op, err)}
+				result.Failed++
+			} else {
+				result.Succeeded++
+			}
+			item.Index = op.index
+			if item.ID == 0 {
+				item.ID = op.id
+			}
+			result.Items[i] = item
+		}
+		if dryRun || (mode == BatchAtomic && result.Failed > 0) {
+			return errBatchRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchRollback) {
+		return nil, err
+	}
+	result.Committed = err == nil
+	if !result.Committed && !dryRun {
+		for i := range result.Items {
+			if result.Items[i].Status != BatchFailed {
+				result.Items[i].Status = BatchRolledBack
+				result.Items[i].Link = nil
+			}
+		}
+		result.Succeeded = 0
+	}
+	return result, nil
+}
+
+// withQuerier возвращает копию сервиса поверх запросов транзакции.
+// Превью в копии не ставятся в очередь: до коммита ссылки не видны воркеру.
+func (l *LinkService) withQuerier(q store.Querier) *LinkService {
+	s := *l
+	s.q = q
+	s.tx = nil
+	s.meta = nil
+	return &s
+}
+
+// batchError - текст ошибки элемента для клиента. Известные ошибки получают постоянные сообщения,
+// остальные (ошибки БД и т.п.) пишутся в лог, а клиент видит только "internal error".
+func batchError(ctx context.Context, op batchOp, err error) string {
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "link not found"
+	case errors.Is(err, ErrShortNameTaken):
+		return ErrShortNameTaken.Error()
+	case errors.Is(err, ErrOriginalURLTaken):
+		return ErrOriginalURLTaken.Error()
+	case errors.Is(err, ErrShortNameReserved):
+		return ErrShortNameReserved.Error()
+	case errors.As(err, &validationErrs):
+		return "invalid link data"
+	}
+	logging.FromContext(ctx).Error("batch item failed", "index", op.index, "link_id", op.id, "err", err)
+	return "internal error"
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	store "code/internal/db/postgres_db"
+	"code/internal/db/visits"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrExportUnavailable - хранилище не умеет отдавать строки потоком.
+var ErrExportUnavailable = errors.New("export is not supported by the store")
+
+// ExportLinks передаёт в fn ссылки по возрастанию id, начиная после afterID.
+// Строки читаются из БД по одной, весь результат в памяти не держится.
+func (l *LinkService) ExportLinks(ctx context.Context, filter LinkFilter, afterID int64, fn func(link *Link) error) error {
+	exp, ok := l.q.(store.Exporter)
+	if !ok {
+		return ErrExportUnavailable
+	}
+	err := exp.ExportLinks(ctx, store.ExportLinksParams{
+		Health:      StrToText(filter.Health),
+		Query:       StrToText(escapeLike(filter.Query)),
+		Ids:         filter.IDs,
+		ShortName:   StrToText(filter.ShortName),
+		CreatedFrom: TimeToTimestamptz(filter.CreatedFrom),
+		CreatedTo:   TimeToTimestamptz(filter.CreatedTo),
+		Deleted:     filter.Deleted,
+		AfterID:     afterID,
+	}, func(row store.ExportLinksRow) error {
+		return fn(&Link{
+			ID:          row.ID,
+			OriginalUrl: row.OriginalUrl,
+			ShortName:   row.ShortName,
+			ShortUrl:    l.ShortURL(row.ShortName),
+			Title:       row.Title.String,
+			Description: row.Description.String,
+			SocialPreview: SocialPreview{
+				OgTitle:       row.OgTitle.String,
+				OgDescription: row.OgDescription.String,
+				OgImage:       row.OgImage.String,
+			},
+			HealthStatus: row.HealthStatus,
+			CreatedAt:    timePtr(row.CreatedAt),
+			DeletedAt:    timePtr(row.DeletedAt),
+			Revision:     int(row.Revision),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("exportLinks: %w", err)
+	}
+	return nil
+}
+
+// ExportVisits передаёт в fn посещения по возрастанию id, начиная после afterID.
+func (v *VisitsService) ExportVisits(ctx context.Context, filter VisitFilter, afterID int64, fn func(visit *Visit) error) error {
+	exp, ok := v.s.(visits.Exporter)
+	if !ok {
+		return ErrExportUnavailable
+	}
+	where := visitsWhere(filter)
+	err := exp.ExportVisits(ctx, visits.ExportVisitsParams{
+		Query:       where.Query,
+		Ids:         where.Ids,
+		LinkIds:     where.LinkIds,
+		CreatedFrom: where.CreatedFrom,
+		CreatedTo:   where.CreatedTo,
+		Status:      where.Status,
+		Ip:          where.Ip,
+		RefererHost: where.RefererHost,
+		AfterID:     afterID,
+	}, func(row visits.Visit) error {
+		return fn(&Visit{
+			ID:           int(row.ID),
+			Link_ID:      int(row.LinkID),
+			CreatedAt:    row.CreatedAt.Time,
+			IP:           row.Ip,
+			UserAgent:    row.UserAgent,
+			Referer:      row.Referer.String,
+			RefererHost:  row.RefererHost.String,
+			Status:       int(row.Status),
+			IsCrawler:    row.IsCrawler,
+			LinkRevision: int(row.LinkRevision.Int32),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("exportVisits: %w", err)
+	}
+	return nil
+}
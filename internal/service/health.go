@@ -0,0 +1,221 @@
+package service
+
+import (
+	store "code/internal/db/postgres_db"
+	"code/internal/healthcheck"
+	"code/internal/logging"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	HealthUnknown = "unknown"
+	HealthHealthy = "healthy"
+	HealthBroken  = "broken"
+
+	// DefaultHealthHistory - сколько последних проверок отдаёт GET /api/links/:id/health
+	DefaultHealthHistory = 10
+)
+
+// HealthProber выполняет одну проверку адреса назначения.
+type HealthProber interface {
+	Check(ctx context.Context, rawURL string) healthcheck.Result
+}
+
+type HealthCheckOptions struct {
+	// Interval - как часто перепроверять одну и ту же ссылку
+	Interval time.Duration
+	// Concurrency - сколько хостов проверяется одновременно
+	Concurrency int
+	// HostDelay - пауза между запросами к одному хосту
+	HostDelay time.Duration
+	// FailureThreshold - после скольких неудач подряд ссылка считается сломанной
+	FailureThreshold int32
+	// BatchSize - сколько ссылок берётся за один проход
+	BatchSize int32
+}
+
+type LinkCheck struct {
+	CheckedAt     time.Time `json:"checked_at"`
+	OK            bool      `json:"ok"`
+	StatusCode    int       `json:"status_code,omitempty"`
+	LatencyMs     int       `json:"latency_ms"`
+	RedirectChain []string  `json:"redirect_chain"`
+	Error         string    `json:"error,omitempty"`
+}
+
+type LinkHealth struct {
+	Status              string      `json:"status"`
+	ConsecutiveFailures int         `json:"consecutive_failures"`
+	LastCheckedAt       *time.Time  `json:"last_checked_at"`
+	Checks              []LinkCheck `json:"checks"`
+}
+
+// HealthChecker периодически проверяет адреса назначения и записывает результат в link_checks.
+type HealthChecker struct {
+	q      store.Querier
+	prober HealthProber
+	opts   HealthCheckOptions
+}
+
+func NewHealthChecker(q store.Querier, prober HealthProber, opts HealthCheckOptions) *HealthChecker {
+	opts.Concurrency = max(1, opts.Concurrency)
+	opts.FailureThreshold = max(1, opts.FailureThreshold)
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	return &HealthChecker{q: q, prober: prober, opts: opts}
+}
+
+// Run выполняет проход сразу и затем раз в Interval, пока не отменён ctx.
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := h.RunOnce(ctx); err != nil {
+			logging.FromContext(ctx).Error("health check", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce проверяет ссылки, которые не проверялись дольше Interval.
+// Ссылки группируются по хосту: хосты проверяются параллельно, а запросы к одному хосту - по очереди.
+func (h *HealthChecker) RunOnce(ctx context.Context) error {
+	links, err := h.q.GetLinksForHealthCheck(ctx, store.GetLinksForHealthCheckParams{
+		CheckedBefore: pgtype.Timestamptz{Time: time.Now().Add(-h.opts.Interval), Valid: true},
+		Limit:         h.opts.BatchSize,
+	})
+	if err != nil {
+		return fmt.Errorf("getLinksForHealthCheck: %w", err)
+	}
+
+	byHost := make(map[string][]store.GetLinksForHealthCheckRow)
+	for _, link := range links {
+		host := link.OriginalUrl
+		if u, err := url.Parse(link.OriginalUrl); err == nil {
+			host = u.Hostname()
+		}
+		byHost[host] = append(byHost[host], link)
+	}
+
+	sem := make(chan struct{}, h.opts.Concurrency)
+	var wg sync.WaitGroup
+	for _, hostLinks := range byHost {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			for i, link := range hostLinks {
+				if i > 0 && !sleep(ctx, h.opts.HostDelay) {
+					return
+				}
+				h.check(ctx, link.ID, link.OriginalUrl)
+			}
+		})
+	}
+	wg.Wait()
+	return nil
+}
+
+func (h *HealthChecker) check(ctx context.Context, id int64, originalURL string) {
+	res := h.prober.Check(ctx, originalURL)
+	if ctx.Err() != nil {
+		return
+	}
+	params := store.CreateLinkCheckParams{
+		LinkID:        id,
+		Ok:            res.OK,
+		LatencyMs:     int32(min(res.Latency.Milliseconds(), math.MaxInt32)),
+		RedirectChain: res.RedirectChain,
+	}
+	if params.RedirectChain == nil {
+		params.RedirectChain = []string{}
+	}
+	if res.StatusCode != 0 {
+		params.StatusCode = pgtype.Int4{Int32: int32(res.StatusCode), Valid: true}
+	}
+	if res.Err != nil {
+		params.Error = StrToText(res.Err.Error())
+	}
+	if err := h.q.CreateLinkCheck(ctx, params); err != nil {
+		logging.FromContext(ctx).Error("save link check", "link_id", id, "err", err)
+		return
+	}
+	health, err := h.q.UpdateLinkHealth(ctx, store.UpdateLinkHealthParams{
+		Ok:               res.OK,
+		FailureThreshold: h.opts.FailureThreshold,
+		ID:               id,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("update link health", "link_id", id, "err", err)
+		return
+	}
+	if health.HealthStatus == HealthBroken && health.ConsecutiveFailures == h.opts.FailureThreshold {
+		logging.FromContext(ctx).Warn("link marked as broken", "link_id", id, "err", res.Err)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// GetLinkHealth возвращает текущее состояние ссылки и последние проверки.
+func (l *LinkService) GetLinkHealth(ctx context.Context, id int64, limit int32) (*LinkHealth, error) {
+	row, err := l.q.GetLinkHealth(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("getLinkHealth: %w", err)
+	}
+	checks, err := l.q.GetLinkChecks(ctx, store.GetLinkChecksParams{LinkID: id, Limit: limit})
+	if err != nil {
+		return nil, fmt.Errorf("getLinkChecks: %w", err)
+	}
+	out := &LinkHealth{
+		Status:              row.HealthStatus,
+		ConsecutiveFailures: int(row.ConsecutiveFailures),
+		Checks:              make([]LinkCheck, 0, len(checks)),
+	}
+	if row.LastCheckedAt.Valid {
+		out.LastCheckedAt = &row.LastCheckedAt.Time
+	}
+	for _, c := range checks {
+		out.Checks = append(out.Checks, LinkCheck{
+			CheckedAt:     c.CheckedAt.Time,
+			OK:            c.Ok,
+			StatusCode:    int(c.StatusCode.Int32),
+			LatencyMs:     int(c.LatencyMs),
+			RedirectChain: c.RedirectChain,
+			Error:         c.Error.String,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bytes"
+	store "code/internal/db/postgres_db"
+	"code/internal/logging"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	// ErrIdempotencyKeyReused - ключ уже использован для запроса с другим телом.
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+	// ErrIdempotencyInProgress - первый запрос с этим ключом ещё выполняется.
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is still in progress")
+)
+
+// IdempotentResponse - сохранённый ответ, который повторяется для запросов с тем же ключом.
+type IdempotentResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyService хранит ответы на запросы с Idempotency-Key в течение ttl.
+type IdempotencyService struct {
+	q   store.Querier
+	ttl time.Duration
+}
+
+func NewIdempotencyService(q store.Querier, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{q: q, ttl: ttl}
+}
+
+// Begin занимает ключ для нового запроса и возвращает nil, nil.
+// Для повтора уже выполненного запроса возвращается сохранённый ответ.
+func (s *IdempotencyService) Begin(ctx context.Context, key, fingerprint string) (*IdempotentResponse, error) {
+	// Вторая попытка нужна, если ключ истёк или был освобождён между Claim и Get
+	for range 2 {
+		n, err := s.q.ClaimIdempotencyKey(ctx, store.ClaimIdempotencyKeyParams{
+			Key:         key,
+			Fingerprint: fingerprint,
+			ExpiresAt:   pgtype.Timestamptz{Time: time.Now().Add(s.ttl), Valid: true},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("claimIdempotencyKey: %w", err)
+		}
+		if n == 1 {
+			return nil, nil
+		}
+		row, err := s.q.GetIdempotencyKey(ctx, key)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return nil, fmt.Errorf("getIdempotencyKey: %w", err)
+		}
+		if row.Fingerprint != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if !row.StatusCode.Valid {
+			return nil, ErrIdempotencyInProgress
+		}
+		return &IdempotentResponse{
+			StatusCode:  int(row.StatusCode.Int32),
+			ContentType: row.ContentType.String,
+			Body:        row.Response,
+		}, nil
+	}
+	return nil, ErrIdempotencyInProgress
+}
+
+// Complete сохраняет ответ для повторов.
+func (s *IdempotencyService) Complete(ctx context.Context, key string, resp IdempotentResponse) error {
+	err := s.q.SaveIdempotencyResponse(ctx, store.SaveIdempotencyResponseParams{
+		Key:         key,
+		StatusCode:  pgtype.Int4{Int32: int32(resp.StatusCode), Valid: true},
+		ContentType: StrToText(resp.ContentType),
+		Response:    resp.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("saveIdempotencyResponse: %w", err)
+	}
+	return nil
+}
+
+// Release освобождает ключ незавершённого запроса, чтобы его можно было повторить.
+func (s *IdempotencyService) Release(ctx context.Context, key string) error {
+	if err := s.q.ReleaseIdempotencyKey(ctx, key); err != nil {
+		return fmt.Errorf("releaseIdempotencyKey: %w", err)
+	}
+	return nil
+}
+
+// Run удаляет просроченные ключи сразу и затем раз в interval, пока не отменён ctx.
+func (s *IdempotencyService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.q.DeleteExpiredIdempotencyKeys(ctx); err != nil && ctx.Err() == nil {
+			logging.FromContext(ctx).Error("idempotency keys cleanup", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RequestFingerprint - отпечаток запроса для сравнения повторов.
+// JSON-тело сжимается, чтобы пробелы и переносы не делали запросы разными.
+func RequestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err == nil {
+		body = compact.Bytes()
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
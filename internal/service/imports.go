@@ -0,0 +1,307 @@
+package service
+
+import (
+	"bytes"
+	store "code/internal/db/postgres_db"
+	"code/internal/importer"
+	"code/internal/logging"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Статусы задачи импорта
+const (
+	ImportPending = "pending"
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+const (
+	// MaxImportErrors - сколько ошибок строк сохраняется в отчёте, остальные только считаются
+	MaxImportErrors = 1000
+	// importChunkSize - сколько строк импортируется в одной транзакции, после каждой обновляется прогресс
+	importChunkSize = 100
+	// ImportStaleAfter - задача без обновления прогресса дольше этого считается прерванной
+	ImportStaleAfter = 10 * time.Minute
+	// importShortNameLength - длина короткого имени для строк без short_name, как в API
+	importShortNameLength = 6
+)
+
+// ErrInvalidImport - файл нельзя импортировать: неизвестный формат, нет колонки с адресом и т.п.
+var ErrInvalidImport = errors.New("invalid import")
+
+// ImportRowError - строка файла, которую не удалось импортировать.
+type ImportRowError struct {
+	Line      int    `json:"line"`
+	ShortName string `json:"short_name,omitempty"`
+	Error     string `json:"error"`
+}
+
+// ImportJob - задача импорта и её прогресс. В режиме DryRun Created - сколько ссылок было бы создано.
+type ImportJob struct {
+	ID         int64            `json:"id"`
+	Format     string           `json:"format"`
+	DryRun     bool             `json:"dry_run"`
+	Status     string           `json:"status"`
+	Actor      string           `json:"actor,omitempty"`
+	Total      int              `json:"total_rows"`
+	Processed  int              `json:"processed_rows"`
+	Created    int              `json:"created_rows"`
+	Failed     int              `json:"failed_rows"`
+	Errors     []ImportRowError `json:"errors"`
+	Error      string           `json:"error,omitempty"`
+	Mapping    importer.Mapping `json:"mapping,omitempty"`
+	CreatedAt  *time.Time       `json:"created_at,omitempty"`
+	StartedAt  *time.Time       `json:"started_at,omitempty"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+}
+
+type ImportServer interface {
+	CreateImport(ctx context.Context, format importer.Format, mapping importer.Mapping, payload []byte, dryRun bool) (*ImportJob, error)
+	GetImport(ctx context.Context, id int64) (*ImportJob, error)
+}
+
+// ImportService ставит файлы в очередь импорта и в фоне разбирает их.
+// Очередь хранится в import_jobs, так что задачи переживают перезапуск до начала обработки.
+type ImportService struct {
+	q        store.Querier
+	links    *LinkService
+	interval time.Duration
+	wake     chan struct{}
+}
+
+func NewImportService(q store.Querier, links *LinkService, interval time.Duration) *ImportService {
+	return &ImportService{q: q, links: links, interval: interval, wake: make(chan struct{}, 1)}
+}
+
+// CreateImport проверяет, что файл разбирается, и ставит его в очередь.
+func (s *ImportService) CreateImport(ctx context.Context, format importer.Format, mapping importer.Mapping, payload []byte, dryRun bool) (*ImportJob, error) {
+	if _, err := importer.Parse(format, bytes.NewReader(payload), mapping); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	var rawMapping []byte
+	if len(mapping) > 0 {
+		var err error
+		if rawMapping, err = json.Marshal(mapping); err != nil {
+			return nil, fmt.Errorf("createImport: %w", err)
+		}
+	}
+	id, err := s.q.CreateImportJob(ctx, store.CreateImportJobParams{
+		Format:  string(format),
+		DryRun:  dryRun,
+		Actor:   ActorFromContext(ctx),
+		Mapping: rawMapping,
+		Payload: payload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("createImportJob: %w", err)
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return s.GetImport(ctx, id)
+}
+
+func (s *ImportService) GetImport(ctx context.Context, id int64) (*ImportJob, error) {
+	row, err := s.q.GetImportJob(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("getImportJob: %w", err)
+	}
+	job := &ImportJob{
+		ID:         row.ID,
+		Format:     row.Format,
+		DryRun:     row.DryRun,
+		Status:     row.Status,
+		Actor:      row.Actor,
+		Total:      int(row.TotalRows),
+		Processed:  int(row.ProcessedRows),
+		Created:    int(row.CreatedRows),
+		Failed:     int(row.FailedRows),
+		Errors:     []ImportRowError{},
+		Error:      row.Error.String,
+		CreatedAt:  timePtr(row.CreatedAt),
+		StartedAt:  timePtr(row.StartedAt),
+		FinishedAt: timePtr(row.FinishedAt),
+	}
+	if len(row.Errors) > 0 {
+		if err := json.Unmarshal(row.Errors, &job.Errors); err != nil {
+			return nil, fmt.Errorf("getImportJob: errors: %w", err)
+		}
+	}
+	if len(row.Mapping) > 0 {
+		if err := json.Unmarshal(row.Mapping, &job.Mapping); err != nil {
+			return nil, fmt.Errorf("getImportJob: mapping: %w", err)
+		}
+	}
+	return job, nil
+}
+
+// Run разбирает очередь, пока не отменён ctx. Новая задача будит обработчик сразу,
+// interval нужен для задач, поставленных другими экземплярами сервиса.
+func (s *ImportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			ok, err := s.RunOnce(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Error("import", "err", err)
+			}
+			if !ok || ctx.Err() != nil {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// RunOnce обрабатывает одну задачу из очереди. false - очередь пуста.
+func (s *ImportService) RunOnce(ctx context.Context) (bool, error) {
+	if n, err := s.q.FailStaleImportJobs(ctx, pgtype.Timestamptz{Time: time.Now().Add(-ImportStaleAfter), Valid: true}); err != nil {
+		return false, fmt.Errorf("failStaleImportJobs: %w", err)
+	} else if n > 0 {
+		logging.FromContext(ctx).Warn("interrupted import jobs marked as failed", "count", n)
+	}
+	job, err := s.q.ClaimImportJob(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("claimImportJob: %w", err)
+	}
+	status, jobErr := ImportDone, pgtype.Text{}
+	if err := s.process(ctx, job); err != nil {
+		status, jobErr = ImportFailed, pgtype.Text{String: err.Error(), Valid: true}
+	}
+	if err := s.q.FinishImportJob(context.WithoutCancel(ctx), store.FinishImportJobParams{
+		ID:     job.ID,
+		Status: status,
+		Error:  jobErr,
+	}); err != nil {
+		return true, fmt.Errorf("finishImportJob: %w", err)
+	}
+	return true, nil
+}
+
+// importProgress - счётчики задачи, сохраняются после каждой порции строк.
+type importProgress struct {
+	total, processed, created, failed int
+	errors                            []ImportRowError
+}
+
+func (p *importProgress) fail(line int, shortName, msg string) {
+	p.failed++
+	if len(p.errors) < MaxImportErrors {
+		p.errors = append(p.errors, ImportRowError{Line: line, ShortName: shortName, Error: msg})
+	}
+}
+
+func (s *ImportService) process(ctx context.Context, job store.ImportJob) error {
+	var mapping importer.Mapping
+	if len(job.Mapping) > 0 {
+		if err := json.Unmarshal(job.Mapping, &mapping); err != nil {
+			return fmt.Errorf("mapping: %w", err)
+		}
+	}
+	records, err := importer.Parse(importer.Format(job.Format), bytes.NewReader(job.Payload), mapping)
+	if err != nil {
+		return err
+	}
+	ctx = WithActor(ctx, job.Actor)
+	progress := &importProgress{total: len(records)}
+	// Первая строка с каждым коротким именем: дубликаты внутри файла видны и в dry-run
+	seen := make(map[string]int)
+
+	for start := 0; start < len(records); start += importChunkSize {
+		chunk := records[start:min(start+importChunkSize, len(records))]
+		inputs := make([]BatchLinkInput, 0, len(chunk))
+		for i, rec := range chunk {
+			if rec.Err != nil {
+				progress.fail(rec.Line, "", rec.Err.Error())
+				continue
+			}
+			if err := ValidateLinkInput(CreateLinkInput{OriginalUrl: rec.OriginalURL, ShortName: rec.ShortName}); err != nil {
+				progress.fail(rec.Line, rec.ShortName, err.Error())
+				continue
+			}
+			shortName := rec.ShortName
+			if shortName == "" {
+				if shortName, err = GenerateShortName(importShortNameLength); err != nil {
+					return err
+				}
+			} else if line, ok := seen[shortName]; ok {
+				progress.fail(rec.Line, shortName, fmt.Sprintf("duplicate short_name, first used on line %d", line))
+				continue
+			}
+			seen[shortName] = rec.Line
+			inputs = append(inputs, BatchLinkInput{
+				Index:       start + i,
+				OriginalUrl: rec.OriginalURL,
+				ShortName:   shortName,
+				Title:       rec.Title,
+				Description: rec.Description,
+				Preview:     SocialPreview{OgTitle: rec.OgTitle, OgDescription: rec.OgDescription},
+			})
+		}
+		if len(inputs) > 0 {
+			result, err := s.links.createLinksBatch(ctx, inputs, BatchBestEffort, job.DryRun)
+			if err != nil {
+				return err
+			}
+			for _, item := range result.Items {
+				rec := records[item.Index]
+				if item.Status == BatchFailed {
+					progress.fail(rec.Line, rec.ShortName, item.Error)
+					continue
+				}
+				progress.created++
+			}
+		}
+		progress.processed += len(chunk)
+		if err := s.saveProgress(ctx, job.ID, progress); err != nil {
+			return err
+		}
+	}
+	if len(records) == 0 {
+		return s.saveProgress(ctx, job.ID, progress)
+	}
+	return nil
+}
+
+func (s *ImportService) saveProgress(ctx context.Context, id int64, p *importProgress) error {
+	errs := p.errors
+	if errs == nil {
+		errs = []ImportRowError{}
+	}
+	raw, err := json.Marshal(errs)
+	if err != nil {
+		return err
+	}
+	if err := s.q.UpdateImportJobProgress(ctx, store.UpdateImportJobProgressParams{
+		ID:            id,
+		TotalRows:     int32(p.total),
+		ProcessedRows: int32(p.processed),
+		CreatedRows:   int32(p.created),
+		FailedRows:    int32(p.failed),
+		Errors:        raw,
+	}); err != nil {
+		return fmt.Errorf("updateImportJobProgress: %w", err)
+	}
+	return nil
+}
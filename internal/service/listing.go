@@ -0,0 +1,125 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sort - поле и направление сортировки списка.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+var (
+	// LinkSortFields - поля, по которым GetLinks умеет сортировать
+	LinkSortFields = []string{"id", "original_url", "short_name", "title", "health_status", "created_at", "deleted_at"}
+	// VisitSortFields - поля, по которым GetVisits умеет сортировать
+	VisitSortFields = []string{"id", "link_id", "created_at", "ip", "status"}
+
+	DefaultLinkSort  = Sort{Field: "id"}
+	DefaultVisitSort = Sort{Field: "created_at", Desc: true}
+)
+
+// LinkFilter - условия отбора для GetLinks. Пустые поля не ограничивают выборку.
+type LinkFilter struct {
+	Health string
+	// Query ищет подстроку в original_url, short_name и title
+	Query string
+	// IDs - nil не ограничивает выборку, пустой срез не находит ничего
+	IDs         []int64
+	ShortName   string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Deleted - показать корзину вместо действующих ссылок
+	Deleted bool
+}
+
+// VisitFilter - условия отбора для GetVisits. Пустые поля не ограничивают выборку.
+type VisitFilter struct {
+	// Query ищет подстроку в ip, user_agent и referer
+	Query       string
+	IDs         []int64
+	LinkIDs     []int64
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Status - HTTP-статус ответа, 0 не ограничивает выборку
+	Status      int32
+	IP          string
+	RefererHost string
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike экранирует спецсимволы ILIKE, чтобы поиск шёл по буквальной подстроке.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(strings.TrimSpace(s))
+}
+
+// IsEmpty сообщает, что фильтр не ограничивает выборку.
+func (f VisitFilter) IsEmpty() bool {
+	return f.Query == "" && f.IDs == nil && f.LinkIDs == nil && f.CreatedFrom == nil && f.CreatedTo == nil &&
+		f.Status == 0 && f.IP == "" && f.RefererHost == ""
+}
+
+// CountMode - как считать общее число записей для списка.
+type CountMode string
+
+const (
+	// CountExact - точный COUNT, медленный на больших таблицах
+	CountExact CountMode = "exact"
+	// CountEstimate - оценка планировщика из pg_class, если фильтр пустой, иначе точный COUNT
+	CountEstimate CountMode = "estimate"
+	// CountNone - не считать вовсе
+	CountNone CountMode = "none"
+)
+
+// UnknownTotal возвращается вместо общего числа записей при CountNone.
+const UnknownTotal int64 = -1
+
+// ErrInvalidCursor возвращается, если курсор не удалось разобрать.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// VisitPage - страница посещений при keyset-пагинации.
+type VisitPage struct {
+	Items []*Visit `json:"items"`
+	// NextCursor пустой на последней странице
+	NextCursor     string `json:"next_cursor,omitempty"`
+	Total          *int64 `json:"total,omitempty"`
+	TotalEstimated bool   `json:"total_estimated,omitempty"`
+}
+
+// visitCursor - позиция последней отданной записи в порядке (created_at DESC, id DESC).
+type visitCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// encode упаковывает позицию в непрозрачную для клиента строку.
+func (c visitCursor) encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixMicro(), 10) + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeVisitCursor(token string) (visitCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return visitCursor{}, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return visitCursor{}, ErrInvalidCursor
+	}
+	micros, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return visitCursor{}, ErrInvalidCursor
+	}
+	visitID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return visitCursor{}, ErrInvalidCursor
+	}
+	return visitCursor{CreatedAt: time.UnixMicro(micros).UTC(), ID: visitID}, nil
+}
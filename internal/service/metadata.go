@@ -0,0 +1,100 @@
+package service
+
+import (
+	store "code/internal/db/postgres_db"
+	"code/internal/logging"
+	"code/internal/preview"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const DefaultMetadataQueueSize = 256
+
+// MetadataFetcher загружает превью страницы назначения.
+type MetadataFetcher interface {
+	Fetch(ctx context.Context, rawURL string) (*preview.Metadata, error)
+}
+
+// MetadataQueue принимает ссылки, для которых нужно обновить превью.
+type MetadataQueue interface {
+	Enqueue(id int64, originalURL string)
+}
+
+type metadataJob struct {
+	id          int64
+	originalURL string
+}
+
+// MetadataWorker в фоне загружает превью и сохраняет его в links.
+type MetadataWorker struct {
+	q       store.Querier
+	fetcher MetadataFetcher
+	jobs    chan metadataJob
+	timeout time.Duration
+	wg      sync.WaitGroup
+}
+
+func NewMetadataWorker(q store.Querier, fetcher MetadataFetcher, queueSize int, timeout time.Duration) *MetadataWorker {
+	if queueSize <= 0 {
+		queueSize = DefaultMetadataQueueSize
+	}
+	if timeout <= 0 {
+		timeout = preview.DefaultTimeout
+	}
+	return &MetadataWorker{
+		q:       q,
+		fetcher: fetcher,
+		jobs:    make(chan metadataJob, queueSize),
+		timeout: timeout,
+	}
+}
+
+// Enqueue не блокирует запрос: если очередь переполнена, задача отбрасывается.
+func (w *MetadataWorker) Enqueue(id int64, originalURL string) {
+	select {
+	case w.jobs <- metadataJob{id: id, originalURL: originalURL}:
+	default:
+		slog.Warn("metadata queue is full, link skipped", "link_id", id)
+	}
+}
+
+// Run запускает workers обработчиков и блокируется до отмены ctx.
+func (w *MetadataWorker) Run(ctx context.Context, workers int) {
+	for range max(1, workers) {
+		w.wg.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-w.jobs:
+					w.process(ctx, job)
+				}
+			}
+		})
+	}
+	w.wg.Wait()
+}
+
+func (w *MetadataWorker) process(ctx context.Context, job metadataJob) {
+	fetchCtx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	meta, err := w.fetcher.Fetch(fetchCtx, job.originalURL)
+	if err != nil {
+		logging.FromContext(ctx).Warn("fetch metadata", "link_id", job.id, "err", err)
+		return
+	}
+	// original_url в условии защищает от записи превью старого адреса после UpdateLinkByID
+	if err := w.q.UpdateLinkMetadata(ctx, store.UpdateLinkMetadataParams{
+		ID:          job.id,
+		Title:       StrToText(meta.Title),
+		Description: StrToText(meta.Description),
+		FaviconUrl:  StrToText(meta.FaviconURL),
+		OgImageUrl:  StrToText(meta.ImageURL),
+		OriginalUrl: job.originalURL,
+	}); err != nil {
+		logging.FromContext(ctx).Error("save metadata", "link_id", job.id, "err", err)
+	}
+}
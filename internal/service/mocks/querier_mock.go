@@ -7,6 +7,7 @@ import (
 	"code/internal/db/visits"
 	"context"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -19,8 +20,63 @@ func (m *MockQuerier) CreateLink(ctx context.Context, arg postgres_db.CreateLink
 	return args.Get(0).(postgres_db.CreateLinkRow), args.Error(1)
 }
 
-func (m *MockQuerier) DeleteLinkByID(ctx context.Context, id int64) (int64, error) {
+func (m *MockQuerier) DeleteLinkByID(ctx context.Context, id int64) (postgres_db.DeleteLinkByIDRow, error) {
 	args := m.Called(ctx, id)
+	return args.Get(0).(postgres_db.DeleteLinkByIDRow), args.Error(1)
+}
+
+func (m *MockQuerier) DeleteLinkByIDArchivingVisits(ctx context.Context, id int64) (postgres_db.DeleteLinkByIDArchivingVisitsRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(postgres_db.DeleteLinkByIDArchivingVisitsRow), args.Error(1)
+}
+
+func (m *MockQuerier) SoftDeleteLinkByID(ctx context.Context, arg postgres_db.SoftDeleteLinkByIDParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQuerier) RestoreLinkByID(ctx context.Context, arg postgres_db.RestoreLinkByIDParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQuerier) PurgeDeletedLinks(ctx context.Context, arg postgres_db.PurgeDeletedLinksParams) (postgres_db.PurgeDeletedLinksRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(postgres_db.PurgeDeletedLinksRow), args.Error(1)
+}
+
+func (m *MockQuerier) GetLinkRevision(ctx context.Context, arg postgres_db.GetLinkRevisionParams) (postgres_db.LinkRevision, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(postgres_db.LinkRevision), args.Error(1)
+}
+
+func (m *MockQuerier) GetLinkRevisions(ctx context.Context, linkID int64) ([]postgres_db.LinkRevision, error) {
+	args := m.Called(ctx, linkID)
+	return args.Get(0).([]postgres_db.LinkRevision), args.Error(1)
+}
+
+func (m *MockQuerier) ClaimIdempotencyKey(ctx context.Context, arg postgres_db.ClaimIdempotencyKeyParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQuerier) GetIdempotencyKey(ctx context.Context, key string) (postgres_db.IdempotencyKey, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(postgres_db.IdempotencyKey), args.Error(1)
+}
+
+func (m *MockQuerier) SaveIdempotencyResponse(ctx context.Context, arg postgres_db.SaveIdempotencyResponseParams) error {
+	args := m.Called(ctx, arg)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
 	return args.Get(0).(int64), args.Error(1)
 }
 
@@ -39,16 +95,56 @@ func (m *MockQuerier) GetOriginalURLByShortName(ctx context.Context, shortName s
 	return args.Get(0).(postgres_db.GetOriginalURLByShortNameRow), args.Error(1)
 }
 
-func (m *MockQuerier) GetTotalLinks(ctx context.Context) (int64, error) {
-	args := m.Called(ctx)
+func (m *MockQuerier) GetTotalLinks(ctx context.Context, arg postgres_db.GetTotalLinksParams) (int64, error) {
+	args := m.Called(ctx, arg)
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *MockQuerier) IsShortNameTrashed(ctx context.Context, shortName string) (bool, error) {
+	args := m.Called(ctx, shortName)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockQuerier) UpdateLinkByID(ctx context.Context, arg postgres_db.UpdateLinkByIDParams) (postgres_db.UpdateLinkByIDRow, error) {
 	args := m.Called(ctx, arg)
 	return args.Get(0).(postgres_db.UpdateLinkByIDRow), args.Error(1)
 }
 
+func (m *MockQuerier) UpdateLinkMetadata(ctx context.Context, arg postgres_db.UpdateLinkMetadataParams) error {
+	args := m.Called(ctx, arg)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) UpdateLinkSocial(ctx context.Context, arg postgres_db.UpdateLinkSocialParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQuerier) CreateLinkCheck(ctx context.Context, arg postgres_db.CreateLinkCheckParams) error {
+	args := m.Called(ctx, arg)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) GetLinkChecks(ctx context.Context, arg postgres_db.GetLinkChecksParams) ([]postgres_db.GetLinkChecksRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]postgres_db.GetLinkChecksRow), args.Error(1)
+}
+
+func (m *MockQuerier) GetLinkHealth(ctx context.Context, id int64) (postgres_db.GetLinkHealthRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(postgres_db.GetLinkHealthRow), args.Error(1)
+}
+
+func (m *MockQuerier) GetLinksForHealthCheck(ctx context.Context, arg postgres_db.GetLinksForHealthCheckParams) ([]postgres_db.GetLinksForHealthCheckRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).([]postgres_db.GetLinksForHealthCheckRow), args.Error(1)
+}
+
+func (m *MockQuerier) UpdateLinkHealth(ctx context.Context, arg postgres_db.UpdateLinkHealthParams) (postgres_db.UpdateLinkHealthRow, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(postgres_db.UpdateLinkHealthRow), args.Error(1)
+}
+
 type MockVisits struct {
 	mock.Mock
 }
@@ -63,7 +159,125 @@ func (mv *MockVisits) GetVisits(ctx context.Context, arg visits.GetVisitsParams)
 	return args.Get(0).([]visits.GetVisitsRow), args.Error(1)
 }
 
-func (mv *MockVisits) GetTotalVisits(ctx context.Context) (int64, error) {
+func (mv *MockVisits) GetTotalVisits(ctx context.Context, arg visits.GetTotalVisitsParams) (int64, error) {
+	args := mv.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (mv *MockVisits) GetVisitsPage(ctx context.Context, arg visits.GetVisitsPageParams) ([]visits.GetVisitsPageRow, error) {
+	args := mv.Called(ctx, arg)
+	return args.Get(0).([]visits.GetVisitsPageRow), args.Error(1)
+}
+
+func (mv *MockVisits) EstimateTotalVisits(ctx context.Context) (int64, error) {
+	args := mv.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (mv *MockVisits) ArchiveOrphanVisits(ctx context.Context, limit int32) (int64, error) {
+	args := mv.Called(ctx, limit)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (mv *MockVisits) DeleteOrphanVisits(ctx context.Context, limit int32) (int64, error) {
+	args := mv.Called(ctx, limit)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (mv *MockVisits) ValidateVisitsLinkFK(ctx context.Context) error {
 	args := mv.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) CreateImportJob(ctx context.Context, arg postgres_db.CreateImportJobParams) (int64, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQuerier) ClaimImportJob(ctx context.Context) (postgres_db.ImportJob, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(postgres_db.ImportJob), args.Error(1)
+}
+
+func (m *MockQuerier) UpdateImportJobProgress(ctx context.Context, arg postgres_db.UpdateImportJobProgressParams) error {
+	args := m.Called(ctx, arg)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) FinishImportJob(ctx context.Context, arg postgres_db.FinishImportJobParams) error {
+	args := m.Called(ctx, arg)
+	return args.Error(0)
+}
+
+func (m *MockQuerier) FailStaleImportJobs(ctx context.Context, updatedAt pgtype.Timestamptz) (int64, error) {
+	args := m.Called(ctx, updatedAt)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockQuerier) GetImportJob(ctx context.Context, id int64) (postgres_db.GetImportJobRow, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(postgres_db.GetImportJobRow), args.Error(1)
+}
+
+// MockTxRunner выполняет fn поверх Q без настоящей транзакции и запоминает, был ли коммит.
+type MockTxRunner struct {
+	Q         *MockQuerier
+	Committed bool
+}
+
+func (r *MockTxRunner) InTx(ctx context.Context, fn func(tx postgres_db.Tx) error) error {
+	if err := fn(mockTx{r.Q}); err != nil {
+		return err
+	}
+	r.Committed = true
+	return nil
+}
+
+type mockTx struct {
+	*MockQuerier
+}
+
+func (t mockTx) Savepoint(ctx context.Context, fn func(q postgres_db.Querier) error) error {
+	return fn(t.MockQuerier)
+}
+
+func (m *MockQuerier) CreateAPIKey(ctx context.Context, arg postgres_db.CreateAPIKeyParams) (postgres_db.ApiKey, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(postgres_db.ApiKey), args.Error(1)
+}
+
+func (m *MockQuerier) ListAPIKeys(ctx context.Context) ([]postgres_db.ApiKey, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]postgres_db.ApiKey), args.Error(1)
+}
+
+func (m *MockQuerier) RevokeAPIKey(ctx context.Context, id int64) (int64, error) {
+	args := m.Called(ctx, id)
 	return args.Get(0).(int64), args.Error(1)
 }
+
+func (m *MockQuerier) GetActiveAPIKeyByHash(ctx context.Context, keyHash string) (postgres_db.ApiKey, error) {
+	args := m.Called(ctx, keyHash)
+	return args.Get(0).(postgres_db.ApiKey), args.Error(1)
+}
+
+// ExportLinks передаёт в fn строки, заданные в Return, и возвращает ошибку из Return.
+func (m *MockQuerier) ExportLinks(ctx context.Context, arg postgres_db.ExportLinksParams, fn func(row postgres_db.ExportLinksRow) error) error {
+	args := m.Called(ctx, arg)
+	for _, row := range args.Get(0).([]postgres_db.ExportLinksRow) {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (mv *MockVisits) ExportVisits(ctx context.Context, arg visits.ExportVisitsParams, fn func(row visits.Visit) error) error {
+	args := mv.Called(ctx, arg)
+	for _, row := range args.Get(0).([]visits.Visit) {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"code/internal/config"
+	"code/internal/db/visits"
+	"code/internal/logging"
+	"context"
+	"fmt"
+)
+
+const DefaultOrphanBatchSize = 1000
+
+// OrphanCleaner разбирает посещения, ссылки которых уже удалены, и затем валидирует
+// внешний ключ visits.link_id. Новые сироты после этого появиться не могут,
+// поэтому очистку достаточно запустить один раз при старте.
+type OrphanCleaner struct {
+	q         visits.Querier
+	archive   bool
+	batchSize int32
+}
+
+func NewOrphanCleaner(q visits.Querier, cfg config.VisitsConfig) *OrphanCleaner {
+	batchSize := cfg.OrphanBatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultOrphanBatchSize
+	}
+	return &OrphanCleaner{
+		q:         q,
+		archive:   cfg.OnLinkDelete != config.VisitsOnDeleteCascade,
+		batchSize: batchSize,
+	}
+}
+
+// Run удаляет или архивирует сирот порциями по batchSize и возвращает их число.
+func (o *OrphanCleaner) Run(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		var (
+			n   int64
+			err error
+		)
+		if o.archive {
+			n, err = o.q.ArchiveOrphanVisits(ctx, o.batchSize)
+		} else {
+			n, err = o.q.DeleteOrphanVisits(ctx, o.batchSize)
+		}
+		if err != nil {
+			return total, fmt.Errorf("clean orphan visits: %w", err)
+		}
+		total += n
+		if n < int64(o.batchSize) {
+			break
+		}
+	}
+	if err := o.q.ValidateVisitsLinkFK(ctx); err != nil {
+		return total, fmt.Errorf("validateVisitsLinkFK: %w", err)
+	}
+	if total > 0 {
+		action := "deleted"
+		if o.archive {
+			action = "archived"
+		}
+		logging.FromContext(ctx).Info("orphan visits "+action, "count", total)
+	}
+	return total, nil
+}
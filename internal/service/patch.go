@@ -0,0 +1,104 @@
+package service
+
+import (
+	store "code/internal/db/postgres_db"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrVersionMismatch - ссылку уже изменил кто-то другой, If-Match не совпал с её ревизией.
+	ErrVersionMismatch = errors.New("link was modified concurrently")
+	// ErrShortNameTaken - короткое имя занято другой ссылкой, в том числе ссылкой в корзине.
+	ErrShortNameTaken = errors.New("short_name already exists")
+	// ErrOriginalURLTaken - на этот адрес уже есть ссылка.
+	ErrOriginalURLTaken = errors.New("original_url already exists")
+	// ErrShortNameReserved - при редиректах с корня имя совпадает с маршрутом сервиса (api, healthz...).
+	ErrShortNameReserved = errors.New("short_name is reserved")
+)
+
+// LinkPatch - изменения для PATCH. nil-поля остаются как есть.
+type LinkPatch struct {
+	OriginalUrl *string
+	ShortName   *string
+}
+
+// PatchLink применяет patch к ссылке. expectedRevisions - ревизии из If-Match:
+// nil не проверяет версию, иначе текущая ревизия должна быть в списке, или вернётся ErrVersionMismatch.
+func (l *LinkService) PatchLink(ctx context.Context, id int64, patch LinkPatch, expectedRevisions []int32) (*Link, error) {
+	link, err := l.GetLinkByID(ctx, id)
+	if err != nil {
+		return &Link{}, err
+	}
+	if link.DeletedAt != nil {
+		return &Link{}, ErrNotFound
+	}
+	params := store.UpdateLinkByIDParams{
+		ID:                id,
+		ExpectedRevisions: expectedRevisions,
+		OriginalUrl:       link.OriginalUrl,
+		ShortName:         link.ShortName,
+		Action:            RevisionUpdate,
+		Actor:             ActorFromContext(ctx),
+	}
+	if patch.OriginalUrl != nil {
+		params.OriginalUrl = *patch.OriginalUrl
+	}
+	if patch.ShortName != nil && *patch.ShortName != link.ShortName {
+		if err := l.checkShortName(*patch.ShortName); err != nil {
+			return &Link{}, err
+		}
+		params.ShortName = *patch.ShortName
+	}
+	if params.OriginalUrl == link.OriginalUrl && params.ShortName == link.ShortName {
+		// Изменений нет - новую ревизию не создаём, но версию всё равно сверяем
+		if expectedRevisions != nil && !slices.Contains(expectedRevisions, int32(link.Revision)) {
+			return &Link{}, ErrVersionMismatch
+		}
+		return link, nil
+	}
+
+	row, err := l.q.UpdateLinkByID(ctx, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return &Link{}, l.updateMissError(ctx, id)
+		case uniqueViolationError(err) != nil:
+			return &Link{}, uniqueViolationError(err)
+		}
+		return &Link{}, fmt.Errorf("patchLink: %w", err)
+	}
+	if row.OriginalUrl != link.OriginalUrl {
+		l.enqueueMetadata(row.ID, row.OriginalUrl)
+	}
+	return l.GetLinkByID(ctx, id)
+}
+
+// updateMissError объясняет, почему UpdateLinkByID не нашёл строку: ссылки нет или не совпала ревизия.
+func (l *LinkService) updateMissError(ctx context.Context, id int64) error {
+	link, err := l.GetLinkByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if link.DeletedAt != nil {
+		return ErrNotFound
+	}
+	return ErrVersionMismatch
+}
+
+// uniqueViolationError переводит нарушение уникальности links в ошибку сервиса, для других ошибок - nil.
+func uniqueViolationError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return nil
+	}
+	if pgErr.ConstraintName == "links_original_url_key" {
+		return ErrOriginalURLTaken
+	}
+	return ErrShortNameTaken
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	store "code/internal/db/postgres_db"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Действия, которые записываются в link_revisions
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+	// RevisionSocial - изменены свои Open Graph теги, адрес и короткое имя те же
+	RevisionSocial = "social"
+)
+
+// ErrRevisionNotRevertible - ревизия не содержит состояния ссылки (например, delete).
+var ErrRevisionNotRevertible = errors.New("revision has no link state to revert to")
+
+// LinkValues - адрес назначения и короткое имя ссылки в какой-то ревизии.
+type LinkValues struct {
+	OriginalUrl string `json:"original_url"`
+	ShortName   string `json:"short_name"`
+}
+
+type LinkRevision struct {
+	Revision  int         `json:"revision"`
+	Action    string      `json:"action"`
+	Old       *LinkValues `json:"old"`
+	New       *LinkValues `json:"new"`
+	Actor     string      `json:"actor"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type actorKey struct{}
+
+// WithActor запоминает в ctx, кто меняет ссылку, чтобы записать это в историю.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext возвращает автора изменения или "anonymous", если он не известен.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+// GetLinkHistory возвращает ревизии ссылки от новых к старым.
+func (l *LinkService) GetLinkHistory(ctx context.Context, id int64) ([]LinkRevision, error) {
+	if _, err := l.GetLinkByID(ctx, id); err != nil {
+		return nil, err
+	}
+	rows, err := l.q.GetLinkRevisions(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getLinkRevisions: %w", err)
+	}
+	out := make([]LinkRevision, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, newLinkRevision(row))
+	}
+	return out, nil
+}
+
+// RevertLink возвращает ссылке адрес и короткое имя из revision. Откат сам становится новой ревизией.
+func (l *LinkService) RevertLink(ctx context.Context, id int64, revision int32) (*Link, error) {
+	rev, err := l.q.GetLinkRevision(ctx, store.GetLinkRevisionParams{LinkID: id, Revision: revision})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &Link{}, ErrNotFound
+		}
+		return &Link{}, fmt.Errorf("getLinkRevision: %w", err)
+	}
+	if !rev.NewOriginalUrl.Valid {
+		return &Link{}, ErrRevisionNotRevertible
+	}
+	if err := l.checkShortName(rev.NewShortName.String); err != nil {
+		return &Link{}, err
+	}
+	row, err := l.q.UpdateLinkByID(ctx, store.UpdateLinkByIDParams{
+		ID:          id,
+		OriginalUrl: rev.NewOriginalUrl.String,
+		ShortName:   rev.NewShortName.String,
+		Action:      RevisionRevert,
+		Actor:       ActorFromContext(ctx),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &Link{}, ErrNotFound
+		}
+		return &Link{}, fmt.Errorf("revertLink: %w", err)
+	}
+	l.enqueueMetadata(row.ID, row.OriginalUrl)
+	return &Link{
+		ID:          row.ID,
+		OriginalUrl: row.OriginalUrl,
+		ShortName:   row.ShortName,
+		ShortUrl:    l.ShortURL(row.ShortName),
+		Revision:    int(row.Revision),
+	}, nil
+}
+
+func newLinkRevision(row store.LinkRevision) LinkRevision {
+	rev := LinkRevision{
+		Revision:  int(row.Revision),
+		Action:    row.Action,
+		Actor:     row.Actor,
+		CreatedAt: row.CreatedAt.Time,
+	}
+	if row.OldOriginalUrl.Valid {
+		rev.Old = &LinkValues{OriginalUrl: row.OldOriginalUrl.String, ShortName: row.OldShortName.String}
+	}
+	if row.NewOriginalUrl.Valid {
+		rev.New = &LinkValues{OriginalUrl: row.NewOriginalUrl.String, ShortName: row.NewShortName.String}
+	}
+	return rev
+}
@@ -4,14 +4,20 @@ import (
 	"code/internal/config"
 	store "code/internal/db/postgres_db"
 	"code/internal/db/visits"
+	"code/internal/qr"
 	"context"
 	"crypto/rand"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -20,6 +26,28 @@ type Link struct {
 	OriginalUrl string `json:"original_url"`
 	ShortName   string `json:"short_name"`
 	ShortUrl    string `json:"short_url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	FaviconURL  string `json:"favicon_url,omitempty"`
+	ImageURL    string `json:"og_image_url,omitempty"`
+	SocialPreview
+	HealthStatus string     `json:"health_status,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	Revision     int        `json:"revision,omitempty"`
+}
+
+// SocialPreview - свои Open Graph теги, которые видят краулеры мессенджеров и соцсетей
+// вместо данных страницы назначения.
+type SocialPreview struct {
+	OgTitle       string `json:"og_title,omitempty"`
+	OgDescription string `json:"og_description,omitempty"`
+	OgImage       string `json:"og_image,omitempty"`
+}
+
+// IsEmpty сообщает, что переопределения не заданы.
+func (p SocialPreview) IsEmpty() bool {
+	return p.OgTitle == "" && p.OgDescription == "" && p.OgImage == ""
 }
 
 type Visit struct {
@@ -29,34 +57,73 @@ type Visit struct {
 	IP        string    `json:"ip"`
 	UserAgent string    `json:"user_agent"`
 	Status    int       `json:"status"`
+	IsCrawler bool      `json:"is_crawler"`
+	// LinkRevision - ревизия ссылки на момент посещения, 0 для старых посещений
+	LinkRevision int `json:"link_revision,omitempty"`
+	// Referer и RefererHost заполняются только при выгрузке
+	Referer     string `json:"referer,omitempty"`
+	RefererHost string `json:"referer_host,omitempty"`
+}
+
+// DeleteLinkResult - итог удаления ссылки и её посещений.
+// Без Permanent ссылка только перенесена в корзину, посещения не тронуты.
+type DeleteLinkResult struct {
+	Deleted        int64 `json:"deleted"`
+	Permanent      bool  `json:"permanent"`
+	VisitsDeleted  int64 `json:"visits_deleted"`
+	VisitsArchived int64 `json:"visits_archived"`
 }
 
 type CreateLinkInput struct {
-	OriginalUrl string `json:"original_url"`
-	ShortName   string `json:"short_name"`
+	OriginalUrl string `json:"original_url" validate:"required,url"`
+	ShortName   string `json:"short_name" validate:"max=100"`
+}
+
+// ValidateLinkInput - правила для новой ссылки, общие для API, пакетов и импорта.
+func ValidateLinkInput(in CreateLinkInput) error {
+	return validator.New().Struct(&in)
 }
 
 // ErrNotFound возвращается, если запись отсутствует.
 var ErrNotFound = errors.New("product not found")
 
+// ErrLinkTrashed - ссылка с таким именем лежит в корзине. Оборачивает sql.ErrNoRows,
+// чтобы для редиректа она оставалась ненайденной.
+var ErrLinkTrashed = fmt.Errorf("link is in trash: %w", sql.ErrNoRows)
+
 type LinkServer interface {
 	CreateShortLink(ctx context.Context, shortName, originalUrl string) (*Link, error)
-	GetLinks(ctx context.Context, limit, offset int32) ([]*Link, int64, error)
+	GetLinks(ctx context.Context, filter LinkFilter, sort Sort, limit, offset int32) ([]*Link, int64, error)
 	GetLinkByID(ctx context.Context, id int64) (*Link, error)
 	UpdateLinkByID(ctx context.Context, shortName, originalUrl string, id int64) (*Link, error)
-	DeleteLinkByID(ctx context.Context, id int64) (int64, error)
+	PatchLink(ctx context.Context, id int64, patch LinkPatch, expectedRevisions []int32) (*Link, error)
+	DeleteLinkByID(ctx context.Context, id int64, permanent bool) (*DeleteLinkResult, error)
+	RestoreLinkByID(ctx context.Context, id int64) (*Link, error)
+	GetLinkHistory(ctx context.Context, id int64) ([]LinkRevision, error)
+	RevertLink(ctx context.Context, id int64, revision int32) (*Link, error)
 	GetOriginalURLByShortName(ctx context.Context, shortName string) (*Link, error)
+	GetLinkQR(ctx context.Context, id int64, opts qr.Options) (*qr.Image, error)
+	UpdateLinkSocial(ctx context.Context, id int64, preview SocialPreview) (*Link, error)
+	GetLinkHealth(ctx context.Context, id int64, limit int32) (*LinkHealth, error)
+	CreateLinksBatch(ctx context.Context, items []BatchLinkInput, mode BatchMode) (*BatchResult, error)
+	DeleteLinksBatch(ctx context.Context, ids []int64, permanent bool, mode BatchMode) (*BatchResult, error)
+	ExportLinks(ctx context.Context, filter LinkFilter, afterID int64, fn func(link *Link) error) error
 }
 
 type VisitServer interface {
-	CreateVisit(ctx context.Context, id int64, ip, agent string, referer string, status int32) error
-	GetVisits(ctx context.Context, limit, offset int32) ([]*Visit, int64, error)
+	CreateVisit(ctx context.Context, id int64, ip, agent string, referer string, status int32, isCrawler bool) error
+	GetVisits(ctx context.Context, filter VisitFilter, sort Sort, count CountMode, limit, offset int32) ([]*Visit, int64, error)
+	GetVisitsPage(ctx context.Context, filter VisitFilter, cursor string, limit int32, count CountMode) (*VisitPage, error)
+	ExportVisits(ctx context.Context, filter VisitFilter, afterID int64, fn func(visit *Visit) error) error
 }
 
 // LinkService инкапсулирует работу с sqlc-запросами.
 type LinkService struct {
-	q   store.Querier
-	cfg *config.AppConfig
+	q    store.Querier
+	tx   store.TxRunner
+	cfg  *config.AppConfig
+	qr   *qr.Generator
+	meta MetadataQueue
 }
 
 type VisitsService struct {
@@ -68,6 +135,23 @@ func NewLinkService(q store.Querier, config *config.AppConfig) *LinkService {
 	return &LinkService{
 		q:   q,
 		cfg: config,
+		qr:  qr.NewGenerator(config.QRConfig.LogoPath, config.QRConfig.CacheSize),
+	}
+}
+
+// SetMetadataQueue включает фоновую загрузку превью после создания и изменения ссылки.
+func (l *LinkService) SetMetadataQueue(queue MetadataQueue) {
+	l.meta = queue
+}
+
+// SetTxRunner включает пакетные операции, они выполняются в одной транзакции.
+func (l *LinkService) SetTxRunner(tx store.TxRunner) {
+	l.tx = tx
+}
+
+func (l *LinkService) enqueueMetadata(id int64, originalURL string) {
+	if l.meta != nil {
+		l.meta.Enqueue(id, originalURL)
 	}
 }
 
@@ -75,44 +159,63 @@ func NewVisitService(v visits.Querier) VisitsService {
 	return VisitsService{s: v}
 }
 
-// CreateShortLink создаёт короткий url
+// CreateShortLink создаёт короткий url. Занятое имя - ErrShortNameTaken.
 func (l *LinkService) CreateShortLink(ctx context.Context, shortName, originalUrl string) (*Link, error) {
-	links, err := l.q.GetLinks(ctx, store.GetLinksParams{})
-	if err != nil {
-		return &Link{}, fmt.Errorf("createShortLink: %w", err)
-	}
-	for _, l := range links {
-		if shortName == l.ShortName {
-			return &Link{}, fmt.Errorf("short_name already exists")
-		}
-	}
-	baseUrl := l.cfg.BaseURL
-	shortUrl := baseUrl + "/" + shortName
+	return l.createLink(ctx, shortName, originalUrl)
+}
 
+// createLink вставляет ссылку. Занятое короткое имя ловит уникальный индекс - ErrShortNameTaken.
+func (l *LinkService) createLink(ctx context.Context, shortName, originalUrl string) (*Link, error) {
+	if err := l.checkShortName(shortName); err != nil {
+		return &Link{}, err
+	}
 	params := store.CreateLinkParams{
 		OriginalUrl: originalUrl,
 		ShortName:   shortName,
-		ShortUrl:    shortUrl,
+		Actor:       ActorFromContext(ctx),
 	}
 
 	row, err := l.q.CreateLink(ctx, params)
 	if err != nil {
+		if taken := uniqueViolationError(err); taken != nil {
+			return &Link{}, taken
+		}
 		return &Link{}, fmt.Errorf("createShortLink: %w", err)
 	}
+	l.enqueueMetadata(row.ID, row.OriginalUrl)
 	out := &Link{
 		ID:          row.ID,
 		OriginalUrl: row.OriginalUrl,
 		ShortName:   row.ShortName,
-		ShortUrl:    row.ShortUrl,
+		ShortUrl:    l.ShortURL(row.ShortName),
+		Revision:    1,
 	}
 	return out, nil
 }
 
-// GetLinks возвращает все объекты из БД
-func (l *LinkService) GetLinks(ctx context.Context, limit, offset int32) ([]*Link, int64, error) {
+// GetLinks возвращает объекты из БД, подходящие под filter, в порядке sort
+func (l *LinkService) GetLinks(ctx context.Context, filter LinkFilter, sort Sort, limit, offset int32) ([]*Link, int64, error) {
+	where := store.GetTotalLinksParams{
+		Health:      StrToText(filter.Health),
+		Query:       StrToText(escapeLike(filter.Query)),
+		Ids:         filter.IDs,
+		ShortName:   StrToText(filter.ShortName),
+		CreatedFrom: TimeToTimestamptz(filter.CreatedFrom),
+		CreatedTo:   TimeToTimestamptz(filter.CreatedTo),
+		Deleted:     filter.Deleted,
+	}
 	rows, err := l.q.GetLinks(ctx, store.GetLinksParams{
-		Limit:  limit,
-		Offset: offset,
+		Health:      where.Health,
+		Query:       where.Query,
+		Ids:         where.Ids,
+		ShortName:   where.ShortName,
+		CreatedFrom: where.CreatedFrom,
+		CreatedTo:   where.CreatedTo,
+		Deleted:     where.Deleted,
+		SortField:   sort.Field,
+		SortDesc:    sort.Desc,
+		Limit:       limit,
+		Offset:      offset,
 	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -126,11 +229,24 @@ func (l *LinkService) GetLinks(ctx context.Context, limit, offset int32) ([]*Lin
 			ID:          row.ID,
 			OriginalUrl: row.OriginalUrl,
 			ShortName:   row.ShortName,
-			ShortUrl:    row.ShortUrl,
+			ShortUrl:    l.ShortURL(row.ShortName),
+			Title:       row.Title.String,
+			Description: row.Description.String,
+			FaviconURL:  row.FaviconUrl.String,
+			ImageURL:    row.OgImageUrl.String,
+			SocialPreview: SocialPreview{
+				OgTitle:       row.OgTitle.String,
+				OgDescription: row.OgDescription.String,
+				OgImage:       row.OgImage.String,
+			},
+			HealthStatus: row.HealthStatus,
+			CreatedAt:    timePtr(row.CreatedAt),
+			DeletedAt:    timePtr(row.DeletedAt),
+			Revision:     int(row.Revision),
 		}
 		out = append(out, link)
 	}
-	total, err := l.q.GetTotalLinks(ctx)
+	total, err := l.q.GetTotalLinks(ctx, where)
 	if err != nil {
 		return nil, 0, fmt.Errorf("getTotalLinks: %w", err)
 	}
@@ -149,7 +265,20 @@ func (l *LinkService) GetLinkByID(ctx context.Context, id int64) (*Link, error)
 		ID:          row.ID,
 		OriginalUrl: row.OriginalUrl,
 		ShortName:   row.ShortName,
-		ShortUrl:    row.ShortUrl,
+		ShortUrl:    l.ShortURL(row.ShortName),
+		Title:       row.Title.String,
+		Description: row.Description.String,
+		FaviconURL:  row.FaviconUrl.String,
+		ImageURL:    row.OgImageUrl.String,
+		SocialPreview: SocialPreview{
+			OgTitle:       row.OgTitle.String,
+			OgDescription: row.OgDescription.String,
+			OgImage:       row.OgImage.String,
+		},
+		HealthStatus: row.HealthStatus,
+		CreatedAt:    timePtr(row.CreatedAt),
+		DeletedAt:    timePtr(row.DeletedAt),
+		Revision:     int(row.Revision),
 	}
 	return &out, nil
 }
@@ -162,27 +291,30 @@ func (l *LinkService) UpdateLinkByID(ctx context.Context, shortName, originalUrl
 	if link.ShortName == shortName {
 		return &Link{}, fmt.Errorf("short_name already exists")
 	}
-
-	baseUrl := l.cfg.BaseURL
-	shortUrl := baseUrl + "/" + shortName
+	if err := l.checkShortName(shortName); err != nil {
+		return &Link{}, err
+	}
 
 	params := store.UpdateLinkByIDParams{
+		ID:          id,
 		OriginalUrl: originalUrl,
 		ShortName:   shortName,
-		ShortUrl:    shortUrl,
-		ID:          id,
+		Action:      RevisionUpdate,
+		Actor:       ActorFromContext(ctx),
 	}
 
 	row, err := l.q.UpdateLinkByID(ctx, params)
 	if err != nil {
 		return &Link{}, fmt.Errorf("updateLinkByID: %w", err)
 	}
+	l.enqueueMetadata(row.ID, row.OriginalUrl)
 
 	out := &Link{
 		ID:          row.ID,
 		OriginalUrl: row.OriginalUrl,
 		ShortName:   row.ShortName,
-		ShortUrl:    row.ShortUrl,
+		ShortUrl:    l.ShortURL(row.ShortName),
+		Revision:    int(row.Revision),
 	}
 	return out, nil
 }
@@ -190,22 +322,130 @@ func (l *LinkService) UpdateLinkByID(ctx context.Context, shortName, originalUrl
 func (l *LinkService) GetOriginalURLByShortName(ctx context.Context, shortName string) (*Link, error) {
 	link, err := l.q.GetOriginalURLByShortName(ctx, shortName)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			trashed, terr := l.q.IsShortNameTrashed(ctx, shortName)
+			if terr != nil {
+				return &Link{}, fmt.Errorf("isShortNameTrashed: %w", terr)
+			}
+			if trashed {
+				return &Link{}, ErrLinkTrashed
+			}
+		}
 		return &Link{}, fmt.Errorf("getOriginalURLByShortName: %w", err)
 	}
 	out := &Link{
 		ID:          link.ID,
 		OriginalUrl: link.OriginalUrl,
 		ShortName:   shortName,
+		ShortUrl:    l.ShortURL(shortName),
+		Title:       link.Title.String,
+		Description: link.Description.String,
+		ImageURL:    link.OgImageUrl.String,
+		SocialPreview: SocialPreview{
+			OgTitle:       link.OgTitle.String,
+			OgDescription: link.OgDescription.String,
+			OgImage:       link.OgImage.String,
+		},
 	}
 	return out, nil
 }
 
-func (l *LinkService) DeleteLinkByID(ctx context.Context, id int64) (int64, error) {
-	n, err := l.q.DeleteLinkByID(ctx, id)
+// QRCacheStats возвращает попадания и промахи кэша QR-кодов.
+func (l *LinkService) QRCacheStats() (hits, misses uint64) {
+	return l.qr.CacheStats()
+}
+
+// GetLinkQR рисует QR-код с short_url ссылки.
+// Готовые картинки кэшируются, ключ меняется с каждой ревизией ссылки.
+func (l *LinkService) GetLinkQR(ctx context.Context, id int64, opts qr.Options) (*qr.Image, error) {
+	link, err := l.GetLinkByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getLinkQR: %w", err)
+	}
+	img, err := l.qr.Render(link.ShortUrl, strconv.Itoa(link.Revision), opts)
+	if err != nil {
+		return nil, fmt.Errorf("getLinkQR: %w", err)
+	}
+	return img, nil
+}
+
+// UpdateLinkSocial сохраняет Open Graph теги для краулеров. Пустые значения сбрасывают переопределение.
+// Изменение записывается в историю отдельной ревизией, ссылку из корзины изменить нельзя.
+func (l *LinkService) UpdateLinkSocial(ctx context.Context, id int64, preview SocialPreview) (*Link, error) {
+	n, err := l.q.UpdateLinkSocial(ctx, store.UpdateLinkSocialParams{
+		ID:            id,
+		OgTitle:       StrToText(preview.OgTitle),
+		OgDescription: StrToText(preview.OgDescription),
+		OgImage:       StrToText(preview.OgImage),
+		Actor:         ActorFromContext(ctx),
+	})
 	if err != nil {
-		return 0, fmt.Errorf("deleteLinkByID: %w", err)
+		return &Link{}, fmt.Errorf("updateLinkSocial: %w", err)
+	}
+	if n == 0 {
+		return &Link{}, ErrNotFound
 	}
-	return n, nil
+	return l.GetLinkByID(ctx, id)
+}
+
+// DeleteLinkByID переносит ссылку в корзину: она перестаёт редиректить, но её можно восстановить.
+// С permanent ссылка удаляется сразу вместе с посещениями или с переносом их в архив,
+// в зависимости от VISITS_ON_LINK_DELETE. Всё происходит одним запросом.
+func (l *LinkService) DeleteLinkByID(ctx context.Context, id int64, permanent bool) (*DeleteLinkResult, error) {
+	if !permanent {
+		n, err := l.q.SoftDeleteLinkByID(ctx, store.SoftDeleteLinkByIDParams{ID: id, Actor: ActorFromContext(ctx)})
+		if err != nil {
+			return nil, fmt.Errorf("softDeleteLinkByID: %w", err)
+		}
+		return &DeleteLinkResult{Deleted: n}, nil
+	}
+	if l.cfg.VisitsConfig.OnLinkDelete == config.VisitsOnDeleteCascade {
+		row, err := l.q.DeleteLinkByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("deleteLinkByID: %w", err)
+		}
+		return &DeleteLinkResult{Deleted: row.LinksDeleted, Permanent: true, VisitsDeleted: row.VisitsDeleted}, nil
+	}
+	row, err := l.q.DeleteLinkByIDArchivingVisits(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("deleteLinkByIDArchivingVisits: %w", err)
+	}
+	return &DeleteLinkResult{Deleted: row.LinksDeleted, Permanent: true, VisitsArchived: row.VisitsArchived}, nil
+}
+
+// RestoreLinkByID возвращает ссылку из корзины. ErrNotFound, если её нет в корзине.
+func (l *LinkService) RestoreLinkByID(ctx context.Context, id int64) (*Link, error) {
+	n, err := l.q.RestoreLinkByID(ctx, store.RestoreLinkByIDParams{ID: id, Actor: ActorFromContext(ctx)})
+	if err != nil {
+		return &Link{}, fmt.Errorf("restoreLinkByID: %w", err)
+	}
+	if n == 0 {
+		return &Link{}, ErrNotFound
+	}
+	return l.GetLinkByID(ctx, id)
+}
+
+// reservedRootNames - первые сегменты путей сервиса. При редиректах с корня (REDIRECT_PREFIX "" или "/")
+// ссылка с таким именем была бы недоступна: gin отдаёт предпочтение статическим маршрутам.
+// "r" - старый префикс редиректов, он обслуживается всегда.
+var reservedRootNames = []string{"api", "healthz", "readyz", "r"}
+
+// checkShortName не пускает имена, которые перекрыты маршрутами сервиса.
+func (l *LinkService) checkShortName(shortName string) error {
+	if l.cfg.RedirectPrefix != "" {
+		return nil
+	}
+	metrics, _, _ := strings.Cut(strings.TrimPrefix(l.cfg.MetricsConfig.Path, "/"), "/")
+	if slices.Contains(reservedRootNames, shortName) || (l.cfg.MetricsConfig.Enabled && shortName == metrics) {
+		return ErrShortNameReserved
+	}
+	return nil
+}
+
+// ShortURL собирает публичный адрес короткой ссылки из BASE_URL и префикса редиректа.
+// Значение не хранится в БД, поэтому смена BASE_URL сразу отражается во всех ссылках.
+func (l *LinkService) ShortURL(shortName string) string {
+	return l.cfg.BaseURL + l.cfg.RedirectPrefix + "/" + shortName
 }
 
 func GenerateShortName(size int) (string, error) {
@@ -223,23 +463,37 @@ func GenerateShortName(size int) (string, error) {
 	return string(result), nil
 }
 
-func (v *VisitsService) CreateVisit(ctx context.Context, id int64, ip, agent string, referer string, status int32) error {
+func (v *VisitsService) CreateVisit(ctx context.Context, id int64, ip, agent string, referer string, status int32, isCrawler bool) error {
 	if err := v.s.CreateVisit(ctx, visits.CreateVisitParams{
-		LinkID:    id,
-		Ip:        ip,
-		UserAgent: agent,
-		Referer:   StrToText(referer),
-		Status:    status,
+		LinkID:      id,
+		Ip:          ip,
+		UserAgent:   agent,
+		Referer:     StrToText(referer),
+		Status:      status,
+		IsCrawler:   isCrawler,
+		RefererHost: StrToText(RefererHost(referer)),
 	}); err != nil {
 		return fmt.Errorf("createVisit: %w", err)
 	}
 	return nil
 }
 
-func (v *VisitsService) GetVisits(ctx context.Context, limit, offset int32) ([]*Visit, int64, error) {
+// GetVisits возвращает страницу посещений по смещению. При CountNone вместо total возвращается UnknownTotal.
+func (v *VisitsService) GetVisits(ctx context.Context, filter VisitFilter, sort Sort, count CountMode, limit, offset int32) ([]*Visit, int64, error) {
+	where := visitsWhere(filter)
 	rows, err := v.s.GetVisits(ctx, visits.GetVisitsParams{
-		Limit:  limit,
-		Offset: offset,
+		Query:       where.Query,
+		Ids:         where.Ids,
+		LinkIds:     where.LinkIds,
+		CreatedFrom: where.CreatedFrom,
+		CreatedTo:   where.CreatedTo,
+		Status:      where.Status,
+		Ip:          where.Ip,
+		RefererHost: where.RefererHost,
+		SortField:   sort.Field,
+		SortDesc:    sort.Desc,
+		Limit:       limit,
+		Offset:      offset,
 	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -249,27 +503,137 @@ func (v *VisitsService) GetVisits(ctx context.Context, limit, offset int32) ([]*
 	}
 	out := make([]*Visit, 0, len(rows))
 	for _, row := range rows {
-		t, convErr := ConvertTime(row.CreatedAt)
-		if convErr != nil {
+		visit, err := newVisit(row)
+		if err != nil {
 			return nil, 0, fmt.Errorf("getVisits: %w", err)
 		}
-		visit := &Visit{
-			ID:        int(row.ID),
-			Link_ID:   int(row.LinkID),
-			CreatedAt: t,
-			IP:        row.Ip,
-			UserAgent: row.UserAgent,
-			Status:    int(row.Status),
-		}
 		out = append(out, visit)
 	}
-	total, err := v.s.GetTotalVisits(ctx)
+	total, _, err := v.countVisits(ctx, filter, where, count)
 	if err != nil {
-		return nil, 0, fmt.Errorf("getTotalVisits: %w", err)
+		return nil, 0, err
 	}
 	return out, total, nil
 }
 
+// GetVisitsPage возвращает посещения, идущие после cursor в порядке (created_at DESC, id DESC).
+// Пустой cursor означает первую страницу.
+func (v *VisitsService) GetVisitsPage(ctx context.Context, filter VisitFilter, cursor string, limit int32, count CountMode) (*VisitPage, error) {
+	where := visitsWhere(filter)
+	params := visits.GetVisitsPageParams{
+		Query:       where.Query,
+		Ids:         where.Ids,
+		LinkIds:     where.LinkIds,
+		CreatedFrom: where.CreatedFrom,
+		CreatedTo:   where.CreatedTo,
+		Status:      where.Status,
+		Ip:          where.Ip,
+		RefererHost: where.RefererHost,
+		// Берём на одну запись больше, чтобы понять, есть ли следующая страница
+		Limit: limit + 1,
+	}
+	if cursor != "" {
+		after, err := decodeVisitCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		params.AfterCreatedAt = pgtype.Timestamptz{Time: after.CreatedAt, Valid: true}
+		params.AfterID = after.ID
+	}
+	rows, err := v.s.GetVisitsPage(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("getVisitsPage: %w", err)
+	}
+	page := &VisitPage{Items: make([]*Visit, 0, min(len(rows), int(limit)))}
+	for i, row := range rows {
+		if i == int(limit) {
+			last := page.Items[len(page.Items)-1]
+			page.NextCursor = visitCursor{CreatedAt: last.CreatedAt, ID: int64(last.ID)}.encode()
+			break
+		}
+		visit, err := newVisit(visits.GetVisitsRow(row))
+		if err != nil {
+			return nil, fmt.Errorf("getVisitsPage: %w", err)
+		}
+		page.Items = append(page.Items, visit)
+	}
+	total, estimated, err := v.countVisits(ctx, filter, where, count)
+	if err != nil {
+		return nil, err
+	}
+	if total != UnknownTotal {
+		page.Total = &total
+		page.TotalEstimated = estimated
+	}
+	return page, nil
+}
+
+// countVisits считает посещения согласно mode. Оценка из pg_class годится только для всей таблицы,
+// поэтому с непустым фильтром, как и для ни разу не проанализированной таблицы, считаем точно.
+func (v *VisitsService) countVisits(ctx context.Context, filter VisitFilter, where visits.GetTotalVisitsParams, mode CountMode) (int64, bool, error) {
+	switch mode {
+	case CountNone:
+		return UnknownTotal, false, nil
+	case CountEstimate:
+		if filter.IsEmpty() {
+			estimate, err := v.s.EstimateTotalVisits(ctx)
+			if err != nil {
+				return 0, false, fmt.Errorf("estimateTotalVisits: %w", err)
+			}
+			if estimate >= 0 {
+				return estimate, true, nil
+			}
+		}
+	}
+	total, err := v.s.GetTotalVisits(ctx, where)
+	if err != nil {
+		return 0, false, fmt.Errorf("getTotalVisits: %w", err)
+	}
+	return total, false, nil
+}
+
+func visitsWhere(filter VisitFilter) visits.GetTotalVisitsParams {
+	return visits.GetTotalVisitsParams{
+		Query:       StrToText(escapeLike(filter.Query)),
+		Ids:         filter.IDs,
+		LinkIds:     filter.LinkIDs,
+		CreatedFrom: TimeToTimestamptz(filter.CreatedFrom),
+		CreatedTo:   TimeToTimestamptz(filter.CreatedTo),
+		Status:      pgtype.Int4{Int32: filter.Status, Valid: filter.Status != 0},
+		Ip:          StrToText(filter.IP),
+		RefererHost: StrToText(strings.ToLower(filter.RefererHost)),
+	}
+}
+
+func newVisit(row visits.GetVisitsRow) (*Visit, error) {
+	t, err := ConvertTime(row.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &Visit{
+		ID:           int(row.ID),
+		Link_ID:      int(row.LinkID),
+		CreatedAt:    t,
+		IP:           row.Ip,
+		UserAgent:    row.UserAgent,
+		Status:       int(row.Status),
+		IsCrawler:    row.IsCrawler,
+		LinkRevision: int(row.LinkRevision.Int32),
+	}, nil
+}
+
+// RefererHost возвращает хост из заголовка Referer в нижнем регистре или "", если его не разобрать.
+func RefererHost(referer string) string {
+	if referer == "" {
+		return ""
+	}
+	u, err := url.Parse(referer)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
 func StrToText(val string) pgtype.Text {
 	return pgtype.Text{
 		String: val,
@@ -283,3 +647,17 @@ func ConvertTime(t pgtype.Timestamptz) (time.Time, error) {
 	}
 	return t.Time, nil
 }
+
+func TimeToTimestamptz(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
+
+func timePtr(t pgtype.Timestamptz) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
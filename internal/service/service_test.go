@@ -4,12 +4,22 @@ import (
 	"code/internal/config"
 	"code/internal/db/postgres_db"
 	"code/internal/db/visits"
+	"code/internal/healthcheck"
+	"code/internal/importer"
+	"code/internal/preview"
+	"code/internal/qr"
 	"code/internal/service"
 	"code/internal/service/mocks"
 	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -27,17 +37,14 @@ func TestLinkService_CreateShortLink(t *testing.T) {
 	shortName := "test"
 	expectedShortUrl := baseUrl + "/" + shortName
 
-	m.On("GetLinks", ctx, postgres_db.GetLinksParams{}).Return([]postgres_db.GetLinksRow{}, nil).Once()
-
 	m.On("CreateLink", ctx, postgres_db.CreateLinkParams{
 		OriginalUrl: originalUrl,
 		ShortName:   shortName,
-		ShortUrl:    expectedShortUrl,
+		Actor:       "anonymous",
 	}).Return(postgres_db.CreateLinkRow{
 		ID:          1,
 		OriginalUrl: originalUrl,
 		ShortName:   shortName,
-		ShortUrl:    expectedShortUrl,
 	}, nil).Once()
 
 	s := service.NewLinkService(m, &config.AppConfig{
@@ -66,33 +73,32 @@ func TestLinkService_GetLinks(t *testing.T) {
 				ID:          1,
 				OriginalUrl: "https://example1.com/very-very-long?query=long",
 				ShortName:   "test1",
-				ShortUrl:    baseUrl + "/test1",
 			},
 			{
 				ID:          2,
 				OriginalUrl: "https://example2.com/very-very-long?query=long",
 				ShortName:   "test2",
-				ShortUrl:    baseUrl + "/test2",
 			},
 		}
 
 		m.On("GetLinks", ctx, postgres_db.GetLinksParams{
-			Limit:  2,
-			Offset: 0,
+			SortField: "id",
+			Limit:     2,
+			Offset:    0,
 		}).Return(mockedRows, nil).Once()
 
-		m.On("GetTotalLinks", ctx).Return(int64(2), nil)
+		m.On("GetTotalLinks", ctx, postgres_db.GetTotalLinksParams{}).Return(int64(2), nil)
 
 		s := service.NewLinkService(m, &config.AppConfig{
 			BaseURL: baseUrl,
 		})
 
-		links, total, err := s.GetLinks(ctx, 2, 0)
+		links, total, err := s.GetLinks(ctx, service.LinkFilter{}, service.DefaultLinkSort, 2, 0)
 		require.NoError(t, err)
 		require.Len(t, links, len(mockedRows))
 		assert.Equal(t, expectTotalLinks, total)
 		assert.Equal(t, mockedRows[0].ID, links[0].ID)
-		assert.Equal(t, mockedRows[1].ShortUrl, links[1].ShortUrl)
+		assert.Equal(t, baseUrl+"/test2", links[1].ShortUrl)
 	})
 	t.Run("returns empty list when no links", func(t *testing.T) {
 		t.Parallel()
@@ -102,20 +108,56 @@ func TestLinkService_GetLinks(t *testing.T) {
 		mockedRows := []postgres_db.GetLinksRow{}
 
 		m.On("GetLinks", ctx, postgres_db.GetLinksParams{
-			Limit:  2,
-			Offset: 0,
+			SortField: "id",
+			Limit:     2,
+			Offset:    0,
 		}).Return(mockedRows, nil).Once()
 
-		m.On("GetTotalLinks", ctx).Return(int64(2), nil)
+		m.On("GetTotalLinks", ctx, postgres_db.GetTotalLinksParams{}).Return(int64(2), nil)
 
 		s := service.NewLinkService(m, &config.AppConfig{})
 
-		links, total, err := s.GetLinks(ctx, 2, 0)
+		links, total, err := s.GetLinks(ctx, service.LinkFilter{}, service.DefaultLinkSort, 2, 0)
 		_ = total
 		require.NoError(t, err)
 		require.Empty(t, links)
 		m.AssertExpectations(t)
 	})
+	t.Run("passes filter and sort", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		m := new(mocks.MockQuerier)
+		from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+		where := postgres_db.GetTotalLinksParams{
+			Query:       service.StrToText(`50\%\_off`),
+			Ids:         []int64{1, 3},
+			ShortName:   service.StrToText("sale"),
+			CreatedFrom: pgtype.Timestamptz{Time: from, Valid: true},
+		}
+
+		m.On("GetLinks", ctx, postgres_db.GetLinksParams{
+			Query:       where.Query,
+			Ids:         where.Ids,
+			ShortName:   where.ShortName,
+			CreatedFrom: where.CreatedFrom,
+			SortField:   "short_name",
+			SortDesc:    true,
+			Limit:       10,
+		}).Return([]postgres_db.GetLinksRow{{ID: 3, ShortName: "sale"}}, nil).Once()
+		m.On("GetTotalLinks", ctx, where).Return(int64(1), nil).Once()
+
+		s := service.NewLinkService(m, &config.AppConfig{})
+		links, total, err := s.GetLinks(ctx, service.LinkFilter{
+			Query:       " 50%_off ",
+			IDs:         []int64{1, 3},
+			ShortName:   "sale",
+			CreatedFrom: &from,
+		}, service.Sort{Field: "short_name", Desc: true}, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, links, 1)
+		assert.Equal(t, int64(1), total)
+		m.AssertExpectations(t)
+	})
 }
 
 func TestLinkService_GetLinkByID(t *testing.T) {
@@ -128,7 +170,7 @@ func TestLinkService_GetLinkByID(t *testing.T) {
 		ID:          linkID,
 		OriginalUrl: "https://example1.com/very-very-long?query=long",
 		ShortName:   "test1",
-		ShortUrl:    baseUrl + "/test1",
+		Title:       service.StrToText("Example title"),
 	}
 
 	m.On("GetLinkByID", ctx, linkID).Return(mockedRow, nil).Once()
@@ -139,13 +181,15 @@ func TestLinkService_GetLinkByID(t *testing.T) {
 	link, err := s.GetLinkByID(ctx, linkID)
 	require.NoError(t, err)
 	assert.Equal(t, linkID, link.ID)
-	assert.Equal(t, mockedRow.ShortUrl, link.ShortUrl)
+	assert.Equal(t, baseUrl+"/test1", link.ShortUrl)
+	assert.Equal(t, "Example title", link.Title)
+	assert.Empty(t, link.ImageURL)
 	m.AssertExpectations(t)
 }
 
 func TestLinkService_UpdateLinkByID(t *testing.T) {
 	t.Parallel()
-	ctx := context.Background()
+	ctx := service.WithActor(context.Background(), "editor")
 	m := new(mocks.MockQuerier)
 	linkID := int64(11)
 	newShortName := "new_test"
@@ -155,22 +199,21 @@ func TestLinkService_UpdateLinkByID(t *testing.T) {
 		ID:          linkID,
 		OriginalUrl: "https://example1.com/very-very-long?query=long",
 		ShortName:   "test1",
-		ShortUrl:    baseUrl + "/test1",
 	}
 
 	updatedRow := postgres_db.UpdateLinkByIDRow{
 		ID:          linkID,
 		OriginalUrl: "https://example1.com/very-very-long?query=long",
 		ShortName:   newShortName,
-		ShortUrl:    baseUrl + "/" + newShortName,
 	}
 
 	m.On("GetLinkByID", ctx, linkID).Return(oldRow, nil).Once()
 	m.On("UpdateLinkByID", ctx, postgres_db.UpdateLinkByIDParams{
+		ID:          linkID,
 		OriginalUrl: oldRow.OriginalUrl,
 		ShortName:   newShortName,
-		ShortUrl:    baseUrl + "/" + newShortName,
-		ID:          linkID,
+		Action:      service.RevisionUpdate,
+		Actor:       "editor",
 	}).Return(updatedRow, nil).Once()
 
 	s := service.NewLinkService(m, &config.AppConfig{
@@ -185,23 +228,523 @@ func TestLinkService_UpdateLinkByID(t *testing.T) {
 	m.AssertExpectations(t)
 }
 
+type fakeFetcher struct {
+	meta *preview.Metadata
+}
+
+func (f *fakeFetcher) Fetch(_ context.Context, _ string) (*preview.Metadata, error) {
+	return f.meta, nil
+}
+
+type recordingQueue struct {
+	ids []int64
+}
+
+func (r *recordingQueue) Enqueue(id int64, _ string) {
+	r.ids = append(r.ids, id)
+}
+
+func TestLinkService_CreateShortLink_EnqueuesMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	queue := &recordingQueue{}
+
+	m.On("CreateLink", ctx, mock.Anything).
+		Return(postgres_db.CreateLinkRow{ID: 42, OriginalUrl: "https://example.com", ShortName: "meta"}, nil).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{BaseURL: baseUrl})
+	s.SetMetadataQueue(queue)
+
+	_, err := s.CreateShortLink(ctx, "meta", "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{42}, queue.ids)
+	m.AssertExpectations(t)
+}
+
+func TestMetadataWorker_Run(t *testing.T) {
+	t.Parallel()
+	m := new(mocks.MockQuerier)
+	fetcher := &fakeFetcher{meta: &preview.Metadata{
+		Title:      "Example",
+		FaviconURL: "https://example.com/favicon.ico",
+	}}
+	done := make(chan struct{})
+
+	m.On("UpdateLinkMetadata", mock.Anything, postgres_db.UpdateLinkMetadataParams{
+		ID:          5,
+		Title:       service.StrToText("Example"),
+		Description: service.StrToText(""),
+		FaviconUrl:  service.StrToText("https://example.com/favicon.ico"),
+		OgImageUrl:  service.StrToText(""),
+		OriginalUrl: "https://example.com",
+	}).Return(nil).Once().Run(func(_ mock.Arguments) { close(done) })
+
+	w := service.NewMetadataWorker(m, fetcher, 1, time.Second)
+	ctx, cancel := context.WithCancel(t.Context())
+	stopped := make(chan struct{})
+	go func() {
+		w.Run(ctx, 1)
+		close(stopped)
+	}()
+
+	w.Enqueue(5, "https://example.com")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("metadata was not saved")
+	}
+	cancel()
+	<-stopped
+	m.AssertExpectations(t)
+}
+
+// Занятое имя ловит уникальный индекс, без предварительного чтения ссылок.
+func TestLinkService_CreateShortLink_Taken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	m.On("CreateLink", ctx, postgres_db.CreateLinkParams{OriginalUrl: "https://example.com", ShortName: "taken", Actor: "anonymous"}).
+		Return(postgres_db.CreateLinkRow{}, &pgconn.PgError{Code: "23505", ConstraintName: "links_short_name_key"}).Once()
+
+	_, err := service.NewLinkService(m, &config.AppConfig{BaseURL: baseUrl}).CreateShortLink(ctx, "taken", "https://example.com")
+	require.ErrorIs(t, err, service.ErrShortNameTaken)
+	m.AssertNotCalled(t, "GetLinks", mock.Anything, mock.Anything)
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_CreateShortLink_ReservedNames(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	root := &config.AppConfig{BaseURL: baseUrl, MetricsConfig: config.MetricsConfig{Enabled: true, Path: "/internal/metrics"}}
+
+	for _, name := range []string{"api", "healthz", "readyz", "r", "internal"} {
+		m := new(mocks.MockQuerier)
+		_, err := service.NewLinkService(m, root).CreateShortLink(ctx, name, "https://example.com/"+name)
+		require.ErrorIs(t, err, service.ErrShortNameReserved, name)
+		m.AssertNotCalled(t, "CreateLink", mock.Anything, mock.Anything)
+	}
+
+	// Под префиксом /r эти имена маршрутам не мешают
+	m := new(mocks.MockQuerier)
+	m.On("CreateLink", ctx, postgres_db.CreateLinkParams{OriginalUrl: "https://example.com/api", ShortName: "api", Actor: "anonymous"}).
+		Return(postgres_db.CreateLinkRow{ID: 1, OriginalUrl: "https://example.com/api", ShortName: "api"}, nil).Once()
+	s := service.NewLinkService(m, &config.AppConfig{BaseURL: baseUrl, RedirectPrefix: "/r"})
+	_, err := s.CreateShortLink(ctx, "api", "https://example.com/api")
+	require.NoError(t, err)
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_ShortURL(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{name: "root_prefix", prefix: "", want: baseUrl + "/abc123"},
+		{name: "r_prefix", prefix: "/r", want: baseUrl + "/r/abc123"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			s := service.NewLinkService(new(mocks.MockQuerier), &config.AppConfig{
+				BaseURL:        baseUrl,
+				RedirectPrefix: tc.prefix,
+			})
+			assert.Equal(t, tc.want, s.ShortURL("abc123"))
+		})
+	}
+}
+
+func TestLinkService_UpdateLinkSocial(t *testing.T) {
+	t.Parallel()
+	ctx := service.WithActor(context.Background(), "marketing")
+	m := new(mocks.MockQuerier)
+	linkID := int64(12)
+	preview := service.SocialPreview{OgTitle: "Spring sale", OgImage: "https://cdn.example.com/sale.png"}
+
+	m.On("UpdateLinkSocial", ctx, postgres_db.UpdateLinkSocialParams{
+		ID:            linkID,
+		OgTitle:       service.StrToText(preview.OgTitle),
+		OgDescription: service.StrToText(""),
+		OgImage:       service.StrToText(preview.OgImage),
+		Actor:         "marketing",
+	}).Return(int64(1), nil).Once()
+	m.On("GetLinkByID", ctx, linkID).Return(postgres_db.GetLinkByIDRow{
+		ID:        linkID,
+		ShortName: "sale",
+		OgTitle:   service.StrToText(preview.OgTitle),
+		OgImage:   service.StrToText(preview.OgImage),
+	}, nil).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{BaseURL: baseUrl})
+	link, err := s.UpdateLinkSocial(ctx, linkID, preview)
+	require.NoError(t, err)
+	assert.Equal(t, preview, link.SocialPreview)
+
+	m.On("UpdateLinkSocial", ctx, mock.Anything).Return(int64(0), nil).Once()
+	_, err = s.UpdateLinkSocial(ctx, 999, preview)
+	require.ErrorIs(t, err, service.ErrNotFound)
+	m.AssertExpectations(t)
+}
+
 func TestLinkService_DeleteLinkByID(t *testing.T) {
+	t.Parallel()
+	t.Run("trash", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		m := new(mocks.MockQuerier)
+		linkID := int64(19)
+
+		m.On("SoftDeleteLinkByID", ctx, postgres_db.SoftDeleteLinkByIDParams{ID: linkID, Actor: "anonymous"}).Return(int64(1), nil).Once()
+
+		s := service.NewLinkService(m, &config.AppConfig{})
+
+		result, err := s.DeleteLinkByID(ctx, linkID, false)
+		require.NoError(t, err)
+		assert.Equal(t, &service.DeleteLinkResult{Deleted: 1}, result)
+		m.AssertExpectations(t)
+	})
+	t.Run("cascade", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		m := new(mocks.MockQuerier)
+		linkID := int64(20)
+
+		m.On("DeleteLinkByID", ctx, linkID).
+			Return(postgres_db.DeleteLinkByIDRow{LinksDeleted: 1, VisitsDeleted: 7}, nil).Once()
+
+		s := service.NewLinkService(m, &config.AppConfig{
+			VisitsConfig: config.VisitsConfig{OnLinkDelete: config.VisitsOnDeleteCascade},
+		})
+
+		result, err := s.DeleteLinkByID(ctx, linkID, true)
+		require.NoError(t, err)
+		assert.Equal(t, &service.DeleteLinkResult{Deleted: 1, Permanent: true, VisitsDeleted: 7}, result)
+		m.AssertExpectations(t)
+	})
+	t.Run("archive", func(t *testing.T) {
+		t.Parallel()
+		ctx := context.Background()
+		m := new(mocks.MockQuerier)
+		linkID := int64(21)
+
+		m.On("DeleteLinkByIDArchivingVisits", ctx, linkID).
+			Return(postgres_db.DeleteLinkByIDArchivingVisitsRow{LinksDeleted: 1, VisitsArchived: 3}, nil).Once()
+
+		s := service.NewLinkService(m, &config.AppConfig{
+			VisitsConfig: config.VisitsConfig{OnLinkDelete: config.VisitsOnDeleteArchive},
+		})
+
+		result, err := s.DeleteLinkByID(ctx, linkID, true)
+		require.NoError(t, err)
+		assert.Equal(t, &service.DeleteLinkResult{Deleted: 1, Permanent: true, VisitsArchived: 3}, result)
+		m.AssertExpectations(t)
+	})
+}
+
+func TestLinkService_RestoreLinkByID(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+
+	m.On("RestoreLinkByID", ctx, postgres_db.RestoreLinkByIDParams{ID: 3, Actor: "anonymous"}).Return(int64(1), nil).Once()
+	m.On("GetLinkByID", ctx, int64(3)).Return(postgres_db.GetLinkByIDRow{
+		ID:          3,
+		OriginalUrl: "https://example.com",
+		ShortName:   "restored",
+	}, nil).Once()
+	m.On("RestoreLinkByID", ctx, postgres_db.RestoreLinkByIDParams{ID: 4, Actor: "anonymous"}).Return(int64(0), nil).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{})
+
+	link, err := s.RestoreLinkByID(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "restored", link.ShortName)
+	assert.Nil(t, link.DeletedAt)
+
+	_, err = s.RestoreLinkByID(ctx, 4)
+	require.ErrorIs(t, err, service.ErrNotFound)
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_PatchLink(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
 	m := new(mocks.MockQuerier)
-	linkID := int64(20)
-	affectedRows := int64(1)
+	linkID := int64(40)
+	current := postgres_db.GetLinkByIDRow{
+		ID:          linkID,
+		OriginalUrl: "https://example.com/old",
+		ShortName:   "keep",
+		Revision:    2,
+	}
+	newURL := "https://example.com/new"
 
-	m.On("DeleteLinkByID", ctx, linkID).Return(affectedRows, nil).Once()
+	m.On("GetLinkByID", ctx, linkID).Return(current, nil).Once()
+	m.On("UpdateLinkByID", ctx, postgres_db.UpdateLinkByIDParams{
+		ID:                linkID,
+		ExpectedRevisions: []int32{2},
+		OriginalUrl:       newURL,
+		ShortName:         "keep",
+		Action:            service.RevisionUpdate,
+		Actor:             "anonymous",
+	}).Return(postgres_db.UpdateLinkByIDRow{ID: linkID, OriginalUrl: newURL, ShortName: "keep", Revision: 3}, nil).Once()
+	patched := current
+	patched.OriginalUrl, patched.Revision = newURL, 3
+	m.On("GetLinkByID", ctx, linkID).Return(patched, nil).Once()
 
 	s := service.NewLinkService(m, &config.AppConfig{})
 
-	deleted, err := s.DeleteLinkByID(ctx, linkID)
+	link, err := s.PatchLink(ctx, linkID, service.LinkPatch{OriginalUrl: &newURL}, []int32{2})
+	require.NoError(t, err)
+	assert.Equal(t, newURL, link.OriginalUrl)
+	assert.Equal(t, "keep", link.ShortName)
+	assert.Equal(t, 3, link.Revision)
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_PatchLink_VersionMismatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	linkID := int64(41)
+	current := postgres_db.GetLinkByIDRow{ID: linkID, OriginalUrl: "https://example.com", ShortName: "name", Revision: 5}
+	other := "other"
+
+	// Ревизия сменилась между чтением и записью
+	m.On("GetLinkByID", ctx, linkID).Return(current, nil)
+	m.On("UpdateLinkByID", ctx, mock.Anything).Return(postgres_db.UpdateLinkByIDRow{}, pgx.ErrNoRows).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{})
+
+	_, err := s.PatchLink(ctx, linkID, service.LinkPatch{ShortName: &other}, []int32{4})
+	require.ErrorIs(t, err, service.ErrVersionMismatch)
+
+	// Пустой patch тоже сверяет версию
+	_, err = s.PatchLink(ctx, linkID, service.LinkPatch{}, []int32{4})
+	require.ErrorIs(t, err, service.ErrVersionMismatch)
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_GetLinkHistory(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	linkID := int64(30)
+
+	m.On("GetLinkByID", ctx, linkID).Return(postgres_db.GetLinkByIDRow{ID: linkID, Revision: 2}, nil).Once()
+	m.On("GetLinkRevisions", ctx, linkID).Return([]postgres_db.LinkRevision{
+		{
+			LinkID:         linkID,
+			Revision:       2,
+			Action:         service.RevisionUpdate,
+			OldOriginalUrl: pgtype.Text{String: "https://old.example.com", Valid: true},
+			OldShortName:   pgtype.Text{String: "promo", Valid: true},
+			NewOriginalUrl: pgtype.Text{String: "https://new.example.com", Valid: true},
+			NewShortName:   pgtype.Text{String: "promo", Valid: true},
+			Actor:          "editor",
+		},
+		{
+			LinkID:         linkID,
+			Revision:       1,
+			Action:         service.RevisionCreate,
+			NewOriginalUrl: pgtype.Text{String: "https://old.example.com", Valid: true},
+			NewShortName:   pgtype.Text{String: "promo", Valid: true},
+		},
+	}, nil).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{})
+
+	history, err := s.GetLinkHistory(ctx, linkID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "https://old.example.com", history[0].Old.OriginalUrl)
+	assert.Equal(t, "https://new.example.com", history[0].New.OriginalUrl)
+	assert.Nil(t, history[1].Old)
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_RevertLink(t *testing.T) {
+	t.Parallel()
+	ctx := service.WithActor(context.Background(), "editor")
+	m := new(mocks.MockQuerier)
+	linkID := int64(31)
+
+	m.On("GetLinkRevision", ctx, postgres_db.GetLinkRevisionParams{LinkID: linkID, Revision: 1}).
+		Return(postgres_db.LinkRevision{
+			Revision:       1,
+			Action:         service.RevisionCreate,
+			NewOriginalUrl: pgtype.Text{String: "https://old.example.com", Valid: true},
+			NewShortName:   pgtype.Text{String: "promo", Valid: true},
+		}, nil).Once()
+	m.On("UpdateLinkByID", ctx, postgres_db.UpdateLinkByIDParams{
+		ID:          linkID,
+		OriginalUrl: "https://old.example.com",
+		ShortName:   "promo",
+		Action:      service.RevisionRevert,
+		Actor:       "editor",
+	}).Return(postgres_db.UpdateLinkByIDRow{
+		ID:          linkID,
+		OriginalUrl: "https://old.example.com",
+		ShortName:   "promo",
+		Revision:    4,
+	}, nil).Once()
+	m.On("GetLinkRevision", ctx, postgres_db.GetLinkRevisionParams{LinkID: linkID, Revision: 3}).
+		Return(postgres_db.LinkRevision{Revision: 3, Action: service.RevisionDelete}, nil).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{})
+
+	link, err := s.RevertLink(ctx, linkID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "https://old.example.com", link.OriginalUrl)
+	assert.Equal(t, 4, link.Revision)
+
+	_, err = s.RevertLink(ctx, linkID, 3)
+	require.ErrorIs(t, err, service.ErrRevisionNotRevertible)
+	m.AssertExpectations(t)
+}
+
+func TestIdempotencyService_Begin(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	s := service.NewIdempotencyService(m, time.Hour)
+	claim := func(key string) any {
+		return mock.MatchedBy(func(arg postgres_db.ClaimIdempotencyKeyParams) bool {
+			return arg.Key == key && arg.Fingerprint == "fp" && time.Until(arg.ExpiresAt.Time) > 59*time.Minute
+		})
+	}
+
+	m.On("ClaimIdempotencyKey", ctx, claim("new")).Return(int64(1), nil).Once()
+	resp, err := s.Begin(ctx, "new", "fp")
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	m.On("ClaimIdempotencyKey", ctx, claim("done")).Return(int64(0), nil).Once()
+	m.On("GetIdempotencyKey", ctx, "done").Return(postgres_db.IdempotencyKey{
+		Key:         "done",
+		Fingerprint: "fp",
+		StatusCode:  pgtype.Int4{Int32: 201, Valid: true},
+		ContentType: pgtype.Text{String: "application/json", Valid: true},
+		Response:    []byte(`{"id":1}`),
+	}, nil).Once()
+	resp, err = s.Begin(ctx, "done", "fp")
+	require.NoError(t, err)
+	assert.Equal(t, &service.IdempotentResponse{StatusCode: 201, ContentType: "application/json", Body: []byte(`{"id":1}`)}, resp)
+
+	m.On("ClaimIdempotencyKey", ctx, claim("other")).Return(int64(0), nil).Once()
+	m.On("GetIdempotencyKey", ctx, "other").Return(postgres_db.IdempotencyKey{Key: "other", Fingerprint: "different"}, nil).Once()
+	_, err = s.Begin(ctx, "other", "fp")
+	require.ErrorIs(t, err, service.ErrIdempotencyKeyReused)
+
+	m.On("ClaimIdempotencyKey", ctx, claim("running")).Return(int64(0), nil).Once()
+	m.On("GetIdempotencyKey", ctx, "running").Return(postgres_db.IdempotencyKey{Key: "running", Fingerprint: "fp"}, nil).Once()
+	_, err = s.Begin(ctx, "running", "fp")
+	require.ErrorIs(t, err, service.ErrIdempotencyInProgress)
+	m.AssertExpectations(t)
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	t.Parallel()
+	a := service.RequestFingerprint("POST", "/api/links", []byte(`{"original_url": "https://a.com"}`))
+	b := service.RequestFingerprint("POST", "/api/links", []byte("{\n  \"original_url\":\"https://a.com\"\n}"))
+	c := service.RequestFingerprint("POST", "/api/links", []byte(`{"original_url":"https://b.com"}`))
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+}
+
+func TestAPIKeyService(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	s := service.NewAPIKeyService(m)
+
+	// В базу попадает только хеш, секрет возвращается вызывающему
+	var stored postgres_db.CreateAPIKeyParams
+	m.On("CreateAPIKey", ctx, mock.MatchedBy(func(arg postgres_db.CreateAPIKeyParams) bool {
+		stored = arg
+		return arg.Name == "ci"
+	})).Return(postgres_db.ApiKey{ID: 7, Name: "ci", Prefix: "lsk_0123abcd"}, nil).Once()
+	key, secret, err := s.Create(ctx, " ci ")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), key.ID)
+	assert.True(t, strings.HasPrefix(secret, service.APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(secret, stored.Prefix))
+	assert.NotContains(t, stored.KeyHash, secret[len(service.APIKeyPrefix):])
+	assert.Len(t, stored.KeyHash, 64)
+
+	_, _, err = s.Create(ctx, "  ")
+	require.Error(t, err)
+
+	m.On("GetActiveAPIKeyByHash", ctx, stored.KeyHash).Return(postgres_db.ApiKey{ID: 7, Name: "ci"}, nil).Once()
+	key, err = s.Authenticate(ctx, secret)
 	require.NoError(t, err)
-	assert.Equal(t, affectedRows, deleted)
+	assert.Equal(t, int64(7), key.ID)
+
+	m.On("GetActiveAPIKeyByHash", ctx, mock.Anything).Return(postgres_db.ApiKey{}, pgx.ErrNoRows).Once()
+	_, err = s.Authenticate(ctx, service.APIKeyPrefix+"revoked")
+	require.ErrorIs(t, err, service.ErrInvalidAPIKey)
+	// Строка без префикса не ищется в базе
+	_, err = s.Authenticate(ctx, "not-a-key")
+	require.ErrorIs(t, err, service.ErrInvalidAPIKey)
+
+	m.On("RevokeAPIKey", ctx, int64(7)).Return(int64(1), nil).Once()
+	require.NoError(t, s.Revoke(ctx, 7))
+	m.On("RevokeAPIKey", ctx, int64(7)).Return(int64(0), nil).Once()
+	require.ErrorIs(t, s.Revoke(ctx, 7), service.ErrNotFound)
 	m.AssertExpectations(t)
 }
 
+func TestTrashPurger_PurgeOnce(t *testing.T) {
+	t.Parallel()
+	m := new(mocks.MockQuerier)
+	m.On("PurgeDeletedLinks", mock.Anything, mock.MatchedBy(func(arg postgres_db.PurgeDeletedLinksParams) bool {
+		return arg.Limit == service.DefaultPurgeBatchSize && time.Since(arg.DeletedBefore.Time) >= 24*time.Hour
+	})).Return(postgres_db.PurgeDeletedLinksRow{LinksDeleted: 2, VisitsDeleted: 10}, nil).Once()
+
+	purger := service.NewTrashPurger(m, 24*time.Hour, time.Hour)
+	result, err := purger.PurgeOnce(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.Deleted)
+	assert.Equal(t, int64(10), result.VisitsDeleted)
+	m.AssertExpectations(t)
+}
+
+func TestOrphanCleaner_Run(t *testing.T) {
+	t.Parallel()
+	t.Run("archive_in_batches", func(t *testing.T) {
+		t.Parallel()
+		mv := new(mocks.MockVisits)
+		mv.On("ArchiveOrphanVisits", mock.Anything, int32(2)).Return(int64(2), nil).Once()
+		mv.On("ArchiveOrphanVisits", mock.Anything, int32(2)).Return(int64(1), nil).Once()
+		mv.On("ValidateVisitsLinkFK", mock.Anything).Return(nil).Once()
+
+		cleaner := service.NewOrphanCleaner(mv, config.VisitsConfig{
+			OnLinkDelete:    config.VisitsOnDeleteArchive,
+			OrphanBatchSize: 2,
+		})
+		n, err := cleaner.Run(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+		mv.AssertExpectations(t)
+	})
+	t.Run("cascade_deletes", func(t *testing.T) {
+		t.Parallel()
+		mv := new(mocks.MockVisits)
+		mv.On("DeleteOrphanVisits", mock.Anything, int32(service.DefaultOrphanBatchSize)).Return(int64(0), nil).Once()
+		mv.On("ValidateVisitsLinkFK", mock.Anything).Return(nil).Once()
+
+		cleaner := service.NewOrphanCleaner(mv, config.VisitsConfig{OnLinkDelete: config.VisitsOnDeleteCascade})
+		n, err := cleaner.Run(t.Context())
+		require.NoError(t, err)
+		assert.Zero(t, n)
+		mv.AssertExpectations(t)
+	})
+}
+
 func TestLinkService_GetOriginalURLByShortName(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -223,6 +766,127 @@ func TestLinkService_GetOriginalURLByShortName(t *testing.T) {
 	m.AssertExpectations(t)
 }
 
+func TestLinkService_GetOriginalURLByShortName_Trashed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	m.On("GetOriginalURLByShortName", ctx, "old").
+		Return(postgres_db.GetOriginalURLByShortNameRow{}, sql.ErrNoRows).Once()
+	m.On("IsShortNameTrashed", ctx, "old").Return(true, nil).Once()
+	m.On("GetOriginalURLByShortName", ctx, "missing").
+		Return(postgres_db.GetOriginalURLByShortNameRow{}, sql.ErrNoRows).Once()
+	m.On("IsShortNameTrashed", ctx, "missing").Return(false, nil).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{})
+	_, err := s.GetOriginalURLByShortName(ctx, "old")
+	require.ErrorIs(t, err, service.ErrLinkTrashed)
+	// Для редиректа ссылка из корзины по-прежнему не найдена
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = s.GetOriginalURLByShortName(ctx, "missing")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.NotErrorIs(t, err, service.ErrLinkTrashed)
+	m.AssertExpectations(t)
+}
+
+// fakeProber считает ссылку рабочей, если её адрес есть в ok.
+type fakeProber struct {
+	mu      sync.Mutex
+	ok      map[string]bool
+	checked []string
+}
+
+func (p *fakeProber) Check(_ context.Context, rawURL string) healthcheck.Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checked = append(p.checked, rawURL)
+	if p.ok[rawURL] {
+		return healthcheck.Result{OK: true, StatusCode: 200, Latency: 15 * time.Millisecond}
+	}
+	return healthcheck.Result{StatusCode: 404, Latency: 20 * time.Millisecond, Err: errors.New("unexpected status 404")}
+}
+
+func TestHealthChecker_RunOnce(t *testing.T) {
+	t.Parallel()
+	m := new(mocks.MockQuerier)
+	prober := &fakeProber{ok: map[string]bool{"https://a.example.com/1": true}}
+
+	m.On("GetLinksForHealthCheck", mock.Anything, mock.MatchedBy(func(arg postgres_db.GetLinksForHealthCheckParams) bool {
+		return arg.Limit == 50 && arg.CheckedBefore.Valid
+	})).Return([]postgres_db.GetLinksForHealthCheckRow{
+		{ID: 1, OriginalUrl: "https://a.example.com/1"},
+		{ID: 2, OriginalUrl: "https://a.example.com/2"},
+		{ID: 3, OriginalUrl: "https://b.example.com/3"},
+	}, nil).Once()
+	m.On("CreateLinkCheck", mock.Anything, postgres_db.CreateLinkCheckParams{
+		LinkID:        1,
+		Ok:            true,
+		StatusCode:    pgtype.Int4{Int32: 200, Valid: true},
+		LatencyMs:     15,
+		RedirectChain: []string{},
+	}).Return(nil).Once()
+	for _, id := range []int64{2, 3} {
+		m.On("CreateLinkCheck", mock.Anything, postgres_db.CreateLinkCheckParams{
+			LinkID:        id,
+			StatusCode:    pgtype.Int4{Int32: 404, Valid: true},
+			LatencyMs:     20,
+			RedirectChain: []string{},
+			Error:         service.StrToText("unexpected status 404"),
+		}).Return(nil).Once()
+		m.On("UpdateLinkHealth", mock.Anything, postgres_db.UpdateLinkHealthParams{FailureThreshold: 2, ID: id}).
+			Return(postgres_db.UpdateLinkHealthRow{HealthStatus: service.HealthUnknown, ConsecutiveFailures: 1}, nil).Once()
+	}
+	m.On("UpdateLinkHealth", mock.Anything, postgres_db.UpdateLinkHealthParams{Ok: true, FailureThreshold: 2, ID: 1}).
+		Return(postgres_db.UpdateLinkHealthRow{HealthStatus: service.HealthHealthy}, nil).Once()
+
+	checker := service.NewHealthChecker(m, prober, service.HealthCheckOptions{
+		Interval:         time.Minute,
+		Concurrency:      2,
+		FailureThreshold: 2,
+		BatchSize:        50,
+	})
+	require.NoError(t, checker.RunOnce(t.Context()))
+	assert.Len(t, prober.checked, 3)
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_GetLinkHealth(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	checkedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	m.On("GetLinkHealth", ctx, int64(8)).Return(postgres_db.GetLinkHealthRow{
+		HealthStatus:        service.HealthBroken,
+		ConsecutiveFailures: 3,
+		LastCheckedAt:       pgtype.Timestamptz{Time: checkedAt, Valid: true},
+	}, nil).Once()
+	m.On("GetLinkChecks", ctx, postgres_db.GetLinkChecksParams{LinkID: 8, Limit: 5}).
+		Return([]postgres_db.GetLinkChecksRow{{
+			ID:            1,
+			CheckedAt:     pgtype.Timestamptz{Time: checkedAt, Valid: true},
+			StatusCode:    pgtype.Int4{Int32: 502, Valid: true},
+			LatencyMs:     120,
+			RedirectChain: []string{"https://example.com/next"},
+			Error:         service.StrToText("unexpected status 502"),
+		}}, nil).Once()
+	m.On("GetLinkHealth", ctx, int64(9)).Return(postgres_db.GetLinkHealthRow{}, pgx.ErrNoRows).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{})
+	health, err := s.GetLinkHealth(ctx, 8, 5)
+	require.NoError(t, err)
+	assert.Equal(t, service.HealthBroken, health.Status)
+	assert.Equal(t, 3, health.ConsecutiveFailures)
+	require.NotNil(t, health.LastCheckedAt)
+	require.Len(t, health.Checks, 1)
+	assert.Equal(t, 502, health.Checks[0].StatusCode)
+	assert.Equal(t, []string{"https://example.com/next"}, health.Checks[0].RedirectChain)
+
+	_, err = s.GetLinkHealth(ctx, 9, 5)
+	require.ErrorIs(t, err, service.ErrNotFound)
+	m.AssertExpectations(t)
+}
+
 func Test_GenerateShortName(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
@@ -257,7 +921,7 @@ func TestVisitsService_CreateVisit(t *testing.T) {
 	mv.On("CreateVisit", mock.Anything, arg).
 		Return(nil).Once()
 	vs := service.NewVisitService(mv)
-	err := vs.CreateVisit(t.Context(), 3, "192.168.13.12", "curl/8.14.1", "", int32(302))
+	err := vs.CreateVisit(t.Context(), 3, "192.168.13.12", "curl/8.14.1", "", int32(302), false)
 	require.NoError(t, err)
 	mv.AssertExpectations(t)
 }
@@ -268,8 +932,10 @@ func TestVisitsService_GetVisits(t *testing.T) {
 	vs := service.NewVisitService(mv)
 	totalVisits := int64(2)
 	arg := visits.GetVisitsParams{
-		Limit:  2,
-		Offset: 0,
+		SortField: "created_at",
+		SortDesc:  true,
+		Limit:     2,
+		Offset:    0,
 	}
 	fixedTime := time.Date(2026, 1, 27, 23, 30, 0, 0, time.UTC)
 	rows := []visits.GetVisitsRow{
@@ -298,9 +964,9 @@ func TestVisitsService_GetVisits(t *testing.T) {
 	}
 	mv.On("GetVisits", mock.Anything, arg).Return(rows, nil).Once()
 
-	mv.On("GetTotalVisits", mock.Anything).Return(totalVisits, nil).Once()
+	mv.On("GetTotalVisits", mock.Anything, visits.GetTotalVisitsParams{}).Return(totalVisits, nil).Once()
 
-	got, total, err := vs.GetVisits(t.Context(), arg.Limit, arg.Offset)
+	got, total, err := vs.GetVisits(t.Context(), service.VisitFilter{}, service.DefaultVisitSort, service.CountExact, arg.Limit, arg.Offset)
 	require.NoError(t, err)
 	assert.Equal(t, totalVisits, total)
 	assert.Equal(t, rows[0].Ip, got[0].IP)
@@ -308,6 +974,116 @@ func TestVisitsService_GetVisits(t *testing.T) {
 	mv.AssertExpectations(t)
 }
 
+func TestVisitsService_GetVisitsPage(t *testing.T) {
+	t.Parallel()
+	mv := new(mocks.MockVisits)
+	vs := service.NewVisitService(mv)
+	newest := time.Date(2026, 10, 3, 12, 0, 0, 123456000, time.UTC)
+	rows := []visits.GetVisitsPageRow{
+		{ID: 9, LinkID: 1, CreatedAt: pgtype.Timestamptz{Time: newest, Valid: true}},
+		{ID: 8, LinkID: 1, CreatedAt: pgtype.Timestamptz{Time: newest.Add(-time.Minute), Valid: true}},
+		{ID: 7, LinkID: 1, CreatedAt: pgtype.Timestamptz{Time: newest.Add(-2 * time.Minute), Valid: true}},
+	}
+
+	mv.On("GetVisitsPage", mock.Anything, visits.GetVisitsPageParams{Limit: 3}).Return(rows, nil).Once()
+	mv.On("EstimateTotalVisits", mock.Anything).Return(int64(1_000_000), nil).Once()
+
+	page, err := vs.GetVisitsPage(t.Context(), service.VisitFilter{}, "", 2, service.CountEstimate)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, 8, page.Items[1].ID)
+	require.NotEmpty(t, page.NextCursor)
+	require.NotNil(t, page.Total)
+	assert.Equal(t, int64(1_000_000), *page.Total)
+	assert.True(t, page.TotalEstimated)
+
+	mv.On("GetVisitsPage", mock.Anything, visits.GetVisitsPageParams{
+		AfterCreatedAt: pgtype.Timestamptz{Time: rows[1].CreatedAt.Time, Valid: true},
+		AfterID:        8,
+		Limit:          3,
+	}).Return(rows[2:], nil).Once()
+
+	page, err = vs.GetVisitsPage(t.Context(), service.VisitFilter{}, page.NextCursor, 2, service.CountNone)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Empty(t, page.NextCursor)
+	assert.Nil(t, page.Total)
+
+	_, err = vs.GetVisitsPage(t.Context(), service.VisitFilter{}, "not a cursor!", 2, service.CountNone)
+	require.ErrorIs(t, err, service.ErrInvalidCursor)
+	mv.AssertExpectations(t)
+}
+
+func TestVisitsService_GetVisits_CountModes(t *testing.T) {
+	t.Parallel()
+	linkFilter := service.VisitFilter{LinkIDs: []int64{4}}
+	testCases := []struct {
+		name   string
+		filter service.VisitFilter
+		mode   service.CountMode
+		setup  func(mv *mocks.MockVisits)
+		want   int64
+	}{
+		{
+			name: "none",
+			mode: service.CountNone,
+			want: service.UnknownTotal,
+		},
+		{
+			name: "estimate",
+			mode: service.CountEstimate,
+			setup: func(mv *mocks.MockVisits) {
+				mv.On("EstimateTotalVisits", mock.Anything).Return(int64(500), nil).Once()
+			},
+			want: 500,
+		},
+		{
+			name: "estimate_without_statistics_falls_back_to_exact",
+			mode: service.CountEstimate,
+			setup: func(mv *mocks.MockVisits) {
+				mv.On("EstimateTotalVisits", mock.Anything).Return(int64(-1), nil).Once()
+				mv.On("GetTotalVisits", mock.Anything, visits.GetTotalVisitsParams{}).Return(int64(3), nil).Once()
+			},
+			want: 3,
+		},
+		{
+			name:   "estimate_with_filter_is_exact",
+			filter: linkFilter,
+			mode:   service.CountEstimate,
+			setup: func(mv *mocks.MockVisits) {
+				mv.On("GetTotalVisits", mock.Anything, visits.GetTotalVisitsParams{LinkIds: []int64{4}}).
+					Return(int64(2), nil).Once()
+			},
+			want: 2,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mv := new(mocks.MockVisits)
+			mv.On("GetVisits", mock.Anything, mock.Anything).Return([]visits.GetVisitsRow{}, nil).Once()
+			if tc.setup != nil {
+				tc.setup(mv)
+			}
+			vs := service.NewVisitService(mv)
+
+			_, total, err := vs.GetVisits(t.Context(), tc.filter, service.DefaultVisitSort, tc.mode, 10, 0)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, total)
+			mv.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_RefererHost(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "t.me", service.RefererHost("https://T.me/channel/42"))
+	assert.Equal(t, "example.com", service.RefererHost("http://user@example.com:8080/path"))
+	assert.Empty(t, service.RefererHost(""))
+	assert.Empty(t, service.RefererHost("not a url"))
+}
+
 func Test_StrToText(t *testing.T) {
 	t.Parallel()
 	result := service.StrToText("Hello")
@@ -357,3 +1133,263 @@ func Test_ConvertTime(t *testing.T) {
 		})
 	}
 }
+
+func TestLinkService_CreateLinksBatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	tx := &mocks.MockTxRunner{Q: m}
+
+	m.On("CreateLink", ctx, postgres_db.CreateLinkParams{OriginalUrl: "https://example.com/a", ShortName: "a", Actor: "anonymous"}).
+		Return(postgres_db.CreateLinkRow{ID: 1, OriginalUrl: "https://example.com/a", ShortName: "a"}, nil).Once()
+	m.On("CreateLink", ctx, postgres_db.CreateLinkParams{OriginalUrl: "https://example.com/b", ShortName: "a", Actor: "anonymous"}).
+		Return(postgres_db.CreateLinkRow{}, &pgconn.PgError{Code: "23505"}).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{BaseURL: "http://localhost:8080", RedirectPrefix: "/r"})
+	s.SetTxRunner(tx)
+
+	result, err := s.CreateLinksBatch(ctx, []service.BatchLinkInput{
+		{Index: 0, OriginalUrl: "https://example.com/a", ShortName: "a"},
+		{Index: 2, OriginalUrl: "https://example.com/b", ShortName: "a"},
+	}, service.BatchBestEffort)
+	require.NoError(t, err)
+	assert.True(t, result.Committed)
+	assert.True(t, tx.Committed)
+	assert.Equal(t, 1, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	require.Len(t, result.Items, 2)
+	assert.Equal(t, service.BatchItemResult{
+		Index:  0,
+		ID:     1,
+		Status: service.BatchCreated,
+		Link:   &service.Link{ID: 1, OriginalUrl: "https://example.com/a", ShortName: "a", ShortUrl: "http://localhost:8080/r/a", Revision: 1},
+	}, result.Items[0])
+	assert.Equal(t, service.BatchItemResult{Index: 2, Status: service.BatchFailed, Error: service.ErrShortNameTaken.Error()}, result.Items[1])
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_DeleteLinksBatch_Atomic(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	tx := &mocks.MockTxRunner{Q: m}
+
+	m.On("SoftDeleteLinkByID", ctx, postgres_db.SoftDeleteLinkByIDParams{ID: 1, Actor: "anonymous"}).Return(int64(1), nil).Once()
+	m.On("SoftDeleteLinkByID", ctx, postgres_db.SoftDeleteLinkByIDParams{ID: 2, Actor: "anonymous"}).Return(int64(0), nil).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{})
+	s.SetTxRunner(tx)
+
+	result, err := s.DeleteLinksBatch(ctx, []int64{1, 2}, false, service.BatchAtomic)
+	require.NoError(t, err)
+	// Вторая ссылка не найдена - удаление первой тоже откатывается
+	assert.False(t, result.Committed)
+	assert.False(t, tx.Committed)
+	assert.Equal(t, 0, result.Succeeded)
+	assert.Equal(t, []service.BatchItemResult{
+		{Index: 0, ID: 1, Status: service.BatchRolledBack},
+		{Index: 1, ID: 2, Status: service.BatchFailed, Error: "link not found"},
+	}, result.Items)
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_DeleteLinksBatch_HidesInternalErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	tx := &mocks.MockTxRunner{Q: m}
+
+	m.On("SoftDeleteLinkByID", ctx, postgres_db.SoftDeleteLinkByIDParams{ID: 1, Actor: "anonymous"}).
+		Return(int64(0), errors.New(`relation "links" does not exist`)).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{})
+	s.SetTxRunner(tx)
+
+	result, err := s.DeleteLinksBatch(ctx, []int64{1}, false, service.BatchBestEffort)
+	require.NoError(t, err)
+	// Текст ошибки БД остаётся в логе, клиент его не видит
+	assert.Equal(t, []service.BatchItemResult{
+		{Index: 0, ID: 1, Status: service.BatchFailed, Error: "internal error"},
+	}, result.Items)
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_Batch_WithoutTxRunner(t *testing.T) {
+	t.Parallel()
+	s := service.NewLinkService(new(mocks.MockQuerier), &config.AppConfig{})
+
+	_, err := s.DeleteLinksBatch(context.Background(), []int64{1}, false, service.BatchAtomic)
+	require.ErrorIs(t, err, service.ErrBatchUnavailable)
+}
+
+func TestImportService_RunOnce(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	payload := "url,short_name\n" +
+		"https://example.com/a,a\n" +
+		"not a url,b\n" +
+		"https://example.com/c,a\n"
+
+	m.On("FailStaleImportJobs", ctx, mock.Anything).Return(int64(0), nil).Once()
+	m.On("ClaimImportJob", ctx).Return(postgres_db.ImportJob{
+		ID:      7,
+		Format:  "csv",
+		Actor:   "migration-bot",
+		Payload: []byte(payload),
+	}, nil).Once()
+	m.On("CreateLink", mock.Anything, postgres_db.CreateLinkParams{
+		OriginalUrl: "https://example.com/a",
+		ShortName:   "a",
+		Actor:       "migration-bot",
+	}).Return(postgres_db.CreateLinkRow{ID: 1, OriginalUrl: "https://example.com/a", ShortName: "a"}, nil).Once()
+	m.On("UpdateImportJobProgress", mock.Anything, mock.MatchedBy(func(p postgres_db.UpdateImportJobProgressParams) bool {
+		return p.ID == 7 && p.TotalRows == 3 && p.ProcessedRows == 3 && p.CreatedRows == 1 && p.FailedRows == 2 &&
+			strings.Contains(string(p.Errors), `"line":3`) &&
+			strings.Contains(string(p.Errors), `"error":"duplicate short_name, first used on line 2"`)
+	})).Return(nil).Once()
+	m.On("FinishImportJob", mock.Anything, postgres_db.FinishImportJobParams{ID: 7, Status: service.ImportDone}).Return(nil).Once()
+	m.On("FailStaleImportJobs", ctx, mock.Anything).Return(int64(0), nil).Once()
+	m.On("ClaimImportJob", ctx).Return(postgres_db.ImportJob{}, pgx.ErrNoRows).Once()
+
+	links := service.NewLinkService(m, &config.AppConfig{})
+	links.SetTxRunner(&mocks.MockTxRunner{Q: m})
+	s := service.NewImportService(m, links, time.Minute)
+
+	ok, err := s.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	m.AssertExpectations(t)
+}
+
+// Заголовок из файла - метаданные ссылки, а не её OG теги: краулеры по-прежнему получают редирект,
+// а ревизия social не пишется.
+func TestImportService_RunOnce_TitleIsMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	queue := &recordingQueue{}
+	payload := "url,short_name,title,share\n" +
+		"https://example.com/a,a,Example A,\n" +
+		"https://example.com/b,b,,Share B\n"
+
+	m.On("FailStaleImportJobs", ctx, mock.Anything).Return(int64(0), nil).Once()
+	m.On("ClaimImportJob", ctx).Return(postgres_db.ImportJob{
+		ID:      8,
+		Format:  "csv",
+		Actor:   "migration-bot",
+		Payload: []byte(payload),
+		Mapping: []byte(`{"og_title":"share"}`),
+	}, nil).Once()
+	m.On("CreateLink", mock.Anything, postgres_db.CreateLinkParams{
+		OriginalUrl: "https://example.com/a",
+		ShortName:   "a",
+		Actor:       "migration-bot",
+	}).Return(postgres_db.CreateLinkRow{ID: 1, OriginalUrl: "https://example.com/a", ShortName: "a"}, nil).Once()
+	m.On("UpdateLinkMetadata", mock.Anything, postgres_db.UpdateLinkMetadataParams{
+		ID:          1,
+		Title:       pgtype.Text{String: "Example A", Valid: true},
+		OriginalUrl: "https://example.com/a",
+	}).Return(nil).Once()
+	// OG теги - только по явному mapping
+	m.On("CreateLink", mock.Anything, postgres_db.CreateLinkParams{
+		OriginalUrl: "https://example.com/b",
+		ShortName:   "b",
+		Actor:       "migration-bot",
+	}).Return(postgres_db.CreateLinkRow{ID: 2, OriginalUrl: "https://example.com/b", ShortName: "b"}, nil).Once()
+	m.On("UpdateLinkSocial", mock.Anything, postgres_db.UpdateLinkSocialParams{
+		ID:      2,
+		OgTitle: pgtype.Text{String: "Share B", Valid: true},
+		Actor:   "migration-bot",
+	}).Return(int64(1), nil).Once()
+	m.On("GetLinkByID", mock.Anything, int64(2)).
+		Return(postgres_db.GetLinkByIDRow{ID: 2, OriginalUrl: "https://example.com/b", ShortName: "b"}, nil).Once()
+	m.On("UpdateImportJobProgress", mock.Anything, mock.MatchedBy(func(p postgres_db.UpdateImportJobProgressParams) bool {
+		return p.ID == 8 && p.CreatedRows == 2 && p.FailedRows == 0
+	})).Return(nil).Once()
+	m.On("FinishImportJob", mock.Anything, postgres_db.FinishImportJobParams{ID: 8, Status: service.ImportDone}).Return(nil).Once()
+	m.On("GetOriginalURLByShortName", ctx, "a").Return(postgres_db.GetOriginalURLByShortNameRow{
+		ID:          1,
+		OriginalUrl: "https://example.com/a",
+		Title:       pgtype.Text{String: "Example A", Valid: true},
+	}, nil).Once()
+
+	links := service.NewLinkService(m, &config.AppConfig{})
+	links.SetTxRunner(&mocks.MockTxRunner{Q: m})
+	links.SetMetadataQueue(queue)
+	s := service.NewImportService(m, links, time.Minute)
+
+	ok, err := s.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// Загрузка превью перезаписала бы заголовок из файла
+	assert.Equal(t, []int64{2}, queue.ids)
+
+	link, err := links.GetOriginalURLByShortName(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "Example A", link.Title)
+	assert.True(t, link.SocialPreview.IsEmpty(), "crawlers must be redirected, not served a preview page")
+	m.AssertNotCalled(t, "UpdateLinkSocial", mock.Anything, mock.MatchedBy(func(p postgres_db.UpdateLinkSocialParams) bool {
+		return p.ID == 1
+	}))
+	m.AssertExpectations(t)
+}
+
+func TestImportService_CreateImport_Invalid(t *testing.T) {
+	t.Parallel()
+	s := service.NewImportService(new(mocks.MockQuerier), nil, time.Minute)
+
+	_, err := s.CreateImport(context.Background(), importer.FormatCSV, nil, []byte("name,clicks\nx,1\n"), false)
+	require.ErrorIs(t, err, service.ErrInvalidImport)
+}
+
+func TestLinkService_ExportLinks(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	m.On("ExportLinks", ctx, postgres_db.ExportLinksParams{
+		Health:  pgtype.Text{String: service.HealthBroken, Valid: true},
+		AfterID: 10,
+	}).Return([]postgres_db.ExportLinksRow{
+		{ID: 11, OriginalUrl: "https://example.com/a", ShortName: "a", Revision: 3},
+		{ID: 12, OriginalUrl: "https://example.com/b", ShortName: "b", Revision: 1},
+	}, nil).Once()
+	s := service.NewLinkService(m, &config.AppConfig{BaseURL: "http://localhost:8080", RedirectPrefix: "/r"})
+
+	var got []*service.Link
+	err := s.ExportLinks(ctx, service.LinkFilter{Health: service.HealthBroken}, 10, func(link *service.Link) error {
+		got = append(got, link)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, &service.Link{ID: 11, OriginalUrl: "https://example.com/a", ShortName: "a", ShortUrl: "http://localhost:8080/r/a", Revision: 3}, got[0])
+	m.AssertExpectations(t)
+}
+
+func TestLinkService_GetLinkQR_ChangesWithRevision(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := new(mocks.MockQuerier)
+	linkID := int64(21)
+
+	m.On("GetLinkByID", ctx, linkID).Return(postgres_db.GetLinkByIDRow{ID: linkID, ShortName: "promo", Revision: 1}, nil).Twice()
+	m.On("GetLinkByID", ctx, linkID).Return(postgres_db.GetLinkByIDRow{ID: linkID, ShortName: "promo", Revision: 2}, nil).Once()
+
+	s := service.NewLinkService(m, &config.AppConfig{BaseURL: baseUrl, QRConfig: config.QRConfig{CacheSize: 10}})
+	first, err := s.GetLinkQR(ctx, linkID, qr.DefaultOptions())
+	require.NoError(t, err)
+	cached, err := s.GetLinkQR(ctx, linkID, qr.DefaultOptions())
+	require.NoError(t, err)
+	assert.Same(t, first, cached)
+
+	// Новая ревизия - новый ETag, даже если short_url не изменился
+	updated, err := s.GetLinkQR(ctx, linkID, qr.DefaultOptions())
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ETag, updated.ETag)
+	m.AssertExpectations(t)
+}
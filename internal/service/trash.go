@@ -0,0 +1,69 @@
+package service
+
+import (
+	store "code/internal/db/postgres_db"
+	"code/internal/logging"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const DefaultPurgeBatchSize = 100
+
+// TrashPurger окончательно удаляет ссылки, пролежавшие в корзине дольше Retention,
+// вместе с их посещениями.
+type TrashPurger struct {
+	q         store.Querier
+	retention time.Duration
+	interval  time.Duration
+	batchSize int32
+}
+
+func NewTrashPurger(q store.Querier, retention, interval time.Duration) *TrashPurger {
+	return &TrashPurger{q: q, retention: retention, interval: interval, batchSize: DefaultPurgeBatchSize}
+}
+
+// Run выполняет очистку сразу и затем раз в interval, пока не отменён ctx.
+func (p *TrashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := p.PurgeOnce(ctx); err != nil {
+			logging.FromContext(ctx).Error("trash purge", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOnce удаляет просроченные ссылки порциями по batchSize и возвращает итог.
+func (p *TrashPurger) PurgeOnce(ctx context.Context) (*DeleteLinkResult, error) {
+	total := &DeleteLinkResult{Permanent: true}
+	deletedBefore := pgtype.Timestamptz{Time: time.Now().Add(-p.retention), Valid: true}
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		row, err := p.q.PurgeDeletedLinks(ctx, store.PurgeDeletedLinksParams{
+			DeletedBefore: deletedBefore,
+			Limit:         p.batchSize,
+		})
+		if err != nil {
+			return total, fmt.Errorf("purgeDeletedLinks: %w", err)
+		}
+		total.Deleted += row.LinksDeleted
+		total.VisitsDeleted += row.VisitsDeleted
+		if row.LinksDeleted < int64(p.batchSize) {
+			break
+		}
+	}
+	if total.Deleted > 0 {
+		logging.FromContext(ctx).Info("trash purged", "links", total.Deleted, "visits", total.VisitsDeleted)
+	}
+	return total, nil
+}
@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer создаёт спан на каждый запрос pgx. Подключается через ConnConfig.Tracer.
+type QueryTracer struct{}
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = tracer().Start(ctx, "db "+queryName(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			// Значения параметров в спан не попадают, только текст запроса с плейсхолдерами
+			attribute.String("db.statement", data.SQL),
+		))
+	return ctx
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	end(span, data.Err)
+}
+
+// queryName достаёт имя запроса из комментария sqlc "-- name: GetLinkByID :one",
+// для остальных запросов - первое слово SQL.
+func queryName(sql string) string {
+	sql = strings.TrimSpace(sql)
+	if rest, ok := strings.CutPrefix(sql, "-- name:"); ok {
+		if fields := strings.Fields(rest); len(fields) > 0 {
+			return fields[0]
+		}
+	}
+	if fields := strings.Fields(sql); len(fields) > 0 {
+		return strings.ToUpper(fields[0])
+	}
+	return "query"
+}
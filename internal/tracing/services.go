@@ -0,0 +1,176 @@
+package tracing
+
+import (
+	"context"
+
+	"code/internal/qr"
+	"code/internal/service"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// linkServer оборачивает каждый метод LinkServer в спан "LinkService.<метод>".
+type linkServer struct {
+	next service.LinkServer
+}
+
+// LinkServer добавляет спаны к сервису ссылок.
+func LinkServer(ls service.LinkServer) service.LinkServer {
+	return &linkServer{next: ls}
+}
+
+func start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+func (l *linkServer) CreateShortLink(ctx context.Context, shortName, originalUrl string) (*service.Link, error) {
+	ctx, span := start(ctx, "LinkService.CreateShortLink")
+	link, err := l.next.CreateShortLink(ctx, shortName, originalUrl)
+	end(span, err)
+	return link, err
+}
+
+func (l *linkServer) GetLinks(ctx context.Context, filter service.LinkFilter, sort service.Sort, limit, offset int32) ([]*service.Link, int64, error) {
+	ctx, span := start(ctx, "LinkService.GetLinks")
+	links, total, err := l.next.GetLinks(ctx, filter, sort, limit, offset)
+	end(span, err)
+	return links, total, err
+}
+
+func (l *linkServer) GetLinkByID(ctx context.Context, id int64) (*service.Link, error) {
+	ctx, span := start(ctx, "LinkService.GetLinkByID", attribute.Int64("link.id", id))
+	link, err := l.next.GetLinkByID(ctx, id)
+	end(span, err)
+	return link, err
+}
+
+func (l *linkServer) UpdateLinkByID(ctx context.Context, shortName, originalUrl string, id int64) (*service.Link, error) {
+	ctx, span := start(ctx, "LinkService.UpdateLinkByID", attribute.Int64("link.id", id))
+	link, err := l.next.UpdateLinkByID(ctx, shortName, originalUrl, id)
+	end(span, err)
+	return link, err
+}
+
+func (l *linkServer) PatchLink(ctx context.Context, id int64, patch service.LinkPatch, expectedRevisions []int32) (*service.Link, error) {
+	ctx, span := start(ctx, "LinkService.PatchLink", attribute.Int64("link.id", id))
+	link, err := l.next.PatchLink(ctx, id, patch, expectedRevisions)
+	end(span, err)
+	return link, err
+}
+
+func (l *linkServer) DeleteLinkByID(ctx context.Context, id int64, permanent bool) (*service.DeleteLinkResult, error) {
+	ctx, span := start(ctx, "LinkService.DeleteLinkByID", attribute.Int64("link.id", id), attribute.Bool("permanent", permanent))
+	res, err := l.next.DeleteLinkByID(ctx, id, permanent)
+	end(span, err)
+	return res, err
+}
+
+func (l *linkServer) RestoreLinkByID(ctx context.Context, id int64) (*service.Link, error) {
+	ctx, span := start(ctx, "LinkService.RestoreLinkByID", attribute.Int64("link.id", id))
+	link, err := l.next.RestoreLinkByID(ctx, id)
+	end(span, err)
+	return link, err
+}
+
+func (l *linkServer) GetLinkHistory(ctx context.Context, id int64) ([]service.LinkRevision, error) {
+	ctx, span := start(ctx, "LinkService.GetLinkHistory", attribute.Int64("link.id", id))
+	revisions, err := l.next.GetLinkHistory(ctx, id)
+	end(span, err)
+	return revisions, err
+}
+
+func (l *linkServer) RevertLink(ctx context.Context, id int64, revision int32) (*service.Link, error) {
+	ctx, span := start(ctx, "LinkService.RevertLink", attribute.Int64("link.id", id), attribute.Int("link.revision", int(revision)))
+	link, err := l.next.RevertLink(ctx, id, revision)
+	end(span, err)
+	return link, err
+}
+
+func (l *linkServer) GetOriginalURLByShortName(ctx context.Context, shortName string) (*service.Link, error) {
+	// Короткое имя в атрибуты не пишем: оно и так есть в пути HTTP-спана
+	ctx, span := start(ctx, "LinkService.GetOriginalURLByShortName")
+	link, err := l.next.GetOriginalURLByShortName(ctx, shortName)
+	end(span, err)
+	return link, err
+}
+
+func (l *linkServer) GetLinkQR(ctx context.Context, id int64, opts qr.Options) (*qr.Image, error) {
+	ctx, span := start(ctx, "LinkService.GetLinkQR", attribute.Int64("link.id", id), attribute.String("qr.format", opts.Format))
+	img, err := l.next.GetLinkQR(ctx, id, opts)
+	end(span, err)
+	return img, err
+}
+
+func (l *linkServer) UpdateLinkSocial(ctx context.Context, id int64, preview service.SocialPreview) (*service.Link, error) {
+	ctx, span := start(ctx, "LinkService.UpdateLinkSocial", attribute.Int64("link.id", id))
+	link, err := l.next.UpdateLinkSocial(ctx, id, preview)
+	end(span, err)
+	return link, err
+}
+
+func (l *linkServer) GetLinkHealth(ctx context.Context, id int64, limit int32) (*service.LinkHealth, error) {
+	ctx, span := start(ctx, "LinkService.GetLinkHealth", attribute.Int64("link.id", id))
+	health, err := l.next.GetLinkHealth(ctx, id, limit)
+	end(span, err)
+	return health, err
+}
+
+func (l *linkServer) CreateLinksBatch(ctx context.Context, items []service.BatchLinkInput, mode service.BatchMode) (*service.BatchResult, error) {
+	ctx, span := start(ctx, "LinkService.CreateLinksBatch", attribute.Int("batch.size", len(items)), attribute.String("batch.mode", string(mode)))
+	res, err := l.next.CreateLinksBatch(ctx, items, mode)
+	end(span, err)
+	return res, err
+}
+
+func (l *linkServer) DeleteLinksBatch(ctx context.Context, ids []int64, permanent bool, mode service.BatchMode) (*service.BatchResult, error) {
+	ctx, span := start(ctx, "LinkService.DeleteLinksBatch", attribute.Int("batch.size", len(ids)), attribute.String("batch.mode", string(mode)))
+	res, err := l.next.DeleteLinksBatch(ctx, ids, permanent, mode)
+	end(span, err)
+	return res, err
+}
+
+func (l *linkServer) ExportLinks(ctx context.Context, filter service.LinkFilter, afterID int64, fn func(link *service.Link) error) error {
+	ctx, span := start(ctx, "LinkService.ExportLinks", attribute.Int64("export.after_id", afterID))
+	err := l.next.ExportLinks(ctx, filter, afterID, fn)
+	end(span, err)
+	return err
+}
+
+// visitServer оборачивает каждый метод VisitServer в спан "VisitsService.<метод>".
+type visitServer struct {
+	next service.VisitServer
+}
+
+// VisitServer добавляет спаны к сервису посещений.
+func VisitServer(vs service.VisitServer) service.VisitServer {
+	return &visitServer{next: vs}
+}
+
+func (v *visitServer) CreateVisit(ctx context.Context, id int64, ip, agent string, referer string, status int32, isCrawler bool) error {
+	ctx, span := start(ctx, "VisitsService.CreateVisit", attribute.Int64("link.id", id), attribute.Bool("visit.crawler", isCrawler))
+	err := v.next.CreateVisit(ctx, id, ip, agent, referer, status, isCrawler)
+	end(span, err)
+	return err
+}
+
+func (v *visitServer) GetVisits(ctx context.Context, filter service.VisitFilter, sort service.Sort, count service.CountMode, limit, offset int32) ([]*service.Visit, int64, error) {
+	ctx, span := start(ctx, "VisitsService.GetVisits")
+	visits, total, err := v.next.GetVisits(ctx, filter, sort, count, limit, offset)
+	end(span, err)
+	return visits, total, err
+}
+
+func (v *visitServer) GetVisitsPage(ctx context.Context, filter service.VisitFilter, cursor string, limit int32, count service.CountMode) (*service.VisitPage, error) {
+	ctx, span := start(ctx, "VisitsService.GetVisitsPage")
+	page, err := v.next.GetVisitsPage(ctx, filter, cursor, limit, count)
+	end(span, err)
+	return page, err
+}
+
+func (v *visitServer) ExportVisits(ctx context.Context, filter service.VisitFilter, afterID int64, fn func(visit *service.Visit) error) error {
+	ctx, span := start(ctx, "VisitsService.ExportVisits", attribute.Int64("export.after_id", afterID))
+	err := v.next.ExportVisits(ctx, filter, afterID, fn)
+	end(span, err)
+	return err
+}
@@ -0,0 +1,110 @@
+// Package tracing настраивает OpenTelemetry: экспорт спанов по OTLP/HTTP, W3C trace-context
+// для входящих запросов, спаны запросов к базе и сервисов ссылок и посещений.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"code/internal/config"
+
+	sentrygin "github.com/getsentry/sentry-go/gin"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "code/internal/tracing"
+
+// Setup устанавливает глобальный propagator и, если трассировка включена, провайдер с экспортом
+// по OTLP. Возвращаемая функция отправляет накопленные спаны и останавливает экспорт.
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracehttp.Option
+	// Без адреса экспортёр берёт OTEL_EXPORTER_OTLP_* из окружения или localhost:4318
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter: %w", err)
+	}
+	tp, err := NewTracerProvider(exporter, cfg)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// NewTracerProvider создаёт провайдер, который отправляет спаны в exporter пачками.
+func NewTracerProvider(exporter sdktrace.SpanExporter, cfg config.TracingConfig) (*sdktrace.TracerProvider, error) {
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("tracing resource: %w", err)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// Решение о записи принимает вызывающий сервис, если он передал traceparent
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	), nil
+}
+
+// TraceID возвращает идентификатор трассировки из ctx или "", если её нет.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Middleware создаёт спан на каждый запрос, продолжая трассировку из заголовка traceparent.
+// Спан называется по шаблону маршрута. Запросы к skipPaths, например к пробам, не трассируются.
+func Middleware(serviceName string, skipPaths ...string) gin.HandlerFunc {
+	return otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !slices.Contains(skipPaths, r.URL.Path)
+	}))
+}
+
+// SentryTraceID помечает события Sentry текущего запроса идентификатором трассировки.
+// Подключается после Middleware, который создаёт спан запроса.
+func SentryTraceID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if hub := sentrygin.GetHubFromContext(c); hub != nil {
+			if id := TraceID(c.Request.Context()); id != "" {
+				hub.Scope().SetTag("trace_id", id)
+			}
+		}
+		c.Next()
+	}
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// end завершает спан, отмечая ошибку.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,140 @@
+package tracing_test
+
+import (
+	"code/internal/config"
+	"code/internal/handlers/mocks"
+	"code/internal/service"
+	"code/internal/tracing"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector - приёмник OTLP/HTTP в памяти процесса.
+type collector struct {
+	mu    sync.Mutex
+	spans map[string]string // имя спана -> trace id
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req collectortrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				c.spans[s.Name] = hexID(s.TraceId)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	out, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	_, _ = w.Write(out)
+}
+
+func hexID(b []byte) string {
+	const digits = "0123456789abcdef"
+	out := make([]byte, 0, len(b)*2)
+	for _, c := range b {
+		out = append(out, digits[c>>4], digits[c&0xf])
+	}
+	return string(out)
+}
+
+func TestSetup_ExportsToCollector(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	col := &collector{spans: map[string]string{}}
+	srv := httptest.NewServer(col)
+	defer srv.Close()
+
+	shutdown, err := tracing.Setup(context.Background(), config.TracingConfig{
+		Enabled:     true,
+		Endpoint:    srv.URL + "/v1/traces",
+		ServiceName: "lshortener-test",
+		SampleRatio: 1,
+	})
+	require.NoError(t, err)
+
+	ls := new(mocks.MockLinkService)
+	ls.On("GetLinkByID", mock.Anything, int64(1)).Return(&service.Link{ID: 1}, nil)
+	linkServer := tracing.LinkServer(ls)
+
+	var gotTraceID string
+	router := gin.New()
+	router.Use(tracing.Middleware("lshortener-test", "/healthz"))
+	router.GET("/api/links/:id", func(c *gin.Context) {
+		gotTraceID = tracing.TraceID(c.Request.Context())
+		_, err := linkServer.GetLinkByID(c.Request.Context(), 1)
+		require.NoError(t, err)
+		c.Status(http.StatusOK)
+	})
+	router.GET("/healthz", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/links/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	require.NoError(t, shutdown(context.Background()))
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	assert.Equal(t, traceID, gotTraceID)
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	assert.Equal(t, traceID, col.spans["LinkService.GetLinkByID"])
+	assert.Equal(t, traceID, col.spans["GET /api/links/:id"])
+	assert.NotContains(t, col.spans, "GET /healthz")
+	ls.AssertExpectations(t)
+}
+
+func TestQueryTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	var tr tracing.QueryTracer
+	ctx := tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+		SQL: "-- name: GetLinkByID :one\nSELECT id FROM links WHERE id = $1",
+	})
+	tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+	ctx = tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "select 1"})
+	tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "db GetLinkByID", spans[0].Name)
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Equal(t, "db SELECT", spans[1].Name)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+}
+
+func TestTraceID_NoSpan(t *testing.T) {
+	assert.Empty(t, tracing.TraceID(context.Background()))
+}
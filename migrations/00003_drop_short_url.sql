@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- short_url вычисляется при чтении из BASE_URL и REDIRECT_PREFIX, хранить его не нужно
+ALTER TABLE links DROP COLUMN IF EXISTS short_url;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose ENVSUB ON
+-- +goose StatementBegin
+-- short_url восстанавливается так, как его считала версия до этой миграции: BASE_URL + "/" + short_name.
+-- BASE_URL берётся из окружения процесса, который делает откат (значение из CONFIG_FILE сюда не попадает);
+-- без него short_url получится относительным: /short_name.
+ALTER TABLE links ADD COLUMN IF NOT EXISTS short_url TEXT NOT NULL DEFAULT '';
+UPDATE links SET short_url = rtrim('${BASE_URL:-}', '/') || '/' || short_name;
+ALTER TABLE links ALTER COLUMN short_url DROP DEFAULT;
+-- +goose StatementEnd
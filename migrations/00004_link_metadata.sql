@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE links
+    ADD COLUMN title TEXT,
+    ADD COLUMN description TEXT,
+    ADD COLUMN favicon_url TEXT,
+    ADD COLUMN og_image_url TEXT,
+    ADD COLUMN metadata_fetched_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE links
+    DROP COLUMN IF EXISTS title,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS favicon_url,
+    DROP COLUMN IF EXISTS og_image_url,
+    DROP COLUMN IF EXISTS metadata_fetched_at;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE links
+    ADD COLUMN og_title TEXT,
+    ADD COLUMN og_description TEXT,
+    ADD COLUMN og_image TEXT;
+
+ALTER TABLE visits
+    ADD COLUMN is_crawler BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE visits
+    DROP COLUMN IF EXISTS is_crawler;
+
+ALTER TABLE links
+    DROP COLUMN IF EXISTS og_title,
+    DROP COLUMN IF EXISTS og_description,
+    DROP COLUMN IF EXISTS og_image;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS link_checks (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    link_id BIGINT NOT NULL,
+    checked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ok BOOLEAN NOT NULL,
+    status_code INTEGER,
+    latency_ms INTEGER NOT NULL,
+    redirect_chain TEXT[] NOT NULL DEFAULT '{}',
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS link_checks_link_id_checked_at_idx ON link_checks (link_id, checked_at DESC);
+
+ALTER TABLE links
+    ADD COLUMN health_status VARCHAR(16) NOT NULL DEFAULT 'unknown',
+    ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN last_checked_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE links
+    DROP COLUMN IF EXISTS health_status,
+    DROP COLUMN IF EXISTS consecutive_failures,
+    DROP COLUMN IF EXISTS last_checked_at;
+
+DROP TABLE IF EXISTS link_checks;
+-- +goose StatementEnd
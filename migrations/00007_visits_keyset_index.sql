@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Индекс под keyset-пагинацию посещений: ORDER BY created_at DESC, id DESC
+CREATE INDEX IF NOT EXISTS visits_created_at_id_idx ON visits (created_at DESC, id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS visits_created_at_id_idx;
+-- +goose StatementEnd
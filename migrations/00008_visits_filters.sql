@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Хост реферера храним отдельно, чтобы фильтр по нему мог использовать индекс
+ALTER TABLE visits ADD COLUMN referer_host TEXT;
+
+UPDATE visits
+SET referer_host = lower(substring(referer FROM '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/]*@)?([^/:?#]+)'))
+WHERE referer IS NOT NULL AND referer <> '';
+
+CREATE INDEX IF NOT EXISTS visits_link_id_created_at_idx ON visits (link_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS visits_referer_host_idx ON visits (referer_host);
+CREATE INDEX IF NOT EXISTS visits_ip_idx ON visits (ip);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS visits_ip_idx;
+DROP INDEX IF EXISTS visits_referer_host_idx;
+DROP INDEX IF EXISTS visits_link_id_created_at_idx;
+
+ALTER TABLE visits DROP COLUMN IF EXISTS referer_host;
+-- +goose StatementEnd
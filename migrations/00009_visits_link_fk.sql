@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Посещения удалённых ссылок (и «осиротевшие» посещения) переносятся сюда, если включён режим archive
+CREATE TABLE IF NOT EXISTS visits_archive (
+    id BIGINT PRIMARY KEY,
+    link_id BIGINT NOT NULL,
+    ip VARCHAR(255) NOT NULL,
+    user_agent TEXT NOT NULL,
+    referer TEXT,
+    status INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    is_crawler BOOLEAN NOT NULL DEFAULT FALSE,
+    referer_host TEXT,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    reason VARCHAR(16) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS visits_archive_link_id_idx ON visits_archive (link_id);
+
+-- NOT VALID: уже существующие сироты не мешают миграции, их разбирает фоновая очистка,
+-- после чего ограничение валидируется. Новые посещения проверяются сразу.
+ALTER TABLE visits
+    ADD CONSTRAINT visits_link_id_fkey FOREIGN KEY (link_id) REFERENCES links (id) ON DELETE CASCADE NOT VALID;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE visits DROP CONSTRAINT IF EXISTS visits_link_id_fkey;
+
+DROP TABLE IF EXISTS visits_archive;
+-- +goose StatementEnd
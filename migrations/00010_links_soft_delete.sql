@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- deleted_at != NULL - ссылка в корзине: не редиректит, но её можно восстановить до очистки
+ALTER TABLE links ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS links_deleted_at_idx ON links (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS links_deleted_at_idx;
+
+ALTER TABLE links DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
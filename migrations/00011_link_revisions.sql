@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Каждое создание, изменение, удаление и восстановление ссылки - отдельная ревизия.
+-- Для create старые значения пустые, для delete - новые.
+CREATE TABLE IF NOT EXISTS link_revisions (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    link_id BIGINT NOT NULL,
+    revision INTEGER NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    old_original_url TEXT,
+    old_short_name VARCHAR(100),
+    new_original_url TEXT,
+    new_short_name VARCHAR(100),
+    actor TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (link_id, revision)
+);
+
+ALTER TABLE links ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+
+-- Для уже существующих ссылок текущее состояние становится первой ревизией
+INSERT INTO link_revisions (link_id, revision, action, new_original_url, new_short_name, actor, created_at)
+SELECT id, 1, 'create', original_url, short_name, 'migration', created_at FROM links;
+
+-- Ревизия ссылки на момент посещения. У посещений до этой миграции она неизвестна.
+ALTER TABLE visits ADD COLUMN link_revision INTEGER;
+ALTER TABLE visits_archive ADD COLUMN link_revision INTEGER;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE visits_archive DROP COLUMN IF EXISTS link_revision;
+ALTER TABLE visits DROP COLUMN IF EXISTS link_revision;
+ALTER TABLE links DROP COLUMN IF EXISTS revision;
+
+DROP TABLE IF EXISTS link_revisions;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Ответы на запросы с Idempotency-Key. status_code NULL - запрос ещё выполняется.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(255) PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    status_code INTEGER,
+    content_type TEXT,
+    response BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS idempotency_keys;
+-- +goose StatementEnd
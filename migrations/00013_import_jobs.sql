@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Задачи импорта ссылок из файлов других сокращателей. payload - сам файл, очищается после завершения.
+-- errors - отчёт по строкам [{"line": 3, "error": "..."}], хранится не больше первых ошибок.
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    format VARCHAR(16) NOT NULL,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    actor TEXT NOT NULL DEFAULT '',
+    mapping JSONB,
+    payload BYTEA,
+    total_rows INTEGER NOT NULL DEFAULT 0,
+    processed_rows INTEGER NOT NULL DEFAULT 0,
+    created_rows INTEGER NOT NULL DEFAULT 0,
+    failed_rows INTEGER NOT NULL DEFAULT 0,
+    errors JSONB NOT NULL DEFAULT '[]',
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS import_jobs_status_idx ON import_jobs (status) WHERE status IN ('pending', 'running');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS import_jobs;
+-- +goose StatementEnd
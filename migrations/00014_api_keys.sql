@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Ключи доступа к /api. Сам ключ не хранится: только sha256 (key_hash) и начало ключа (prefix),
+-- по которому его можно узнать в списке. revoked_at - ключ отозван и больше не принимается.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    name TEXT NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_keys;
+-- +goose StatementEnd
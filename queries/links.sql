@@ -3,36 +3,376 @@ SELECT
     id,
     original_url,
     short_name,
-    short_url
+    title,
+    description,
+    favicon_url,
+    og_image_url,
+    og_title,
+    og_description,
+    og_image,
+    health_status,
+    created_at,
+    deleted_at,
+    revision
 FROM links
-ORDER BY id
-LIMIT $1 OFFSET $2;
+WHERE (sqlc.narg('health')::text IS NULL OR health_status = sqlc.narg('health'))
+    AND (sqlc.narg('query')::text IS NULL
+        OR original_url ILIKE '%' || sqlc.narg('query') || '%'
+        OR short_name ILIKE '%' || sqlc.narg('query') || '%'
+        OR title ILIKE '%' || sqlc.narg('query') || '%')
+    AND (sqlc.narg('ids')::bigint[] IS NULL OR id = ANY(sqlc.narg('ids')::bigint[]))
+    AND (sqlc.narg('short_name')::text IS NULL OR short_name = sqlc.narg('short_name'))
+    AND (sqlc.narg('created_from')::timestamptz IS NULL OR created_at >= sqlc.narg('created_from'))
+    AND (sqlc.narg('created_to')::timestamptz IS NULL OR created_at <= sqlc.narg('created_to'))
+    AND (deleted_at IS NOT NULL) = sqlc.arg('deleted')::boolean
+ORDER BY
+    CASE WHEN NOT sqlc.arg('sort_desc')::boolean THEN
+        CASE sqlc.arg('sort_field')::text
+            WHEN 'original_url' THEN original_url
+            WHEN 'short_name' THEN short_name
+            WHEN 'title' THEN title
+            WHEN 'health_status' THEN health_status
+        END
+    END ASC,
+    CASE WHEN sqlc.arg('sort_desc')::boolean THEN
+        CASE sqlc.arg('sort_field')::text
+            WHEN 'original_url' THEN original_url
+            WHEN 'short_name' THEN short_name
+            WHEN 'title' THEN title
+            WHEN 'health_status' THEN health_status
+        END
+    END DESC,
+    CASE WHEN sqlc.arg('sort_field')::text = 'created_at' AND NOT sqlc.arg('sort_desc')::boolean THEN created_at END ASC,
+    CASE WHEN sqlc.arg('sort_field')::text = 'created_at' AND sqlc.arg('sort_desc')::boolean THEN created_at END DESC,
+    CASE WHEN sqlc.arg('sort_field')::text = 'deleted_at' AND NOT sqlc.arg('sort_desc')::boolean THEN deleted_at END ASC,
+    CASE WHEN sqlc.arg('sort_field')::text = 'deleted_at' AND sqlc.arg('sort_desc')::boolean THEN deleted_at END DESC,
+    CASE WHEN NOT sqlc.arg('sort_desc')::boolean THEN id END ASC,
+    CASE WHEN sqlc.arg('sort_desc')::boolean THEN id END DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
 
 -- name: GetTotalLinks :one
-    SELECT COUNT(id) AS total_links FROM links;
+SELECT COUNT(id) AS total_links FROM links
+WHERE (sqlc.narg('health')::text IS NULL OR health_status = sqlc.narg('health'))
+    AND (sqlc.narg('query')::text IS NULL
+        OR original_url ILIKE '%' || sqlc.narg('query') || '%'
+        OR short_name ILIKE '%' || sqlc.narg('query') || '%'
+        OR title ILIKE '%' || sqlc.narg('query') || '%')
+    AND (sqlc.narg('ids')::bigint[] IS NULL OR id = ANY(sqlc.narg('ids')::bigint[]))
+    AND (sqlc.narg('short_name')::text IS NULL OR short_name = sqlc.narg('short_name'))
+    AND (sqlc.narg('created_from')::timestamptz IS NULL OR created_at >= sqlc.narg('created_from'))
+    AND (sqlc.narg('created_to')::timestamptz IS NULL OR created_at <= sqlc.narg('created_to'))
+    AND (deleted_at IS NOT NULL) = sqlc.arg('deleted')::boolean;
 
 -- name: CreateLink :one
-INSERT INTO links(original_url, short_name, short_url)
-VALUES ($1, $2, $3)
-RETURNING id, original_url, short_name, short_url;
+WITH created AS (
+    INSERT INTO links (original_url, short_name)
+    VALUES (sqlc.arg('original_url'), sqlc.arg('short_name'))
+    RETURNING id, original_url, short_name, revision
+), rev AS (
+    INSERT INTO link_revisions (link_id, revision, action, new_original_url, new_short_name, actor)
+    SELECT id, revision, 'create', original_url, short_name, sqlc.arg('actor') FROM created
+)
+SELECT id, original_url, short_name FROM created;
 
 -- name: GetLinkByID :one
 SELECT
     id,
     original_url,
     short_name,
-    short_url
+    title,
+    description,
+    favicon_url,
+    og_image_url,
+    og_title,
+    og_description,
+    og_image,
+    health_status,
+    created_at,
+    deleted_at,
+    revision
 FROM links WHERE id = $1;
 
 -- name: UpdateLinkByID :one
-UPDATE links
-SET original_url = $1, short_name = $2, short_url = $3
-WHERE id = $4
-RETURNING id, original_url, short_name, short_url;
+-- action - update или revert, старые и новые значения попадают в link_revisions.
+-- expected_revisions (If-Match): если задан, ссылка обновляется, только если её ревизия в этом списке.
+WITH old AS (
+    SELECT id, original_url, short_name FROM links
+    WHERE id = sqlc.arg('id') AND deleted_at IS NULL
+        AND (sqlc.narg('expected_revisions')::integer[] IS NULL OR revision = ANY(sqlc.narg('expected_revisions')::integer[]))
+    FOR UPDATE
+), updated AS (
+    UPDATE links l
+    SET original_url = sqlc.arg('original_url'), short_name = sqlc.arg('short_name'), revision = l.revision + 1
+    FROM old
+    WHERE l.id = old.id
+    RETURNING l.id, l.original_url, l.short_name, l.revision
+), rev AS (
+    INSERT INTO link_revisions (link_id, revision, action, old_original_url, old_short_name, new_original_url, new_short_name, actor)
+    SELECT u.id, u.revision, sqlc.arg('action'), old.original_url, old.short_name, u.original_url, u.short_name, sqlc.arg('actor')
+    FROM updated u JOIN old ON old.id = u.id
+)
+SELECT id, original_url, short_name, revision FROM updated;
+
+-- name: DeleteLinkByID :one
+WITH removed AS (
+    DELETE FROM visits
+    WHERE link_id = $1 AND EXISTS (SELECT 1 FROM links WHERE id = $1)
+    RETURNING id
+), deleted AS (
+    DELETE FROM links WHERE id = $1 RETURNING id
+), checks AS (
+    DELETE FROM link_checks WHERE link_id = $1
+), revisions AS (
+    DELETE FROM link_revisions WHERE link_id = $1
+)
+SELECT
+    (SELECT COUNT(*) FROM deleted) AS links_deleted,
+    (SELECT COUNT(*) FROM removed) AS visits_deleted;
+
+-- name: DeleteLinkByIDArchivingVisits :one
+WITH moved AS (
+    DELETE FROM visits
+    WHERE link_id = $1 AND EXISTS (SELECT 1 FROM links WHERE id = $1)
+    RETURNING id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision
+), archived AS (
+    INSERT INTO visits_archive (id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision, reason)
+    SELECT id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision, 'link_deleted'
+    FROM moved
+    RETURNING id
+), deleted AS (
+    DELETE FROM links WHERE id = $1 RETURNING id
+), checks AS (
+    DELETE FROM link_checks WHERE link_id = $1
+), revisions AS (
+    DELETE FROM link_revisions WHERE link_id = $1
+)
+SELECT
+    (SELECT COUNT(*) FROM deleted) AS links_deleted,
+    (SELECT COUNT(*) FROM archived) AS visits_archived;
 
--- name: DeleteLinkByID :execrows
-DELETE FROM links WHERE id = $1;
+-- name: SoftDeleteLinkByID :execrows
+WITH deleted AS (
+    UPDATE links SET deleted_at = NOW(), revision = revision + 1
+    WHERE id = sqlc.arg('id') AND deleted_at IS NULL
+    RETURNING id, original_url, short_name, revision
+)
+INSERT INTO link_revisions (link_id, revision, action, old_original_url, old_short_name, actor)
+SELECT id, revision, 'delete', original_url, short_name, sqlc.arg('actor') FROM deleted;
+
+-- name: RestoreLinkByID :execrows
+WITH restored AS (
+    UPDATE links SET deleted_at = NULL, revision = revision + 1
+    WHERE id = sqlc.arg('id') AND deleted_at IS NOT NULL
+    RETURNING id, original_url, short_name, revision
+)
+INSERT INTO link_revisions (link_id, revision, action, new_original_url, new_short_name, actor)
+SELECT id, revision, 'restore', original_url, short_name, sqlc.arg('actor') FROM restored;
+
+-- name: PurgeDeletedLinks :one
+WITH purged AS (
+    SELECT id FROM links
+    WHERE deleted_at < sqlc.arg('deleted_before')
+    ORDER BY deleted_at
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+), removed AS (
+    DELETE FROM visits WHERE link_id IN (SELECT id FROM purged) RETURNING id
+), checks AS (
+    DELETE FROM link_checks WHERE link_id IN (SELECT id FROM purged)
+), revisions AS (
+    DELETE FROM link_revisions WHERE link_id IN (SELECT id FROM purged)
+), deleted AS (
+    DELETE FROM links WHERE id IN (SELECT id FROM purged) RETURNING id
+)
+SELECT
+    (SELECT COUNT(*) FROM deleted) AS links_deleted,
+    (SELECT COUNT(*) FROM removed) AS visits_deleted;
 
 -- name: GetOriginalURLByShortName :one
-SELECT id, original_url FROM links WHERE short_name = $1;
+SELECT
+    id,
+    original_url,
+    title,
+    description,
+    og_image_url,
+    og_title,
+    og_description,
+    og_image
+FROM links WHERE short_name = $1 AND deleted_at IS NULL;
+
+-- name: IsShortNameTrashed :one
+SELECT EXISTS (SELECT 1 FROM links WHERE short_name = $1 AND deleted_at IS NOT NULL) AS trashed;
+
+-- name: UpdateLinkMetadata :exec
+UPDATE links
+SET title = $2, description = $3, favicon_url = $4, og_image_url = $5, metadata_fetched_at = NOW()
+WHERE id = $1 AND original_url = $6;
+
+-- name: UpdateLinkSocial :execrows
+-- Свои Open Graph теги - тоже ревизия ссылки: адрес и короткое имя в ней не меняются.
+WITH updated AS (
+    UPDATE links
+    SET og_title = sqlc.narg('og_title'), og_description = sqlc.narg('og_description'), og_image = sqlc.narg('og_image'),
+        revision = revision + 1
+    WHERE id = sqlc.arg('id') AND deleted_at IS NULL
+    RETURNING id, original_url, short_name, revision
+)
+INSERT INTO link_revisions (link_id, revision, action, old_original_url, old_short_name, new_original_url, new_short_name, actor)
+SELECT id, revision, 'social', original_url, short_name, original_url, short_name, sqlc.arg('actor') FROM updated;
+
+-- name: GetLinksForHealthCheck :many
+SELECT id, original_url FROM links
+WHERE deleted_at IS NULL
+    AND (last_checked_at IS NULL OR last_checked_at < sqlc.arg('checked_before'))
+ORDER BY last_checked_at NULLS FIRST, id
+LIMIT sqlc.arg('limit');
+
+-- name: CreateLinkCheck :exec
+INSERT INTO link_checks (link_id, ok, status_code, latency_ms, redirect_chain, error)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: UpdateLinkHealth :one
+UPDATE links
+SET consecutive_failures = CASE WHEN sqlc.arg('ok')::boolean THEN 0 ELSE consecutive_failures + 1 END,
+    health_status = CASE
+        WHEN sqlc.arg('ok')::boolean THEN 'healthy'
+        WHEN consecutive_failures + 1 >= sqlc.arg('failure_threshold')::integer THEN 'broken'
+        ELSE health_status
+    END,
+    last_checked_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING health_status, consecutive_failures;
+
+-- name: GetLinkHealth :one
+SELECT health_status, consecutive_failures, last_checked_at FROM links WHERE id = $1;
+
+-- name: GetLinkChecks :many
+SELECT id, checked_at, ok, status_code, latency_ms, redirect_chain, error
+FROM link_checks
+WHERE link_id = $1
+ORDER BY checked_at DESC, id DESC
+LIMIT $2;
+
+-- name: GetLinkRevisions :many
+SELECT
+    id,
+    link_id,
+    revision,
+    action,
+    old_original_url,
+    old_short_name,
+    new_original_url,
+    new_short_name,
+    actor,
+    created_at
+FROM link_revisions
+WHERE link_id = $1
+ORDER BY revision DESC;
+
+-- name: GetLinkRevision :one
+SELECT
+    id,
+    link_id,
+    revision,
+    action,
+    old_original_url,
+    old_short_name,
+    new_original_url,
+    new_short_name,
+    actor,
+    created_at
+FROM link_revisions
+WHERE link_id = $1 AND revision = $2;
+
+-- name: ClaimIdempotencyKey :execrows
+-- Занимает ключ. Просроченный ключ можно занять заново, 0 строк - ключ уже используется.
+INSERT INTO idempotency_keys (key, fingerprint, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (key) DO UPDATE
+SET fingerprint = EXCLUDED.fingerprint,
+    status_code = NULL,
+    content_type = NULL,
+    response = NULL,
+    created_at = NOW(),
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at < NOW();
+
+-- name: GetIdempotencyKey :one
+SELECT key, fingerprint, status_code, content_type, response, created_at, expires_at
+FROM idempotency_keys
+WHERE key = $1;
+
+-- name: SaveIdempotencyResponse :exec
+UPDATE idempotency_keys
+SET status_code = $2, content_type = $3, response = $4
+WHERE key = $1;
+
+-- name: ReleaseIdempotencyKey :exec
+DELETE FROM idempotency_keys WHERE key = $1 AND status_code IS NULL;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys WHERE expires_at < NOW();
+
+-- name: CreateImportJob :one
+INSERT INTO import_jobs (format, dry_run, actor, mapping, payload)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id;
+
+-- name: ClaimImportJob :one
+-- Берёт самую старую задачу из очереди. Другие экземпляры сервиса её пропустят.
+UPDATE import_jobs
+SET status = 'running', started_at = NOW(), updated_at = NOW()
+WHERE id = (
+    SELECT id FROM import_jobs
+    WHERE status = 'pending'
+    ORDER BY id
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, format, dry_run, status, actor, mapping, payload, total_rows, processed_rows, created_rows, failed_rows, errors, error, created_at, started_at, updated_at, finished_at;
+
+-- name: UpdateImportJobProgress :exec
+UPDATE import_jobs
+SET total_rows = $2,
+    processed_rows = $3,
+    created_rows = $4,
+    failed_rows = $5,
+    errors = $6,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: FinishImportJob :exec
+UPDATE import_jobs
+SET status = $2, error = $3, payload = NULL, updated_at = NOW(), finished_at = NOW()
+WHERE id = $1;
+
+-- name: FailStaleImportJobs :execrows
+-- Задачи, которые давно не обновляли прогресс: экземпляр сервиса остановился посреди импорта.
+-- Повторять их нельзя, часть ссылок уже создана.
+UPDATE import_jobs
+SET status = 'failed', error = 'import was interrupted', payload = NULL, finished_at = NOW()
+WHERE status = 'running' AND updated_at < $1;
+
+-- name: GetImportJob :one
+SELECT id, format, dry_run, status, actor, mapping, total_rows, processed_rows, created_rows, failed_rows, errors, error, created_at, started_at, updated_at, finished_at
+FROM import_jobs
+WHERE id = $1;
+
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (name, prefix, key_hash)
+VALUES ($1, $2, $3)
+RETURNING id, name, prefix, key_hash, created_at, revoked_at;
+
+-- name: ListAPIKeys :many
+SELECT id, name, prefix, key_hash, created_at, revoked_at
+FROM api_keys
+ORDER BY id;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys SET revoked_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL;
 
+-- name: GetActiveAPIKeyByHash :one
+SELECT id, name, prefix, key_hash, created_at, revoked_at
+FROM api_keys
+WHERE key_hash = $1 AND revoked_at IS NULL;
@@ -1,6 +1,6 @@
 -- name: CreateVisit :exec
-INSERT INTO visits (link_id, ip, user_agent, referer, status)
-VALUES ($1, $2, $3, $4, $5);
+INSERT INTO visits (link_id, ip, user_agent, referer, status, is_crawler, referer_host, link_revision)
+VALUES ($1, $2, $3, $4, $5, $6, $7, (SELECT revision FROM links WHERE id = $1));
 
 -- name: GetVisits :many
 SELECT
@@ -9,10 +9,107 @@ SELECT
     created_at,
     ip,
     user_agent,
-    status
+    status,
+    is_crawler,
+    link_revision
 FROM visits
-ORDER BY created_at DESC, id DESC
-LIMIT $1 OFFSET $2;
+WHERE (sqlc.narg('query')::text IS NULL
+        OR ip ILIKE '%' || sqlc.narg('query') || '%'
+        OR user_agent ILIKE '%' || sqlc.narg('query') || '%'
+        OR referer ILIKE '%' || sqlc.narg('query') || '%')
+    AND (sqlc.narg('ids')::bigint[] IS NULL OR id = ANY(sqlc.narg('ids')::bigint[]))
+    AND (sqlc.narg('link_ids')::bigint[] IS NULL OR link_id = ANY(sqlc.narg('link_ids')::bigint[]))
+    AND (sqlc.narg('created_from')::timestamptz IS NULL OR created_at >= sqlc.narg('created_from'))
+    AND (sqlc.narg('created_to')::timestamptz IS NULL OR created_at <= sqlc.narg('created_to'))
+    AND (sqlc.narg('status')::integer IS NULL OR status = sqlc.narg('status'))
+    AND (sqlc.narg('ip')::text IS NULL OR ip = sqlc.narg('ip'))
+    AND (sqlc.narg('referer_host')::text IS NULL OR referer_host = sqlc.narg('referer_host'))
+ORDER BY
+    CASE WHEN NOT sqlc.arg('sort_desc')::boolean THEN
+        CASE sqlc.arg('sort_field')::text
+            WHEN 'link_id' THEN link_id
+            WHEN 'status' THEN status
+        END
+    END ASC,
+    CASE WHEN sqlc.arg('sort_desc')::boolean THEN
+        CASE sqlc.arg('sort_field')::text
+            WHEN 'link_id' THEN link_id
+            WHEN 'status' THEN status
+        END
+    END DESC,
+    CASE WHEN sqlc.arg('sort_field')::text = 'ip' AND NOT sqlc.arg('sort_desc')::boolean THEN ip END ASC,
+    CASE WHEN sqlc.arg('sort_field')::text = 'ip' AND sqlc.arg('sort_desc')::boolean THEN ip END DESC,
+    CASE WHEN sqlc.arg('sort_field')::text = 'created_at' AND NOT sqlc.arg('sort_desc')::boolean THEN created_at END ASC,
+    CASE WHEN sqlc.arg('sort_field')::text = 'created_at' AND sqlc.arg('sort_desc')::boolean THEN created_at END DESC,
+    CASE WHEN NOT sqlc.arg('sort_desc')::boolean THEN id END ASC,
+    CASE WHEN sqlc.arg('sort_desc')::boolean THEN id END DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
 
 -- name: GetTotalVisits :one
-SELECT COUNT(id) AS total_visits FROM visits;
\ No newline at end of file
+SELECT COUNT(id) AS total_visits FROM visits
+WHERE (sqlc.narg('query')::text IS NULL
+        OR ip ILIKE '%' || sqlc.narg('query') || '%'
+        OR user_agent ILIKE '%' || sqlc.narg('query') || '%'
+        OR referer ILIKE '%' || sqlc.narg('query') || '%')
+    AND (sqlc.narg('ids')::bigint[] IS NULL OR id = ANY(sqlc.narg('ids')::bigint[]))
+    AND (sqlc.narg('link_ids')::bigint[] IS NULL OR link_id = ANY(sqlc.narg('link_ids')::bigint[]))
+    AND (sqlc.narg('created_from')::timestamptz IS NULL OR created_at >= sqlc.narg('created_from'))
+    AND (sqlc.narg('created_to')::timestamptz IS NULL OR created_at <= sqlc.narg('created_to'))
+    AND (sqlc.narg('status')::integer IS NULL OR status = sqlc.narg('status'))
+    AND (sqlc.narg('ip')::text IS NULL OR ip = sqlc.narg('ip'))
+    AND (sqlc.narg('referer_host')::text IS NULL OR referer_host = sqlc.narg('referer_host'));
+
+-- name: GetVisitsPage :many
+SELECT
+    id,
+    link_id,
+    created_at,
+    ip,
+    user_agent,
+    status,
+    is_crawler,
+    link_revision
+FROM visits
+WHERE (sqlc.narg('query')::text IS NULL
+        OR ip ILIKE '%' || sqlc.narg('query') || '%'
+        OR user_agent ILIKE '%' || sqlc.narg('query') || '%'
+        OR referer ILIKE '%' || sqlc.narg('query') || '%')
+    AND (sqlc.narg('ids')::bigint[] IS NULL OR id = ANY(sqlc.narg('ids')::bigint[]))
+    AND (sqlc.narg('link_ids')::bigint[] IS NULL OR link_id = ANY(sqlc.narg('link_ids')::bigint[]))
+    AND (sqlc.narg('created_from')::timestamptz IS NULL OR created_at >= sqlc.narg('created_from'))
+    AND (sqlc.narg('created_to')::timestamptz IS NULL OR created_at <= sqlc.narg('created_to'))
+    AND (sqlc.narg('status')::integer IS NULL OR status = sqlc.narg('status'))
+    AND (sqlc.narg('ip')::text IS NULL OR ip = sqlc.narg('ip'))
+    AND (sqlc.narg('referer_host')::text IS NULL OR referer_host = sqlc.narg('referer_host'))
+    AND (sqlc.narg('after_created_at')::timestamptz IS NULL
+        OR (created_at, id) < (sqlc.narg('after_created_at'), sqlc.arg('after_id')::bigint))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: EstimateTotalVisits :one
+SELECT reltuples::bigint AS estimate FROM pg_class WHERE oid = 'visits'::regclass;
+
+-- name: DeleteOrphanVisits :execrows
+DELETE FROM visits
+WHERE id IN (
+    SELECT v.id FROM visits v
+    WHERE NOT EXISTS (SELECT 1 FROM links l WHERE l.id = v.link_id)
+    LIMIT $1
+);
+
+-- name: ArchiveOrphanVisits :execrows
+WITH moved AS (
+    DELETE FROM visits
+    WHERE id IN (
+        SELECT v.id FROM visits v
+        WHERE NOT EXISTS (SELECT 1 FROM links l WHERE l.id = v.link_id)
+        LIMIT $1
+    )
+    RETURNING id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision
+)
+INSERT INTO visits_archive (id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision, reason)
+SELECT id, link_id, ip, user_agent, referer, status, created_at, is_crawler, referer_host, link_revision, 'orphan'
+FROM moved;
+
+-- name: ValidateVisitsLinkFK :exec
+ALTER TABLE visits VALIDATE CONSTRAINT visits_link_id_fkey;